@@ -1,5 +1,15 @@
 import { useState, useEffect } from 'react'
 
+// Reads the message of an API error response ({"error": {"code", "message"}})
+async function apiErrorMessage(response, fallback) {
+  try {
+    const body = await response.json()
+    return body?.error?.message || fallback
+  } catch {
+    return fallback
+  }
+}
+
 function App() {
   const [simulations, setSimulations] = useState([])
   const [logs, setLogs] = useState([])
@@ -86,8 +96,7 @@ function App() {
       })
 
       if (!response.ok) {
-        const errorText = await response.text()
-        throw new Error(errorText || 'Failed to upload scenario')
+        throw new Error(await apiErrorMessage(response, 'Failed to upload scenario'))
       }
 
       const result = await response.json()
@@ -134,8 +143,7 @@ function App() {
         method: 'POST',
       })
       if (!response.ok) {
-        const errorText = await response.text()
-        throw new Error(errorText || 'Failed to activate scenario')
+        throw new Error(await apiErrorMessage(response, 'Failed to activate scenario'))
       }
       const result = await response.json()
       setScenario(result)
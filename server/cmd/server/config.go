@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/config"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/websocket"
+	"github.com/joho/godotenv"
+)
+
+// startupConfig holds the settings that only take effect when the server starts
+type startupConfig struct {
+	ScenarioFile    string
+	Port            string
+	StrictMode      bool
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+	AuthTokens      string
+	AllowedOrigins  string
+	LogFormat       string
+
+	EventQueueWorkers int
+
+	UniqueScenarioNames bool
+
+	WSReadBufferSize  int
+	WSWriteBufferSize int
+	WSWriteBufferPool bool
+	WSCompression     bool
+	WSMaxMessageSize  int64
+
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration
+}
+
+// parseConfig parses the command-line flags in args into fs
+// Each flag defaults to its environment variable, so an explicit flag always wins over
+// the environment. Hot-reloadable settings are returned in the config.Runtime.
+func parseConfig(fs *flag.FlagSet, args []string) (*startupConfig, *config.Runtime, error) {
+	startup := &startupConfig{}
+	runtime := &config.Runtime{}
+
+	fs.StringVar(&startup.ScenarioFile, "scenario", getEnv("SCENARIO_FILE", "scenarios/example.yaml"), "Path to scenario YAML file")
+	fs.StringVar(&startup.Port, "port", getEnv("PORT", "3000"), "Server port")
+	fs.IntVar(&startup.EventQueueWorkers, "event-queue-workers", getEnvInt("EVENT_QUEUE_WORKERS", 1), "Event queue workers per simulation; more than 1 processes a simulation's events concurrently and out of order")
+	fs.DurationVar(&runtime.EventProcessingTimeout, "event-processing-timeout", getEnvDuration("EVENT_PROCESSING_TIMEOUT", 30*time.Second), "Maximum time to process a single event before moving on (0 = no limit)")
+	fs.DurationVar(&runtime.EventEnqueueTimeout, "event-enqueue-timeout", getEnvDuration("EVENT_ENQUEUE_TIMEOUT", queue.DefaultEnqueueTimeout), "Time an event may wait for room in a full event queue before it is dropped (0 = drop at once)")
+	fs.DurationVar(&runtime.EventDedupeTTL, "event-dedupe-ttl", getEnvDuration("EVENT_DEDUPE_TTL", queue.DefaultDedupeTTL), "How long an event_id is remembered, so a retried event doesn't start another Saga (0 = no deduplication)")
+	fs.IntVar(&runtime.EventDedupeSize, "event-dedupe-size", getEnvInt("EVENT_DEDUPE_SIZE", queue.DefaultDedupeSize), "Most event_ids remembered per simulation for deduplication (0 = no deduplication)")
+	fs.Float64Var(&runtime.EventRateLimit, "event-rate-limit", getEnvFloat("EVENT_RATE_LIMIT", 0), "Events per second each simulation may send; excess events are dropped (0 = no limit)")
+	fs.IntVar(&runtime.EventRateBurst, "event-rate-burst", getEnvInt("EVENT_RATE_BURST", queue.DefaultRateBurst), "Events a simulation may send at once before the event rate limit applies")
+	fs.IntVar(&runtime.UnmatchedEventsSize, "unmatched-events-size", getEnvInt("UNMATCHED_EVENTS_SIZE", queue.DefaultUnmatchedEventsSize), "Most recent events that matched no rule to keep for GET /api/events/unmatched (0 = none)")
+	fs.IntVar(&runtime.ScenarioCacheSize, "scenario-cache-size", getEnvInt("SCENARIO_CACHE_SIZE", scenario.DefaultScenarioCacheSize), "Parsed stored scenarios to keep in memory for activation (0 = no cache)")
+	fs.DurationVar(&runtime.StepTimeout, "step-timeout", getEnvDuration("STEP_TIMEOUT", saga.DefaultStepTimeout), "Default time a Saga step may stay in flight before failing (0 = no timeout)")
+	fs.DurationVar(&runtime.StepTimeoutMin, "step-timeout-min", getEnvDuration("STEP_TIMEOUT_MIN", time.Second), "Lower bound for step timeouts derived from a simulation's declared latency")
+	fs.DurationVar(&runtime.StepTimeoutMax, "step-timeout-max", getEnvDuration("STEP_TIMEOUT_MAX", 5*time.Minute), "Upper bound for step timeouts derived from a simulation's declared latency")
+	fs.Float64Var(&runtime.StepTimeoutLatencyMultiplier, "step-timeout-latency-multiplier", getEnvFloat("STEP_TIMEOUT_LATENCY_MULTIPLIER", 3), "Multiplier applied to a simulation's declared latency to get its step timeout")
+	fs.DurationVar(&runtime.CommandAckTimeout, "command-ack-timeout", getEnvDuration("COMMAND_ACK_TIMEOUT", saga.DefaultCommandAckTimeout), "Time a simulation registered with acks_commands has to send command.received before the step fails (0 = no acknowledgment timeout)")
+	fs.DurationVar(&runtime.CompensationTimeout, "compensation-timeout", getEnvDuration("COMPENSATION_TIMEOUT", saga.DefaultCompensationTimeout), "Time a compensation may wait for step.compensated before it is considered failed (0 = wait indefinitely)")
+	fs.IntVar(&runtime.CompensationRetries, "compensation-retries", getEnvInt("COMPENSATION_RETRIES", saga.DefaultCompensationRetries), "Times a failed compensation is retried before the step needs a manual rollback")
+	fs.DurationVar(&runtime.CompensationRetryDelay, "compensation-retry-delay", getEnvDuration("COMPENSATION_RETRY_DELAY", saga.DefaultCompensationRetryDelay), "Time to wait before retrying a failed compensation")
+	fs.IntVar(&runtime.CompensationDeadLetterSize, "compensation-dead-letter-size", getEnvInt("COMPENSATION_DEAD_LETTER_SIZE", saga.DefaultCompensationDeadLetterSize), "Most recent compensations that failed for good to keep for GET /api/sagas/dead-letter (0 = none)")
+	fs.DurationVar(&runtime.SagaTimeout, "saga-timeout", getEnvDuration("SAGA_TIMEOUT", 0), "Time a Saga may take to finish before it is failed and compensated, unless its rule sets saga_timeout (0 = no timeout)")
+	fs.IntVar(&runtime.MaxConcurrentSagas, "max-concurrent-sagas", getEnvInt("MAX_CONCURRENT_SAGAS", 0), "Most Sagas that may run at once (0 = unlimited)")
+	fs.DurationVar(&runtime.SagaLimitWait, "saga-limit-wait", getEnvDuration("SAGA_LIMIT_WAIT", 0), "How long a new Saga waits for a slot when the concurrent Saga limit is reached (0 = fail at once)")
+	fs.IntVar(&runtime.MaxSagaSteps, "max-saga-steps", getEnvInt("MAX_SAGA_STEPS", saga.DefaultMaxSagaSteps), "Most steps a Saga may have; larger Sagas are refused (0 = no limit)")
+	fs.BoolVar(&runtime.AllowDuplicateSagaTargets, "allow-duplicate-saga-targets", getEnvBool("ALLOW_DUPLICATE_SAGA_TARGETS", true), "Allow several steps of one Saga to target the same simulation")
+	fs.IntVar(&runtime.StepResultMaxBytes, "step-result-max-bytes", getEnvInt("STEP_RESULT_MAX_BYTES", saga.DefaultMaxStepResultSize), "Largest step.completed payload kept as a step result, in bytes (0 = no limit)")
+	fs.IntVar(&runtime.FanOutWarningRules, "fanout-warning-rules", getEnvInt("FANOUT_WARNING_RULES", scenario.DefaultFanOutWarningRules), "Warn when one event matches more than this many rules (0 = never)")
+	fs.IntVar(&runtime.FanOutWarningActions, "fanout-warning-actions", getEnvInt("FANOUT_WARNING_ACTIONS", scenario.DefaultFanOutWarningActions), "Warn when one event's matched rules produce more than this many actions (0 = never)")
+	fs.BoolVar(&runtime.ParamTemplateStrict, "param-template-strict", getEnvBool("PARAM_TEMPLATE_STRICT", false), "Fail Saga creation when a param template references a missing payload field (default: render it as \"\")")
+	fs.StringVar(&runtime.LateCompletionPolicy, "late-completion-policy", getEnv("LATE_COMPLETION_POLICY", string(saga.LateCompletionIgnore)), "How step completions for finished Sagas are handled: ignore, warn or ack")
+	fs.BoolVar(&startup.StrictMode, "strict", getEnvBool("STRICT_MODE", false), "Fail fast on orchestration inconsistencies (for testing environments)")
+	fs.StringVar(&startup.TLSCertFile, "tls-cert", getEnv("TLS_CERT_FILE", ""), "Path to TLS certificate (enables HTTPS/WSS)")
+	fs.StringVar(&startup.TLSKeyFile, "tls-key", getEnv("TLS_KEY_FILE", ""), "Path to TLS private key")
+	fs.StringVar(&runtime.ShutdownMessageType, "shutdown-message-type", getEnv("SHUTDOWN_MESSAGE_TYPE", "command"), "Message type broadcast to simulations on shutdown")
+	fs.StringVar(&runtime.ShutdownCommand, "shutdown-command", getEnv("SHUTDOWN_COMMAND", "server_shutdown"), "Command broadcast to simulations on shutdown")
+	fs.StringVar(&runtime.ShutdownMessage, "shutdown-message", getEnv("SHUTDOWN_MESSAGE", "Server is shutting down"), "Human-readable message included in the shutdown broadcast")
+	fs.DurationVar(&runtime.ShutdownBroadcastTimeout, "shutdown-broadcast-timeout", getEnvDuration("SHUTDOWN_BROADCAST_TIMEOUT", 2*time.Second), "Maximum time to spend notifying simulations on shutdown")
+	fs.DurationVar(&runtime.ShutdownGracePeriod, "shutdown-grace-period", getEnvDuration("SHUTDOWN_GRACE_PERIOD", 10*time.Second), "Maximum time to wait for in-flight Sagas to finish on shutdown")
+	fs.DurationVar(&runtime.ReconnectTokenTTL, "reconnect-token-ttl", getEnvDuration("RECONNECT_TOKEN_TTL", 5*time.Minute), "How long a disconnected simulation can resume its session with its reconnect token (0 = disable reconnect tokens)")
+	fs.StringVar(&startup.TLSClientCAFile, "tls-client-ca", getEnv("TLS_CLIENT_CA_FILE", ""), "Path to CA bundle for simulation client certificates (enables mTLS)")
+	fs.StringVar(&startup.AuthTokens, "auth-tokens", getEnv("AUTH_TOKENS", ""), "Comma-separated bearer tokens required by /api and /ws (empty = no authentication)")
+	fs.StringVar(&startup.AllowedOrigins, "allowed-origins", getEnv("ALLOWED_ORIGINS", "http://localhost:5174"), "Comma-separated origins allowed to call the API from a browser (* = any origin, empty = none)")
+	fs.StringVar(&startup.LogFormat, "log-format", getEnv("LOG_FORMAT", logging.FormatText), "Console log format: text or json")
+	fs.BoolVar(&startup.UniqueScenarioNames, "unique-scenario-names", getEnvBool("UNIQUE_SCENARIO_NAMES", false), "Enforce a unique index on stored scenario names (uploads of an existing name then need ?replace=true)")
+
+	fs.IntVar(&startup.WSReadBufferSize, "ws-read-buffer-size", getEnvInt("WS_READ_BUFFER_SIZE", 0), "WebSocket read buffer size in bytes (0 = library default, 4096)")
+	fs.IntVar(&startup.WSWriteBufferSize, "ws-write-buffer-size", getEnvInt("WS_WRITE_BUFFER_SIZE", 0), "WebSocket write buffer size in bytes (0 = library default, 4096)")
+	fs.BoolVar(&startup.WSWriteBufferPool, "ws-write-buffer-pool", getEnvBool("WS_WRITE_BUFFER_POOL", false), "Share WebSocket write buffers between connections")
+	fs.BoolVar(&startup.WSCompression, "ws-compression", getEnvBool("WS_COMPRESSION", true), "Offer permessage-deflate compression to WebSocket clients that support it")
+	fs.Int64Var(&startup.WSMaxMessageSize, "ws-max-message-size", int64(getEnvInt("WS_MAX_MESSAGE_SIZE", websocket.DefaultMaxMessageSize)), "Largest WebSocket message accepted from a client, in bytes; larger ones close the connection (0 = no limit)")
+	fs.DurationVar(&startup.HeartbeatInterval, "heartbeat-interval", getEnvDuration("HEARTBEAT_INTERVAL", websocket.DefaultHeartbeatInterval), "How often simulations are pinged (0 = no heartbeats)")
+	fs.DurationVar(&startup.HeartbeatTimeout, "heartbeat-timeout", getEnvDuration("HEARTBEAT_TIMEOUT", websocket.DefaultHeartbeatTimeout), "How long a simulation may stay silent before it is considered dead")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if startup.EventQueueWorkers < 1 {
+		return nil, nil, fmt.Errorf("event queue workers must be at least 1, got %d", startup.EventQueueWorkers)
+	}
+	if _, err := saga.ParseLateCompletionPolicy(runtime.LateCompletionPolicy); err != nil {
+		return nil, nil, err
+	}
+	if _, err := logging.ParseFormat(startup.LogFormat); err != nil {
+		return nil, nil, err
+	}
+	if (startup.TLSCertFile == "") != (startup.TLSKeyFile == "") {
+		return nil, nil, fmt.Errorf("TLS needs both a certificate and a key (TLS_CERT_FILE and TLS_KEY_FILE)")
+	}
+	if startup.HeartbeatInterval > 0 && startup.HeartbeatTimeout <= startup.HeartbeatInterval {
+		return nil, nil, fmt.Errorf("heartbeat timeout (%s) must be longer than the heartbeat interval (%s)", startup.HeartbeatTimeout, startup.HeartbeatInterval)
+	}
+	return startup, runtime, nil
+}
+
+// envFile tracks the variables loaded from a .env file so they can be refreshed
+// Variables set in the real environment always take precedence over the file, on
+// startup and on every reload.
+type envFile struct {
+	path     string
+	external map[string]bool // Variables set before the file was loaded
+	loaded   map[string]bool // Variables currently set from the file
+}
+
+// loadEnvFile loads path into the environment if it exists
+func loadEnvFile(path string) *envFile {
+	e := &envFile{
+		path:     path,
+		external: make(map[string]bool),
+		loaded:   make(map[string]bool),
+	}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		e.external[key] = true
+	}
+
+	// Ignore errors for local development; in production, environment variables
+	// should be set directly
+	_ = e.reload()
+	return e
+}
+
+// reload re-reads the file, updating changed variables and unsetting removed ones
+func (e *envFile) reload() error {
+	values, err := godotenv.Read(e.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			values = map[string]string{}
+		} else {
+			return err
+		}
+	}
+
+	for key := range e.loaded {
+		if _, stillSet := values[key]; !stillSet {
+			os.Unsetenv(key)
+			delete(e.loaded, key)
+		}
+	}
+	for key, value := range values {
+		if e.external[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		e.loaded[key] = true
+	}
+	return nil
+}
+
+// runtimeConfigLoader returns a config.LoadFunc that re-reads the .env file and
+// environment, then re-applies the original command-line flags on top
+func runtimeConfigLoader(env *envFile, args []string) config.LoadFunc {
+	return func() (*config.Runtime, error) {
+		if err := env.reload(); err != nil {
+			return nil, err
+		}
+
+		fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		_, runtime, err := parseConfig(fs, args)
+		return runtime, err
+	}
+}
@@ -1,22 +1,34 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/api"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/auth"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/config"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/events"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/session"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/websocket"
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/joho/godotenv"
 )
 
 // getEnv gets an environment variable or returns a default value
@@ -27,21 +39,122 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvDuration gets an environment variable as a time.Duration or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Warning: Invalid duration for %s (%q), using default %s", key, value, defaultValue)
+			return defaultValue
+		}
+		return d
+	}
+	return defaultValue
+}
+
+// getEnvBool gets an environment variable as a bool or returns a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Printf("Warning: Invalid boolean for %s (%q), using default %t", key, value, defaultValue)
+			return defaultValue
+		}
+		return b
+	}
+	return defaultValue
+}
+
+// getEnvInt gets an environment variable as an int or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			log.Printf("Warning: Invalid integer for %s (%q), using default %d", key, value, defaultValue)
+			return defaultValue
+		}
+		return i
+	}
+	return defaultValue
+}
+
+// getEnvFloat gets an environment variable as a float64 or returns a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Printf("Warning: Invalid number for %s (%q), using default %g", key, value, defaultValue)
+			return defaultValue
+		}
+		return f
+	}
+	return defaultValue
+}
+
+// loadClientCATLSConfig builds a TLS config that verifies simulation client certificates
+// against the CA bundle at caFile. Certificates are verified if given; whether they are
+// required is enforced per-endpoint so browser dashboards can still use the API.
+func loadClientCATLSConfig(caFile string) (*tls.Config, error) {
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no valid certificates found in client CA file: %s", caFile)
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
 func main() {
-	// Load .env file if it exists (ignore errors for local development)
-	// In production, environment variables should be set directly
-	_ = godotenv.Load()
+	// Load .env file if it exists
+	env := loadEnvFile(".env")
 
 	// Parse command line flags
-	scenarioFile := flag.String("scenario", getEnv("SCENARIO_FILE", "scenarios/example.yaml"), "Path to scenario YAML file")
-	port := flag.String("port", getEnv("PORT", "3000"), "Server port")
-	flag.Parse()
+	startup, runtime, err := parseConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := logging.SetFormat(startup.LogFormat); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Hot-reloadable settings can be changed via POST /api/config/reload or SIGHUP
+	configStore := config.NewStore(runtime, runtimeConfigLoader(env, os.Args[1:]))
+
+	// Client certificate authentication only makes sense on a TLS listener
+	var tlsConfig *tls.Config
+	if startup.TLSClientCAFile != "" {
+		if startup.TLSCertFile == "" || startup.TLSKeyFile == "" {
+			log.Fatalf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE to be set")
+		}
+		var err error
+		tlsConfig, err = loadClientCATLSConfig(startup.TLSClientCAFile)
+		if err != nil {
+			log.Fatalf("Failed to configure mTLS: %v", err)
+		}
+	}
 
 	// Initialize components
 	reg := registry.NewRegistry()
 	scenarioManager := scenario.NewScenarioManager()
+	scenarioManager.SetRegistry(reg)
 	sagaManager := saga.NewSagaManager(reg)
+	sagaManager.SetStrictMode(startup.StrictMode)
 	logStore := logging.NewLogStore(10000) // Store up to 10000 log entries
+	sagaManager.SetLogStore(logStore)
+
+	// Dashboards follow simulations, Sagas and logs through the event hub (see /ws/dashboard)
+	eventHub := events.NewHub()
+	reg.SetEventHub(eventHub)
+	sagaManager.SetEventHub(eventHub)
+	logStore.SetEventHub(eventHub)
 
 	// Initialize scenario store
 	// Use DATABASE_URL environment variable if set, otherwise default to SQLite
@@ -51,55 +164,237 @@ func main() {
 		log.Fatalf("Failed to initialize scenario store: %v", err)
 	}
 	defer scenarioStore.Close()
+	if err := scenarioStore.SetUniqueNames(startup.UniqueScenarioNames); err != nil {
+		log.Fatalf("Failed to configure unique scenario names: %v", err)
+	}
+
+	// Persist Sagas to the same database and restore the ones that were still running
+	sagaStore, err := store.NewSagaStore(dbConnectionString)
+	if err != nil {
+		log.Fatalf("Failed to initialize saga store: %v", err)
+	}
+	defer sagaStore.Close()
+	sagaManager.SetSagaStore(sagaStore)
+	if restored, err := sagaManager.LoadActiveSagas(); err != nil {
+		log.Printf("Warning: Failed to restore Sagas: %v", err)
+	} else if restored > 0 {
+		log.Printf("Restored %d Sagas that were in progress when the server stopped", restored)
+	}
+
+	// Keep an audit trail of every event received and command dispatched
+	eventLog, err := store.NewEventLog(dbConnectionString)
+	if err != nil {
+		log.Fatalf("Failed to initialize event log: %v", err)
+	}
+	defer eventLog.Close()
+	sagaManager.SetEventLog(eventLog)
 
 	// Create event queue for ordered event processing (prevents race conditions)
 	// Buffer size of 1000 should be sufficient for most use cases
 	eventQueue := queue.NewEventQueue(1000)
 
+	// Reconnect tokens let a simulation resume its session after a dropped connection
+	sessions := session.NewManager(runtime.ReconnectTokenTTL)
+
+	// Retried events carrying an event_id already seen don't start another Saga
+	dedupe := queue.NewDeduper(runtime.EventDedupeTTL, runtime.EventDedupeSize)
+
+	// Each simulation may only send events so fast (step reports are exempt)
+	rateLimit := queue.NewRateLimiter(runtime.EventRateLimit, runtime.EventRateBurst)
+
+	// Events that match no rule are kept for scenario authors to inspect
+	unmatched := queue.NewUnmatchedEvents(runtime.UnmatchedEventsSize)
+
+	// Apply the runtime configuration now and after every reload
+	configStore.OnReload(func(cfg *config.Runtime) {
+		eventQueue.SetProcessingTimeout(cfg.EventProcessingTimeout)
+		eventQueue.SetEnqueueTimeout(cfg.EventEnqueueTimeout)
+		dedupe.SetLimits(cfg.EventDedupeTTL, cfg.EventDedupeSize)
+		rateLimit.SetLimits(cfg.EventRateLimit, cfg.EventRateBurst)
+		unmatched.SetSize(cfg.UnmatchedEventsSize)
+		sagaManager.SetStepTimeouts(saga.StepTimeoutConfig{
+			Default:           cfg.StepTimeout,
+			Min:               cfg.StepTimeoutMin,
+			Max:               cfg.StepTimeoutMax,
+			LatencyMultiplier: cfg.StepTimeoutLatencyMultiplier,
+		})
+		sagaManager.SetCommandAckTimeout(cfg.CommandAckTimeout)
+		sagaManager.SetCompensationTimeout(cfg.CompensationTimeout)
+		sagaManager.SetCompensationRetries(cfg.CompensationRetries, cfg.CompensationRetryDelay)
+		sagaManager.SetCompensationDeadLetterSize(cfg.CompensationDeadLetterSize)
+		sagaManager.SetSagaTimeout(cfg.SagaTimeout)
+		sagaManager.SetConcurrencyLimit(cfg.MaxConcurrentSagas, cfg.SagaLimitWait)
+		sagaManager.SetStepLimits(cfg.MaxSagaSteps, cfg.AllowDuplicateSagaTargets)
+		sessions.SetTTL(cfg.ReconnectTokenTTL)
+		sagaManager.SetMaxStepResultSize(cfg.StepResultMaxBytes)
+		scenarioManager.SetFanOutWarningThresholds(cfg.FanOutWarningRules, cfg.FanOutWarningActions)
+		scenarioManager.SetScenarioCacheSize(cfg.ScenarioCacheSize)
+		lateCompletionPolicy, _ := saga.ParseLateCompletionPolicy(cfg.LateCompletionPolicy) // validated by parseConfig
+		sagaManager.SetLateCompletionPolicy(lateCompletionPolicy)
+		sagaManager.SetStrictTemplates(cfg.ParamTemplateStrict)
+	})
+
+	// Bearer token authentication for /api and /ws (opt-in)
+	tokens := auth.ParseTokens(startup.AuthTokens)
+
 	// Create event handler
-	eventHandler := websocket.CreateEventHandler(scenarioManager, sagaManager, logStore)
+	wsConfig := websocket.Config{
+		RequireClientCert: tlsConfig != nil,
+		StrictMode:        startup.StrictMode,
+		ReadBufferSize:    startup.WSReadBufferSize,
+		WriteBufferSize:   startup.WSWriteBufferSize,
+		WriteBufferPool:   startup.WSWriteBufferPool,
+		Compression:       startup.WSCompression,
+		MaxMessageSize:    startup.WSMaxMessageSize,
+		HeartbeatInterval: startup.HeartbeatInterval,
+		HeartbeatTimeout:  startup.HeartbeatTimeout,
+		Tokens:            tokens,
+		Dedupe:            dedupe,
+		RateLimit:         rateLimit,
+		EventLog:          eventLog,
+		Unmatched:         unmatched,
+	}
+	eventHandler := websocket.CreateEventHandler(scenarioManager, sagaManager, logStore, reg, wsConfig)
 
-	// Start event queue processor (runs in background goroutine)
-	eventQueue.StartProcessor(eventHandler)
+	// Start event queue processor (runs in background worker goroutines)
+	eventQueue.StartProcessor(eventHandler, startup.EventQueueWorkers)
 
 	// Load initial scenario (optional, can be overridden via API)
-	if *scenarioFile != "" {
-		if err := scenarioManager.LoadScenario(*scenarioFile); err != nil {
+	if startup.ScenarioFile != "" {
+		if err := scenarioManager.LoadScenario(startup.ScenarioFile); err != nil {
 			log.Printf("Warning: Failed to load initial scenario: %v", err)
 		} else {
-			logStore.LogAndStore("info", "Loaded initial scenario from: %s", *scenarioFile)
+			logStore.LogAndStore("info", "Loaded initial scenario from: %s", startup.ScenarioFile)
 		}
 	}
 
-	logStore.LogAndStore("info", "Server starting on port %s", *port)
-	logStore.LogAndStore("info", "WebSocket endpoint: ws://localhost:%s/ws", *port)
+	httpScheme, wsScheme := "http", "ws"
+	if startup.TLSCertFile != "" {
+		httpScheme, wsScheme = "https", "wss"
+	}
+	logStore.LogAndStore("info", "Server starting on port %s (%s)", startup.Port, httpScheme)
+	logStore.LogAndStore("info", "WebSocket endpoint: %s://localhost:%s/ws", wsScheme, startup.Port)
+	if startup.StrictMode {
+		logStore.LogAndStore("info", "Strict mode enabled: orchestration inconsistencies are reported as errors")
+	}
+	if tlsConfig != nil {
+		logStore.LogAndStore("info", "mTLS enabled: simulations must present a client certificate")
+	}
+	if tokens.Enabled() {
+		logStore.LogAndStore("info", "Token authentication enabled for /api and /ws")
+	}
+	allowedOrigins := api.ParseOrigins(startup.AllowedOrigins)
+	if len(allowedOrigins) > 0 {
+		logStore.LogAndStore("info", "CORS allowed origins: %s", strings.Join(allowedOrigins, ", "))
+	} else {
+		logStore.LogAndStore("info", "CORS disabled: no origins allowed")
+	}
 
 	// Setup router
-	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-
-	// Health check endpoint
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("Simulation Orchestration Server - MVP"))
-	})
-
-	// WebSocket endpoint
-	r.Get("/ws", websocket.HandleWebSocket(reg, scenarioManager, sagaManager, eventQueue, logStore, eventHandler))
-
-	// API endpoints
-	r.Route("/api", func(r chi.Router) {
-		r.Get("/simulations", api.HandleGetSimulations(reg))
-		r.Get("/logs", api.HandleGetLogs(logStore))
-		r.Get("/scenario", api.HandleGetScenario(scenarioManager))
-		r.Get("/scenarios", api.HandleGetScenarios(scenarioStore))
-		r.Get("/scenarios/{id}", api.HandleGetScenarioYAML(scenarioStore))
-		r.Post("/scenarios/upload", api.HandleUploadScenario(scenarioManager, scenarioStore, logStore))
-		r.Post("/scenarios/{id}/activate", api.HandleActivateScenario(scenarioManager, scenarioStore, logStore))
+	r := newRouter(components{
+		reg:             reg,
+		scenarioManager: scenarioManager,
+		sagaManager:     sagaManager,
+		scenarioStore:   scenarioStore,
+		eventLog:        eventLog,
+		eventQueue:      eventQueue,
+		eventHub:        eventHub,
+		logStore:        logStore,
+		sessions:        sessions,
+		rateLimit:       rateLimit,
+		unmatched:       unmatched,
+		configStore:     configStore,
+		tokens:          tokens,
+		allowedOrigins:  allowedOrigins,
+		eventHandler:    eventHandler,
+		wsConfig:        wsConfig,
 	})
 
 	// Start server
-	if err := http.ListenAndServe(":"+*port, r); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	server := &http.Server{
+		Addr:      ":" + startup.Port,
+		Handler:   r,
+		TLSConfig: tlsConfig,
+	}
+	go func() {
+		var err error
+		if startup.TLSCertFile != "" {
+			err = server.ListenAndServeTLS(startup.TLSCertFile, startup.TLSKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// Reload configuration on SIGHUP; stop on SIGINT/SIGTERM
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	for waiting := true; waiting; {
+		select {
+		case <-reload:
+			if _, err := configStore.Reload(); err != nil {
+				logStore.LogAndStore("error", "Configuration reload failed, keeping current configuration: %v", err)
+			} else {
+				logStore.LogAndStore("info", "Configuration reloaded (SIGHUP)")
+			}
+		case <-stop:
+			waiting = false
+		}
+	}
+
+	logStore.LogAndStore("info", "Shutdown signal received, draining in-flight Sagas")
+	cfg := configStore.Current()
+
+	// End log and dashboard streams so they don't hold up the HTTP shutdown below
+	logStore.CloseSubscribers()
+	if !eventHub.Close(time.Second) {
+		log.Printf("Warning: Not every dashboard connection was closed cleanly")
+	}
+
+	// Stop accepting new connections and API calls and wait for in-flight requests.
+	// Connected simulations stay connected (WebSockets are hijacked and not closed by
+	// Shutdown), so their step reports still reach the Sagas below.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+
+	// Let the running Sagas finish, but don't start new ones
+	sagaManager.StopAccepting()
+	graceCtx, graceCancel := context.WithTimeout(context.Background(), cfg.ShutdownGracePeriod)
+	defer graceCancel()
+	if remaining := sagaManager.WaitForInFlight(graceCtx); len(remaining) > 0 {
+		logStore.LogAndStore("warning", "%d Sagas still in flight after the %s shutdown grace period: %s", len(remaining), cfg.ShutdownGracePeriod, strings.Join(remaining, ", "))
+	} else {
+		logStore.LogAndStore("info", "No Sagas in flight")
+	}
+
+	// Let simulations know we're going away so they can pause cleanly
+	shutdownMsg := models.Message{
+		Type:    cfg.ShutdownMessageType,
+		Command: cfg.ShutdownCommand,
+		Status:  "shutting_down",
+		Params: map[string]interface{}{
+			"message": cfg.ShutdownMessage,
+		},
+	}
+	for simID, err := range reg.Broadcast(shutdownMsg, cfg.ShutdownBroadcastTimeout) {
+		logStore.LogAndStore("warning", "Failed to notify simulation %s of shutdown: %v", simID, err)
+	}
+	reg.CloseAll(cfg.ShutdownBroadcastTimeout)
+
+	// Process the events already queued, then stop the workers; the stores are closed
+	// once main returns
+	eventQueue.Close()
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer drainCancel()
+	if !eventQueue.WaitDrained(drainCtx) {
+		logStore.LogAndStore("warning", "Event queue not drained after 10s, %d events left", eventQueue.GetQueueLength())
 	}
+	logStore.LogAndStore("info", "Server stopped")
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/api"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/auth"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/config"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/events"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/metrics"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/session"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// components are the server parts the HTTP routes are served from
+type components struct {
+	reg             *registry.Registry
+	scenarioManager *scenario.ScenarioManager
+	sagaManager     *saga.SagaManager
+	scenarioStore   *store.ScenarioStore
+	eventLog        *store.EventLog
+	eventQueue      *queue.EventQueue
+	eventHub        *events.Hub
+	logStore        *logging.LogStore
+	sessions        *session.Manager
+	rateLimit       *queue.RateLimiter
+	unmatched       *queue.UnmatchedEvents
+	configStore     *config.Store
+	tokens          *auth.Tokens
+	allowedOrigins  []string
+	eventHandler    websocket.EventHandler
+	wsConfig        websocket.Config
+}
+
+// newRouter registers the server's HTTP and WebSocket routes
+func newRouter(c components) chi.Router {
+	r := chi.NewRouter()
+	if logging.JSONOutput() {
+		// middleware.Logger writes to its own stdout logger; use the default one so
+		// request lines are JSON as well
+		r.Use(middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.Default(), NoColor: true}))
+	} else {
+		r.Use(middleware.Logger)
+	}
+	r.Use(middleware.Recoverer)
+	r.Use(api.CORS(c.allowedOrigins))
+
+	// Health check endpoint
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Simulation Orchestration Server - MVP"))
+	})
+
+	// Liveness and readiness probes
+	r.Get("/healthz", api.HandleHealthz(c.scenarioStore, c.eventQueue))
+	r.Get("/readyz", api.HandleReadyz(c.scenarioStore, c.eventQueue, c.reg, c.scenarioManager))
+
+	// Prometheus metrics endpoint
+	r.Handle("/metrics", metrics.Handler(metrics.NewCollector(c.reg, c.sagaManager, c.scenarioManager, c.eventQueue, c.rateLimit)))
+
+	// WebSocket endpoint
+	r.Get("/ws", websocket.HandleWebSocket(c.reg, c.scenarioManager, c.sagaManager, c.eventQueue, c.logStore, c.sessions, c.eventHandler, c.wsConfig))
+
+	// Read-only event stream for dashboards
+	r.Get("/ws/dashboard", websocket.HandleDashboard(c.eventHub, c.logStore, c.wsConfig))
+
+	// API endpoints
+	// Handlers don't check the method: chi answers 405 for methods a route doesn't
+	// register, and the CORS middleware answers every OPTIONS preflight.
+	r.Route("/api", func(r chi.Router) {
+		r.Use(c.tokens.Middleware)
+		r.Get("/simulations", api.HandleGetSimulations(c.reg))
+		r.Get("/simulations/{id}", api.HandleGetSimulation(c.reg, c.sagaManager))
+		r.Post("/simulations/command/bulk", api.HandleBulkCommand(c.reg, c.logStore))
+		r.Post("/simulations/{id}/command", api.HandleSimulationCommand(c.reg, c.sagaManager, c.logStore))
+		r.Post("/broadcast", api.HandleBroadcast(c.reg, c.logStore))
+		r.Get("/logs", api.HandleGetLogs(c.logStore))
+		r.Get("/logs/stream", api.HandleStreamLogs(c.logStore))
+		r.Get("/scenario", api.HandleGetScenario(c.scenarioManager))
+		r.Get("/scenario/active", api.HandleGetActiveScenarios(c.scenarioManager))
+		r.Get("/scenario/effective", api.HandleGetEffectiveScenario(c.scenarioManager))
+		r.Post("/scenario/rules/test", api.HandleTestRule())
+		r.Get("/scenarios", api.HandleGetScenarios(c.scenarioStore))
+		r.Get("/scenarios/active", api.HandleGetActiveScenarios(c.scenarioManager))
+		r.Get("/scenarios/{id}", api.HandleGetScenarioYAML(c.scenarioStore))
+		r.Put("/scenarios/{id}", api.HandleUpdateScenario(c.scenarioManager, c.scenarioStore, c.logStore))
+		r.Delete("/scenarios/{id}", api.HandleDeleteScenario(c.scenarioManager, c.scenarioStore, c.logStore))
+		r.Post("/scenarios/upload", api.HandleUploadScenario(c.scenarioManager, c.scenarioStore, c.logStore))
+		r.Post("/scenarios/validate", api.HandleValidateScenario(c.reg, c.scenarioStore))
+		r.Post("/scenarios/{id}/activate", api.HandleActivateScenario(c.scenarioManager, c.scenarioStore, c.logStore))
+		r.Post("/scenarios/{id}/deactivate", api.HandleDeactivateScenario(c.scenarioManager, c.scenarioStore, c.logStore))
+		r.Get("/sagas", api.HandleGetSagas(c.sagaManager))
+		r.Get("/sagas/dead-letter", api.HandleGetCompensationDeadLetters(c.sagaManager))
+		r.Get("/sagas/{id}", api.HandleGetSaga(c.sagaManager))
+		r.Post("/sagas/{id}/replay", api.HandleReplaySaga(c.sagaManager, c.logStore))
+		r.Post("/sagas/{id}/steps/{step}/resume", api.HandleResumeSagaStep(c.sagaManager, c.logStore))
+		r.Post("/sagas/{id}/cancel", api.HandleCancelSaga(c.sagaManager))
+		r.Post("/config/reload", api.HandleReloadConfig(c.configStore, c.logStore))
+		r.Get("/events/queue", api.HandleGetEventQueue(c.eventQueue))
+		r.Get("/events", api.HandleGetEventLog(c.eventLog))
+		r.Get("/events/unmatched", api.HandleGetUnmatchedEvents(c.unmatched))
+		r.Post("/events/queue/drain", api.HandleDrainEventQueue(c.eventQueue, c.logStore))
+		r.Post("/events/queue/pause", api.HandlePauseEventQueue(c.eventQueue, c.logStore))
+		r.Post("/events/queue/resume", api.HandleResumeEventQueue(c.eventQueue, c.logStore))
+	})
+
+	return r
+}
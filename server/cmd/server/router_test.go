@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/auth"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/config"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/events"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/session"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
+)
+
+const testOrigin = "https://dashboard.example.com"
+
+// newTestRouter builds the server's router with token authentication enabled
+func newTestRouter(t *testing.T) http.Handler {
+	t.Helper()
+
+	db := filepath.Join(t.TempDir(), "test.db")
+	scenarioStore, err := store.NewScenarioStore(db)
+	if err != nil {
+		t.Fatalf("NewScenarioStore: %v", err)
+	}
+	t.Cleanup(func() { scenarioStore.Close() })
+	eventLog, err := store.NewEventLog(db)
+	if err != nil {
+		t.Fatalf("NewEventLog: %v", err)
+	}
+	t.Cleanup(func() { eventLog.Close() })
+
+	reg := registry.NewRegistry()
+	eventQueue := queue.NewEventQueue(10)
+	t.Cleanup(eventQueue.Close)
+
+	return newRouter(components{
+		reg:             reg,
+		scenarioManager: scenario.NewScenarioManager(),
+		sagaManager:     saga.NewSagaManager(reg),
+		scenarioStore:   scenarioStore,
+		eventLog:        eventLog,
+		eventQueue:      eventQueue,
+		eventHub:        events.NewHub(),
+		logStore:        logging.NewLogStore(100),
+		sessions:        session.NewManager(time.Minute),
+		rateLimit:       queue.NewRateLimiter(0, 0),
+		unmatched:       queue.NewUnmatchedEvents(10),
+		configStore:     config.NewStore(&config.Runtime{}, nil),
+		tokens:          auth.ParseTokens("secret"),
+		allowedOrigins:  []string{testOrigin},
+	})
+}
+
+func TestRegisteredRoutes(t *testing.T) {
+	router := newTestRouter(t)
+
+	for _, path := range []string{
+		"/api/simulations",
+		"/api/sagas",
+		"/api/sagas/dead-letter",
+		"/api/events",
+		"/api/events/queue",
+		"/api/events/unmatched",
+		"/api/scenario/active",
+	} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+		})
+	}
+}
+
+func TestUnregisteredMethodNotAllowed(t *testing.T) {
+	router := newTestRouter(t)
+
+	tests := []struct {
+		method, path string
+		wantAllow    string
+	}{
+		{http.MethodPost, "/healthz", "GET"},
+		{http.MethodPut, "/api/simulations", "GET"},
+		{http.MethodDelete, "/api/sagas", "GET"},
+		{http.MethodGet, "/api/broadcast", "POST"},
+		{http.MethodGet, "/api/config/reload", "POST"},
+		{http.MethodPost, "/api/scenarios/1", "GET"},
+		{http.MethodPatch, "/api/scenarios/1", "PUT"},
+		{http.MethodGet, "/api/sagas/saga_1/cancel", "POST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d, want 405", rec.Code)
+			}
+			if allow := rec.Header().Values("Allow"); !containsMethod(allow, tt.wantAllow) {
+				t.Fatalf("Allow = %v, want it to include %s", allow, tt.wantAllow)
+			}
+		})
+	}
+}
+
+// containsMethod reports whether any of the Allow header values lists method
+func containsMethod(allow []string, method string) bool {
+	for _, value := range allow {
+		for _, m := range strings.Split(value, ",") {
+			if strings.TrimSpace(m) == method {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestPreflight(t *testing.T) {
+	router := newTestRouter(t)
+
+	// Preflights carry no credentials, so they're answered before authentication, on
+	// every path
+	for _, path := range []string{"/api/simulations", "/api/scenarios/1", "/api/sagas/saga_1/cancel", "/healthz", "/api/unknown"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, path, nil)
+			req.Header.Set("Origin", testOrigin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNoContent {
+				t.Fatalf("status = %d, want 204", rec.Code)
+			}
+			h := rec.Header()
+			want := map[string]string{
+				"Access-Control-Allow-Origin":      testOrigin,
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, POST, PUT, DELETE, OPTIONS",
+				"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+			}
+			for name, value := range want {
+				if got := h.Get(name); got != value {
+					t.Fatalf("%s = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+
+	// A preflight from another origin gets no CORS headers, so the browser blocks the call
+	req := httptest.NewRequest(http.MethodOptions, "/api/simulations", nil)
+	req.Header.Set("Origin", "https://other.example.com")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("Access-Control-Allow-Origin = %q for another origin, want none", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "" {
+		t.Fatalf("Access-Control-Allow-Methods = %q for another origin, want none", got)
+	}
+}
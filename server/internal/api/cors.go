@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+/*
+CORS
+
+Browser dashboards call the API from another origin, so the API answers with CORS
+headers. Which origins may do so is configured once (ALLOWED_ORIGINS) and applied by
+the CORS middleware to every route, instead of by each handler.
+
+A request from an allowed origin gets that origin echoed back in
+Access-Control-Allow-Origin, with Access-Control-Allow-Credentials so browsers may send
+cookies and Authorization headers. "*" allows every origin, but only when configured
+explicitly; the wildcard is sent as is and never combined with credentials, as browsers
+require. Requests from other origins get no CORS headers, so browsers block them.
+
+The custom response headers some endpoints set (X-Total-Count on the scenario list,
+X-Saga-Active-Count and X-Saga-Limit on the Saga list) are exposed to allowed origins
+here as well, so scripts can read them; handlers only set the headers themselves.
+
+Every OPTIONS request is treated as a preflight and answered by the middleware itself,
+before authentication and routing: preflights never carry credentials, and no handler
+implements OPTIONS.
+*/
+
+// corsAllowedMethods and corsAllowedHeaders are what preflights are allowed
+const (
+	corsAllowedMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	corsAllowedHeaders = "Authorization, Content-Type"
+)
+
+// corsExposedHeaders are the response headers scripts from allowed origins may read
+const corsExposedHeaders = "X-Total-Count, X-Saga-Active-Count, X-Saga-Limit"
+
+// ParseOrigins splits a comma-separated origin list, dropping empty entries and
+// trailing slashes
+func ParseOrigins(list string) []string {
+	var origins []string
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// CORS returns a middleware that sets the CORS headers for the allowed origins and
+// answers preflight requests
+// An origin of "*" allows all origins; an empty list allows none.
+func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
+	wildcard := false
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			wildcard = true
+		}
+		allowed[strings.ToLower(origin)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+
+			originAllowed := origin != "" && (wildcard || allowed[strings.ToLower(origin)])
+			if originAllowed {
+				if wildcard {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+				w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			}
+
+			// Handle preflight OPTIONS request
+			if r.Method == "OPTIONS" {
+				if originAllowed {
+					w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+					w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
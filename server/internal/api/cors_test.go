@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseOrigins(t *testing.T) {
+	got := ParseOrigins(" https://a.example.com/, ,http://localhost:5174,")
+	want := []string{"https://a.example.com", "http://localhost:5174"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseOrigins = %v, want %v", got, want)
+	}
+	if got := ParseOrigins(""); len(got) != 0 {
+		t.Fatalf("ParseOrigins(\"\") = %v, want none", got)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name            string
+		allowed         []string
+		origin          string
+		wantOrigin      string
+		wantCredentials bool
+	}{
+		{name: "allowed origin", allowed: []string{"https://dash.example.com"}, origin: "https://dash.example.com", wantOrigin: "https://dash.example.com", wantCredentials: true},
+		{name: "origins compare case-insensitively", allowed: []string{"https://Dash.example.com"}, origin: "https://dash.example.com", wantOrigin: "https://dash.example.com", wantCredentials: true},
+		{name: "other origin", allowed: []string{"https://dash.example.com"}, origin: "https://evil.example.com"},
+		{name: "wildcard", allowed: []string{"*"}, origin: "https://any.example.com", wantOrigin: "*"},
+		{name: "nothing allowed", allowed: nil, origin: "https://dash.example.com"},
+		{name: "same-origin request", allowed: []string{"*"}, origin: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CORS(tt.allowed)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Total-Count", "3")
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/scenarios", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (CORS doesn't block, browsers do)", rec.Code)
+			}
+			h := rec.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCredentials {
+				t.Fatalf("credentials allowed = %v, want %v", got, tt.wantCredentials)
+			}
+			wantExposed := ""
+			if tt.wantOrigin != "" {
+				wantExposed = corsExposedHeaders
+			}
+			if got := h.Get("Access-Control-Expose-Headers"); got != wantExposed {
+				t.Fatalf("Access-Control-Expose-Headers = %q, want %q", got, wantExposed)
+			}
+			if got := h.Get("Vary"); got != "Origin" {
+				t.Fatalf("Vary = %q, want Origin", got)
+			}
+		})
+	}
+}
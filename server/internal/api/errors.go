@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+/*
+Error Responses
+
+Every API error is answered with the same JSON body, whatever the endpoint:
+
+	{"error": {"code": "scenario_not_found", "message": "Scenario not found"}}
+
+code is a stable, machine-readable identifier clients can branch on; message is for
+people and may change. The HTTP status is unchanged by the body: a missing scenario is
+still 404, invalid YAML still 400, and so on.
+*/
+
+// Error codes returned in ErrorResponse
+const (
+	ErrCodeInternal           = "internal_error"  // The server failed to complete the request
+	ErrCodeInvalidRequest     = "invalid_request" // The body or a query parameter is malformed or incomplete
+	ErrCodeInvalidID          = "invalid_id"      // A path ID is not a valid number
+	ErrCodeInvalidYAML        = "invalid_yaml"    // A scenario doesn't parse or validate
+	ErrCodeInvalidFile        = "invalid_file"    // An uploaded scenario file is missing or not YAML text
+	ErrCodeInvalidRule        = "invalid_rule"    // A rule sent for testing can't be tested
+	ErrCodeInvalidConfig      = "invalid_config"  // A configuration reload was rejected
+	ErrCodeSimulationNotFound = "simulation_not_found"
+	ErrCodeSimulationBusy     = "simulation_busy" // The simulation is locked by a Saga
+	ErrCodeSendFailed         = "send_failed"     // A command could not be sent to a simulation
+	ErrCodeScenarioNotFound   = "scenario_not_found"
+	ErrCodeScenarioNotActive  = "scenario_not_active" // No (matching) scenario is active
+	ErrCodeScenarioNameTaken  = "scenario_name_taken"
+	ErrCodeSagaNotFound       = "saga_not_found"
+	ErrCodeSagaConflict       = "saga_conflict"      // The Saga is not in a state that allows the operation
+	ErrCodeSagaLimitReached   = "saga_limit_reached" // The concurrent Saga limit is reached
+	ErrCodeQueueClosed        = "queue_closed"       // The event queue no longer accepts events
+
+	// "unauthorized" (401, no or an invalid bearer token) is returned by the auth
+	// middleware before a request reaches the handlers
+)
+
+// ErrorResponse is the body of every API error response
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an API error
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError replies to the request with the given status and an ErrorResponse body
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	h := w.Header()
+	// Headers set for a successful response don't apply to the error
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error: ErrorDetail{Code: code, Message: message},
+	})
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/auth"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	// Headers of an abandoned successful response
+	rec.Header().Set("Content-Type", "application/yaml")
+	rec.Header().Set("Content-Length", "1234")
+
+	writeError(rec, http.StatusTeapot, ErrCodeInternal, "failed")
+
+	assertError(t, rec, http.StatusTeapot, ErrCodeInternal)
+	if got := rec.Header().Get("Content-Length"); got != "" {
+		t.Fatalf("Content-Length = %q kept from the successful response", got)
+	}
+	if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Fatalf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	reg := registry.NewRegistry()
+	sagaManager := saga.NewSagaManager(reg)
+	scenarioManager := scenario.NewScenarioManager()
+	scenarioStore := newTestScenarioStore(t)
+	logStore := logging.NewLogStore(100)
+
+	router := chi.NewRouter()
+	router.Get("/simulations/{id}", HandleGetSimulation(reg, sagaManager))
+	router.Post("/simulations/{id}/command", HandleSimulationCommand(reg, sagaManager, logStore))
+	router.Post("/scenario/rules/test", HandleTestRule())
+	router.Post("/scenarios/upload", HandleUploadScenario(scenarioManager, scenarioStore, logStore))
+	router.Delete("/scenarios/{id}", HandleDeleteScenario(scenarioManager, scenarioStore, logStore))
+	router.Get("/sagas/{id}", HandleGetSaga(sagaManager))
+	router.Post("/sagas/{id}/cancel", HandleCancelSaga(sagaManager))
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{name: "unknown simulation", method: http.MethodGet, target: "/simulations/missing", status: http.StatusNotFound, code: ErrCodeSimulationNotFound},
+		{name: "malformed command", method: http.MethodPost, target: "/simulations/sim/command", contentType: "application/json", body: "{", status: http.StatusBadRequest, code: ErrCodeInvalidRequest},
+		{name: "command missing", method: http.MethodPost, target: "/simulations/sim/command", contentType: "application/json", body: "{}", status: http.StatusBadRequest, code: ErrCodeInvalidRequest},
+		{name: "command to unknown simulation", method: http.MethodPost, target: "/simulations/missing/command", contentType: "application/json", body: `{"command": "go"}`, status: http.StatusNotFound, code: ErrCodeSimulationNotFound},
+		{name: "untestable rule", method: http.MethodPost, target: "/scenario/rules/test", contentType: "application/yaml", body: "rule:\n  when: {}\n", status: http.StatusBadRequest, code: ErrCodeInvalidRule},
+		{name: "upload without a file", method: http.MethodPost, target: "/scenarios/upload", contentType: "text/plain", body: "scenario", status: http.StatusBadRequest, code: ErrCodeInvalidFile},
+		{name: "upload of invalid YAML", method: http.MethodPost, target: "/scenarios/upload", contentType: "application/yaml", body: "scenario: [", status: http.StatusBadRequest, code: ErrCodeInvalidYAML},
+		{name: "invalid scenario ID", method: http.MethodDelete, target: "/scenarios/abc", status: http.StatusBadRequest, code: ErrCodeInvalidID},
+		{name: "unknown scenario", method: http.MethodDelete, target: "/scenarios/9999", status: http.StatusNotFound, code: ErrCodeScenarioNotFound},
+		{name: "unknown saga", method: http.MethodGet, target: "/sagas/missing", status: http.StatusNotFound, code: ErrCodeSagaNotFound},
+		{name: "cancel unknown saga", method: http.MethodPost, target: "/sagas/missing/cancel", status: http.StatusNotFound, code: ErrCodeSagaNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(router, tt.method, tt.target, tt.contentType, tt.body)
+			assertError(t, rec, tt.status, tt.code)
+		})
+	}
+}
+
+// The 401 is written by the auth middleware, not writeError, but has the same shape
+func TestUnauthorizedErrorResponse(t *testing.T) {
+	handler := auth.ParseTokens("secret").Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("request without a token reached the handler")
+	}))
+
+	rec := serve(handler, http.MethodGet, "/api/sagas", "", "")
+	assertError(t, rec, http.StatusUnauthorized, "unauthorized")
+}
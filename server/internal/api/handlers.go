@@ -2,57 +2,556 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"sort"
 	"strconv"
-	"strings"
+	"time"
 
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/config"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
 	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
 )
 
 // SimulationResponse represents a simulation in the API response
 type SimulationResponse struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Tenant       string   `json:"tenant,omitempty"`
+	Capabilities []string `json:"capabilities"` // Empty = accepts any command
+	ConnectedAt  string   `json:"connected_at"`
+	LastActivity string   `json:"last_activity"` // When a message was last received from it
 }
 
 // HandleGetSimulations returns all connected simulations
 func HandleGetSimulations(reg *registry.Registry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 
 		simulations := reg.GetAll()
 		response := make([]SimulationResponse, 0, len(simulations))
-		for id, sim := range simulations {
+		for key, sim := range simulations {
+			capabilities := sim.Capabilities
+			if capabilities == nil {
+				capabilities = []string{}
+			}
 			response = append(response, SimulationResponse{
-				ID:   id,
-				Name: sim.Name,
+				ID:           sim.ID,
+				Name:         sim.Name,
+				Tenant:       sim.Tenant,
+				Capabilities: capabilities,
+				ConnectedAt:  sim.ConnectedAt.Format("2006-01-02 15:04:05"),
+				LastActivity: reg.LastActivity(key).Format("2006-01-02 15:04:05"),
 			})
 		}
 
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// SimulationDetailResponse represents one simulation and its Saga involvement in API response
+type SimulationDetailResponse struct {
+	ID                       string   `json:"id"`
+	Name                     string   `json:"name"`
+	Tenant                   string   `json:"tenant,omitempty"`
+	ConnectedAt              string   `json:"connected_at"`
+	LastActivity             string   `json:"last_activity"`
+	ExpectedLatency          string   `json:"expected_latency,omitempty"`
+	Capabilities             []string `json:"capabilities"`                         // Empty = accepts any command
+	DefaultCompensateCommand string   `json:"default_compensate_command,omitempty"` // Rolls back steps without a compensate_command
+	LockedBy                 string   `json:"locked_by,omitempty"`                  // Saga holding the simulation's lock
+	ActiveSagas              []string `json:"active_sagas"`                         // Unfinished Sagas with a step targeting it
+}
+
+// HandleGetSimulation returns one connected simulation with the Sagas it is involved in
+// The simulation is looked up in the tenant given by ?tenant= (default tenant if unset).
+func HandleGetSimulation(reg *registry.Registry, sagaManager *saga.SagaManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		simKey := registry.Key(r.URL.Query().Get("tenant"), chi.URLParam(r, "id"))
+		sim, exists := reg.Get(simKey)
+		if !exists {
+			writeError(w, http.StatusNotFound, ErrCodeSimulationNotFound, "Simulation not found")
+			return
+		}
+
+		capabilities := sim.Capabilities
+		if capabilities == nil {
+			capabilities = []string{}
+		}
+		response := SimulationDetailResponse{
+			ID:           sim.ID,
+			Name:         sim.Name,
+			Tenant:       sim.Tenant,
+			ConnectedAt:  sim.ConnectedAt.Format("2006-01-02 15:04:05"),
+			LastActivity: reg.LastActivity(simKey).Format("2006-01-02 15:04:05"),
+			Capabilities: capabilities,
+			ActiveSagas:  sagaManager.GetActiveSagasForSim(simKey),
+
+			DefaultCompensateCommand: sim.DefaultCompensateCommand,
+		}
+		if sim.ExpectedLatency > 0 {
+			response.ExpectedLatency = sim.ExpectedLatency.String()
+		}
+		if holders, locked := sagaManager.CheckConflict(simKey); locked {
+			response.LockedBy = holders[0]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// bulkCommandWriteTimeout bounds each write of a bulk command
+const bulkCommandWriteTimeout = 5 * time.Second
+
+// BulkCommandSelector chooses the simulations a bulk command is sent to
+// Exactly one of IDs, All or Capability must be set. Tenant scopes IDs (and All or
+// Capability, if set).
+type BulkCommandSelector struct {
+	IDs        []string `json:"ids,omitempty"`
+	All        bool     `json:"all,omitempty"`
+	Capability string   `json:"capability,omitempty"`
+	Tenant     string   `json:"tenant,omitempty"`
+}
+
+// BulkCommandRequest represents a bulk command dispatch request
+type BulkCommandRequest struct {
+	Selector BulkCommandSelector    `json:"selector"`
+	Command  string                 `json:"command"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+}
+
+// BulkCommandResult represents the outcome of sending a bulk command to one simulation
+type BulkCommandResult struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant,omitempty"`
+	Status string `json:"status"` // "sent", "failed" or "not_connected"
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkCommandResponse represents the per-target results of a bulk command
+type BulkCommandResponse struct {
+	Command string              `json:"command"`
+	Results []BulkCommandResult `json:"results"`
+}
+
+// HandleBulkCommand sends one command to a set of simulations and reports each write's outcome
+func HandleBulkCommand(reg *registry.Registry, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req BulkCommandRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		if req.Command == "" {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Missing command")
+			return
+		}
+
+		selector := req.Selector
+		selectors := 0
+		if len(selector.IDs) > 0 {
+			selectors++
+		}
+		if selector.All {
+			selectors++
+		}
+		if selector.Capability != "" {
+			selectors++
+		}
+		if selectors != 1 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Selector must set exactly one of ids, all or capability")
+			return
+		}
+
+		// Resolve the selector to registry keys; requested IDs that aren't connected
+		// are reported rather than silently skipped
+		targets := make(map[string]*models.Simulation)
+		results := make([]BulkCommandResult, 0)
+		if selector.All || selector.Capability != "" {
+			for key, sim := range reg.GetAll() {
+				if selector.Tenant != "" && sim.Tenant != selector.Tenant {
+					continue
+				}
+				// A capability selects only simulations that advertise it, not those
+				// that declared no capabilities at all
+				if selector.Capability != "" && !slices.Contains(sim.Capabilities, selector.Capability) {
+					continue
+				}
+				targets[key] = sim
+			}
+		} else {
+			for _, id := range selector.IDs {
+				key := registry.Key(selector.Tenant, id)
+				if sim, exists := reg.Get(key); exists {
+					targets[key] = sim
+				} else {
+					results = append(results, BulkCommandResult{
+						ID:     id,
+						Tenant: selector.Tenant,
+						Status: "not_connected",
+					})
+				}
+			}
+		}
+
+		results, sent := sendBulkCommand(targets, req.Command, req.Params, results)
+		logStore.LogAndStore("info", "Bulk command %s sent to %d of %d selected simulations", req.Command, sent, len(results))
+
+		w.Header().Set("Content-Type", "application/json")
+		response := BulkCommandResponse{
+			Command: req.Command,
+			Results: results,
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// sendBulkCommand sends a command to each target (keyed by registry key) and appends
+// each write's outcome to results, which are returned sorted by registry key along
+// with the number of successful writes
+func sendBulkCommand(targets map[string]*models.Simulation, command string, params map[string]interface{}, results []BulkCommandResult) ([]BulkCommandResult, int) {
+	msg := models.Message{
+		Type:    "command",
+		Command: command,
+		Params:  params,
+	}
+	errs := registry.SendAll(targets, msg, bulkCommandWriteTimeout)
+	for key, sim := range targets {
+		result := BulkCommandResult{
+			ID:     sim.ID,
+			Tenant: sim.Tenant,
+			Status: "sent",
+		}
+		if err, failed := errs[key]; failed {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return registry.Key(results[i].Tenant, results[i].ID) < registry.Key(results[j].Tenant, results[j].ID)
+	})
+	return results, len(targets) - len(errs)
+}
+
+// SimulationCommandRequest represents a command sent directly to one simulation
+type SimulationCommandRequest struct {
+	Command string                 `json:"command"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+}
+
+// SimulationCommandResponse represents the outcome of a direct command
+type SimulationCommandResponse struct {
+	ID      string `json:"id"`
+	Tenant  string `json:"tenant,omitempty"`
+	Command string `json:"command"`
+	Status  string `json:"status"` // "sent"
+}
+
+// HandleSimulationCommand sends one command directly to a connected simulation
+// The simulation is looked up in the tenant given by ?tenant= (default tenant if unset).
+// The command bypasses the Saga machinery (no saga_id, no acknowledgment expected) but
+// is refused while a Saga holds the simulation's lock, so it can't interleave with
+// the Saga's steps. Writes go through the same serialized path as Saga commands.
+func HandleSimulationCommand(reg *registry.Registry, sagaManager *saga.SagaManager, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SimulationCommandRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		if req.Command == "" {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Missing command")
+			return
+		}
+
+		simKey := registry.Key(r.URL.Query().Get("tenant"), chi.URLParam(r, "id"))
+		sim, exists := reg.Get(simKey)
+		if !exists {
+			writeError(w, http.StatusNotFound, ErrCodeSimulationNotFound, "Simulation not found")
+			return
+		}
+		if holders, locked := sagaManager.CheckConflict(simKey); locked {
+			writeError(w, http.StatusConflict, ErrCodeSimulationBusy, fmt.Sprintf("Simulation %s is locked by Saga %s", sim.ID, holders[0]))
+			return
+		}
+
+		msg := models.Message{
+			Type:    "command",
+			Command: req.Command,
+			Params:  req.Params,
+		}
+		if err := sim.Send(msg, bulkCommandWriteTimeout); err != nil {
+			writeError(w, http.StatusBadGateway, ErrCodeSendFailed, fmt.Sprintf("Failed to send command: %v", err))
+			return
+		}
+		logStore.LogAndStoreCtx("info", "", simKey, "Command %s sent directly to %s", req.Command, simKey)
+
+		w.Header().Set("Content-Type", "application/json")
+		response := SimulationCommandResponse{
+			ID:      sim.ID,
+			Tenant:  sim.Tenant,
+			Command: req.Command,
+			Status:  "sent",
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// BroadcastRequest represents a command sent to every connected simulation
+type BroadcastRequest struct {
+	Command string                 `json:"command"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Tenant  string                 `json:"tenant,omitempty"` // Only simulations of this tenant ("" = all)
+}
+
+// HandleBroadcast sends one command to every connected simulation and reports each write's outcome
+// Writes go through the same serialized path as Saga commands, so a broadcast never
+// interleaves with a dispatch to the same simulation.
+func HandleBroadcast(reg *registry.Registry, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req BroadcastRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		if req.Command == "" {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Missing command")
+			return
+		}
+
+		targets := make(map[string]*models.Simulation)
+		for key, sim := range reg.GetAll() {
+			if req.Tenant == "" || sim.Tenant == req.Tenant {
+				targets[key] = sim
+			}
+		}
+
+		results, sent := sendBulkCommand(targets, req.Command, req.Params, make([]BulkCommandResult, 0, len(targets)))
+		logStore.LogAndStore("info", "Broadcast command %s sent to %d of %d simulations", req.Command, sent, len(targets))
+
+		w.Header().Set("Content-Type", "application/json")
+		response := BulkCommandResponse{
+			Command: req.Command,
+			Results: results,
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
 			return
 		}
 	}
 }
 
-// HandleGetLogs returns all log entries
+// HandleGetLogs returns all log entries, optionally filtered by ?saga_id= and ?source=
 func HandleGetLogs(logStore *logging.LogStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 
-		logs := logStore.GetAll()
+		filter := logging.LogFilter{
+			SagaID: r.URL.Query().Get("saga_id"),
+			Source: r.URL.Query().Get("source"),
+		}
+
+		var logs []logging.LogEntry
+		if filter.SagaID == "" && filter.Source == "" {
+			logs = logStore.GetAll()
+		} else {
+			logs = logStore.Query(filter)
+		}
 		if err := json.NewEncoder(w).Encode(logs); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// EventLogEntryResponse represents one audited event or dispatched command
+type EventLogEntryResponse struct {
+	ID        int64                  `json:"id"`
+	Kind      string                 `json:"kind"` // "event" or "command"
+	Tenant    string                 `json:"tenant,omitempty"`
+	Source    string                 `json:"source,omitempty"`
+	EventType string                 `json:"event_type,omitempty"`
+	SagaID    string                 `json:"saga_id,omitempty"`
+	StepID    *int                   `json:"step_id,omitempty"`
+	Target    string                 `json:"target,omitempty"`
+	Command   string                 `json:"command,omitempty"`
+	Payload   map[string]interface{} `json:"payload,omitempty"` // Event payload or command params
+	Timestamp string                 `json:"timestamp"`
+}
+
+// HandleGetEventLog returns the audited events and commands, oldest first
+// Filters: ?saga_id= (commands of that Saga), ?source= (events from, or commands to,
+// that simulation), ?tenant= and ?since= (RFC 3339 timestamp).
+func HandleGetEventLog(eventLog *store.EventLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := store.EventLogFilter{
+			SagaID: query.Get("saga_id"),
+			Tenant: query.Get("tenant"),
+			Source: query.Get("source"),
+		}
+		if since := query.Get("since"); since != "" {
+			t, err := time.Parse(time.RFC3339Nano, since)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid since (expected an RFC 3339 timestamp): %v", err))
+				return
+			}
+			filter.Since = t
+		}
+
+		entries, err := eventLog.Query(filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to query event log: %v", err))
+			return
+		}
+
+		response := make([]EventLogEntryResponse, len(entries))
+		for i, entry := range entries {
+			response[i] = EventLogEntryResponse{
+				ID:        entry.ID,
+				Kind:      entry.Kind,
+				Tenant:    entry.Tenant,
+				Source:    entry.Source,
+				EventType: entry.EventType,
+				SagaID:    entry.SagaID,
+				StepID:    entry.StepID,
+				Target:    entry.Target,
+				Command:   entry.Command,
+				Payload:   entry.Payload,
+				Timestamp: entry.Timestamp.Format(time.RFC3339Nano),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// UnmatchedEventResponse represents an event that matched no rule in API response
+type UnmatchedEventResponse struct {
+	Source    string                 `json:"source"`
+	Tenant    string                 `json:"tenant,omitempty"`
+	EventType string                 `json:"event_type"`
+	EventID   string                 `json:"event_id,omitempty"`
+	Payload   map[string]interface{} `json:"payload,omitempty"`
+	Timestamp string                 `json:"timestamp"`
+}
+
+// HandleGetUnmatchedEvents returns the most recent events that matched no rule, oldest first
+// Filters: ?source= (simulation ID), ?tenant= and ?event_type=.
+func HandleGetUnmatchedEvents(unmatched *queue.UnmatchedEvents) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		source := query.Get("source")
+		tenant := query.Get("tenant")
+		eventType := query.Get("event_type")
+
+		response := make([]UnmatchedEventResponse, 0)
+		for _, event := range unmatched.List() {
+			if (source != "" && event.Source != source) ||
+				(tenant != "" && event.Tenant != tenant) ||
+				(eventType != "" && event.EventType != eventType) {
+				continue
+			}
+			response = append(response, UnmatchedEventResponse{
+				Source:    event.Source,
+				Tenant:    event.Tenant,
+				EventType: event.EventType,
+				EventID:   event.EventID,
+				Payload:   event.Payload,
+				Timestamp: event.Timestamp.Format(time.RFC3339Nano),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// logStreamKeepAlive is how often an idle log stream sends a comment so proxies don't
+// close the connection
+const logStreamKeepAlive = 15 * time.Second
+
+// HandleStreamLogs streams each new log entry to the client as a Server-Sent Event
+// Every entry is sent as a "data:" line holding the same JSON as an element of /api/logs.
+// Entries logged before the client connected are not sent; fetch them from /api/logs.
+func HandleStreamLogs(logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Streaming not supported")
 			return
 		}
+
+		entries, unsubscribe := logStore.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(logStreamKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				// Client disconnected
+				return
+			case entry, ok := <-entries:
+				if !ok {
+					// Subscription ended (server shutting down)
+					return
+				}
+				data, err := json.Marshal(entry)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
 	}
 }
 
@@ -62,15 +561,88 @@ type ScenarioInfoResponse struct {
 	Rules int    `json:"rules"`
 }
 
-// HandleGetScenario returns information about the current scenario
+// ActiveScenarioResponse represents an active scenario and a digest of its rules in API response
+type ActiveScenarioResponse struct {
+	Name        string               `json:"name"`
+	StoredID    int                  `json:"stored_id,omitempty"` // Stored scenario it was activated from (omitted if loaded from SCENARIO_FILE)
+	Tenant      string               `json:"tenant,omitempty"`
+	Rules       int                  `json:"rules"`
+	RuleDigests []RuleDigestResponse `json:"rule_digests"`
+}
+
+// RuleDigestResponse summarizes what a rule matches and what it sends
+type RuleDigestResponse struct {
+	EventType  string                 `json:"event_type,omitempty"`
+	From       string                 `json:"from,omitempty"`
+	JoinEvents []string               `json:"join_events,omitempty"` // Event types a join rule waits for
+	Priority   int                    `json:"priority,omitempty"`
+	Exclusive  bool                   `json:"exclusive,omitempty"`
+	Actions    []ActionDigestResponse `json:"actions"`
+}
+
+// ActionDigestResponse is the target and command of a rule's action
+type ActionDigestResponse struct {
+	SendTo  string `json:"send_to"`
+	Command string `json:"command"`
+}
+
+// HandleGetActiveScenarios returns all active scenarios with a digest of their rules,
+// in the order their rules are evaluated
+func HandleGetActiveScenarios(scenarioManager *scenario.ScenarioManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		active := scenarioManager.ListActive()
+		response := make([]ActiveScenarioResponse, len(active))
+		for i, s := range active {
+			digests := make([]RuleDigestResponse, len(s.Rules))
+			for j, rule := range s.Rules {
+				digest := RuleDigestResponse{
+					EventType: rule.When.EventType,
+					From:      rule.When.From,
+					Priority:  rule.Priority,
+					Exclusive: rule.Exclusive,
+					Actions:   make([]ActionDigestResponse, len(rule.Then)),
+				}
+				if rule.When.Join != nil {
+					for _, event := range rule.When.Join.Events {
+						digest.JoinEvents = append(digest.JoinEvents, event.EventType)
+					}
+				}
+				for k, action := range rule.Then {
+					digest.Actions[k] = ActionDigestResponse{
+						SendTo:  action.SendTo,
+						Command: action.Command,
+					}
+				}
+				digests[j] = digest
+			}
+			response[i] = ActiveScenarioResponse{
+				Name:        s.Name,
+				StoredID:    s.StoredID,
+				Tenant:      s.Tenant,
+				Rules:       len(s.Rules),
+				RuleDigests: digests,
+			}
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// HandleGetScenario returns information about the most recently activated scenario
+// Only that one scenario is returned even when several are active; HandleGetActiveScenarios
+// lists them all.
 func HandleGetScenario(scenarioManager *scenario.ScenarioManager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 
 		scenario := scenarioManager.GetCurrentScenario()
 		if scenario == nil {
-			http.Error(w, "No scenario loaded", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, ErrCodeScenarioNotActive, "No scenario loaded")
 			return
 		}
 
@@ -80,9 +652,48 @@ func HandleGetScenario(scenarioManager *scenario.ScenarioManager) http.HandlerFu
 		}
 
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// HandleGetEffectiveScenario returns an active scenario with all load-time and
+// rule-expansion transformations applied, as YAML (default) or JSON (?format=json)
+// ?name= selects the scenario; by default it is the most recently activated one.
+func HandleGetEffectiveScenario(scenarioManager *scenario.ScenarioManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		effective := scenarioManager.EffectiveScenario(r.URL.Query().Get("name"))
+		if effective == nil {
+			writeError(w, http.StatusNotFound, ErrCodeScenarioNotActive, "No scenario loaded")
+			return
+		}
+
+		yamlBytes, err := yaml.Marshal(models.ScenarioFile{Scenario: *effective})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode scenario")
 			return
 		}
+
+		switch r.URL.Query().Get("format") {
+		case "", "yaml":
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write(yamlBytes)
+		case "json":
+			// Round-trip through YAML so JSON uses the same field names as the scenario file
+			var document interface{}
+			if err := yaml.Unmarshal(yamlBytes, &document); err != nil {
+				writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode scenario")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(document); err != nil {
+				writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+				return
+			}
+		default:
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Unsupported format (want yaml or json)")
+		}
 	}
 }
 
@@ -94,102 +705,126 @@ type StoredScenarioResponse struct {
 }
 
 // HandleUploadScenario handles YAML scenario file uploads and saves them to the database
+// Each upload is saved as a new scenario. With ?replace=true, a stored scenario with the
+// same name is updated in place instead, keeping its ID and creation time.
 func HandleUploadScenario(scenarioManager *scenario.ScenarioManager, scenarioStore *store.ScenarioStore, logStore *logging.LogStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		// Handle preflight OPTIONS request
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		if r.Method != "POST" {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
+		replace := false
+		if replaceParam := r.URL.Query().Get("replace"); replaceParam != "" {
+			parsed, err := strconv.ParseBool(replaceParam)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid replace parameter (want true or false)")
+				return
+			}
+			replace = parsed
 		}
 
-		// Parse multipart form (max 10MB)
-		if err := r.ParseMultipartForm(10 << 20); err != nil {
-			http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+		fileBytes, ok := readScenarioFile(w, r)
+		if !ok {
 			return
 		}
 
-		// Get the file from form
-		file, header, err := r.FormFile("scenario")
-		if err != nil {
-			http.Error(w, "No file uploaded or invalid form field: "+err.Error(), http.StatusBadRequest)
-			return
-		}
-		defer file.Close()
+		// Validate, save and activate as one linearized operation so concurrent
+		// uploads/activations can't interleave between saving and loading
+		var uploaded *models.Scenario
+		var scenarioID int
+		status, code := http.StatusOK, ""
+		err := scenarioManager.RunExclusive(func() error {
+			// Validate scenario by parsing it
+			parsed, err := scenario.ParseScenario(fileBytes)
+			if err != nil {
+				logStore.LogAndStore("error", "Failed to validate uploaded scenario: %v", err)
+				status, code = http.StatusBadRequest, ErrCodeInvalidYAML
+				return fmt.Errorf("Failed to validate scenario: %w", err)
+			}
+			uploaded = parsed
 
-		// Check file extension
-		filename := strings.ToLower(header.Filename)
-		if !strings.HasSuffix(filename, ".yaml") && !strings.HasSuffix(filename, ".yml") {
-			http.Error(w, "File must be a YAML file (.yaml or .yml)", http.StatusBadRequest)
-			return
-		}
+			// Save to database
+			save := scenarioStore.SaveScenario
+			if replace {
+				save = scenarioStore.UpsertScenario
+			}
+			id, err := save(uploaded.Name, string(fileBytes))
+			if errors.Is(err, store.ErrScenarioNameTaken) {
+				status, code = http.StatusConflict, ErrCodeScenarioNameTaken
+				return fmt.Errorf("A scenario named %q already exists (upload with ?replace=true to update it)", uploaded.Name)
+			}
+			if err != nil {
+				logStore.LogAndStore("error", "Failed to save scenario to database: %v", err)
+				status, code = http.StatusInternalServerError, ErrCodeInternal
+				return fmt.Errorf("Failed to save scenario: %w", err)
+			}
+			scenarioID = id
+			if replace {
+				// The upload may have overwritten an existing stored scenario
+				scenarioManager.InvalidateCachedScenario(id)
+			}
 
-		// Read file content
-		fileBytes, err := io.ReadAll(file)
+			// Activate it, remembering its ID so deleting it also deactivates it
+			uploaded.StoredID = id
+			scenarioManager.ActivateScenario(uploaded)
+			return nil
+		})
 		if err != nil {
-			http.Error(w, "Failed to read file: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		// Validate scenario by loading it
-		if err := scenarioManager.LoadScenarioFromBytes(fileBytes); err != nil {
-			logStore.LogAndStore("error", "Failed to validate uploaded scenario: %v", err)
-			http.Error(w, "Failed to validate scenario: "+err.Error(), http.StatusBadRequest)
+			writeError(w, status, code, err.Error())
 			return
 		}
 
-		scenario := scenarioManager.GetCurrentScenario()
-
-		// Save to database
-		scenarioID, err := scenarioStore.SaveScenario(scenario.Name, string(fileBytes))
-		if err != nil {
-			logStore.LogAndStore("error", "Failed to save scenario to database: %v", err)
-			http.Error(w, "Failed to save scenario: "+err.Error(), http.StatusInternalServerError)
-			return
+		if replace {
+			logStore.LogAndStore("info", "Scenario uploaded and saved to database, replacing by name: %s (ID: %d, %d rules)", uploaded.Name, scenarioID, len(uploaded.Rules))
+		} else {
+			logStore.LogAndStore("info", "Scenario uploaded and saved to database: %s (ID: %d, %d rules)", uploaded.Name, scenarioID, len(uploaded.Rules))
 		}
 
-		logStore.LogAndStore("info", "Scenario uploaded and saved to database: %s (ID: %d, %d rules)", scenario.Name, scenarioID, len(scenario.Rules))
-
 		// Return success response
 		w.Header().Set("Content-Type", "application/json")
 		storedScenario, err := scenarioStore.GetScenarioByID(scenarioID)
 		if err != nil {
-			http.Error(w, "Failed to retrieve saved scenario: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to retrieve saved scenario: "+err.Error())
 			return
 		}
 
 		response := StoredScenarioResponse{
 			ID:        storedScenario.ID,
 			Name:      storedScenario.Name,
-			CreatedAt:  storedScenario.CreatedAt.Format("2006-01-02 15:04:05"),
+			CreatedAt: storedScenario.CreatedAt.Format("2006-01-02 15:04:05"),
 		}
 
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
 			return
 		}
 	}
 }
 
 // HandleGetScenarios returns all stored scenarios
+// Scenarios are listed newest first. Optional query parameters: ?name= keeps scenarios whose
+// name contains it (case-insensitive), ?limit= and ?offset= page the list. The number of
+// matching scenarios before paging is returned in the X-Total-Count header.
 func HandleGetScenarios(scenarioStore *store.ScenarioStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 
-		scenarios, err := scenarioStore.GetAllScenarios()
+		query := store.ScenarioQuery{Name: r.URL.Query().Get("name")}
+		for param, value := range map[string]*int{"limit": &query.Limit, "offset": &query.Offset} {
+			raw := r.URL.Query().Get(param)
+			if raw == "" {
+				continue
+			}
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid "+param+" (want a non-negative integer)")
+				return
+			}
+			*value = n
+		}
+
+		scenarios, total, err := scenarioStore.QueryScenarios(query)
 		if err != nil {
-			http.Error(w, "Failed to retrieve scenarios: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to retrieve scenarios: "+err.Error())
 			return
 		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
 
 		response := make([]StoredScenarioResponse, len(scenarios))
 		for i, s := range scenarios {
@@ -201,7 +836,7 @@ func HandleGetScenarios(scenarioStore *store.ScenarioStore) http.HandlerFunc {
 		}
 
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
 			return
 		}
 	}
@@ -219,18 +854,17 @@ type ScenarioYAMLResponse struct {
 func HandleGetScenarioYAML(scenarioStore *store.ScenarioStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 
 		idParam := chi.URLParam(r, "id")
 		scenarioID, err := strconv.Atoi(idParam)
 		if err != nil {
-			http.Error(w, "Invalid scenario ID", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidID, "Invalid scenario ID")
 			return
 		}
 
 		scenario, err := scenarioStore.GetScenarioByID(scenarioID)
 		if err != nil {
-			http.Error(w, "Scenario not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, ErrCodeScenarioNotFound, "Scenario not found")
 			return
 		}
 
@@ -242,62 +876,867 @@ func HandleGetScenarioYAML(scenarioStore *store.ScenarioStore) http.HandlerFunc
 		}
 
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
 			return
 		}
 	}
 }
 
-// HandleActivateScenario loads and activates a scenario from the database
-func HandleActivateScenario(scenarioManager *scenario.ScenarioManager, scenarioStore *store.ScenarioStore, logStore *logging.LogStore) http.HandlerFunc {
+// HandleUpdateScenario replaces the YAML content (and name) of a stored scenario in place
+// The new YAML is validated before it is written. If the scenario is active (i.e. it was
+// activated or uploaded from this ID), the active copy is replaced by the new version.
+func HandleUpdateScenario(scenarioManager *scenario.ScenarioManager, scenarioStore *store.ScenarioStore, logStore *logging.LogStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		// Handle preflight OPTIONS request
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		idParam := chi.URLParam(r, "id")
+		scenarioID, err := strconv.Atoi(idParam)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidID, "Invalid scenario ID")
 			return
 		}
 
-		if r.Method != "POST" {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		fileBytes, ok := readScenarioFile(w, r)
+		if !ok {
 			return
 		}
 
-		idParam := chi.URLParam(r, "id")
-		scenarioID, err := strconv.Atoi(idParam)
+		// Validate, update and re-activate as one linearized operation
+		var updated *models.Scenario
+		reactivated := false
+		status, code := http.StatusOK, ""
+		err = scenarioManager.RunExclusive(func() error {
+			parsed, err := scenario.ParseScenario(fileBytes)
+			if err != nil {
+				logStore.LogAndStore("error", "Failed to validate updated scenario %d: %v", scenarioID, err)
+				status, code = http.StatusBadRequest, ErrCodeInvalidYAML
+				return fmt.Errorf("Failed to validate scenario: %w", err)
+			}
+			updated = parsed
+
+			if err := scenarioStore.UpdateScenario(scenarioID, updated.Name, string(fileBytes)); err != nil {
+				if errors.Is(err, store.ErrScenarioNotFound) {
+					status, code = http.StatusNotFound, ErrCodeScenarioNotFound
+					return fmt.Errorf("Scenario not found")
+				}
+				if errors.Is(err, store.ErrScenarioNameTaken) {
+					status, code = http.StatusConflict, ErrCodeScenarioNameTaken
+					return fmt.Errorf("A scenario named %q already exists", updated.Name)
+				}
+				logStore.LogAndStore("error", "Failed to update scenario %d in database: %v", scenarioID, err)
+				status, code = http.StatusInternalServerError, ErrCodeInternal
+				return fmt.Errorf("Failed to update scenario: %w", err)
+			}
+			scenarioManager.InvalidateCachedScenario(scenarioID)
+
+			// The name may have changed, so the old version is removed before the
+			// new one is activated
+			if scenarioManager.DeactivateStoredScenario(scenarioID) != nil {
+				updated.StoredID = scenarioID
+				scenarioManager.ActivateScenario(updated)
+				reactivated = true
+			}
+			return nil
+		})
 		if err != nil {
-			http.Error(w, "Invalid scenario ID", http.StatusBadRequest)
+			writeError(w, status, code, err.Error())
 			return
 		}
 
-		scenario, err := scenarioStore.GetScenarioByID(scenarioID)
+		if reactivated {
+			logStore.LogAndStore("info", "Scenario updated and reactivated: %s (ID: %d, %d rules)", updated.Name, scenarioID, len(updated.Rules))
+		} else {
+			logStore.LogAndStore("info", "Scenario updated: %s (ID: %d, %d rules)", updated.Name, scenarioID, len(updated.Rules))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		storedScenario, err := scenarioStore.GetScenarioByID(scenarioID)
 		if err != nil {
-			http.Error(w, "Scenario not found", http.StatusNotFound)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to retrieve updated scenario: "+err.Error())
 			return
 		}
 
-		// Load scenario from YAML content
-		if err := scenarioManager.LoadScenarioFromBytes([]byte(scenario.YAMLContent)); err != nil {
-			logStore.LogAndStore("error", "Failed to load scenario from database: %v", err)
-			http.Error(w, "Failed to load scenario: "+err.Error(), http.StatusInternalServerError)
+		response := StoredScenarioResponse{
+			ID:        storedScenario.ID,
+			Name:      storedScenario.Name,
+			CreatedAt: storedScenario.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
 			return
 		}
+	}
+}
 
-		loadedScenario := scenarioManager.GetCurrentScenario()
-		logStore.LogAndStore("info", "Scenario activated: %s (ID: %d, %d rules)", loadedScenario.Name, scenarioID, len(loadedScenario.Rules))
+// HandleDeleteScenario deletes a stored scenario
+// If the scenario is active (i.e. it was activated or uploaded from this ID), it is
+// deactivated as well so its rules stop firing.
+func HandleDeleteScenario(scenarioManager *scenario.ScenarioManager, scenarioStore *store.ScenarioStore, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idParam := chi.URLParam(r, "id")
+		scenarioID, err := strconv.Atoi(idParam)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidID, "Invalid scenario ID")
+			return
+		}
 
-		// Return success response
-		w.Header().Set("Content-Type", "application/json")
+		// Delete and deactivate as one linearized operation so a concurrent
+		// activation of the same ID can't leave the deleted scenario active
+		var deactivated *models.Scenario
+		err = scenarioManager.RunExclusive(func() error {
+			if err := scenarioStore.DeleteScenario(scenarioID); err != nil {
+				return err
+			}
+			scenarioManager.InvalidateCachedScenario(scenarioID)
+			deactivated = scenarioManager.DeactivateStoredScenario(scenarioID)
+			return nil
+		})
+		if errors.Is(err, store.ErrScenarioNotFound) {
+			writeError(w, http.StatusNotFound, ErrCodeScenarioNotFound, "Scenario not found")
+			return
+		}
+		if err != nil {
+			logStore.LogAndStore("error", "Failed to delete scenario %d: %v", scenarioID, err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to delete scenario: "+err.Error())
+			return
+		}
+
+		if deactivated != nil {
+			logStore.LogAndStore("info", "Scenario deleted and deactivated: %s (ID: %d)", deactivated.Name, scenarioID)
+		} else {
+			logStore.LogAndStore("info", "Scenario deleted (ID: %d)", scenarioID)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleActivateScenario loads a scenario from the database and adds it to the active scenarios
+// An active scenario with the same name (e.g. another revision) is replaced. A scenario
+// parsed before is taken from the scenario manager's cache instead.
+func HandleActivateScenario(scenarioManager *scenario.ScenarioManager, scenarioStore *store.ScenarioStore, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idParam := chi.URLParam(r, "id")
+		scenarioID, err := strconv.Atoi(idParam)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidID, "Invalid scenario ID")
+			return
+		}
+
+		var loadedScenario *models.Scenario
+		status, code := http.StatusOK, ""
+		err = scenarioManager.RunExclusive(func() error {
+			parsed, cached := scenarioManager.CachedScenario(scenarioID)
+			if !cached {
+				stored, err := scenarioStore.GetScenarioByID(scenarioID)
+				if err != nil {
+					status, code = http.StatusNotFound, ErrCodeScenarioNotFound
+					return fmt.Errorf("Scenario not found")
+				}
+
+				// Parse scenario from YAML content and add it to the active scenarios
+				parsed, err = scenario.ParseScenario([]byte(stored.YAMLContent))
+				if err != nil {
+					logStore.LogAndStore("error", "Failed to load scenario from database: %v", err)
+					status, code = http.StatusInternalServerError, ErrCodeInternal
+					return fmt.Errorf("Failed to load scenario: %w", err)
+				}
+				scenarioManager.CacheScenario(scenarioID, parsed)
+			}
+
+			parsed.StoredID = scenarioID
+			scenarioManager.ActivateScenario(parsed)
+			loadedScenario = parsed
+			return nil
+		})
+		if err != nil {
+			writeError(w, status, code, err.Error())
+			return
+		}
+
+		logStore.LogAndStore("info", "Scenario activated: %s (ID: %d, %d rules)", loadedScenario.Name, scenarioID, len(loadedScenario.Rules))
+
+		// Return success response
+		w.Header().Set("Content-Type", "application/json")
 		response := ScenarioInfoResponse{
 			Name:  loadedScenario.Name,
 			Rules: len(loadedScenario.Rules),
 		}
 
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// HandleDeactivateScenario removes a scenario from the active scenarios
+// The stored scenario's name selects the active scenario to remove, so any revision's
+// ID deactivates whichever revision of that scenario is active.
+func HandleDeactivateScenario(scenarioManager *scenario.ScenarioManager, scenarioStore *store.ScenarioStore, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idParam := chi.URLParam(r, "id")
+		scenarioID, err := strconv.Atoi(idParam)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidID, "Invalid scenario ID")
+			return
+		}
+
+		var removed *models.Scenario
+		code := ""
+		err = scenarioManager.RunExclusive(func() error {
+			stored, err := scenarioStore.GetScenarioByID(scenarioID)
+			if err != nil {
+				code = ErrCodeScenarioNotFound
+				return fmt.Errorf("Scenario not found")
+			}
+
+			removed = scenarioManager.DeactivateScenario(stored.Name)
+			if removed == nil {
+				code = ErrCodeScenarioNotActive
+				return fmt.Errorf("Scenario %s is not active", stored.Name)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, http.StatusNotFound, code, err.Error())
+			return
+		}
+
+		logStore.LogAndStore("info", "Scenario deactivated: %s (ID: %d)", removed.Name, scenarioID)
+
+		w.Header().Set("Content-Type", "application/json")
+		response := ScenarioInfoResponse{
+			Name:  removed.Name,
+			Rules: len(removed.Rules),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// QueuedEventResponse represents a pending event in the event queue API response
+type QueuedEventResponse struct {
+	Source     string  `json:"source"`
+	Type       string  `json:"type"`
+	EventType  string  `json:"event_type"`
+	QueuedAt   string  `json:"queued_at"`
+	AgeSeconds float64 `json:"age_seconds"`
+}
+
+// EventQueueResponse represents the event queue contents in API response
+type EventQueueResponse struct {
+	Length int                   `json:"length"`
+	Paused bool                  `json:"paused"`
+	Events []QueuedEventResponse `json:"events"`
+}
+
+// toQueuedEventResponses converts queued events to their API representation
+func toQueuedEventResponses(events []queue.QueuedEvent) []QueuedEventResponse {
+	now := time.Now()
+	response := make([]QueuedEventResponse, len(events))
+	for i, e := range events {
+		response[i] = QueuedEventResponse{
+			Source:     e.SourceID,
+			Type:       e.Message.Type,
+			EventType:  e.Message.EventType,
+			QueuedAt:   e.Timestamp.Format("2006-01-02 15:04:05"),
+			AgeSeconds: now.Sub(e.Timestamp).Seconds(),
+		}
+	}
+	return response
+}
+
+// HandleGetEventQueue returns the events currently waiting in the event queue
+func HandleGetEventQueue(eventQueue *queue.EventQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		events := eventQueue.Snapshot()
+		response := EventQueueResponse{
+			Length: len(events),
+			Paused: eventQueue.IsPaused(),
+			Events: toQueuedEventResponses(events),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// HandleDrainEventQueue discards all pending events in the event queue
+// Each dropped event is logged so the drain can be reviewed afterwards
+func HandleDrainEventQueue(eventQueue *queue.EventQueue, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dropped := eventQueue.Drain()
+		for _, e := range dropped {
+			logStore.LogAndStore("warning", "Drained queued event from %s: %s (queued at %s)", e.SourceID, e.Message.EventType, e.Timestamp.Format("2006-01-02 15:04:05"))
+		}
+		logStore.LogAndStore("warning", "Event queue drained: %d events dropped", len(dropped))
+
+		w.Header().Set("Content-Type", "application/json")
+		response := EventQueueResponse{
+			Length: len(dropped),
+			Paused: eventQueue.IsPaused(),
+			Events: toQueuedEventResponses(dropped),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// RuleTestRequest is the body of a rule test request
+// The body is parsed as YAML, so both YAML and JSON bodies are accepted
+type RuleTestRequest struct {
+	Rule  models.Rule   `yaml:"rule"`
+	Event RuleTestEvent `yaml:"event"`
+}
+
+// RuleTestEvent is the sample event a rule is tested against
+type RuleTestEvent struct {
+	EventType string                 `yaml:"event_type"`
+	Source    string                 `yaml:"source"`
+	Payload   map[string]interface{} `yaml:"payload"`
+}
+
+// ActionResponse represents a rule action in API response
+type ActionResponse struct {
+	SendTo            string                 `json:"send_to"`
+	Command           string                 `json:"command"`
+	Params            map[string]interface{} `json:"params,omitempty"`
+	CompensateCommand string                 `json:"compensate_command,omitempty"`
+	CompensateParams  map[string]interface{} `json:"compensate_params,omitempty"`
+}
+
+// RuleTestResponse represents the result of testing a rule against an event
+type RuleTestResponse struct {
+	Matched bool             `json:"matched"`
+	Actions []ActionResponse `json:"actions"`
+}
+
+// HandleTestRule evaluates a single rule against a sample event
+// The rule is not loaded into the active scenario
+func HandleTestRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Failed to read request body: "+err.Error())
+			return
+		}
+
+		var req RuleTestRequest
+		if err := yaml.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Failed to parse request: "+err.Error())
+			return
+		}
+
+		if req.Rule.When.Join != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRule, "Join rules need several correlated events and cannot be tested against a single event")
+			return
+		}
+		if req.Rule.When.EventType == "" {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRule, "Rule must have when.event_type")
+			return
+		}
+		if err := scenario.ValidateConditions(req.Rule.When.Conditions); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRule, "Invalid when.conditions: "+err.Error())
+			return
+		}
+		if err := scenario.CompileEventPattern(&req.Rule.When); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRule, "Invalid when.event_type: "+err.Error())
+			return
+		}
+
+		event := models.Event{
+			Type:      "event",
+			EventType: req.Event.EventType,
+			Source:    req.Event.Source,
+			Payload:   req.Event.Payload,
+		}
+
+		response := RuleTestResponse{
+			Matched: scenario.MatchRule(req.Rule, event),
+			Actions: make([]ActionResponse, 0),
+		}
+		if response.Matched {
+			for _, action := range req.Rule.Then {
+				response.Actions = append(response.Actions, ActionResponse{
+					SendTo:            action.SendTo,
+					Command:           action.Command,
+					Params:            action.Params,
+					CompensateCommand: action.CompensateCommand,
+					CompensateParams:  action.CompensateParams,
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// EventQueueStateResponse represents the event queue delivery state in API response
+type EventQueueStateResponse struct {
+	Paused bool `json:"paused"`
+	Length int  `json:"length"`
+}
+
+// HandlePauseEventQueue stops delivering queued events to the processor
+// Events are still accepted while paused
+func HandlePauseEventQueue(eventQueue *queue.EventQueue, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !eventQueue.Pause() {
+			writeError(w, http.StatusConflict, ErrCodeQueueClosed, "Event queue is closed")
+			return
+		}
+		logStore.LogAndStore("warning", "Event queue paused (%d events pending)", eventQueue.GetQueueLength())
+
+		w.Header().Set("Content-Type", "application/json")
+		response := EventQueueStateResponse{
+			Paused: eventQueue.IsPaused(),
+			Length: eventQueue.GetQueueLength(),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// HandleResumeEventQueue resumes delivering queued events to the processor
+func HandleResumeEventQueue(eventQueue *queue.EventQueue, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventQueue.Resume()
+		logStore.LogAndStore("info", "Event queue resumed (%d events pending)", eventQueue.GetQueueLength())
+
+		w.Header().Set("Content-Type", "application/json")
+		response := EventQueueStateResponse{
+			Paused: eventQueue.IsPaused(),
+			Length: eventQueue.GetQueueLength(),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// SagaSummaryResponse represents a Saga in the Saga list API response
+type SagaSummaryResponse struct {
+	SagaID      string `json:"saga_id"`
+	Tenant      string `json:"tenant,omitempty"`
+	Status      string `json:"status"`
+	CurrentStep int    `json:"current_step"`
+	StepCount   int    `json:"step_count"`
+	CreatedAt   string `json:"created_at"`
+	ReplayOf    string `json:"replay_of,omitempty"`
+}
+
+// SagaStepResponse represents a Saga step in the Saga detail API response
+type SagaStepResponse struct {
+	StepID              int    `json:"step_id"`
+	TargetSimulation    string `json:"target_simulation"`
+	Command             string `json:"command"`
+	Status              string `json:"status"`
+	CreatedAt           string `json:"created_at"`
+	CompletedAt         string `json:"completed_at,omitempty"`
+	Breakpoint          bool   `json:"breakpoint,omitempty"`
+	CompensateOnPartial bool   `json:"compensate_on_partial,omitempty"`
+	Timeout             string `json:"timeout,omitempty"`           // Set in the scenario
+	EffectiveTimeout    string `json:"effective_timeout,omitempty"` // Applied at dispatch
+	ParallelGroup       int    `json:"parallel_group,omitempty"`    // Steps with the same group run together
+	ResultDiscarded     bool   `json:"result_discarded,omitempty"`
+}
+
+// SagaDetailResponse represents a single Saga with its steps in API response
+type SagaDetailResponse struct {
+	SagaSummaryResponse
+	Timeout        string             `json:"timeout,omitempty"`   // Time the Saga may take to finish
+	Deadline       string             `json:"deadline,omitempty"`  // When the Saga times out
+	Remaining      string             `json:"remaining,omitempty"` // Time left until the deadline, while Pending or InProgress
+	FailureReasons []string           `json:"failure_reasons,omitempty"`
+	Steps          []SagaStepResponse `json:"steps"`
+}
+
+// toSagaSummaryResponse converts a Saga snapshot to its list API representation
+func toSagaSummaryResponse(s saga.SagaSnapshot) SagaSummaryResponse {
+	return SagaSummaryResponse{
+		SagaID:      s.SagaID,
+		Tenant:      s.Tenant,
+		Status:      string(s.Status),
+		CurrentStep: s.CurrentStep,
+		StepCount:   len(s.Steps),
+		CreatedAt:   s.CreatedAt.Format("2006-01-02 15:04:05"),
+		ReplayOf:    s.ReplayOf,
+	}
+}
+
+// CompensationDeadLetterResponse represents a step needing manual rollback in API response
+type CompensationDeadLetterResponse struct {
+	SagaID            string                 `json:"saga_id"`
+	StepID            int                    `json:"step_id"`
+	Tenant            string                 `json:"tenant,omitempty"`
+	TargetSimulation  string                 `json:"target_simulation"`
+	CompensateCommand string                 `json:"compensate_command"`
+	CompensateParams  map[string]interface{} `json:"compensate_params,omitempty"`
+	Reason            string                 `json:"reason"`
+	Attempts          int                    `json:"attempts"`
+	Timestamp         string                 `json:"timestamp"`
+}
+
+// HandleGetCompensationDeadLetters returns the steps whose compensation failed for
+// good and need a manual rollback, oldest first
+func HandleGetCompensationDeadLetters(sagaManager *saga.SagaManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deadLetters := sagaManager.GetCompensationDeadLetters()
+		response := make([]CompensationDeadLetterResponse, len(deadLetters))
+		for i, entry := range deadLetters {
+			_, simID := registry.SplitKey(entry.TargetSimulation)
+			response[i] = CompensationDeadLetterResponse{
+				SagaID:            entry.SagaID,
+				StepID:            entry.StepID,
+				Tenant:            entry.Tenant,
+				TargetSimulation:  simID,
+				CompensateCommand: entry.CompensateCommand,
+				CompensateParams:  entry.CompensateParams,
+				Reason:            entry.Reason,
+				Attempts:          entry.Attempts,
+				Timestamp:         entry.Timestamp.Format(time.RFC3339Nano),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// HandleGetSagas returns all Sagas, oldest first
+func HandleGetSagas(sagaManager *saga.SagaManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// The concurrency limit travels in headers so the body stays a plain list
+		limit, active := sagaManager.ConcurrencyLimit()
+		w.Header().Set("X-Saga-Active-Count", strconv.Itoa(active))
+		w.Header().Set("X-Saga-Limit", strconv.Itoa(limit))
+
+		sagas := sagaManager.GetAllSagas()
+		snapshots := make([]saga.SagaSnapshot, 0, len(sagas))
+		for _, s := range sagas {
+			snapshots = append(snapshots, s.Snapshot())
+		}
+		sort.Slice(snapshots, func(i, j int) bool {
+			if !snapshots[i].CreatedAt.Equal(snapshots[j].CreatedAt) {
+				return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+			}
+			return snapshots[i].SagaID < snapshots[j].SagaID
+		})
+
+		response := make([]SagaSummaryResponse, len(snapshots))
+		for i, s := range snapshots {
+			response[i] = toSagaSummaryResponse(s)
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// HandleGetSaga returns a single Saga with the state of each of its steps
+func HandleGetSaga(sagaManager *saga.SagaManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, exists := sagaManager.GetSaga(chi.URLParam(r, "id"))
+		if !exists {
+			writeError(w, http.StatusNotFound, ErrCodeSagaNotFound, "Saga not found")
+			return
+		}
+		snapshot := s.Snapshot()
+
+		response := SagaDetailResponse{
+			SagaSummaryResponse: toSagaSummaryResponse(snapshot),
+			FailureReasons:      snapshot.FailureReasons,
+			Steps:               make([]SagaStepResponse, len(snapshot.Steps)),
+		}
+		if snapshot.Timeout > 0 {
+			deadline := snapshot.CreatedAt.Add(snapshot.Timeout)
+			response.Timeout = snapshot.Timeout.String()
+			response.Deadline = deadline.Format("2006-01-02 15:04:05")
+			// The deadline stops applying once the Saga compensates or finishes
+			if snapshot.Status == saga.SagaStatusPending || snapshot.Status == saga.SagaStatusInProgress {
+				response.Remaining = max(time.Until(deadline), 0).Round(time.Second).String()
+			}
+		}
+		for i, step := range snapshot.Steps {
+			// Targets are registry keys; the Saga's tenant is reported once above
+			_, simID := registry.SplitKey(step.TargetSimulation)
+			stepResponse := SagaStepResponse{
+				StepID:              step.StepID,
+				TargetSimulation:    simID,
+				Command:             step.Command,
+				Status:              string(step.Status),
+				CreatedAt:           step.CreatedAt.Format("2006-01-02 15:04:05"),
+				Breakpoint:          step.Breakpoint,
+				CompensateOnPartial: step.CompensateOnPartial,
+				ParallelGroup:       step.ParallelGroup,
+				ResultDiscarded:     step.ResultDiscarded,
+			}
+			if step.CompletedAt != nil {
+				stepResponse.CompletedAt = step.CompletedAt.Format("2006-01-02 15:04:05")
+			}
+			if step.Timeout > 0 {
+				stepResponse.Timeout = step.Timeout.String()
+			}
+			if step.EffectiveTimeout > 0 {
+				stepResponse.EffectiveTimeout = step.EffectiveTimeout.String()
+			}
+			response.Steps[i] = stepResponse
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// SagaReplayResponse represents the Saga started by a replay in API response
+type SagaReplayResponse struct {
+	SagaID   string `json:"saga_id"`
+	ReplayOf string `json:"replay_of"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HandleReplaySaga starts a new Saga with the same steps and params as a finished one
+func HandleReplaySaga(sagaManager *saga.SagaManager, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sagaID := chi.URLParam(r, "id")
+		replay, err := sagaManager.ReplaySaga(sagaID)
+		if replay == nil {
+			switch {
+			case errors.Is(err, saga.ErrSagaNotFound):
+				writeError(w, http.StatusNotFound, ErrCodeSagaNotFound, "Saga not found")
+			case errors.Is(err, saga.ErrSagaLimitReached):
+				writeError(w, http.StatusTooManyRequests, ErrCodeSagaLimitReached, fmt.Sprintf("Failed to replay saga: %v", err))
+			default:
+				// Not finished yet, a target isn't connected, its simulations are busy in other
+				// Sagas, or it breaks the Saga size limits
+				writeError(w, http.StatusConflict, ErrCodeSagaConflict, fmt.Sprintf("Failed to replay saga: %v", err))
+			}
+			return
+		}
+
+		// The replay Saga exists even if its first step couldn't be dispatched;
+		// report it so the failure can be inspected
+		response := SagaReplayResponse{
+			SagaID:   replay.SagaID,
+			ReplayOf: replay.ReplayOf,
+			Status:   string(replay.GetStatus()),
+		}
+		if err != nil {
+			response.Error = err.Error()
+			logStore.LogAndStore("error", "Replay %s of saga %s failed to start: %v", replay.SagaID, sagaID, err)
+		} else {
+			logStore.LogAndStore("info", "Saga %s replayed as %s", sagaID, replay.SagaID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// SagaStepResumeResponse represents a resumed Saga step in API response
+type SagaStepResumeResponse struct {
+	SagaID string `json:"saga_id"`
+	StepID int    `json:"step_id"`
+	Status string `json:"status"`
+}
+
+// HandleResumeSagaStep dispatches a Saga step that is paused at a breakpoint
+func HandleResumeSagaStep(sagaManager *saga.SagaManager, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sagaID := chi.URLParam(r, "id")
+		stepID, err := strconv.Atoi(chi.URLParam(r, "step"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidID, "Invalid step ID")
+			return
+		}
+
+		if err := sagaManager.ResumeStep(sagaID, stepID); err != nil {
+			switch {
+			case errors.Is(err, saga.ErrSagaNotFound):
+				writeError(w, http.StatusNotFound, ErrCodeSagaNotFound, "Saga not found")
+			case errors.Is(err, saga.ErrStepNotPaused):
+				writeError(w, http.StatusConflict, ErrCodeSagaConflict, err.Error())
+			default:
+				// The step was resumed but could not be sent; the Saga has failed
+				logStore.LogAndStore("error", "Saga %s step %d failed after resuming from breakpoint: %v", sagaID, stepID, err)
+				writeError(w, http.StatusBadGateway, ErrCodeSendFailed, fmt.Sprintf("Failed to dispatch step: %v", err))
+			}
+			return
+		}
+		logStore.LogAndStore("info", "Saga %s resumed at breakpoint, step %d dispatched", sagaID, stepID)
+
+		s, _ := sagaManager.GetSaga(sagaID)
+		w.Header().Set("Content-Type", "application/json")
+		response := SagaStepResumeResponse{
+			SagaID: sagaID,
+			StepID: stepID,
+			Status: string(s.GetStatus()),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// SagaCancelResponse represents a cancelled Saga in API response
+type SagaCancelResponse struct {
+	SagaID string `json:"saga_id"`
+	Status string `json:"status"` // Cancelling while compensations run, then Cancelled
+}
+
+// HandleCancelSaga cancels an in-progress Saga and compensates its completed steps
+func HandleCancelSaga(sagaManager *saga.SagaManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sagaID := chi.URLParam(r, "id")
+		if err := sagaManager.CancelSaga(sagaID); err != nil {
+			switch {
+			case errors.Is(err, saga.ErrSagaNotFound):
+				writeError(w, http.StatusNotFound, ErrCodeSagaNotFound, "Saga not found")
+			case errors.Is(err, saga.ErrSagaNotCancellable):
+				writeError(w, http.StatusConflict, ErrCodeSagaConflict, err.Error())
+			default:
+				writeError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Failed to cancel saga: %v", err))
+			}
+			return
+		}
+
+		s, _ := sagaManager.GetSaga(sagaID)
+		w.Header().Set("Content-Type", "application/json")
+		response := SagaCancelResponse{
+			SagaID: sagaID,
+			Status: string(s.GetStatus()),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// RuntimeConfigResponse represents the hot-reloadable configuration in API response
+type RuntimeConfigResponse struct {
+	EventProcessingTimeout       string  `json:"event_processing_timeout"`
+	EventEnqueueTimeout          string  `json:"event_enqueue_timeout"`
+	EventDedupeTTL               string  `json:"event_dedupe_ttl"`
+	EventDedupeSize              int     `json:"event_dedupe_size"`
+	EventRateLimit               float64 `json:"event_rate_limit"`
+	EventRateBurst               int     `json:"event_rate_burst"`
+	UnmatchedEventsSize          int     `json:"unmatched_events_size"`
+	ScenarioCacheSize            int     `json:"scenario_cache_size"`
+	StepTimeout                  string  `json:"step_timeout"`
+	StepTimeoutMin               string  `json:"step_timeout_min"`
+	StepTimeoutMax               string  `json:"step_timeout_max"`
+	StepTimeoutLatencyMultiplier float64 `json:"step_timeout_latency_multiplier"`
+	CommandAckTimeout            string  `json:"command_ack_timeout"`
+	CompensationTimeout          string  `json:"compensation_timeout"`
+	CompensationRetries          int     `json:"compensation_retries"`
+	CompensationRetryDelay       string  `json:"compensation_retry_delay"`
+	CompensationDeadLetterSize   int     `json:"compensation_dead_letter_size"`
+	SagaTimeout                  string  `json:"saga_timeout"`
+	MaxConcurrentSagas           int     `json:"max_concurrent_sagas"`
+	SagaLimitWait                string  `json:"saga_limit_wait"`
+	MaxSagaSteps                 int     `json:"max_saga_steps"`
+	AllowDuplicateSagaTargets    bool    `json:"allow_duplicate_saga_targets"`
+	StepResultMaxBytes           int     `json:"step_result_max_bytes"`
+	FanOutWarningRules           int     `json:"fanout_warning_rules"`
+	FanOutWarningActions         int     `json:"fanout_warning_actions"`
+	LateCompletionPolicy         string  `json:"late_completion_policy"`
+	ParamTemplateStrict          bool    `json:"param_template_strict"`
+	ReconnectTokenTTL            string  `json:"reconnect_token_ttl"`
+	ShutdownMessageType          string  `json:"shutdown_message_type"`
+	ShutdownCommand              string  `json:"shutdown_command"`
+	ShutdownMessage              string  `json:"shutdown_message"`
+	ShutdownBroadcastTimeout     string  `json:"shutdown_broadcast_timeout"`
+	ShutdownGracePeriod          string  `json:"shutdown_grace_period"`
+}
+
+// HandleReloadConfig re-reads the environment (.env included) and swaps in the new
+// hot-reloadable configuration, returning the configuration now in effect
+func HandleReloadConfig(configStore *config.Store, logStore *logging.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg, err := configStore.Reload()
+		if err != nil {
+			logStore.LogAndStore("error", "Configuration reload failed, keeping current configuration: %v", err)
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidConfig, fmt.Sprintf("Failed to reload configuration: %v", err))
+			return
+		}
+		logStore.LogAndStore("info", "Configuration reloaded (API)")
+
+		w.Header().Set("Content-Type", "application/json")
+		response := RuntimeConfigResponse{
+			EventProcessingTimeout:       cfg.EventProcessingTimeout.String(),
+			EventEnqueueTimeout:          cfg.EventEnqueueTimeout.String(),
+			EventDedupeTTL:               cfg.EventDedupeTTL.String(),
+			EventDedupeSize:              cfg.EventDedupeSize,
+			EventRateLimit:               cfg.EventRateLimit,
+			EventRateBurst:               cfg.EventRateBurst,
+			UnmatchedEventsSize:          cfg.UnmatchedEventsSize,
+			ScenarioCacheSize:            cfg.ScenarioCacheSize,
+			StepTimeout:                  cfg.StepTimeout.String(),
+			StepTimeoutMin:               cfg.StepTimeoutMin.String(),
+			StepTimeoutMax:               cfg.StepTimeoutMax.String(),
+			StepTimeoutLatencyMultiplier: cfg.StepTimeoutLatencyMultiplier,
+			CommandAckTimeout:            cfg.CommandAckTimeout.String(),
+			CompensationTimeout:          cfg.CompensationTimeout.String(),
+			CompensationRetries:          cfg.CompensationRetries,
+			CompensationRetryDelay:       cfg.CompensationRetryDelay.String(),
+			CompensationDeadLetterSize:   cfg.CompensationDeadLetterSize,
+			SagaTimeout:                  cfg.SagaTimeout.String(),
+			MaxConcurrentSagas:           cfg.MaxConcurrentSagas,
+			SagaLimitWait:                cfg.SagaLimitWait.String(),
+			MaxSagaSteps:                 cfg.MaxSagaSteps,
+			AllowDuplicateSagaTargets:    cfg.AllowDuplicateSagaTargets,
+			StepResultMaxBytes:           cfg.StepResultMaxBytes,
+			FanOutWarningRules:           cfg.FanOutWarningRules,
+			FanOutWarningActions:         cfg.FanOutWarningActions,
+			LateCompletionPolicy:         cfg.LateCompletionPolicy,
+			ParamTemplateStrict:          cfg.ParamTemplateStrict,
+			ReconnectTokenTTL:            cfg.ReconnectTokenTTL.String(),
+			ShutdownMessageType:          cfg.ShutdownMessageType,
+			ShutdownCommand:              cfg.ShutdownCommand,
+			ShutdownMessage:              cfg.ShutdownMessage,
+			ShutdownBroadcastTimeout:     cfg.ShutdownBroadcastTimeout.String(),
+			ShutdownGracePeriod:          cfg.ShutdownGracePeriod.String(),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
 			return
 		}
 	}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestScenarioStore opens a scenario store on a new SQLite database
+func newTestScenarioStore(t *testing.T) *store.ScenarioStore {
+	t.Helper()
+	ss, err := store.NewScenarioStore(filepath.Join(t.TempDir(), "scenarios.db"))
+	if err != nil {
+		t.Fatalf("NewScenarioStore: %v", err)
+	}
+	t.Cleanup(func() { ss.Close() })
+	return ss
+}
+
+// scenarioYAML is a minimal valid scenario with the given name
+func scenarioYAML(name string) string {
+	return fmt.Sprintf(`scenario:
+  name: %q
+  rules:
+    - when:
+        event_type: "ping"
+      then:
+        - send_to: "sim"
+          command: "pong"
+`, name)
+}
+
+// serve sends a request to handler and returns the recorded response
+func serve(handler http.Handler, method, target, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// assertError checks that rec is an API error with the given status and code
+func assertError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, status, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var body ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not an ErrorResponse: %v", rec.Body.String(), err)
+	}
+	if body.Error.Code != code || body.Error.Message == "" {
+		t.Fatalf("error = %+v, want code %q with a message", body.Error, code)
+	}
+}
+
+func TestHandleUpdateScenario(t *testing.T) {
+	scenarioManager := scenario.NewScenarioManager()
+	scenarioStore := newTestScenarioStore(t)
+	router := chi.NewRouter()
+	router.Put("/scenarios/{id}", HandleUpdateScenario(scenarioManager, scenarioStore, logging.NewLogStore(100)))
+
+	id, err := scenarioStore.SaveScenario("first", scenarioYAML("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := scenarioStore.GetScenarioByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(router, http.MethodPut, fmt.Sprintf("/scenarios/%d", id), "application/yaml", scenarioYAML("renamed"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	var response StoredScenarioResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.ID != id || response.Name != "renamed" || response.CreatedAt != before.CreatedAt.Format("2006-01-02 15:04:05") {
+		t.Fatalf("response = %+v, want ID %d, renamed, created %v", response, id, before.CreatedAt)
+	}
+	after, err := scenarioStore.GetScenarioByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.YAMLContent != scenarioYAML("renamed") || !after.CreatedAt.Equal(before.CreatedAt) {
+		t.Fatalf("stored scenario = %+v, want the new YAML and created_at %v", after, before.CreatedAt)
+	}
+}
+
+func TestHandleUpdateScenarioErrors(t *testing.T) {
+	scenarioManager := scenario.NewScenarioManager()
+	scenarioStore := newTestScenarioStore(t)
+	if err := scenarioStore.SetUniqueNames(true); err != nil {
+		t.Fatal(err)
+	}
+	router := chi.NewRouter()
+	router.Put("/scenarios/{id}", HandleUpdateScenario(scenarioManager, scenarioStore, logging.NewLogStore(100)))
+
+	if _, err := scenarioStore.SaveScenario("taken", scenarioYAML("taken")); err != nil {
+		t.Fatal(err)
+	}
+	id, err := scenarioStore.SaveScenario("other", scenarioYAML("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+		code   string
+	}{
+		{name: "not found", target: "/scenarios/9999", body: scenarioYAML("missing"), status: http.StatusNotFound, code: ErrCodeScenarioNotFound},
+		{name: "name taken", target: fmt.Sprintf("/scenarios/%d", id), body: scenarioYAML("taken"), status: http.StatusConflict, code: ErrCodeScenarioNameTaken},
+		{name: "invalid ID", target: "/scenarios/abc", body: scenarioYAML("other"), status: http.StatusBadRequest, code: ErrCodeInvalidID},
+		{name: "invalid YAML", target: fmt.Sprintf("/scenarios/%d", id), body: "scenario: [", status: http.StatusBadRequest, code: ErrCodeInvalidYAML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(router, http.MethodPut, tt.target, "application/yaml", tt.body)
+			assertError(t, rec, tt.status, tt.code)
+		})
+	}
+
+	// None of the refused updates changed the stored scenario
+	s, err := scenarioStore.GetScenarioByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "other" || s.YAMLContent != scenarioYAML("other") {
+		t.Fatalf("refused updates changed the scenario to %+v", s)
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
+)
+
+/*
+Health Probes
+
+/healthz (liveness) and /readyz (readiness) are meant for Kubernetes probes. Both run
+the same checks: the scenario database answers a ping, and the event queue processor
+is running. Either answers 200 when every check passes and 503 otherwise, with the
+result of each check as JSON.
+
+/readyz also reports the number of connected simulations and the active scenarios.
+These are informational and never make the server unready: simulations connect and
+scenarios are uploaded through the server itself, so it must take traffic without them.
+
+The database ping is bounded by healthCheckTimeout, so a hung database fails the probe
+instead of hanging it.
+*/
+
+// healthCheckTimeout bounds the database ping of a health probe
+const healthCheckTimeout = 2 * time.Second
+
+// Health check results
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// HealthResponse is the /healthz response
+type HealthResponse struct {
+	Status string            `json:"status"` // "ok" or "unavailable"
+	Checks map[string]string `json:"checks"` // Check name -> "ok" or what failed
+}
+
+// ReadinessResponse is the /readyz response
+type ReadinessResponse struct {
+	HealthResponse
+	Simulations      int      `json:"simulations"`
+	ScenarioLoaded   bool     `json:"scenario_loaded"`
+	ActiveScenarios  []string `json:"active_scenarios"`
+	EventQueuePaused bool     `json:"event_queue_paused"`
+}
+
+// HandleHealthz reports whether the database and the event queue processor are up
+func HandleHealthz(scenarioStore *store.ScenarioStore, eventQueue *queue.EventQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health := runHealthChecks(r.Context(), scenarioStore, eventQueue)
+		writeHealth(w, health, health)
+	}
+}
+
+// HandleReadyz runs the /healthz checks and also reports connected simulations and
+// loaded scenarios
+func HandleReadyz(scenarioStore *store.ScenarioStore, eventQueue *queue.EventQueue, reg *registry.Registry, scenarioManager *scenario.ScenarioManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		active := scenarioManager.ListActive()
+		response := ReadinessResponse{
+			HealthResponse:   runHealthChecks(r.Context(), scenarioStore, eventQueue),
+			Simulations:      reg.Count(),
+			ScenarioLoaded:   len(active) > 0,
+			ActiveScenarios:  make([]string, len(active)),
+			EventQueuePaused: eventQueue.IsPaused(),
+		}
+		for i, s := range active {
+			response.ActiveScenarios[i] = s.Name
+		}
+		writeHealth(w, response.HealthResponse, response)
+	}
+}
+
+// runHealthChecks runs the liveness checks
+func runHealthChecks(ctx context.Context, scenarioStore *store.ScenarioStore, eventQueue *queue.EventQueue) HealthResponse {
+	response := HealthResponse{Status: healthOK, Checks: make(map[string]string)}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if err := scenarioStore.Ping(ctx); err != nil {
+		response.Status = healthUnavailable
+		response.Checks["database"] = err.Error()
+	} else {
+		response.Checks["database"] = healthOK
+	}
+
+	if !eventQueue.Running() {
+		response.Status = healthUnavailable
+		response.Checks["event_queue"] = "processor not running"
+	} else {
+		response.Checks["event_queue"] = healthOK
+	}
+
+	return response
+}
+
+// writeHealth writes a probe response: 200 if health is ok, 503 otherwise
+func writeHealth(w http.ResponseWriter, health HealthResponse, response interface{}) {
+	status := http.StatusOK
+	if health.Status != healthOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlContentTypes are the declared part content types accepted for scenario uploads
+// Clients label YAML inconsistently, and many (curl, some browsers) send
+// application/octet-stream or nothing for .yaml files, so those are accepted too;
+// the content itself is always checked by checkTextContent.
+var yamlContentTypes = map[string]bool{
+	"application/yaml":         true,
+	"application/x-yaml":       true,
+	"text/yaml":                true,
+	"text/x-yaml":              true,
+	"text/plain":               true,
+	"application/octet-stream": true,
+}
+
+// maxScenarioSize is the largest scenario accepted in a request, in bytes
+const maxScenarioSize = 10 << 20
+
+// yamlBodyContentTypes are the request content types of a raw YAML scenario body
+var yamlBodyContentTypes = map[string]bool{
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+	"text/x-yaml":        true,
+}
+
+// ScenarioJSONRequest represents a scenario sent as a JSON body
+// Name is optional; if set, it must match the name in the YAML.
+type ScenarioJSONRequest struct {
+	Name string `json:"name,omitempty"`
+	YAML string `json:"yaml"`
+}
+
+// readScenarioFile reads and checks the scenario of an upload, update or validation
+// request, sent as any of:
+// - a multipart form with the file in field "scenario" (the browser UI)
+// - a raw YAML body (Content-Type application/x-yaml, text/yaml or similar)
+// - a JSON body (Content-Type application/json, see ScenarioJSONRequest)
+// On failure the error response has been written and false is returned.
+func readScenarioFile(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case yamlBodyContentTypes[mediaType]:
+		return readScenarioBody(w, r)
+	case mediaType == "application/json":
+		return readScenarioJSON(w, r)
+	default:
+		return readScenarioForm(w, r)
+	}
+}
+
+// readScenarioForm reads the scenario file of a multipart request (field "scenario")
+func readScenarioForm(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	// Parse multipart form (max 10MB)
+	if err := r.ParseMultipartForm(maxScenarioSize); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidFile, "Failed to parse form: "+err.Error())
+		return nil, false
+	}
+
+	// Get the file from form
+	file, header, err := r.FormFile("scenario")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidFile, "No file uploaded or invalid form field: "+err.Error())
+		return nil, false
+	}
+	defer file.Close()
+
+	// Check file extension
+	filename := strings.ToLower(header.Filename)
+	if !strings.HasSuffix(filename, ".yaml") && !strings.HasSuffix(filename, ".yml") {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidFile, "File must be a YAML file (.yaml or .yml)")
+		return nil, false
+	}
+
+	// Read file content
+	fileBytes, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to read file: "+err.Error())
+		return nil, false
+	}
+
+	// Reject binary or mislabeled files with a clear error instead of a YAML parse error
+	if err := validateScenarioUpload(header, fileBytes); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidFile, "File must be a YAML text file: "+err.Error())
+		return nil, false
+	}
+
+	return fileBytes, true
+}
+
+// readScenarioBody reads a scenario sent as the raw request body
+func readScenarioBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxScenarioSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Failed to read request body: "+err.Error())
+		return nil, false
+	}
+	if err := checkTextContent(content); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidYAML, "Body must be YAML text: "+err.Error())
+		return nil, false
+	}
+	return content, true
+}
+
+// readScenarioJSON reads a scenario sent as a JSON body
+func readScenarioJSON(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	var req ScenarioJSONRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxScenarioSize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return nil, false
+	}
+
+	content := []byte(req.YAML)
+	if err := checkTextContent(content); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidYAML, "yaml must be YAML text: "+err.Error())
+		return nil, false
+	}
+	if req.Name != "" {
+		// The stored name always comes from the YAML, so a different name is a mistake;
+		// YAML that can't be read is left for the parser to report
+		var doc struct {
+			Scenario struct {
+				Name string `yaml:"name"`
+			} `yaml:"scenario"`
+		}
+		if yaml.Unmarshal(content, &doc) == nil && doc.Scenario.Name != req.Name {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("name %q does not match the scenario's name %q", req.Name, doc.Scenario.Name))
+			return nil, false
+		}
+	}
+	return content, true
+}
+
+// validateScenarioUpload rejects uploads that can't be YAML before they reach the parser
+// It checks the multipart part's declared content type and sniffs the content, since a
+// renamed binary file still gets a YAML content type from most clients.
+func validateScenarioUpload(header *multipart.FileHeader, content []byte) error {
+	if declared := header.Header.Get("Content-Type"); declared != "" {
+		mediaType, _, err := mime.ParseMediaType(declared)
+		if err != nil {
+			return fmt.Errorf("invalid content type %q", declared)
+		}
+		if !yamlContentTypes[mediaType] && !strings.HasPrefix(mediaType, "text/") {
+			return fmt.Errorf("content type %s is not YAML", mediaType)
+		}
+	}
+
+	return checkTextContent(content)
+}
+
+// checkTextContent reports an error if content doesn't look like a UTF-8 text file
+func checkTextContent(content []byte) error {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return fmt.Errorf("file is empty")
+	}
+	if bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content) {
+		return fmt.Errorf("file is not UTF-8 text")
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
+)
+
+// ValidationIssueResponse represents one problem found in a scenario
+// Rule and Action are the indexes of the rule and action it concerns, if any.
+type ValidationIssueResponse struct {
+	Rule    *int   `json:"rule,omitempty"`
+	Action  *int   `json:"action,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationTargetResponse represents a simulation a scenario sends commands to
+type ValidationTargetResponse struct {
+	ID         string   `json:"id"`
+	Registered bool     `json:"registered"`
+	Commands   []string `json:"commands"`
+}
+
+// ScenarioValidationResponse represents the dry-run report of a scenario
+type ScenarioValidationResponse struct {
+	Name     string                     `json:"name,omitempty"`
+	Valid    bool                       `json:"valid"` // No errors
+	Targets  []ValidationTargetResponse `json:"targets"`
+	Errors   []ValidationIssueResponse  `json:"errors"`
+	Warnings []ValidationIssueResponse  `json:"warnings"`
+}
+
+// HandleValidateScenario checks a scenario without activating or storing it
+// The scenario is either uploaded (multipart field "scenario", as for an upload) or a
+// stored one (?id=). Besides the static checks of scenario.ValidateScenario, it reports
+// targets that aren't connected and commands a connected target doesn't advertise.
+// A scenario that fails to parse is reported with valid=false rather than an HTTP error.
+func HandleValidateScenario(reg *registry.Registry, scenarioStore *store.ScenarioStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var content []byte
+		if idParam := r.URL.Query().Get("id"); idParam != "" {
+			scenarioID, err := strconv.Atoi(idParam)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidID, "Invalid scenario ID")
+				return
+			}
+			stored, err := scenarioStore.GetScenarioByID(scenarioID)
+			if errors.Is(err, store.ErrScenarioNotFound) {
+				writeError(w, http.StatusNotFound, ErrCodeScenarioNotFound, "Scenario not found")
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to load scenario: "+err.Error())
+				return
+			}
+			content = []byte(stored.YAMLContent)
+		} else {
+			var ok bool
+			if content, ok = readScenarioFile(w, r); !ok {
+				return
+			}
+		}
+
+		response := ScenarioValidationResponse{
+			Targets:  make([]ValidationTargetResponse, 0),
+			Errors:   make([]ValidationIssueResponse, 0),
+			Warnings: make([]ValidationIssueResponse, 0),
+		}
+
+		parsed, err := scenario.ParseScenario(content)
+		if err != nil {
+			response.Errors = append(response.Errors, ValidationIssueResponse{Message: err.Error()})
+		} else {
+			response.Name = parsed.Name
+			report := scenario.ValidateScenario(parsed)
+			response.Errors = append(response.Errors, issueResponses(report.Errors)...)
+			response.Warnings = append(response.Warnings, issueResponses(report.Warnings)...)
+
+			for _, target := range report.Targets {
+				sims := findTargets(reg, parsed.Tenant, target.ID)
+				response.Targets = append(response.Targets, ValidationTargetResponse{
+					ID:         target.ID,
+					Registered: len(sims) > 0,
+					Commands:   target.Commands,
+				})
+				if len(sims) == 0 {
+					response.Warnings = append(response.Warnings, ValidationIssueResponse{
+						Message: fmt.Sprintf("simulation %s is not connected", target.ID),
+					})
+				}
+				for _, sim := range sims {
+					key := registry.Key(sim.Tenant, sim.ID)
+					for _, command := range target.Commands {
+						if !sim.Supports(command) {
+							response.Errors = append(response.Errors, ValidationIssueResponse{
+								Message: fmt.Sprintf("simulation %s does not handle command %s", key, command),
+							})
+						}
+					}
+					for _, command := range target.CompensateCommands {
+						if !sim.Supports(command) {
+							response.Warnings = append(response.Warnings, ValidationIssueResponse{
+								Message: fmt.Sprintf("simulation %s does not handle compensate_command %s", key, command),
+							})
+						}
+					}
+				}
+			}
+		}
+		response.Valid = len(response.Errors) == 0
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+			return
+		}
+	}
+}
+
+// issueResponses converts scenario validation issues, dropping the -1 indexes
+func issueResponses(issues []scenario.ValidationIssue) []ValidationIssueResponse {
+	responses := make([]ValidationIssueResponse, 0, len(issues))
+	for _, issue := range issues {
+		response := ValidationIssueResponse{Message: issue.Message}
+		if issue.Rule >= 0 {
+			rule := issue.Rule
+			response.Rule = &rule
+		}
+		if issue.Action >= 0 {
+			action := issue.Action
+			response.Action = &action
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+// findTargets returns the connected simulations a scenario's send_to may reach
+// A tenant scenario only reaches its tenant's simulation; a scenario for all tenants
+// reaches the simulation with that ID in whichever tenant the event comes from.
+func findTargets(reg *registry.Registry, tenant, id string) []*models.Simulation {
+	if tenant != "" {
+		if sim, exists := reg.Get(registry.Key(tenant, id)); exists {
+			return []*models.Simulation{sim}
+		}
+		return nil
+	}
+
+	var sims []*models.Simulation
+	for _, sim := range reg.GetAll() {
+		if sim.ID == id {
+			sims = append(sims, sim)
+		}
+	}
+	return sims
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"strings"
+)
+
+/*
+Bearer Token Authentication
+
+When tokens are configured (AUTH_TOKENS), every /api request must present one in an
+`Authorization: Bearer <token>` header, and every /ws connection before it is upgraded.
+Browsers can't set headers on a WebSocket handshake, so a simulation may instead pass
+the token as the `token` query parameter or as the subprotocol pair `bearer, <token>`
+(the server then answers with the `bearer` subprotocol).
+
+Authentication is opt-in: with no tokens configured every request is allowed, as before.
+CORS preflight (OPTIONS) requests never carry credentials; they are answered by the
+CORS middleware (see api/cors.go) before they reach this one.
+*/
+
+// BearerSubprotocol is the WebSocket subprotocol that precedes a token in Sec-WebSocket-Protocol
+const BearerSubprotocol = "bearer"
+
+// Tokens is the set of accepted bearer tokens; an empty set disables authentication
+type Tokens struct {
+	tokens [][]byte
+}
+
+// ParseTokens parses a comma-separated token list, ignoring blanks
+func ParseTokens(list string) *Tokens {
+	t := &Tokens{}
+	for _, token := range strings.Split(list, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			t.tokens = append(t.tokens, []byte(token))
+		}
+	}
+	return t
+}
+
+// Enabled reports whether any token is configured (false for a nil Tokens)
+func (t *Tokens) Enabled() bool {
+	return t != nil && len(t.tokens) > 0
+}
+
+// Valid reports whether token is one of the configured tokens
+// Every token is compared in constant time, so timing doesn't reveal a near match.
+func (t *Tokens) Valid(token string) bool {
+	valid := 0
+	for _, accepted := range t.tokens {
+		valid |= subtle.ConstantTimeCompare([]byte(token), accepted)
+	}
+	return valid == 1
+}
+
+// Allow reports whether the request may proceed: authentication is disabled, or the
+// request carries a valid token in its Authorization header
+func (t *Tokens) Allow(r *http.Request) bool {
+	if !t.Enabled() {
+		return true
+	}
+	token, ok := bearerToken(r)
+	return ok && t.Valid(token)
+}
+
+// AllowWebSocket is Allow for a WebSocket handshake, which may also carry the token as
+// the token query parameter or the bearer subprotocol
+// usedSubprotocol is true when the token came from the subprotocol; the upgrade must
+// then select BearerSubprotocol, or browsers abort the connection.
+func (t *Tokens) AllowWebSocket(r *http.Request) (allowed, usedSubprotocol bool) {
+	if !t.Enabled() {
+		return true, false
+	}
+	if token, ok := bearerToken(r); ok {
+		return t.Valid(token), false
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		return t.Valid(token), false
+	}
+	if token, ok := subprotocolToken(r); ok {
+		return t.Valid(token), true
+	}
+	return false, false
+}
+
+// Middleware rejects requests without a valid token with 401 Unauthorized and an
+// "unauthorized" error body
+// Does nothing while authentication is disabled.
+func (t *Tokens) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !t.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !t.Allow(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="orchestrator"`)
+			// Same body as every other /api error (see api/errors.go)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":{"code":"unauthorized","message":"Unauthorized"}}`+"\n")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bearerToken returns the token of an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// subprotocolToken returns the token following the bearer subprotocol in
+// Sec-WebSocket-Protocol ("bearer, <token>")
+func subprotocolToken(r *http.Request) (string, bool) {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocols = append(protocols, strings.TrimSpace(protocol))
+		}
+	}
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == BearerSubprotocol && protocols[i+1] != "" {
+			return protocols[i+1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTokens(t *testing.T) {
+	tokens := ParseTokens(" a, ,b ,")
+	if !tokens.Enabled() || !tokens.Valid("a") || !tokens.Valid("b") || tokens.Valid("") || tokens.Valid(" a") {
+		t.Fatal("tokens not parsed as [a b]")
+	}
+	if ParseTokens("").Enabled() || ParseTokens(" , ").Enabled() {
+		t.Fatal("empty token list enables authentication")
+	}
+	var none *Tokens
+	if none.Enabled() {
+		t.Fatal("nil Tokens enables authentication")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		tokens        string
+		authorization string
+		want          int
+	}{
+		{name: "disabled", tokens: "", want: http.StatusOK},
+		{name: "disabled ignores a token", tokens: "", authorization: "Bearer anything", want: http.StatusOK},
+		{name: "valid", tokens: "secret,other", authorization: "Bearer other", want: http.StatusOK},
+		{name: "scheme is case-insensitive", tokens: "secret", authorization: "bearer secret", want: http.StatusOK},
+		{name: "invalid", tokens: "secret", authorization: "Bearer wrong", want: http.StatusUnauthorized},
+		{name: "missing", tokens: "secret", want: http.StatusUnauthorized},
+		{name: "other scheme", tokens: "secret", authorization: "Basic secret", want: http.StatusUnauthorized},
+		{name: "empty token", tokens: "secret", authorization: "Bearer ", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := ParseTokens(tt.tokens).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/sagas", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want != http.StatusUnauthorized {
+				return
+			}
+
+			// Same body as every other API error
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("Content-Type = %q, want application/json", ct)
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("no WWW-Authenticate challenge")
+			}
+			var body struct {
+				Error struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body.String(), err)
+			}
+			if body.Error.Code != "unauthorized" || body.Error.Message == "" {
+				t.Fatalf("body = %+v, want code unauthorized with a message", body.Error)
+			}
+		})
+	}
+}
+
+func TestAllowWebSocket(t *testing.T) {
+	tests := []struct {
+		name            string
+		tokens          string
+		authorization   string
+		query           string
+		protocols       string
+		wantAllowed     bool
+		wantSubprotocol bool
+	}{
+		{name: "disabled", tokens: "", wantAllowed: true},
+		{name: "header", tokens: "secret", authorization: "Bearer secret", wantAllowed: true},
+		{name: "invalid header", tokens: "secret", authorization: "Bearer wrong"},
+		{name: "query", tokens: "secret", query: "?token=secret", wantAllowed: true},
+		{name: "invalid query", tokens: "secret", query: "?token=wrong"},
+		{name: "subprotocol", tokens: "secret", protocols: "bearer, secret", wantAllowed: true, wantSubprotocol: true},
+		{name: "subprotocol among others", tokens: "secret", protocols: "json, bearer, secret", wantAllowed: true, wantSubprotocol: true},
+		{name: "invalid subprotocol", tokens: "secret", protocols: "bearer, wrong", wantSubprotocol: true},
+		{name: "bearer without token", tokens: "secret", protocols: "bearer"},
+		{name: "missing", tokens: "secret"},
+		// The header wins over the other places
+		{name: "invalid header, valid query", tokens: "secret", authorization: "Bearer wrong", query: "?token=secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws"+tt.query, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.protocols != "" {
+				req.Header.Set("Sec-WebSocket-Protocol", tt.protocols)
+			}
+
+			allowed, usedSubprotocol := ParseTokens(tt.tokens).AllowWebSocket(req)
+			if allowed != tt.wantAllowed || usedSubprotocol != tt.wantSubprotocol {
+				t.Fatalf("AllowWebSocket = (%v, %v), want (%v, %v)", allowed, usedSubprotocol, tt.wantAllowed, tt.wantSubprotocol)
+			}
+		})
+	}
+
+	var none *Tokens
+	if allowed, _ := none.AllowWebSocket(httptest.NewRequest(http.MethodGet, "/ws", nil)); !allowed {
+		t.Fatal("nil Tokens rejects WebSocket connections")
+	}
+}
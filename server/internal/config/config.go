@@ -0,0 +1,122 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Runtime Configuration
+
+Settings that can be changed without restarting the server live in Runtime. The
+current Runtime is held behind an atomic pointer: readers always see one complete
+configuration, and a reload swaps in a new one all at once.
+
+Components that cache a setting (e.g. the event queue's processing timeout) register
+an apply function with OnReload, which is called with every new configuration.
+Settings that only take effect at startup (port, TLS, database, scenario file, strict
+mode) are not part of Runtime.
+*/
+
+// Runtime holds the hot-reloadable settings
+type Runtime struct {
+	EventProcessingTimeout time.Duration
+	EventEnqueueTimeout    time.Duration
+	EventDedupeTTL         time.Duration
+	EventDedupeSize        int
+	EventRateLimit         float64
+	EventRateBurst         int
+	UnmatchedEventsSize    int
+	ScenarioCacheSize      int
+
+	StepTimeout                  time.Duration
+	StepTimeoutMin               time.Duration
+	StepTimeoutMax               time.Duration
+	StepTimeoutLatencyMultiplier float64
+	CommandAckTimeout            time.Duration
+
+	CompensationTimeout    time.Duration
+	CompensationRetries    int
+	CompensationRetryDelay time.Duration
+
+	CompensationDeadLetterSize int
+
+	SagaTimeout time.Duration
+
+	MaxConcurrentSagas int
+	SagaLimitWait      time.Duration
+
+	MaxSagaSteps              int
+	AllowDuplicateSagaTargets bool
+
+	StepResultMaxBytes int
+
+	FanOutWarningRules   int
+	FanOutWarningActions int
+
+	LateCompletionPolicy string // "ignore", "warn" or "ack"
+
+	ParamTemplateStrict bool
+
+	ReconnectTokenTTL time.Duration
+
+	ShutdownMessageType      string
+	ShutdownCommand          string
+	ShutdownMessage          string
+	ShutdownBroadcastTimeout time.Duration
+	ShutdownGracePeriod      time.Duration
+}
+
+// LoadFunc reads the configuration from its sources (environment, flags, ...)
+type LoadFunc func() (*Runtime, error)
+
+// Store holds the current runtime configuration and reloads it on request
+type Store struct {
+	current atomic.Pointer[Runtime]
+	load    LoadFunc
+
+	appliers []func(*Runtime)
+	mu       sync.Mutex // Serializes reloads and protects appliers
+}
+
+// NewStore creates a store holding initial; Reload uses load to re-read the configuration
+func NewStore(initial *Runtime, load LoadFunc) *Store {
+	s := &Store{load: load}
+	s.current.Store(initial)
+	return s
+}
+
+// Current returns the configuration in effect
+// The returned Runtime must not be modified.
+func (s *Store) Current() *Runtime {
+	return s.current.Load()
+}
+
+// OnReload registers apply to be called with the current configuration now and
+// with every configuration swapped in by Reload
+func (s *Store) OnReload(apply func(*Runtime)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.appliers = append(s.appliers, apply)
+	apply(s.current.Load())
+}
+
+// Reload re-reads the configuration and swaps it in
+// If loading fails, the current configuration is kept and the error is returned.
+func (s *Store) Reload() (*Runtime, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.current.Store(cfg)
+	for _, apply := range s.appliers {
+		apply(cfg)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,191 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Event Hub
+
+The hub is an in-process publish/subscribe point for the things a dashboard watches:
+simulations connecting and disconnecting, Sagas being created, advancing and finishing,
+and new log entries. The registry, the Saga manager and the log store publish to it;
+the /ws/dashboard endpoint subscribes one socket per dashboard client.
+
+Publish never blocks. Each subscriber has a buffered channel, and a subscriber that
+falls a full buffer behind is dropped (its channel closed) instead of holding up the
+publisher; a dashboard that lost events should reconnect and reload the current state
+from the REST API. Events published before a subscription are not replayed.
+
+A nil *Hub discards everything, so publishers don't need to check whether one is set.
+*/
+
+// Type identifies what an Event is about
+type Type string
+
+// Event types
+const (
+	SimulationConnected    Type = "simulation.connected"
+	SimulationDisconnected Type = "simulation.disconnected"
+	SagaCreated            Type = "saga.created"
+	SagaStepAdvanced       Type = "saga.step_advanced"
+	SagaCompleted          Type = "saga.completed"
+	SagaFailed             Type = "saga.failed" // Any terminal status other than completed
+	LogEntry               Type = "log.entry"
+)
+
+// Event is one published occurrence
+type Event struct {
+	Type Type        `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// SimulationEvent is the data of the simulation events
+type SimulationEvent struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// SagaEvent is the data of the Saga events
+// StepID and Simulation are set for step events only.
+type SagaEvent struct {
+	SagaID         string   `json:"saga_id"`
+	Tenant         string   `json:"tenant,omitempty"`
+	Status         string   `json:"status"`
+	CurrentStep    int      `json:"current_step"`
+	Steps          int      `json:"steps"`
+	StepID         *int     `json:"step_id,omitempty"`
+	Simulation     string   `json:"simulation,omitempty"`
+	FailureReasons []string `json:"failure_reasons,omitempty"`
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind before it is dropped
+const subscriberBuffer = 256
+
+// Hub fans published events out to its subscribers
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+	held        sync.WaitGroup // Subscriptions not yet released with Subscription.Close
+}
+
+// Subscription receives the events published after it was created
+type Subscription struct {
+	// C receives the events; it is closed when the subscription ends
+	C <-chan Event
+
+	ch       chan Event
+	hub      *Hub
+	dropped  bool
+	released bool
+}
+
+// NewHub creates an event hub without subscribers
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber without blocking
+// Subscribers without room for it are dropped.
+func (h *Hub) Publish(eventType Type, data interface{}) {
+	if h == nil {
+		return
+	}
+
+	event := Event{Type: eventType, Time: time.Now(), Data: data}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		select {
+		case sub.ch <- event:
+		default: // Subscriber is a full buffer behind
+			sub.dropped = true
+			delete(h.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// Subscribe starts a subscription to every event published from now on
+// On a closed hub the subscription's channel is already closed.
+func (h *Hub) Subscribe() *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, hub: h}
+	if h.closed {
+		close(ch)
+		sub.released = true
+		return sub
+	}
+	h.subscribers[sub] = struct{}{}
+	h.held.Add(1)
+	return sub
+}
+
+// Close ends the subscription, closing its channel, and releases it
+// Every subscription must be closed once its subscriber is done with it, including
+// after it was dropped or the hub was closed. It may be called more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, exists := s.hub.subscribers[s]; exists {
+		delete(s.hub.subscribers, s)
+		close(s.ch)
+	}
+	if !s.released {
+		s.released = true
+		s.hub.held.Done()
+	}
+}
+
+// Dropped reports whether the subscription ended because it fell behind
+func (s *Subscription) Dropped() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.dropped
+}
+
+// Count returns the number of current subscribers
+func (h *Hub) Count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers)
+}
+
+// Close ends every subscription and rejects new ones, e.g. on shutdown
+// It then waits up to timeout for the subscribers to release their subscriptions, so
+// they get a chance to tell their clients. Returns false if some didn't in time.
+func (h *Hub) Close(timeout time.Duration) bool {
+	h.mu.Lock()
+	h.closed = true
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.ch)
+	}
+	h.mu.Unlock()
+
+	released := make(chan struct{})
+	go func() {
+		h.held.Wait()
+		close(released)
+	}()
+	select {
+	case <-released:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+/*
+Console Log Format
+
+By default the server writes free-form text lines through the standard log package,
+which is easy to read during local development. With the json format (LOG_FORMAT=json)
+every console line is a JSON object written by log/slog instead:
+
+	{"time":"2026-01-15T10:30:00.123Z","level":"INFO","msg":"Saga saga_1: Step 0 completed","saga_id":"saga_1","source":"a_sim"}
+
+Entries logged through a LogStore keep their level and correlation fields (saga_id and
+source, when set). Everything else that uses the standard log package is routed
+through the same handler at level INFO, so the console never mixes the two formats.
+The in-memory entries served by /api/logs are the same in both formats.
+*/
+
+// Console log formats (see SetFormat)
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// jsonOutput is set when console output goes through slog
+var jsonOutput atomic.Bool
+
+// ParseFormat checks a console log format name ("" = text)
+func ParseFormat(format string) (string, error) {
+	switch format {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+}
+
+// SetFormat selects the console log format for the whole process
+// Call once at startup, before anything is logged.
+func SetFormat(format string) error {
+	format, err := ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	if format == FormatJSON {
+		// Also routes the standard log package through the handler
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+		jsonOutput.Store(true)
+	}
+	return nil
+}
+
+// JSONOutput reports whether console output is written as JSON lines
+func JSONOutput() bool {
+	return jsonOutput.Load()
+}
+
+// writeConsole writes a stored entry's message to the console in the selected format
+func writeConsole(level, sagaID, source, message string) {
+	if !jsonOutput.Load() {
+		log.Print(message)
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, 2)
+	if sagaID != "" {
+		attrs = append(attrs, slog.String("saga_id", sagaID))
+	}
+	if source != "" {
+		attrs = append(attrs, slog.String("source", source))
+	}
+	slog.LogAttrs(context.Background(), slogLevel(level), message, attrs...)
+}
+
+// slogLevel maps a LogStore level to a slog level (unknown levels are INFO)
+func slogLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
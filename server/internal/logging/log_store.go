@@ -2,9 +2,10 @@ package logging
 
 import (
 	"fmt"
-	"log"
 	"sync"
 	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/events"
 )
 
 // LogEntry represents a single log entry
@@ -12,6 +13,8 @@ type LogEntry struct {
 	Timestamp time.Time `json:"timestamp"`
 	Message   string    `json:"message"`
 	Level     string    `json:"level"`
+	SagaID    string    `json:"saga_id,omitempty"` // Saga the entry is about, if any
+	Source    string    `json:"source,omitempty"`  // Simulation the entry is about, if any
 }
 
 // LogStore stores logs in memory
@@ -19,6 +22,9 @@ type LogStore struct {
 	entries []LogEntry
 	mu      sync.RWMutex
 	maxSize int // Maximum number of logs to keep (0 = unlimited)
+
+	subscribers map[chan LogEntry]struct{} // Live subscribers (see subscribe.go)
+	hub         *events.Hub                // Optional: receives every entry (see subscribe.go)
 }
 
 // NewLogStore creates a new log store
@@ -31,6 +37,11 @@ func NewLogStore(maxSize int) *LogStore {
 
 // Add adds a log entry to the store
 func (ls *LogStore) Add(level, message string) {
+	ls.AddCtx(level, "", "", message)
+}
+
+// AddCtx adds a log entry correlated with a Saga and/or simulation ("" = none)
+func (ls *LogStore) AddCtx(level, sagaID, source, message string) {
 	ls.mu.Lock()
 	defer ls.mu.Unlock()
 
@@ -38,6 +49,8 @@ func (ls *LogStore) Add(level, message string) {
 		Timestamp: time.Now(),
 		Message:   message,
 		Level:     level,
+		SagaID:    sagaID,
+		Source:    source,
 	}
 
 	ls.entries = append(ls.entries, entry)
@@ -46,6 +59,8 @@ func (ls *LogStore) Add(level, message string) {
 	if ls.maxSize > 0 && len(ls.entries) > ls.maxSize {
 		ls.entries = ls.entries[len(ls.entries)-ls.maxSize:]
 	}
+
+	ls.publish(entry)
 }
 
 // GetAll returns all log entries
@@ -59,6 +74,30 @@ func (ls *LogStore) GetAll() []LogEntry {
 	return result
 }
 
+// LogFilter selects log entries in Query; empty fields match every entry
+type LogFilter struct {
+	SagaID string
+	Source string
+}
+
+// Query returns the log entries matching the filter, oldest first
+func (ls *LogStore) Query(filter LogFilter) []LogEntry {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	result := make([]LogEntry, 0)
+	for _, entry := range ls.entries {
+		if filter.SagaID != "" && entry.SagaID != filter.SagaID {
+			continue
+		}
+		if filter.Source != "" && entry.Source != filter.Source {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
 // Clear clears all log entries
 func (ls *LogStore) Clear() {
 	ls.mu.Lock()
@@ -66,9 +105,15 @@ func (ls *LogStore) Clear() {
 	ls.entries = make([]LogEntry, 0)
 }
 
-// LogAndStore logs a message using the standard log package and stores it in the log store
+// LogAndStore logs a message to the console (see SetFormat) and stores it in the log store
 func (ls *LogStore) LogAndStore(level, format string, args ...interface{}) {
+	ls.LogAndStoreCtx(level, "", "", format, args...)
+}
+
+// LogAndStoreCtx is LogAndStore for a message about a Saga and/or simulation
+// sagaID and source ("" = none) are stored with the entry so it can be found with Query.
+func (ls *LogStore) LogAndStoreCtx(level, sagaID, source, format string, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
-	log.Printf(format, args...)
-	ls.Add(level, message)
+	writeConsole(level, sagaID, source, message)
+	ls.AddCtx(level, sagaID, source, message)
 }
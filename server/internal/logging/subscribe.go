@@ -0,0 +1,76 @@
+package logging
+
+import "github.com/aidenletourneau/simulation_orchestration_server/server/internal/events"
+
+/*
+Log Subscriptions
+
+Subscribe lets a consumer (such as the /api/logs/stream endpoint) receive every entry
+added to the store from then on. Each subscriber has a small buffered channel; Add
+delivers to it without blocking, so a slow consumer misses entries instead of holding
+up the code that logs. Entries already in the store are not replayed (use GetAll). CloseSubscribers ends all
+subscriptions, e.g. so streaming requests return on shutdown.
+
+Entries are also published to the event hub set with SetEventHub, for dashboards.
+*/
+
+// subscriberBuffer is how many entries a subscriber may fall behind before entries are
+// dropped for it
+const subscriberBuffer = 100
+
+// Subscribe returns a channel receiving each entry added from now on, and a function
+// that ends the subscription and closes the channel
+// The unsubscribe function may be called more than once.
+func (ls *LogStore) Subscribe() (<-chan LogEntry, func()) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ch := make(chan LogEntry, subscriberBuffer)
+	if ls.subscribers == nil {
+		ls.subscribers = make(map[chan LogEntry]struct{})
+	}
+	ls.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+
+		if _, exists := ls.subscribers[ch]; exists {
+			delete(ls.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// SetEventHub sets the event hub that receives every entry added from now on
+func (ls *LogStore) SetEventHub(hub *events.Hub) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ls.hub = hub
+}
+
+// publish sends an entry to every subscriber that has room for it, and to the event hub
+// Must be called with the store's lock held
+func (ls *LogStore) publish(entry LogEntry) {
+	ls.hub.Publish(events.LogEntry, entry)
+
+	for ch := range ls.subscribers {
+		select {
+		case ch <- entry:
+		default: // Subscriber is behind; it misses this entry
+		}
+	}
+}
+
+// CloseSubscribers ends every subscription, closing the subscribers' channels
+func (ls *LogStore) CloseSubscribers() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for ch := range ls.subscribers {
+		delete(ls.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,265 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+Prometheus Metrics
+
+The collector below reads its values from the registry, saga manager, scenario manager,
+event queue and rate limiter at scrape time, so the core packages only need to expose simple counts and don't
+depend on the Prometheus client themselves.
+*/
+
+const namespace = "orchestrator"
+
+// sagaStatuses lists every Saga status so each one is reported, even when zero
+var sagaStatuses = []saga.SagaStatus{
+	saga.SagaStatusPending,
+	saga.SagaStatusInProgress,
+	saga.SagaStatusCompleted,
+	saga.SagaStatusFailed,
+	saga.SagaStatusCompensating,
+	saga.SagaStatusCompensationFailed,
+	saga.SagaStatusCancelling,
+	saga.SagaStatusCancelled,
+}
+
+// Collector exposes orchestration server state as Prometheus metrics
+type Collector struct {
+	registry        *registry.Registry
+	sagaManager     *saga.SagaManager
+	scenarioManager *scenario.ScenarioManager
+	eventQueue      *queue.EventQueue
+	rateLimit       *queue.RateLimiter
+
+	connectedSimulations *prometheus.Desc
+	sagas                *prometheus.Desc
+	sagasCreated         *prometheus.Desc
+	sagasCompleted       *prometheus.Desc
+	sagasFailed          *prometheus.Desc
+	sagasCancelled       *prometheus.Desc
+	stepLatency          *prometheus.Desc
+	queueLength          *prometheus.Desc
+	queueWorkers         *prometheus.Desc
+	acceptedEvents       *prometheus.Desc
+	blockedEvents        *prometheus.Desc
+	droppedEvents        *prometheus.Desc
+	commandWriteErrors   *prometheus.Desc
+	fanOutWarnings       *prometheus.Desc
+	lateCompletions      *prometheus.Desc
+	pendingJoins         *prometheus.Desc
+	expiredJoins         *prometheus.Desc
+	cooldownSuppressed   *prometheus.Desc
+	schemaRejected       *prometheus.Desc
+	rateLimited          *prometheus.Desc
+	scenarioCacheHits    *prometheus.Desc
+	scenarioCacheMisses  *prometheus.Desc
+}
+
+// NewCollector creates a new Collector wired to the server components
+func NewCollector(reg *registry.Registry, sagaManager *saga.SagaManager, scenarioManager *scenario.ScenarioManager, eventQueue *queue.EventQueue, rateLimit *queue.RateLimiter) *Collector {
+	return &Collector{
+		registry:        reg,
+		sagaManager:     sagaManager,
+		scenarioManager: scenarioManager,
+		eventQueue:      eventQueue,
+		rateLimit:       rateLimit,
+
+		connectedSimulations: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "connected_simulations"),
+			"Number of simulations currently connected and registered.",
+			nil, nil,
+		),
+		sagas: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "sagas"),
+			"Number of Sagas by status.",
+			[]string{"status"}, nil,
+		),
+		sagasCreated: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "sagas_created_total"),
+			"Total number of Sagas created.",
+			nil, nil,
+		),
+		sagasCompleted: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "sagas_completed_total"),
+			"Total number of Sagas that completed all their steps.",
+			nil, nil,
+		),
+		sagasFailed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "sagas_failed_total"),
+			"Total number of Sagas that finished Failed or CompensationFailed.",
+			nil, nil,
+		),
+		sagasCancelled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "sagas_cancelled_total"),
+			"Total number of Sagas cancelled by an operator.",
+			nil, nil,
+		),
+		stepLatency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "step_dispatch_latency_seconds"),
+			"Time from dispatching a step's command to receiving its step.completed report.",
+			nil, nil,
+		),
+		queueLength: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "event_queue", "length"),
+			"Number of events waiting in the event queue.",
+			nil, nil,
+		),
+		queueWorkers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "event_queue", "workers"),
+			"Number of event queue worker goroutines running.",
+			nil, nil,
+		),
+		acceptedEvents: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "event_queue", "accepted_events_total"),
+			"Total number of events accepted into the event queue.",
+			nil, nil,
+		),
+		blockedEvents: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "event_queue", "blocked_events_total"),
+			"Total number of events that had to wait for room in a full event queue.",
+			nil, nil,
+		),
+		droppedEvents: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "event_queue", "dropped_events_total"),
+			"Total number of events dropped because the queue was full, closed, or drained.",
+			nil, nil,
+		),
+		commandWriteErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "command_write_errors_total"),
+			"Total number of commands that failed to send to a simulation.",
+			nil, nil,
+		),
+		fanOutWarnings: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "event_fanout_warnings_total"),
+			"Total number of events that matched more rules or actions than the fan-out warning thresholds.",
+			nil, nil,
+		),
+		lateCompletions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "late_step_completions_total"),
+			"Total number of step completions received after their Saga had already completed or failed.",
+			nil, nil,
+		),
+		pendingJoins: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "pending_joins"),
+			"Number of join rule partial matches waiting for their remaining correlated events.",
+			nil, nil,
+		),
+		expiredJoins: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "expired_joins_total"),
+			"Total number of join rule partial matches discarded because they timed out.",
+			nil, nil,
+		),
+		cooldownSuppressed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "cooldown_suppressed_events_total"),
+			"Total number of rule matches suppressed because the rule was cooling down for the event's source.",
+			nil, nil,
+		),
+		schemaRejected: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "schema_rejected_events_total"),
+			"Total number of times an event was rejected by a scenario's event schema.",
+			nil, nil,
+		),
+		rateLimited: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "rate_limited_events_total"),
+			"Total number of events dropped because their simulation exceeded the event rate limit.",
+			nil, nil,
+		),
+		scenarioCacheHits: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scenario_cache", "hits_total"),
+			"Total number of scenario activations served from the parsed scenario cache.",
+			nil, nil,
+		),
+		scenarioCacheMisses: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scenario_cache", "misses_total"),
+			"Total number of scenario activations that had to load and parse the stored scenario.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.connectedSimulations
+	ch <- c.sagas
+	ch <- c.sagasCreated
+	ch <- c.sagasCompleted
+	ch <- c.sagasFailed
+	ch <- c.sagasCancelled
+	ch <- c.stepLatency
+	ch <- c.queueLength
+	ch <- c.queueWorkers
+	ch <- c.acceptedEvents
+	ch <- c.blockedEvents
+	ch <- c.droppedEvents
+	ch <- c.commandWriteErrors
+	ch <- c.fanOutWarnings
+	ch <- c.lateCompletions
+	ch <- c.pendingJoins
+	ch <- c.expiredJoins
+	ch <- c.cooldownSuppressed
+	ch <- c.schemaRejected
+	ch <- c.rateLimited
+	ch <- c.scenarioCacheHits
+	ch <- c.scenarioCacheMisses
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.connectedSimulations, prometheus.GaugeValue, float64(c.registry.Count()))
+
+	counts := c.sagaManager.CountByStatus()
+	for _, status := range sagaStatuses {
+		ch <- prometheus.MustNewConstMetric(c.sagas, prometheus.GaugeValue, float64(counts[status]), string(status))
+	}
+
+	totals := c.sagaManager.GetSagaTotals()
+	ch <- prometheus.MustNewConstMetric(c.sagasCreated, prometheus.CounterValue, float64(totals.Created))
+	ch <- prometheus.MustNewConstMetric(c.sagasCompleted, prometheus.CounterValue, float64(totals.Completed))
+	ch <- prometheus.MustNewConstMetric(c.sagasFailed, prometheus.CounterValue, float64(totals.Failed))
+	ch <- prometheus.MustNewConstMetric(c.sagasCancelled, prometheus.CounterValue, float64(totals.Cancelled))
+
+	latency := c.sagaManager.GetStepLatency()
+	ch <- prometheus.MustNewConstHistogram(c.stepLatency, latency.Count, latency.Sum, latency.Buckets)
+
+	queueStats := c.eventQueue.GetQueueStats()
+	ch <- prometheus.MustNewConstMetric(c.queueLength, prometheus.GaugeValue, float64(queueStats.Length))
+	ch <- prometheus.MustNewConstMetric(c.queueWorkers, prometheus.GaugeValue, float64(queueStats.Workers))
+	ch <- prometheus.MustNewConstMetric(c.acceptedEvents, prometheus.CounterValue, float64(queueStats.Accepted))
+	ch <- prometheus.MustNewConstMetric(c.blockedEvents, prometheus.CounterValue, float64(queueStats.Blocked))
+	ch <- prometheus.MustNewConstMetric(c.droppedEvents, prometheus.CounterValue, float64(queueStats.Dropped))
+	ch <- prometheus.MustNewConstMetric(c.commandWriteErrors, prometheus.CounterValue, float64(c.sagaManager.GetCommandWriteErrorCount()))
+	ch <- prometheus.MustNewConstMetric(c.fanOutWarnings, prometheus.CounterValue, float64(c.scenarioManager.GetFanOutWarningCount()))
+	ch <- prometheus.MustNewConstMetric(c.lateCompletions, prometheus.CounterValue, float64(c.sagaManager.GetLateCompletionCount()))
+	ch <- prometheus.MustNewConstMetric(c.pendingJoins, prometheus.GaugeValue, float64(c.scenarioManager.GetPendingJoinCount()))
+	ch <- prometheus.MustNewConstMetric(c.expiredJoins, prometheus.CounterValue, float64(c.scenarioManager.GetExpiredJoinCount()))
+	ch <- prometheus.MustNewConstMetric(c.cooldownSuppressed, prometheus.CounterValue, float64(c.scenarioManager.GetCooldownSuppressedCount()))
+	ch <- prometheus.MustNewConstMetric(c.schemaRejected, prometheus.CounterValue, float64(c.scenarioManager.GetSchemaRejectedCount()))
+	ch <- prometheus.MustNewConstMetric(c.rateLimited, prometheus.CounterValue, float64(c.rateLimit.GetRejectedCount()))
+
+	cacheHits, cacheMisses := c.scenarioManager.GetScenarioCacheStats()
+	ch <- prometheus.MustNewConstMetric(c.scenarioCacheHits, prometheus.CounterValue, float64(cacheHits))
+	ch <- prometheus.MustNewConstMetric(c.scenarioCacheMisses, prometheus.CounterValue, float64(cacheMisses))
+}
+
+// Handler returns an HTTP handler serving the metrics in Prometheus exposition format
+// Go runtime and process metrics are included alongside the orchestration metrics
+func Handler(collector *Collector) http.Handler {
+	promRegistry := prometheus.NewRegistry()
+	promRegistry.MustRegister(
+		collector,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{})
+}
@@ -1,12 +1,20 @@
 package models
 
-import "github.com/gorilla/websocket"
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
 
 // Event represents an incoming event from a simulation
 type Event struct {
 	Type      string                 `json:"type"`
 	EventType string                 `json:"event_type"`
 	Source    string                 `json:"source"`
+	Tenant    string                 `json:"tenant,omitempty"`
+	EventID   string                 `json:"event_id,omitempty"` // Idempotency key set by the source (see queue/dedupe.go)
 	Payload   map[string]interface{} `json:"payload"`
 }
 
@@ -19,9 +27,44 @@ type Command struct {
 
 // Simulation represents a connected simulation client
 type Simulation struct {
-	ID         string
-	Name       string
-	Connection *websocket.Conn
+	ID              string
+	Name            string
+	Tenant          string // Tenant/namespace the simulation belongs to ("" = default)
+	Connection      *websocket.Conn
+	ExpectedLatency time.Duration // Declared typical command latency (0 = not declared)
+	Capabilities    []string      // Commands the simulation declared it handles (empty = any)
+	AcksCommands    bool          // Sends command.received for every command it receives (see saga/ack.go)
+	ConnectedAt     time.Time     // When the current connection registered (set by Registry.Register)
+
+	// LastActivity is when a message was last read from the simulation; it is updated
+	// by the read loop, so use Registry.Touch and Registry.LastActivity, which lock it
+	LastActivity time.Time
+
+	// DefaultCompensateCommand rolls back steps sent to the simulation that have no
+	// compensate_command of their own ("" = none)
+	DefaultCompensateCommand string
+
+	writeMu sync.Mutex // Serializes writes to Connection (see Send)
+}
+
+// Supports reports whether the simulation handles command
+// A simulation that declared no capabilities is assumed to handle every command.
+func (s *Simulation) Supports(command string) bool {
+	return len(s.Capabilities) == 0 || slices.Contains(s.Capabilities, command)
+}
+
+// Send writes v to the simulation as JSON, bounded by timeout (0 = no deadline)
+// Writes through Send are serialized, so it is safe to call from several goroutines
+// at once; a WebSocket connection supports only one concurrent writer.
+func (s *Simulation) Send(v interface{}, timeout time.Duration) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if timeout > 0 {
+		s.Connection.SetWriteDeadline(time.Now().Add(timeout))
+		defer s.Connection.SetWriteDeadline(time.Time{})
+	}
+	return s.Connection.WriteJSON(v)
 }
 
 // Message represents a WebSocket message
@@ -30,14 +73,27 @@ type Message struct {
 	ID        string                 `json:"id,omitempty"`
 	Name      string                 `json:"name,omitempty"`
 	EventType string                 `json:"event_type,omitempty"`
+	EventID   string                 `json:"event_id,omitempty"` // Event: optional idempotency key; repeats are ignored
 	Source    string                 `json:"source,omitempty"`
+	Tenant    string                 `json:"tenant,omitempty"`
 	Payload   map[string]interface{} `json:"payload,omitempty"`
 	Command   string                 `json:"command,omitempty"`
 	Params    map[string]interface{} `json:"params,omitempty"`
 	Status    string                 `json:"status,omitempty"`
+	// Registration: typical time the simulation needs to acknowledge a command
+	ExpectedLatencyMs int `json:"expected_latency_ms,omitempty"`
+	// Registration: names of the commands the simulation handles (empty = any)
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Registration: the simulation sends command.received for every command it receives
+	AcksCommands bool `json:"acks_commands,omitempty"`
+	// Registration: rollback command for steps without a compensate_command of their own
+	DefaultCompensateCommand string `json:"default_compensate_command,omitempty"`
+	// Registration: token issued by the server to resume the session after a reconnect
+	ReconnectToken string `json:"reconnect_token,omitempty"`
+	Resumed        bool   `json:"resumed,omitempty"` // Registration reply: the previous session was resumed; command: re-sent after a reconnect
 	// Saga-related fields for event-driven choreography
-	SagaID   string `json:"saga_id,omitempty"`   // Saga identifier
-	StepID   *int   `json:"step_id,omitempty"`   // Step identifier (pointer to allow nil)
+	SagaID string `json:"saga_id,omitempty"` // Saga identifier
+	StepID *int   `json:"step_id,omitempty"` // Step identifier (pointer to allow nil)
 }
 
 // ScenarioFile represents the root YAML structure
@@ -47,27 +103,87 @@ type ScenarioFile struct {
 
 // Scenario represents the loaded YAML scenario
 type Scenario struct {
-	Name  string `yaml:"name"`
-	Rules []Rule `yaml:"rules"`
+	Name   string              `yaml:"name"`
+	Tenant string              `yaml:"tenant,omitempty"` // Only match events from this tenant ("" = all tenants)
+	Groups map[string][]string `yaml:"groups,omitempty"` // Named simulation groups usable in send_to
+	Rules  []Rule              `yaml:"rules"`
+
+	// EventSchemas declares, by event type, the payload fields events must carry to be
+	// matched against the rules (types without a schema are not checked)
+	EventSchemas map[string]EventSchema `yaml:"event_schemas,omitempty"`
+
+	StoredID int `yaml:"-"` // ID of the stored scenario it was loaded from (0 = not from the store)
+}
+
+// EventSchema declares the payload an event type must carry
+type EventSchema struct {
+	Required map[string]string `yaml:"required"` // Dotted payload path -> JSON type (string, number, integer, boolean, object or array)
 }
 
 // Rule represents a trigger-action rule
 type Rule struct {
-	When WhenCondition `yaml:"when"`
-	Then []Action      `yaml:"then"`
+	When        WhenCondition `yaml:"when"`
+	Then        []Action      `yaml:"then"`
+	Cooldown    string        `yaml:"cooldown,omitempty"`     // Minimum time between firings per source simulation (Go duration)
+	SagaTimeout string        `yaml:"saga_timeout,omitempty"` // Time the Saga may take to finish, overriding the server default (Go duration)
+	Priority    int           `yaml:"priority,omitempty"`     // Rules matching one event run highest priority first (default 0)
+	Exclusive   bool          `yaml:"exclusive,omitempty"`    // When the rule fires, rules ranked after it don't
 }
 
 // WhenCondition defines when a rule should fire
 type WhenCondition struct {
-	EventType string `yaml:"event_type"`
-	From      string `yaml:"from,omitempty"`
+	EventType  string             `yaml:"event_type,omitempty"`
+	From       string             `yaml:"from,omitempty"`
+	Conditions []PayloadCondition `yaml:"conditions,omitempty"` // All must hold for the event to match
+	Join       *JoinCondition     `yaml:"join,omitempty"`       // Fire once all correlated events have arrived
+
+	// EventPattern holds the segments of EventType when it contains a * wildcard
+	// (set when the scenario is loaded; nil = EventType is matched exactly)
+	EventPattern []string `yaml:"-" json:"-"`
+}
+
+// PayloadCondition compares a field of the event payload with a value
+// Supported operators:
+//   - eq: the field equals Value (numbers compare by value, so 5 equals 5.0)
+//   - gt, lt: the field is a number greater / less than Value (a number)
+//   - contains: the field is a string containing Value, or a list with an element equal to Value
+//
+// A missing field, or a field whose type doesn't suit the operator, doesn't match.
+type PayloadCondition struct {
+	Key   string      `yaml:"key"`   // Dotted payload path, e.g. "order.amount"
+	Op    string      `yaml:"op"`    // eq, gt, lt or contains
+	Value interface{} `yaml:"value"` // Value to compare the field with
+}
+
+// JoinCondition makes a rule wait for several events that share a correlation value
+type JoinCondition struct {
+	Key     string          `yaml:"key"`               // Payload field whose value correlates the events
+	Events  []WhenCondition `yaml:"events"`            // Required events (event_type and optional from)
+	Timeout string          `yaml:"timeout,omitempty"` // How long a partial match is kept (Go duration)
 }
 
 // Action defines what to do when rule fires
 type Action struct {
-	SendTo            string                 `yaml:"send_to"`
-	Command           string                 `yaml:"command"`
-	Params            map[string]interface{} `yaml:"params"`
-	CompensateCommand string                 `yaml:"compensate_command,omitempty"` // Rollback command
-	CompensateParams  map[string]interface{} `yaml:"compensate_params,omitempty"` // Compensation parameters
+	SendTo              string                 `yaml:"send_to"`
+	Command             string                 `yaml:"command"`
+	Params              map[string]interface{} `yaml:"params"`
+	CompensateCommand   string                 `yaml:"compensate_command,omitempty"`    // Rollback command
+	CompensateParams    map[string]interface{} `yaml:"compensate_params,omitempty"`     // Compensation parameters
+	CompensateAfter     []int                  `yaml:"compensate_after,omitempty"`      // Step IDs whose compensations must run before this one
+	CompensateOnPartial bool                   `yaml:"compensate_on_partial,omitempty"` // Also compensate the step if it was sent but didn't complete
+	EventParams         []string               `yaml:"event_params,omitempty"`          // Event payload fields merged into params
+	EventParamsKey      string                 `yaml:"event_params_key,omitempty"`      // Namespace for event params (empty = merge at top level)
+	Breakpoint          bool                   `yaml:"breakpoint,omitempty"`            // Pause the Saga before dispatching this step
+	Timeout             string                 `yaml:"timeout,omitempty"`               // How long the step may stay in flight (Go duration; empty = server default)
+	Parallel            bool                   `yaml:"parallel,omitempty"`              // Dispatch together with the adjacent parallel actions of the rule
+	Condition           []PayloadCondition     `yaml:"condition,omitempty"`             // Earlier steps' results that must match for the step to run, else it is skipped
+	// Set when a rule's actions are collected for a Saga: consecutive actions with the
+	// same non-zero ParallelGroup are dispatched together (0 = sequential)
+	ParallelGroup int `yaml:"-"`
+	// Set when a rule's actions are collected for a Saga: the parsed Timeout
+	// (0 = server default)
+	StepTimeout time.Duration `yaml:"-"`
+	// Set when a rule's actions are collected for a Saga: the rule's saga_timeout
+	// (0 = server default)
+	SagaTimeout time.Duration `yaml:"-"`
 }
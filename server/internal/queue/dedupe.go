@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+/*
+Event Deduplication
+
+A simulation that retries an event after a network blip would otherwise start a second
+Saga for one logical action. Events may carry an event_id; the Deduper remembers the
+IDs recently seen from each source and reports a repeat, which the event handler then
+ignores. Events without an event_id are never deduplicated. An event whose Saga could
+not be created is forgotten again (see Forget), so the simulation's retry isn't
+mistaken for a duplicate.
+
+Each source keeps at most size IDs, least recently seen evicted first, and an ID counts
+as a repeat only within ttl of the last time it was seen. Sources are kept across
+reconnects, since a retry typically arrives on a new connection, but a source whose IDs
+have all expired is forgotten (checked at most once per ttl), so simulations that come
+and go don't accumulate.
+*/
+
+// Default deduplication settings (see SetLimits)
+const (
+	DefaultDedupeTTL  = 5 * time.Minute
+	DefaultDedupeSize = 1000
+)
+
+// Deduper recognizes events whose event_id was recently seen from the same source
+// It is safe for concurrent use.
+type Deduper struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	sources map[string]*seenIDs
+
+	lastSweep time.Time // When sources with only expired IDs were last forgotten
+}
+
+// seenIDs is one source's IDs, most recently seen at the front
+type seenIDs struct {
+	order *list.List // of *seenID
+	ids   map[string]*list.Element
+}
+
+type seenID struct {
+	id   string
+	seen time.Time
+}
+
+// NewDeduper creates a deduper remembering up to size IDs per source for ttl
+func NewDeduper(ttl time.Duration, size int) *Deduper {
+	d := &Deduper{sources: make(map[string]*seenIDs)}
+	d.SetLimits(ttl, size)
+	return d
+}
+
+// SetLimits sets how long an ID is remembered and how many IDs are kept per source
+// A ttl or size of 0 disables deduplication. May be called at any time; shrinking the
+// size evicts the least recently seen IDs on each source's next event.
+func (d *Deduper) SetLimits(ttl time.Duration, size int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.ttl = ttl
+	d.size = size
+	if ttl <= 0 || size <= 0 {
+		d.sources = make(map[string]*seenIDs)
+	}
+}
+
+// Seen records eventID as seen from source now and reports whether it was already seen
+// within the TTL
+// An empty eventID is never a repeat.
+func (d *Deduper) Seen(source, eventID string) bool {
+	if eventID == "" {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.ttl <= 0 || d.size <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	if now.Sub(d.lastSweep) >= d.ttl {
+		d.sweepLocked(now)
+	}
+
+	s, exists := d.sources[source]
+	if !exists {
+		s = &seenIDs{order: list.New(), ids: make(map[string]*list.Element)}
+		d.sources[source] = s
+	}
+
+	// Forget the IDs that expired, oldest first
+	for back := s.order.Back(); back != nil && now.Sub(back.Value.(*seenID).seen) >= d.ttl; back = s.order.Back() {
+		delete(s.ids, back.Value.(*seenID).id)
+		s.order.Remove(back)
+	}
+
+	if element, exists := s.ids[eventID]; exists {
+		element.Value.(*seenID).seen = now
+		s.order.MoveToFront(element)
+		return true
+	}
+
+	s.ids[eventID] = s.order.PushFront(&seenID{id: eventID, seen: now})
+	for s.order.Len() > d.size {
+		back := s.order.Back()
+		delete(s.ids, back.Value.(*seenID).id)
+		s.order.Remove(back)
+	}
+	return false
+}
+
+// Forget removes eventID from the IDs seen from source, so its next sighting is not a repeat
+func (d *Deduper) Forget(source, eventID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, exists := d.sources[source]
+	if !exists {
+		return
+	}
+	if element, exists := s.ids[eventID]; exists {
+		delete(s.ids, eventID)
+		s.order.Remove(element)
+	}
+}
+
+// sweepLocked forgets the sources whose IDs have all expired
+// Caller must hold mu
+func (d *Deduper) sweepLocked(now time.Time) {
+	for source, s := range d.sources {
+		if front := s.order.Front(); front == nil || now.Sub(front.Value.(*seenID).seen) >= d.ttl {
+			delete(d.sources, source)
+		}
+	}
+	d.lastSweep = now
+}
@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeduperRepeats(t *testing.T) {
+	d := NewDeduper(time.Minute, 10)
+
+	if d.Seen("a", "1") {
+		t.Fatal("first sighting reported as a repeat")
+	}
+	if !d.Seen("a", "1") {
+		t.Fatal("repeat not recognized")
+	}
+	// IDs are per source
+	if d.Seen("b", "1") {
+		t.Fatal("another source's ID reported as a repeat")
+	}
+	// Events without an ID are never repeats
+	if d.Seen("a", "") || d.Seen("a", "") {
+		t.Fatal("empty event_id reported as a repeat")
+	}
+}
+
+func TestDeduperForget(t *testing.T) {
+	d := NewDeduper(time.Minute, 10)
+
+	d.Seen("a", "1")
+	d.Seen("a", "2")
+	d.Forget("a", "1")
+	d.Forget("b", "1")
+	if d.Seen("a", "1") {
+		t.Fatal("forgotten ID reported as a repeat")
+	}
+	if !d.Seen("a", "2") {
+		t.Fatal("Forget removed another ID")
+	}
+}
+
+func TestDeduperTTL(t *testing.T) {
+	d := NewDeduper(200*time.Millisecond, 10)
+
+	d.Seen("a", "1")
+	time.Sleep(80 * time.Millisecond)
+	// Seeing it again within the TTL extends it
+	if !d.Seen("a", "1") {
+		t.Fatal("repeat within the TTL not recognized")
+	}
+	time.Sleep(160 * time.Millisecond)
+	if !d.Seen("a", "1") {
+		t.Fatal("TTL not extended by the last sighting")
+	}
+
+	time.Sleep(240 * time.Millisecond)
+	if d.Seen("a", "1") {
+		t.Fatal("ID still a repeat after its TTL")
+	}
+}
+
+func TestDeduperSizeCap(t *testing.T) {
+	d := NewDeduper(time.Minute, 3)
+
+	for i := 1; i <= 3; i++ {
+		d.Seen("a", strconv.Itoa(i))
+	}
+	// Refresh 1, so 2 is now the least recently seen
+	d.Seen("a", "1")
+	d.Seen("a", "4")
+
+	if d.Seen("a", "2") {
+		t.Fatal("least recently seen ID not evicted at the size cap")
+	}
+	// Seeing 2 evicted 3; 1 and 4 stay
+	for _, id := range []string{"1", "4"} {
+		if !d.Seen("a", id) {
+			t.Fatalf("ID %s evicted, want it kept", id)
+		}
+	}
+	if n := d.sources["a"].order.Len(); n != 3 {
+		t.Fatalf("source keeps %d IDs, want 3", n)
+	}
+
+	// The cap is per source
+	for i := 0; i < 3; i++ {
+		d.Seen("b", strconv.Itoa(i))
+	}
+	if !d.Seen("a", "1") {
+		t.Fatal("another source's IDs evicted this source's")
+	}
+}
+
+func TestDeduperDisabled(t *testing.T) {
+	d := NewDeduper(time.Minute, 10)
+	d.Seen("a", "1")
+
+	d.SetLimits(0, 10)
+	if d.Seen("a", "1") || d.Seen("a", "1") {
+		t.Fatal("repeat reported with deduplication disabled")
+	}
+
+	// Re-enabling starts over
+	d.SetLimits(time.Minute, 10)
+	if d.Seen("a", "1") {
+		t.Fatal("ID remembered from before deduplication was disabled")
+	}
+}
+
+func TestDeduperForgetsExpiredSources(t *testing.T) {
+	d := NewDeduper(30*time.Millisecond, 10)
+
+	for i := 0; i < 100; i++ {
+		d.Seen("sim"+strconv.Itoa(i), "1")
+	}
+	if n := len(d.sources); n != 100 {
+		t.Fatalf("%d sources kept, want 100", n)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	d.Seen("other", "1")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, kept := d.sources["other"]; !kept || len(d.sources) != 1 {
+		t.Fatalf("%d sources kept after every other source's IDs expired, want only the active one", len(d.sources))
+	}
+}
@@ -1,8 +1,10 @@
 package queue
 
 import (
+	"context"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
@@ -16,86 +18,478 @@ multiple simulations. This prevents race conditions when concurrent events arriv
 and need to be processed sequentially.
 
 The queue ensures:
-1. Events are processed in order (FIFO)
-2. Only one event is processed at a time
-3. Predictable ordering when multiple simulations send events concurrently
+1. Events from the same simulation are processed in order (FIFO), one at a time
+   (unless StartProcessor is given more than one worker per source)
+2. Events from different simulations are processed concurrently (see sources.go)
+3. A bounded number of events is in flight (queued or being processed) at once
+
+The queue can be paused and resumed: while paused, events are still accepted but
+are not delivered to the processor. Closing is terminal; pausing is not.
+
+When the queue is full, Enqueue drops the event at once. EnqueueWithContext instead
+applies backpressure: it waits for the processor to make room until its context is
+done, and only then drops the event. The WebSocket handler uses it through
+EnqueueWait with the enqueue timeout, so a momentarily full queue slows the sending
+simulation down (its read loop blocks) instead of losing its events; an enqueue
+timeout of 0 gives the non-blocking behaviour. Step reports go through EnqueueAlways
+instead, which never drops for lack of room: a lost report would leave its Saga (and
+its locks) stuck until a timeout. They still count towards the in-flight limit, so a
+burst of reports makes events wait. Accepted and dropped events are counted (see
+GetQueueStats).
 */
 
+// DefaultEnqueueTimeout is how long the WebSocket handler waits for room in a full queue
+// unless configured otherwise
+const DefaultEnqueueTimeout = 100 * time.Millisecond
+
 // QueuedEvent represents an event waiting to be processed
 type QueuedEvent struct {
 	SourceID  string
 	Message   models.Message
 	Timestamp time.Time
+	seq       uint64 // Identifies the event in the pending mirror
 }
 
-// EventQueue manages a queue of events to be processed sequentially
+// EventQueue manages per-source queues of events, each processed sequentially
 type EventQueue struct {
-	events chan QueuedEvent
-	mu     sync.RWMutex
-	closed bool
+	mu       sync.Mutex // Protects everything below up to nextSeq
+	closed   bool
+	capacity int // Maximum number of events in flight (queued or being processed)
+	inFlight int
+
+	// pending holds every event that has been queued but not yet handed to the
+	// processor, across all sources and in arrival order, so the queue can be
+	// inspected as a whole. It is the source of truth for Drain.
+	pending []QueuedEvent
+	nextSeq uint64
+
+	// sources holds the worker of each simulation with queued or running events
+	sources          map[string]*sourceWorker
+	processor        ProcessorFunc  // Set by StartProcessor; nil until then
+	workersPerSource int            // Worker goroutines per source, set by StartProcessor
+	activeWorkers    int            // Worker goroutines running across all sources
+	workers          sync.WaitGroup // Running worker goroutines (see WaitDrained)
+
+	accepted atomic.Int64 // Number of events queued
+	blocked  atomic.Int64 // Number of events that had to wait for room in a full queue
+	dropped  atomic.Int64 // Number of events dropped (queue closed/full or drained)
+
+	// enqueueTimeout is how long EnqueueWait waits for room (0 = don't wait);
+	// atomic so it can be changed at runtime
+	enqueueTimeout atomic.Int64
+
+	// space is closed (and replaced) whenever room may have been made in the queue, to
+	// wake up EnqueueWithContext callers waiting on a full queue
+	space   chan struct{}
+	spaceMu sync.Mutex
+
+	// processingTimeout bounds how long a worker waits on a single event
+	// (0 = wait forever); atomic so it can be changed while the workers run
+	processingTimeout atomic.Int64
+
+	// paused stops delivery to the processor without closing the queue
+	paused   bool
+	pauseMu  sync.Mutex
+	resumeCh *sync.Cond
 }
 
-// NewEventQueue creates a new event queue with the specified buffer size
+// NewEventQueue creates a new event queue holding at most bufferSize events in flight
 func NewEventQueue(bufferSize int) *EventQueue {
-	return &EventQueue{
-		events: make(chan QueuedEvent, bufferSize),
-		closed: false,
+	eq := &EventQueue{
+		closed:   false,
+		capacity: bufferSize,
+		pending:  make([]QueuedEvent, 0),
+		sources:  make(map[string]*sourceWorker),
+		space:    make(chan struct{}),
 	}
+	eq.resumeCh = sync.NewCond(&eq.pauseMu)
+	eq.SetEnqueueTimeout(DefaultEnqueueTimeout)
+	return eq
 }
 
-// Enqueue adds an event to the queue for processing
-// Returns false if the queue is closed
+// enqueueResult is the outcome of one attempt to queue an event
+type enqueueResult int
+
+const (
+	enqueued enqueueResult = iota
+	queueFull
+	queueClosed
+)
+
+// Enqueue adds an event to the queue for processing without waiting
+// Returns false if the queue is closed or full; the event is dropped.
 func (eq *EventQueue) Enqueue(sourceID string, msg models.Message) bool {
-	eq.mu.RLock()
-	defer eq.mu.RUnlock()
+	switch eq.tryEnqueue(sourceID, msg, true) {
+	case enqueued:
+		return true
+	case queueFull:
+		log.Printf("Event queue is full, dropping event from %s", sourceID)
+	}
+	eq.dropped.Add(1)
+	return false
+}
+
+// EnqueueWithContext adds an event to the queue, waiting for room while the queue is full
+// Returns false if the queue is closed, or if ctx is done before room was made; the
+// event is then dropped. With an already-done context it behaves like Enqueue.
+func (eq *EventQueue) EnqueueWithContext(ctx context.Context, sourceID string, msg models.Message) bool {
+	waited := false
+	for {
+		// Take the wake-up channel before trying, so room made in between isn't missed
+		space := eq.spaceAvailable()
+
+		switch eq.tryEnqueue(sourceID, msg, true) {
+		case enqueued:
+			return true
+		case queueClosed:
+			eq.dropped.Add(1)
+			return false
+		}
+
+		if !waited {
+			waited = true
+			eq.blocked.Add(1)
+		}
+
+		select {
+		case <-space:
+		case <-ctx.Done():
+			log.Printf("Event queue is still full, dropping event from %s: %v", sourceID, ctx.Err())
+			eq.dropped.Add(1)
+			return false
+		}
+	}
+}
+
+// EnqueueAlways adds an event to the queue even if the queue is full
+// The event takes an in-flight slot like any other, possibly exceeding the capacity.
+// Returns false only if the queue is closed; the event is then dropped.
+func (eq *EventQueue) EnqueueAlways(sourceID string, msg models.Message) bool {
+	if eq.tryEnqueue(sourceID, msg, false) != enqueued {
+		eq.dropped.Add(1)
+		return false
+	}
+	return true
+}
+
+// SetEnqueueTimeout sets how long EnqueueWait waits for room in a full queue
+// (0 = drop at once). May be called at any time; it applies to events enqueued afterwards.
+func (eq *EventQueue) SetEnqueueTimeout(timeout time.Duration) {
+	eq.enqueueTimeout.Store(int64(timeout))
+}
+
+// EnqueueWait adds an event to the queue, waiting up to the enqueue timeout for room
+// ctx can end the wait early (e.g. when the sender disconnects).
+func (eq *EventQueue) EnqueueWait(ctx context.Context, sourceID string, msg models.Message) bool {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(eq.enqueueTimeout.Load()))
+	defer cancel()
+
+	return eq.EnqueueWithContext(ctx, sourceID, msg)
+}
+
+// tryEnqueue queues an event if there is room (or regardless, unless bounded), without waiting
+func (eq *EventQueue) tryEnqueue(sourceID string, msg models.Message, bounded bool) enqueueResult {
+	eq.mu.Lock()
+	defer eq.mu.Unlock()
 
 	if eq.closed {
 		log.Printf("Event queue is closed, dropping event from %s", sourceID)
-		return false
+		return queueClosed
+	}
+	if bounded && eq.inFlight >= eq.capacity {
+		return queueFull
 	}
 
+	eq.nextSeq++
 	queuedEvent := QueuedEvent{
 		SourceID:  sourceID,
 		Message:   msg,
 		Timestamp: time.Now(),
+		seq:       eq.nextSeq,
 	}
 
-	select {
-	case eq.events <- queuedEvent:
-		log.Printf("Event queued from %s: %s (queue length: %d)", sourceID, msg.EventType, len(eq.events))
-		return true
-	default:
-		log.Printf("Event queue is full, dropping event from %s", sourceID)
-		return false
+	eq.inFlight++
+	eq.pending = append(eq.pending, queuedEvent)
+	eq.sourceLocked(sourceID).push(queuedEvent)
+	eq.accepted.Add(1)
+	log.Printf("Event queued from %s: %s (queue length: %d)", sourceID, msg.EventType, len(eq.pending))
+	return enqueued
+}
+
+// removePending removes an event from the pending mirror as it is handed to the processor
+// Caller must hold mu
+func (eq *EventQueue) removePending(seq uint64) {
+	for i, pending := range eq.pending {
+		if pending.seq == seq {
+			eq.pending = append(eq.pending[:i], eq.pending[i+1:]...)
+			return
+		}
 	}
 }
 
+// release frees the in-flight slots of n events that were processed or discarded
+func (eq *EventQueue) release(n int) {
+	if n == 0 {
+		return
+	}
+
+	eq.mu.Lock()
+	eq.inFlight -= n
+	eq.mu.Unlock()
+
+	eq.notifySpace()
+}
+
+// spaceAvailable returns a channel that is closed the next time room may have been made
+func (eq *EventQueue) spaceAvailable() <-chan struct{} {
+	eq.spaceMu.Lock()
+	defer eq.spaceMu.Unlock()
+
+	return eq.space
+}
+
+// notifySpace wakes up every EnqueueWithContext caller waiting for room
+func (eq *EventQueue) notifySpace() {
+	eq.spaceMu.Lock()
+	defer eq.spaceMu.Unlock()
+
+	close(eq.space)
+	eq.space = make(chan struct{})
+}
+
 // ProcessorFunc is a function type for processing events
-type ProcessorFunc func(sourceID string, msg models.Message)
+// ctx is cancelled when the event is abandoned after the processing timeout; the
+// processor should then stop as soon as it can and start nothing new, since the
+// source's next event is already being processed.
+type ProcessorFunc func(ctx context.Context, sourceID string, msg models.Message)
+
+// SetProcessingTimeout sets the maximum time a worker waits for a single event
+// If exceeded, the event is abandoned (its context is cancelled) and the worker moves on
+// to its source's next one so a hung handler can't stall that simulation. A timeout of
+// 0 disables this.
+// May be called at any time; it applies from the next event processed.
+func (eq *EventQueue) SetProcessingTimeout(timeout time.Duration) {
+	eq.processingTimeout.Store(int64(timeout))
+}
+
+// StartProcessor starts processing queued events with the given function
+// Each source gets its own workers (goroutines), so different simulations don't wait
+// for each other. With one worker per source, events from one simulation are processed
+// one at a time and in order; with more, they may be processed concurrently and
+// ordering is lost (see sources.go). workers below 1 counts as 1. Call it once.
+func (eq *EventQueue) StartProcessor(processor ProcessorFunc, workers int) {
+	eq.mu.Lock()
+	defer eq.mu.Unlock()
+
+	eq.processor = processor
+	eq.workersPerSource = max(workers, 1)
+	for _, worker := range eq.sources {
+		eq.startWorkerLocked(worker)
+	}
+}
+
+// Running reports whether events are being processed: the processor was started and
+// the queue is not closed (a paused queue still counts as running)
+func (eq *EventQueue) Running() bool {
+	eq.mu.Lock()
+	defer eq.mu.Unlock()
 
-// StartProcessor starts a goroutine that processes events from the queue sequentially
-// This ensures only one event is processed at a time, preventing race conditions
-func (eq *EventQueue) StartProcessor(processor ProcessorFunc) {
+	return eq.processor != nil && !eq.closed
+}
+
+// processWithTimeout runs the processor for one event
+// Without a processing timeout the processor runs on the worker's goroutine. With one,
+// it runs on its own goroutine so the worker can stop waiting for it: once the timeout
+// expires, the processor's context is cancelled and the worker moves on. A processor
+// that doesn't honor its context keeps running in the background and may overlap the
+// source's next event.
+func (eq *EventQueue) processWithTimeout(processor ProcessorFunc, queuedEvent QueuedEvent) {
+	timeout := time.Duration(eq.processingTimeout.Load())
+	if timeout <= 0 {
+		runProcessor(context.Background(), processor, queuedEvent)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan struct{})
 	go func() {
-		for queuedEvent := range eq.events {
-			processor(queuedEvent.SourceID, queuedEvent.Message)
+		defer close(done)
+		runProcessor(ctx, processor, queuedEvent)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Event processing timed out after %s, abandoning event from %s: %s", timeout, queuedEvent.SourceID, queuedEvent.Message.EventType)
+	}
+}
+
+// runProcessor runs the processor for one event, recovering from panics
+func runProcessor(ctx context.Context, processor ProcessorFunc, queuedEvent QueuedEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Event processor panicked on event from %s (%s): %v", queuedEvent.SourceID, queuedEvent.Message.EventType, r)
 		}
 	}()
+	processor(ctx, queuedEvent.SourceID, queuedEvent.Message)
 }
 
-// Close closes the event queue and stops accepting new events
-func (eq *EventQueue) Close() {
+// waitWhilePaused blocks a worker until the queue is resumed or closed
+func (eq *EventQueue) waitWhilePaused() {
+	eq.pauseMu.Lock()
+	defer eq.pauseMu.Unlock()
+
+	for eq.paused {
+		eq.resumeCh.Wait()
+	}
+}
+
+// Pause stops delivering events to the processor
+// Events are still accepted and queued while paused. Events currently being
+// processed (if any) are not interrupted. Returns false if the queue is closed.
+func (eq *EventQueue) Pause() bool {
 	eq.mu.Lock()
 	defer eq.mu.Unlock()
 
+	if eq.closed {
+		return false
+	}
+
+	eq.pauseMu.Lock()
+	defer eq.pauseMu.Unlock()
+
+	if !eq.paused {
+		eq.paused = true
+		log.Println("Event queue paused")
+	}
+	return true
+}
+
+// Resume continues delivering events to the processor after Pause
+func (eq *EventQueue) Resume() {
+	eq.pauseMu.Lock()
+	defer eq.pauseMu.Unlock()
+
+	if eq.paused {
+		eq.paused = false
+		eq.resumeCh.Broadcast()
+		log.Println("Event queue resumed")
+	}
+}
+
+// IsPaused reports whether delivery to the processor is paused
+func (eq *EventQueue) IsPaused() bool {
+	eq.pauseMu.Lock()
+	defer eq.pauseMu.Unlock()
+
+	return eq.paused
+}
+
+// Close closes the event queue and stops accepting new events
+// Closing is terminal. A paused queue is resumed so already-queued events are still
+// processed; each worker exits once its source's events are done.
+func (eq *EventQueue) Close() {
+	eq.mu.Lock()
 	if !eq.closed {
 		eq.closed = true
-		close(eq.events)
+		for _, worker := range eq.sources {
+			worker.wake()
+		}
 		log.Println("Event queue closed")
 	}
+	eq.mu.Unlock()
+
+	eq.Resume()
+
+	// Waiting enqueuers give up once they see the queue is closed
+	eq.notifySpace()
+}
+
+// WaitDrained waits until every worker has stopped after Close, i.e. all events queued
+// before the queue was closed have been processed, or until ctx is done
+// Returns false if ctx ended first.
+func (eq *EventQueue) WaitDrained(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		eq.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
-// GetQueueLength returns the current number of events in the queue
+// GetQueueLength returns the current number of events waiting in the queue
 func (eq *EventQueue) GetQueueLength() int {
-	return len(eq.events)
+	eq.mu.Lock()
+	defer eq.mu.Unlock()
+
+	return len(eq.pending)
+}
+
+// Snapshot returns a copy of the events currently waiting in the queue, oldest first
+// The queue itself is not modified, so processing order is unaffected
+func (eq *EventQueue) Snapshot() []QueuedEvent {
+	eq.mu.Lock()
+	defer eq.mu.Unlock()
+
+	result := make([]QueuedEvent, len(eq.pending))
+	copy(result, eq.pending)
+	return result
+}
+
+// Drain discards all events currently waiting in the queue and returns them
+// Events already handed to the processor are not affected
+func (eq *EventQueue) Drain() []QueuedEvent {
+	eq.mu.Lock()
+	dropped := eq.pending
+	eq.pending = make([]QueuedEvent, 0)
+	for _, worker := range eq.sources {
+		worker.events = nil
+	}
+	eq.mu.Unlock()
+
+	eq.dropped.Add(int64(len(dropped)))
+	eq.release(len(dropped))
+	return dropped
+}
+
+// GetDroppedCount returns the total number of events dropped since the queue was created
+func (eq *EventQueue) GetDroppedCount() int64 {
+	return eq.dropped.Load()
+}
+
+// QueueStats summarizes the queue's current state and lifetime counters
+type QueueStats struct {
+	Length   int   // Events currently waiting in the queue
+	InFlight int   // Events waiting or being processed
+	Capacity int   // Maximum number of events in flight
+	Sources  int   // Simulations with a worker
+	Workers  int   // Worker goroutines running across all simulations
+	Accepted int64 // Events queued since the queue was created
+	Blocked  int64 // Events that had to wait for room (whether or not they were then queued)
+	Dropped  int64 // Events dropped (queue closed/full or drained)
+}
+
+// GetQueueStats returns the queue's current length and its accepted/dropped counters
+func (eq *EventQueue) GetQueueStats() QueueStats {
+	eq.mu.Lock()
+	defer eq.mu.Unlock()
+
+	return QueueStats{
+		Length:   len(eq.pending),
+		InFlight: eq.inFlight,
+		Capacity: eq.capacity,
+		Sources:  len(eq.sources),
+		Workers:  eq.activeWorkers,
+		Accepted: eq.accepted.Load(),
+		Blocked:  eq.blocked.Load(),
+		Dropped:  eq.dropped.Load(),
+	}
 }
@@ -0,0 +1,464 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+// recorder is a processor that records the events it is given, in order
+type recorder struct {
+	mu     sync.Mutex
+	events []string // "<source>:<event type>"
+	done   chan string
+}
+
+func newRecorder() *recorder {
+	return &recorder{done: make(chan string, 1000)}
+}
+
+func (r *recorder) process(_ context.Context, sourceID string, msg models.Message) {
+	r.mu.Lock()
+	r.events = append(r.events, sourceID+":"+msg.EventType)
+	r.mu.Unlock()
+	r.done <- sourceID + ":" + msg.EventType
+}
+
+// wait waits until n events have been processed and returns every event recorded so far
+func (r *recorder) wait(t *testing.T, n int) []string {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d of %d events processed", i, n)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// event builds an event message of the given type
+func event(eventType string) models.Message {
+	return models.Message{Type: "event", EventType: eventType}
+}
+
+func TestProcessingTimeoutCancelsAbandonedEvent(t *testing.T) {
+	eq := NewEventQueue(10)
+	defer eq.Close()
+	eq.SetProcessingTimeout(50 * time.Millisecond)
+
+	cancelled := make(chan error, 1)
+	processed := make(chan string, 10)
+	eq.StartProcessor(func(ctx context.Context, sourceID string, msg models.Message) {
+		if msg.EventType == "hang" {
+			<-ctx.Done()
+			cancelled <- ctx.Err()
+			return
+		}
+		processed <- msg.EventType
+	}, 1)
+
+	eq.Enqueue("sim", event("hang"))
+	eq.Enqueue("sim", event("next"))
+
+	select {
+	case err := <-cancelled:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("abandoned event's context ended with %v, want DeadlineExceeded", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("abandoned event's context was never cancelled")
+	}
+	select {
+	case got := <-processed:
+		if got != "next" {
+			t.Fatalf("processed %q, want next", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker didn't move on after the timeout")
+	}
+}
+
+func TestNoProcessingTimeoutRunsOnWorker(t *testing.T) {
+	eq := NewEventQueue(10)
+	defer eq.Close()
+	eq.SetProcessingTimeout(0)
+
+	done := make(chan bool, 1)
+	eq.StartProcessor(func(ctx context.Context, sourceID string, msg models.Message) {
+		// Without a timeout the context can never be cancelled
+		done <- ctx.Done() == nil
+	}, 1)
+
+	eq.Enqueue("sim", event("a"))
+	select {
+	case uncancellable := <-done:
+		if !uncancellable {
+			t.Fatal("processor got a cancellable context with no processing timeout")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not processed")
+	}
+}
+
+func TestProcessorPanicDoesNotStopWorker(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Second} {
+		eq := NewEventQueue(10)
+		eq.SetProcessingTimeout(timeout)
+
+		rec := newRecorder()
+		eq.StartProcessor(func(ctx context.Context, sourceID string, msg models.Message) {
+			if msg.EventType == "panic" {
+				panic("boom")
+			}
+			rec.process(ctx, sourceID, msg)
+		}, 1)
+
+		eq.Enqueue("sim", event("panic"))
+		eq.Enqueue("sim", event("after"))
+		if got := rec.wait(t, 1); got[0] != "sim:after" {
+			t.Fatalf("timeout %s: processed %v, want sim:after", timeout, got)
+		}
+		eq.Close()
+	}
+}
+
+func TestPerSourceOrdering(t *testing.T) {
+	eq := NewEventQueue(1000)
+	defer eq.Close()
+	rec := newRecorder()
+	eq.StartProcessor(rec.process, 1)
+
+	var want []string
+	for i := 0; i < 200; i++ {
+		source := []string{"a", "b"}[i%2]
+		eventType := strconv.Itoa(i)
+		eq.Enqueue(source, event(eventType))
+		want = append(want, source+":"+eventType)
+	}
+
+	got := rec.wait(t, len(want))
+	// Interleaving across sources is free; each source's own order is not
+	for _, source := range []string{"a", "b"} {
+		var gotSource, wantSource []string
+		for _, e := range got {
+			if e[0] == source[0] {
+				gotSource = append(gotSource, e)
+			}
+		}
+		for _, e := range want {
+			if e[0] == source[0] {
+				wantSource = append(wantSource, e)
+			}
+		}
+		if len(gotSource) != len(wantSource) {
+			t.Fatalf("source %s: processed %d events, want %d", source, len(gotSource), len(wantSource))
+		}
+		for i := range wantSource {
+			if gotSource[i] != wantSource[i] {
+				t.Fatalf("source %s: event %d is %s, want %s", source, i, gotSource[i], wantSource[i])
+			}
+		}
+	}
+}
+
+func TestSourcesAreIndependent(t *testing.T) {
+	eq := NewEventQueue(10)
+	defer eq.Close()
+
+	release := make(chan struct{})
+	rec := newRecorder()
+	eq.StartProcessor(func(ctx context.Context, sourceID string, msg models.Message) {
+		if sourceID == "slow" {
+			<-release
+		}
+		rec.process(ctx, sourceID, msg)
+	}, 1)
+
+	eq.Enqueue("slow", event("blocked"))
+	eq.Enqueue("fast", event("1"))
+	eq.Enqueue("fast", event("2"))
+
+	// The fast source isn't held up by the slow one
+	if got := rec.wait(t, 2); got[0] != "fast:1" || got[1] != "fast:2" {
+		t.Fatalf("processed %v, want fast:1, fast:2 first", got)
+	}
+	close(release)
+	if got := rec.wait(t, 1); got[2] != "slow:blocked" {
+		t.Fatalf("processed %v, want slow:blocked last", got)
+	}
+}
+
+func TestSnapshotAndDrain(t *testing.T) {
+	eq := NewEventQueue(10)
+	defer eq.Close()
+
+	// Not started yet, so everything stays pending
+	eq.Enqueue("a", event("1"))
+	eq.Enqueue("b", event("2"))
+	eq.Enqueue("a", event("3"))
+
+	snapshot := eq.Snapshot()
+	if len(snapshot) != 3 || eq.GetQueueLength() != 3 {
+		t.Fatalf("snapshot has %d events, length %d, want 3", len(snapshot), eq.GetQueueLength())
+	}
+	for i, want := range []string{"a:1", "b:2", "a:3"} {
+		if got := snapshot[i].SourceID + ":" + snapshot[i].Message.EventType; got != want {
+			t.Fatalf("snapshot[%d] = %s, want %s (arrival order)", i, got, want)
+		}
+	}
+
+	drained := eq.Drain()
+	if len(drained) != 3 {
+		t.Fatalf("drained %d events, want 3", len(drained))
+	}
+	for i := range drained {
+		if drained[i].SourceID != snapshot[i].SourceID || drained[i].Message.EventType != snapshot[i].Message.EventType {
+			t.Fatalf("drained[%d] differs from the snapshot", i)
+		}
+	}
+	stats := eq.GetQueueStats()
+	if stats.Length != 0 || stats.InFlight != 0 || stats.Dropped != 3 || stats.Accepted != 3 {
+		t.Fatalf("stats after drain = %+v, want empty with 3 accepted and 3 dropped", stats)
+	}
+
+	// Drained events are never processed; new ones are
+	rec := newRecorder()
+	eq.StartProcessor(rec.process, 1)
+	eq.Enqueue("a", event("4"))
+	if got := rec.wait(t, 1); len(got) != 1 || got[0] != "a:4" {
+		t.Fatalf("processed %v, want only a:4", got)
+	}
+}
+
+func TestPauseHoldsEvents(t *testing.T) {
+	eq := NewEventQueue(10)
+	defer eq.Close()
+	rec := newRecorder()
+	eq.StartProcessor(rec.process, 1)
+
+	if !eq.Pause() {
+		t.Fatal("Pause failed on an open queue")
+	}
+	eq.Enqueue("a", event("1"))
+	eq.Enqueue("a", event("2"))
+
+	time.Sleep(50 * time.Millisecond)
+	if n := len(rec.wait(t, 0)); n != 0 {
+		t.Fatalf("%d events processed while paused", n)
+	}
+	if n := len(eq.Snapshot()); n != 2 {
+		t.Fatalf("snapshot has %d events while paused, want 2", n)
+	}
+
+	eq.Resume()
+	if got := rec.wait(t, 2); got[0] != "a:1" || got[1] != "a:2" {
+		t.Fatalf("processed %v after resume, want a:1, a:2", got)
+	}
+}
+
+func TestRemoveSource(t *testing.T) {
+	eq := NewEventQueue(10)
+	defer eq.Close()
+
+	release := make(chan struct{})
+	rec := newRecorder()
+	eq.StartProcessor(func(ctx context.Context, sourceID string, msg models.Message) {
+		if msg.EventType == "1" {
+			<-release
+		}
+		rec.process(ctx, sourceID, msg)
+	}, 1)
+
+	eq.Enqueue("a", event("1"))
+	eq.Enqueue("a", event("2"))
+	eq.RemoveSource("a")
+
+	// Events queued before the source was removed are still processed, in order
+	close(release)
+	if got := rec.wait(t, 2); got[0] != "a:1" || got[1] != "a:2" {
+		t.Fatalf("processed %v, want a:1, a:2", got)
+	}
+	waitForSources(t, eq, 0)
+
+	// A later event from the same source gets a new worker
+	eq.Enqueue("a", event("3"))
+	if got := rec.wait(t, 1); got[2] != "a:3" {
+		t.Fatalf("processed %v, want a:3 last", got)
+	}
+	eq.RemoveSource("a")
+	waitForSources(t, eq, 0)
+	eq.RemoveSource("unknown")
+}
+
+// waitForSources waits until the queue has n sources with a worker
+func waitForSources(t *testing.T, eq *EventQueue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for eq.GetQueueStats().Sources != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue has %d sources, want %d", eq.GetQueueStats().Sources, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEnqueueWaitBackpressure(t *testing.T) {
+	eq := NewEventQueue(1)
+	defer eq.Close()
+
+	release := make(chan struct{})
+	rec := newRecorder()
+	eq.StartProcessor(func(ctx context.Context, sourceID string, msg models.Message) {
+		if msg.EventType == "1" {
+			<-release
+		}
+		rec.process(ctx, sourceID, msg)
+	}, 1)
+	eq.Enqueue("a", event("1"))
+
+	// Full: waits out the enqueue timeout, then drops
+	eq.SetEnqueueTimeout(20 * time.Millisecond)
+	if eq.EnqueueWait(context.Background(), "a", event("dropped")) {
+		t.Fatal("EnqueueWait succeeded on a full queue")
+	}
+	if stats := eq.GetQueueStats(); stats.Blocked != 1 || stats.Dropped != 1 {
+		t.Fatalf("stats = %+v, want 1 blocked and 1 dropped", stats)
+	}
+
+	// Room made while waiting: queued
+	eq.SetEnqueueTimeout(2 * time.Second)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	if !eq.EnqueueWait(context.Background(), "a", event("2")) {
+		t.Fatal("EnqueueWait dropped the event although room was made")
+	}
+	if got := rec.wait(t, 2); got[0] != "a:1" || got[1] != "a:2" {
+		t.Fatalf("processed %v, want a:1, a:2", got)
+	}
+
+	// A closed queue drops at once
+	eq.Close()
+	if eq.EnqueueWait(context.Background(), "a", event("closed")) {
+		t.Fatal("EnqueueWait succeeded on a closed queue")
+	}
+}
+
+func TestEnqueueAlwaysIgnoresCapacity(t *testing.T) {
+	eq := NewEventQueue(1)
+	defer eq.Close()
+
+	eq.Enqueue("a", event("1"))
+	if eq.Enqueue("a", event("dropped")) {
+		t.Fatal("Enqueue succeeded on a full queue")
+	}
+	if !eq.EnqueueAlways("a", event("2")) {
+		t.Fatal("EnqueueAlways dropped the event on a full queue")
+	}
+	if stats := eq.GetQueueStats(); stats.Length != 2 || stats.InFlight != 2 {
+		t.Fatalf("stats = %+v, want 2 queued and in flight", stats)
+	}
+
+	rec := newRecorder()
+	eq.StartProcessor(rec.process, 1)
+	if got := rec.wait(t, 2); got[0] != "a:1" || got[1] != "a:2" {
+		t.Fatalf("processed %v, want a:1, a:2", got)
+	}
+
+	eq.Close()
+	if eq.EnqueueAlways("a", event("closed")) {
+		t.Fatal("EnqueueAlways succeeded on a closed queue")
+	}
+}
+
+func TestOneWorkerPerSourceKeepsOrder(t *testing.T) {
+	eq := NewEventQueue(100)
+	defer eq.Close()
+
+	var (
+		mu         sync.Mutex
+		running    int
+		maxRunning int
+	)
+	rec := newRecorder()
+	eq.StartProcessor(func(ctx context.Context, sourceID string, msg models.Message) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		rec.process(ctx, sourceID, msg)
+	}, 1)
+
+	for i := 0; i < 20; i++ {
+		eq.Enqueue("a", event(strconv.Itoa(i)))
+	}
+	got := rec.wait(t, 20)
+	for i, e := range got {
+		if e != "a:"+strconv.Itoa(i) {
+			t.Fatalf("event %d is %s, want a:%d", i, e, i)
+		}
+	}
+	if maxRunning != 1 {
+		t.Fatalf("%d events of one source ran at once, want 1", maxRunning)
+	}
+	if stats := eq.GetQueueStats(); stats.Workers > 1 {
+		t.Fatalf("stats report %d workers, want at most 1", stats.Workers)
+	}
+}
+
+func TestSeveralWorkersPerSource(t *testing.T) {
+	const workers = 3
+	eq := NewEventQueue(100)
+	defer eq.Close()
+
+	started := make(chan struct{}, workers)
+	release := make(chan struct{})
+	rec := newRecorder()
+	eq.StartProcessor(func(ctx context.Context, sourceID string, msg models.Message) {
+		started <- struct{}{}
+		<-release
+		rec.process(ctx, sourceID, msg)
+	}, workers)
+
+	for i := 0; i < workers; i++ {
+		eq.Enqueue("a", event(strconv.Itoa(i)))
+	}
+
+	// All of the source's events run at the same time
+	for i := 0; i < workers; i++ {
+		select {
+		case <-started:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d of %d events started concurrently", i, workers)
+		}
+	}
+	if stats := eq.GetQueueStats(); stats.Workers != workers || stats.Sources != 1 {
+		t.Fatalf("stats = %+v, want %d workers for 1 source", stats, workers)
+	}
+
+	eq.Enqueue("b", event("0"))
+	if stats := eq.GetQueueStats(); stats.Workers != 2*workers || stats.Sources != 2 {
+		t.Fatalf("stats = %+v, want %d workers for 2 sources", stats, 2*workers)
+	}
+
+	close(release)
+	rec.wait(t, workers+1)
+	eq.RemoveSource("a")
+	eq.RemoveSource("b")
+	waitForSources(t, eq, 0)
+	if stats := eq.GetQueueStats(); stats.Workers != 0 {
+		t.Fatalf("stats report %d workers after the sources were removed, want 0", stats.Workers)
+	}
+}
@@ -0,0 +1,110 @@
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Event Rate Limiting
+
+One simulation sending events in a tight loop could otherwise fill the event queue and
+starve every other simulation. The RateLimiter gives each source a token bucket: the
+bucket holds up to burst tokens, refills at rate tokens per second, and each event takes
+one token. An event arriving at an empty bucket is rejected; the WebSocket handler drops
+it before it is queued and answers with a rate_limited error.
+
+Only events are limited. Step reports always pass, so Sagas can make progress however
+busy their simulations are. A source's bucket starts full and is forgotten when the
+simulation disconnects, so a reconnecting simulation starts with a full bucket.
+*/
+
+// DefaultRateBurst is the default number of events a simulation may send at once
+// before the rate applies
+const DefaultRateBurst = 20
+
+// RateLimiter limits the rate of events from each source
+// It is safe for concurrent use.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // Tokens added per second; 0 = no limit
+	burst   float64 // Bucket capacity
+	buckets map[string]*tokenBucket
+
+	rejected atomic.Int64 // Number of events rejected
+}
+
+// tokenBucket is one source's bucket
+type tokenBucket struct {
+	tokens float64
+	last   time.Time // When tokens was last brought up to date
+}
+
+// NewRateLimiter creates a rate limiter allowing each source rate events per second
+// with bursts of up to burst events
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	l := &RateLimiter{buckets: make(map[string]*tokenBucket)}
+	l.SetLimits(rate, burst)
+	return l
+}
+
+// SetLimits sets the events per second and the burst allowed to each source
+// A rate of 0 disables rate limiting; a burst below 1 is treated as 1. May be called at
+// any time; every source starts over with a full bucket.
+func (l *RateLimiter) SetLimits(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if burst < 1 {
+		burst = 1
+	}
+	l.rate = rate
+	l.burst = float64(burst)
+	l.buckets = make(map[string]*tokenBucket)
+}
+
+// Allow takes a token from source's bucket and reports whether there was one
+// Rejections are counted (see GetRejectedCount).
+func (l *RateLimiter) Allow(source string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	b, exists := l.buckets[source]
+	if !exists {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[source] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		l.rejected.Add(1)
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Remove forgets source's bucket, e.g. when the simulation disconnects
+func (l *RateLimiter) Remove(source string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.buckets, source)
+}
+
+// GetRejectedCount returns the total number of events rejected since the limiter was
+// created
+func (l *RateLimiter) GetRejectedCount() int64 {
+	return l.rejected.Load()
+}
@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	l := NewRateLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("a") {
+			t.Fatalf("event %d of the burst rejected", i)
+		}
+	}
+	if l.Allow("a") {
+		t.Fatal("event beyond the burst allowed")
+	}
+	if got := l.GetRejectedCount(); got != 1 {
+		t.Fatalf("rejected count = %d, want 1", got)
+	}
+
+	// Buckets are per source
+	if !l.Allow("b") {
+		t.Fatal("another source limited by this source's bucket")
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := NewRateLimiter(20, 1) // A token every 50ms
+
+	if !l.Allow("a") {
+		t.Fatal("first event rejected")
+	}
+	if l.Allow("a") {
+		t.Fatal("second event allowed with an empty bucket")
+	}
+
+	time.Sleep(75 * time.Millisecond)
+	if !l.Allow("a") {
+		t.Fatal("event rejected after the bucket refilled")
+	}
+	if l.Allow("a") {
+		t.Fatal("refill went beyond the tokens earned")
+	}
+
+	// The bucket never holds more than the burst, however long the source waits
+	time.Sleep(200 * time.Millisecond)
+	if !l.Allow("a") || l.Allow("a") {
+		t.Fatal("bucket refilled beyond its burst of 1")
+	}
+}
+
+func TestRateLimiterSetLimits(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	l.Allow("a")
+	if l.Allow("a") {
+		t.Fatal("second event allowed with an empty bucket")
+	}
+
+	// New limits start every source over with a full bucket
+	l.SetLimits(1, 2)
+	if !l.Allow("a") || !l.Allow("a") {
+		t.Fatal("bucket not refilled to the new burst")
+	}
+	if l.Allow("a") {
+		t.Fatal("event beyond the new burst allowed")
+	}
+
+	// A rate of 0 disables limiting
+	l.SetLimits(0, 1)
+	for i := 0; i < 100; i++ {
+		if !l.Allow("a") {
+			t.Fatal("event rejected with rate limiting disabled")
+		}
+	}
+
+	// A burst below 1 counts as 1
+	l.SetLimits(1, 0)
+	if !l.Allow("a") {
+		t.Fatal("burst of 0 rejected the first event")
+	}
+}
+
+func TestRateLimiterRemove(t *testing.T) {
+	l := NewRateLimiter(0.001, 1)
+	l.Allow("a")
+	if l.Allow("a") {
+		t.Fatal("second event allowed with an empty bucket")
+	}
+
+	// A reconnecting simulation starts with a full bucket
+	l.Remove("a")
+	if !l.Allow("a") {
+		t.Fatal("bucket not reset by Remove")
+	}
+}
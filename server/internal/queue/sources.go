@@ -0,0 +1,150 @@
+package queue
+
+import "log"
+
+/*
+Per-Source Workers
+
+Events are queued per source (the simulation that sent them). Each source has its own
+worker goroutine that processes that source's events one at a time, in the order they
+were queued, so a simulation's messages can never overtake each other. Workers of
+different sources run concurrently: an event that is slow to process only holds up
+later events of the same simulation.
+
+StartProcessor can give each source more than one worker goroutine, all taking events
+from the source's queue. A simulation's events are then still handed out in order, but
+may be processed concurrently and finish out of order (a step report can overtake the
+event that created its Saga), so ordering is only guaranteed with one worker, the
+default. Use more only when a simulation's events are independent of each other.
+
+Workers are created lazily when a source's first event is queued (or when the processor
+starts, for events queued before). RemoveSource retires a source's worker when the
+simulation disconnects; the worker still processes the events already queued and exits
+once it is idle. A later event from the same source simply gets a new worker.
+
+All workers share the queue's capacity: at most that many events are in flight
+(waiting or being processed) across all sources, which bounds memory however many
+simulations are connected.
+*/
+
+// sourceWorker holds the queued events of one source and the state of its worker
+// Its fields are protected by the queue's mu.
+type sourceWorker struct {
+	sourceID string
+	events   []QueuedEvent // FIFO, oldest first
+	signal   chan struct{} // Wakes a worker when events arrive or it should exit
+	running  int           // Worker goroutines running for the source
+	retired  bool          // The source disconnected; the workers exit once idle
+}
+
+// push appends an event to the source's queue and wakes its worker
+func (w *sourceWorker) push(event QueuedEvent) {
+	w.events = append(w.events, event)
+	w.wake()
+}
+
+// wake signals the worker without blocking (one pending signal is enough)
+func (w *sourceWorker) wake() {
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// sourceLocked returns the worker of a source, creating (and, once the processor is
+// set, starting) it if needed
+// Caller must hold mu
+func (eq *EventQueue) sourceLocked(sourceID string) *sourceWorker {
+	worker, exists := eq.sources[sourceID]
+	if !exists {
+		worker = &sourceWorker{
+			sourceID: sourceID,
+			signal:   make(chan struct{}, 1),
+		}
+		eq.sources[sourceID] = worker
+	}
+	worker.retired = false
+
+	if eq.processor != nil {
+		eq.startWorkerLocked(worker)
+	}
+	return worker
+}
+
+// startWorkerLocked starts a source's worker goroutines unless they are already running
+// Caller must hold mu
+func (eq *EventQueue) startWorkerLocked(worker *sourceWorker) {
+	for worker.running < eq.workersPerSource {
+		worker.running++
+		eq.activeWorkers++
+		eq.workers.Add(1)
+		go eq.runWorker(worker)
+	}
+}
+
+// RemoveSource retires a source's worker (called when its simulation disconnects)
+// Events of the source that are already queued are still processed; the worker exits
+// after the last one.
+func (eq *EventQueue) RemoveSource(sourceID string) {
+	eq.mu.Lock()
+	defer eq.mu.Unlock()
+
+	worker, exists := eq.sources[sourceID]
+	if !exists {
+		return
+	}
+	worker.retired = true
+	if worker.running == 0 && len(worker.events) == 0 {
+		delete(eq.sources, sourceID)
+		return
+	}
+	worker.wake()
+}
+
+// runWorker processes one source's events sequentially until the source is retired
+// (or the queue closed) and no events are left
+// With several workers per source, each runs this loop and they share the events.
+func (eq *EventQueue) runWorker(worker *sourceWorker) {
+	defer eq.workers.Done()
+
+	for {
+		eq.mu.Lock()
+		for len(worker.events) == 0 {
+			if eq.closed || worker.retired {
+				worker.running--
+				eq.activeWorkers--
+				if worker.running == 0 && eq.sources[worker.sourceID] == worker {
+					delete(eq.sources, worker.sourceID)
+				}
+				worker.wake() // Let the source's other workers exit too
+				eq.mu.Unlock()
+				log.Printf("Event queue worker for %s stopped", worker.sourceID)
+				return
+			}
+			eq.mu.Unlock()
+			<-worker.signal
+			eq.mu.Lock()
+		}
+		eq.mu.Unlock()
+
+		// Hold the next event while paused; it stays visible in Snapshot
+		eq.waitWhilePaused()
+
+		eq.mu.Lock()
+		if len(worker.events) == 0 {
+			eq.mu.Unlock()
+			continue // Drained while paused
+		}
+		queuedEvent := worker.events[0]
+		worker.events = worker.events[1:]
+		if len(worker.events) > 0 {
+			worker.wake() // Hand the next event to another of the source's workers
+		}
+		eq.removePending(queuedEvent.seq)
+		processor := eq.processor
+		eq.mu.Unlock()
+
+		eq.processWithTimeout(processor, queuedEvent)
+		eq.release(1)
+	}
+}
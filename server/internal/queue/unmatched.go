@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Unmatched Events
+
+An event that matches no rule of the active scenarios starts nothing, so when a
+scenario is misconfigured the events that should have matched would otherwise only
+show up as log lines. The event handler keeps them in a dead-letter buffer instead,
+so scenario authors can see exactly which event types and payloads simulations send
+and write rules for them.
+
+The buffer holds the most recent size events; once full, the oldest is evicted for
+each new one. It is kept in memory only: every event taken off the queue is also
+recorded in the event log (see store/event_log.go), when one is configured.
+*/
+
+// DefaultUnmatchedEventsSize is how many unmatched events are kept unless configured otherwise
+const DefaultUnmatchedEventsSize = 1000
+
+// UnmatchedEvent is an event that matched no rule
+type UnmatchedEvent struct {
+	Source    string
+	Tenant    string
+	EventType string
+	EventID   string
+	Payload   map[string]interface{}
+	Timestamp time.Time
+}
+
+// UnmatchedEvents is a bounded buffer of the most recent unmatched events
+// It is safe for concurrent use.
+type UnmatchedEvents struct {
+	mu     sync.Mutex
+	size   int
+	events []UnmatchedEvent // Oldest first
+}
+
+// NewUnmatchedEvents creates a buffer keeping the size most recent unmatched events
+func NewUnmatchedEvents(size int) *UnmatchedEvents {
+	u := &UnmatchedEvents{}
+	u.SetSize(size)
+	return u
+}
+
+// SetSize sets how many events are kept (0 = none)
+// May be called at any time; shrinking the buffer evicts the oldest events at once.
+func (u *UnmatchedEvents) SetSize(size int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.size = max(size, 0)
+	u.trimLocked()
+}
+
+// Add records an unmatched event, evicting the oldest one if the buffer is full
+func (u *UnmatchedEvents) Add(event UnmatchedEvent) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.size == 0 {
+		return
+	}
+	u.events = append(u.events, event)
+	u.trimLocked()
+}
+
+// trimLocked evicts the oldest events beyond the buffer size
+// Caller must hold mu
+func (u *UnmatchedEvents) trimLocked() {
+	if len(u.events) > u.size {
+		u.events = u.events[len(u.events)-u.size:]
+	}
+}
+
+// List returns a copy of the buffered events, oldest first
+func (u *UnmatchedEvents) List() []UnmatchedEvent {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	result := make([]UnmatchedEvent, len(u.events))
+	copy(result, u.events)
+	return result
+}
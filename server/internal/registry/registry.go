@@ -1,8 +1,11 @@
 package registry
 
 import (
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/events"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
 	"github.com/gorilla/websocket"
 )
@@ -11,6 +14,7 @@ import (
 type Registry struct {
 	simulations map[string]*models.Simulation
 	mu          sync.RWMutex
+	hub         *events.Hub // Optional: receives connect and disconnect events
 }
 
 // NewRegistry creates a new simulation registry
@@ -20,22 +24,69 @@ func NewRegistry() *Registry {
 	}
 }
 
-// Register adds a new simulation to the registry
-func (r *Registry) Register(id, name string, conn *websocket.Conn) *models.Simulation {
+// SetEventHub sets the hub that is told about simulations registering and unregistering
+func (r *Registry) SetEventHub(hub *events.Hub) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	sim := &models.Simulation{
-		ID:         id,
-		Name:       name,
-		Connection: conn,
+	r.hub = hub
+}
+
+// Key returns the registry key for a simulation within a tenant
+// Simulations without a tenant are keyed by their bare ID, so single-tenant
+// deployments are unaffected. Tenant names must not contain "/".
+func Key(tenant, id string) string {
+	if tenant == "" {
+		return id
+	}
+	return tenant + "/" + id
+}
+
+// SplitKey splits a registry key into its tenant and simulation ID
+func SplitKey(key string) (tenant, id string) {
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i], key[i+1:]
 	}
+	return "", key
+}
 
-	r.simulations[id] = sim
+// Register adds a new simulation to the registry under Key(sim.Tenant, sim.ID)
+// Its ConnectedAt and LastActivity are set to now.
+func (r *Registry) Register(sim *models.Simulation) *models.Simulation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sim.ConnectedAt = time.Now()
+	sim.LastActivity = sim.ConnectedAt
+	r.simulations[Key(sim.Tenant, sim.ID)] = sim
+	r.hub.Publish(events.SimulationConnected, events.SimulationEvent{ID: sim.ID, Tenant: sim.Tenant, Name: sim.Name})
 	return sim
 }
 
-// Get retrieves a simulation by ID
+// Touch records that a message was just read from the simulation with the given
+// registry key; unknown keys are ignored
+func (r *Registry) Touch(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sim, exists := r.simulations[id]; exists {
+		sim.LastActivity = time.Now()
+	}
+}
+
+// LastActivity returns when a message was last read from the simulation with the
+// given registry key (zero if it isn't registered)
+func (r *Registry) LastActivity(id string) time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if sim, exists := r.simulations[id]; exists {
+		return sim.LastActivity
+	}
+	return time.Time{}
+}
+
+// Get retrieves a simulation by registry key (see Key)
 func (r *Registry) Get(id string) (*models.Simulation, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -44,15 +95,41 @@ func (r *Registry) Get(id string) (*models.Simulation, bool) {
 	return sim, exists
 }
 
-// Unregister removes a simulation from the registry
+// Unregister removes a simulation from the registry by registry key (see Key)
 func (r *Registry) Unregister(id string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	delete(r.simulations, id)
+	if sim, exists := r.simulations[id]; exists {
+		delete(r.simulations, id)
+		r.hub.Publish(events.SimulationDisconnected, events.SimulationEvent{ID: sim.ID, Tenant: sim.Tenant, Name: sim.Name})
+	}
 }
 
-// GetAll returns all registered simulations
+// UnregisterIf removes the simulation registered under key, but only if it is still sim
+// Returns false if key has since been registered again by a newer connection (or was
+// already unregistered), in which case the registry is left unchanged.
+func (r *Registry) UnregisterIf(key string, sim *models.Simulation) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, exists := r.simulations[key]; !exists || current != sim {
+		return false
+	}
+	delete(r.simulations, key)
+	r.hub.Publish(events.SimulationDisconnected, events.SimulationEvent{ID: sim.ID, Tenant: sim.Tenant, Name: sim.Name})
+	return true
+}
+
+// Count returns the number of registered simulations
+func (r *Registry) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.simulations)
+}
+
+// GetAll returns all registered simulations, keyed by registry key
 func (r *Registry) GetAll() map[string]*models.Simulation {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -63,3 +140,46 @@ func (r *Registry) GetAll() map[string]*models.Simulation {
 	}
 	return result
 }
+
+// Broadcast sends a message to all registered simulations concurrently
+// Each write is bounded by timeout. Returns the errors for simulations that could not be reached.
+func (r *Registry) Broadcast(msg models.Message, timeout time.Duration) map[string]error {
+	return SendAll(r.GetAll(), msg, timeout)
+}
+
+// SendAll sends a message to each of the given simulations concurrently
+// simulations is keyed by registry key, as returned by GetAll. Each write is bounded by
+// timeout. Returns the errors for simulations that could not be reached, by key.
+func SendAll(simulations map[string]*models.Simulation, msg models.Message, timeout time.Duration) map[string]error {
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	errs := make(map[string]error)
+
+	for id, sim := range simulations {
+		wg.Add(1)
+		go func(id string, sim *models.Simulation) {
+			defer wg.Done()
+
+			if err := sim.Send(msg, timeout); err != nil {
+				errMu.Lock()
+				errs[id] = err
+				errMu.Unlock()
+			}
+		}(id, sim)
+	}
+
+	wg.Wait()
+	return errs
+}
+
+// CloseAll sends a close frame to every registered simulation and closes its connection
+func (r *Registry) CloseAll(timeout time.Duration) {
+	simulations := r.GetAll()
+
+	for _, sim := range simulations {
+		// WriteControl may be called concurrently with Send, so it needs no write lock
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		sim.Connection.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(timeout))
+		sim.Connection.Close()
+	}
+}
@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+// connect returns a server-side connection and the client connected to it
+func connect(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			conns <- conn
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server = <-conns
+	t.Cleanup(func() { server.Close() })
+	return server, client
+}
+
+// Many goroutines writing to one simulation at once (Sagas, broadcasts, replies) must
+// not interleave frames. Run with -race.
+func TestConcurrentSends(t *testing.T) {
+	const senders, perSender = 20, 50
+
+	server, client := connect(t)
+	reg := NewRegistry()
+	sim := reg.Register(&models.Simulation{ID: "sim", Connection: server})
+
+	received := make(chan error, 1)
+	go func() {
+		seen := make(map[string]bool)
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for len(seen) < senders*perSender+senders {
+			var msg models.Message
+			if err := client.ReadJSON(&msg); err != nil {
+				received <- err
+				return
+			}
+			seen[msg.Command] = true
+		}
+		received <- nil
+	}()
+
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perSender; i++ {
+				command := strings.Repeat("x", 100) + "-" + string(rune('a'+s)) + "-" + string(rune('a'+i))
+				if err := sim.Send(models.Message{Type: "command", Command: command}, time.Second); err != nil {
+					t.Errorf("Send: %v", err)
+					return
+				}
+			}
+			// Broadcasts write to the same connection
+			reg.Broadcast(models.Message{Type: "broadcast", Command: "broadcast-" + string(rune('a'+s))}, time.Second)
+		}()
+	}
+	wg.Wait()
+
+	if err := <-received; err != nil {
+		t.Fatalf("client read failed, frames were corrupted: %v", err)
+	}
+}
+
+func TestUnregisterIf(t *testing.T) {
+	reg := NewRegistry()
+	old := reg.Register(&models.Simulation{ID: "sim"})
+	current := reg.Register(&models.Simulation{ID: "sim"})
+
+	if reg.UnregisterIf("sim", old) {
+		t.Fatal("UnregisterIf removed a simulation that was registered again")
+	}
+	if got, _ := reg.Get("sim"); got != current {
+		t.Fatal("the newer registration was replaced")
+	}
+	if !reg.UnregisterIf("sim", current) {
+		t.Fatal("UnregisterIf didn't remove the current registration")
+	}
+	if _, exists := reg.Get("sim"); exists {
+		t.Fatal("sim still registered")
+	}
+	if reg.UnregisterIf("sim", current) {
+		t.Fatal("UnregisterIf removed an unregistered simulation")
+	}
+}
@@ -0,0 +1,127 @@
+package saga
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Command Acknowledgments
+
+The step timeout covers the whole of a step: delivering the command and doing the
+work. A long-running step therefore needs a long timeout, and a command lost on a
+half-open connection is only noticed when that timeout expires.
+
+A simulation that registers with acks_commands: true promises to send a
+command.received message (with the command's saga_id and step_id) as soon as it
+receives a command, before doing the work. If no acknowledgment arrives within the
+command acknowledgment timeout, the step fails right away, exactly as if it had timed
+out, and compensation runs. Once acknowledged, only the step timeout applies.
+
+Simulations that don't declare acks_commands are never expected to acknowledge, and
+their steps are governed by the step timeout alone. A step.completed or step.failed
+report settles a step whether or not it was acknowledged first.
+*/
+
+// DefaultCommandAckTimeout is how long a command may wait for its acknowledgment unless
+// configured otherwise
+const DefaultCommandAckTimeout = 5 * time.Second
+
+// SetCommandAckTimeout sets how long a simulation that acknowledges commands has to
+// acknowledge one before its step fails (0 = no acknowledgment timeout)
+// May be called at any time; it applies to commands dispatched afterwards.
+func (sm *SagaManager) SetCommandAckTimeout(timeout time.Duration) {
+	sm.commandAckTimeout.Store(int64(max(timeout, 0)))
+}
+
+// startAckTimer fails the step if it is still in flight and unacknowledged when the
+// command acknowledgment timeout expires
+// Does nothing for simulations that don't acknowledge commands.
+func (sm *SagaManager) startAckTimer(saga *Saga, stepIndex int, targetSim *models.Simulation) {
+	timeout := time.Duration(sm.commandAckTimeout.Load())
+	if timeout <= 0 || !targetSim.AcksCommands {
+		return
+	}
+
+	step := saga.Steps[stepIndex]
+
+	saga.mu.Lock()
+	defer saga.mu.Unlock()
+
+	if step.ackTimer != nil {
+		step.ackTimer.Stop()
+		step.ackTimer = nil
+	}
+	if step.Status != StepStatusInFlight || step.commandAcked {
+		return
+	}
+
+	step.ackTimer = time.AfterFunc(timeout, func() {
+		saga.mu.Lock()
+		acked := step.commandAcked || step.Status != StepStatusInFlight
+		saga.mu.Unlock()
+		if acked {
+			return
+		}
+
+		sm.logSaga("error", saga.SagaID, step.TargetSimulation, "Saga %s: Step %d command not acknowledged by %s within %s", saga.SagaID, stepIndex, step.TargetSimulation, timeout)
+		reason := fmt.Sprintf("step %d command not acknowledged within %s by %s", stepIndex, timeout, step.TargetSimulation)
+		if err := sm.failStep(saga.SagaID, stepIndex, step.TargetSimulation, reason); err != nil {
+			log.Printf("Saga %s: Failed to handle step %d acknowledgment timeout: %v", saga.SagaID, stepIndex, err)
+		}
+	})
+}
+
+// HandleCommandReceived is called when a simulation acknowledges receiving a step's
+// command (command.received)
+// It stops the step's acknowledgment timer; the step timeout keeps running. An
+// acknowledgment for a step that is no longer in flight is ignored.
+func (sm *SagaManager) HandleCommandReceived(sagaID string, stepID int, simID string) error {
+	sm.mu.RLock()
+	saga, exists := sm.sagas[sagaID]
+	sm.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("saga not found: %s", sagaID)
+	}
+
+	saga.mu.Lock()
+	defer saga.mu.Unlock()
+
+	if stepID < 0 || stepID >= len(saga.Steps) {
+		return fmt.Errorf("invalid step ID: %d", stepID)
+	}
+
+	step := saga.Steps[stepID]
+
+	// Only the simulation the step was dispatched to may acknowledge it
+	if step.TargetSimulation != simID {
+		return fmt.Errorf("simulation %s is not the target of saga %s step %d", simID, sagaID, stepID)
+	}
+
+	if step.Status != StepStatusInFlight || step.commandAcked {
+		return nil
+	}
+
+	step.commandAcked = true
+	if step.ackTimer != nil {
+		step.ackTimer.Stop()
+		step.ackTimer = nil
+	}
+	log.Printf("Saga %s: Step %d command acknowledged by %s", sagaID, stepID, simID)
+	return nil
+}
+
+// restartAckTimer gives a re-sent, still unacknowledged command a new acknowledgment window
+func (sm *SagaManager) restartAckTimer(sagaID string, stepID int, targetSim *models.Simulation) {
+	sm.mu.RLock()
+	saga, exists := sm.sagas[sagaID]
+	sm.mu.RUnlock()
+
+	if exists && stepID >= 0 && stepID < len(saga.Steps) {
+		sm.startAckTimer(saga, stepID, targetSim)
+	}
+}
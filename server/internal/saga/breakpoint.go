@@ -0,0 +1,78 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+/*
+Step Breakpoints
+
+A step marked as a breakpoint (`breakpoint: true` on the scenario action) is not
+dispatched when the Saga reaches it. The Saga stays where it is, with the step Pending
+and all simulation locks held, until an operator calls ResumeStep. No step timeout
+runs while paused, since the step hasn't been sent. This allows step-through
+debugging against live simulations. A breakpoint on a member of a parallel group holds
+back the whole group, which is dispatched once every member's breakpoint is resumed.
+*/
+
+// ErrStepNotPaused is returned when resuming a step that isn't waiting at a breakpoint
+var ErrStepNotPaused = errors.New("step is not paused at a breakpoint")
+
+// pauseAtBreakpoint reports whether dispatching the step must wait for an operator
+func (sm *SagaManager) pauseAtBreakpoint(saga *Saga, stepIndex int) bool {
+	saga.mu.Lock()
+	defer saga.mu.Unlock()
+
+	step := saga.Steps[stepIndex]
+	if !step.Breakpoint || step.breakpointReleased {
+		return false
+	}
+
+	if saga.Status == SagaStatusPending {
+		saga.Status = SagaStatusInProgress
+	}
+	sm.logSaga("info", saga.SagaID, step.TargetSimulation, "Saga %s: Paused at breakpoint before step %d (%s to %s)", saga.SagaID, stepIndex, step.Command, step.TargetSimulation)
+	return true
+}
+
+// ResumeStep dispatches a step the Saga is paused at
+// If the dispatch fails, the Saga fails and compensates as for any dispatch failure.
+func (sm *SagaManager) ResumeStep(sagaID string, stepID int) error {
+	saga, exists := sm.GetSaga(sagaID)
+	if !exists {
+		return ErrSagaNotFound
+	}
+
+	saga.mu.Lock()
+	if stepID < 0 || stepID >= len(saga.Steps) {
+		saga.mu.Unlock()
+		return fmt.Errorf("invalid step ID: %d", stepID)
+	}
+	step := saga.Steps[stepID]
+	paused := step.Breakpoint && !step.breakpointReleased &&
+		step.Status == StepStatusPending && saga.Status == SagaStatusInProgress &&
+		stepID >= saga.CurrentStep && stepID < saga.stageEnd(saga.CurrentStep)
+	if !paused {
+		saga.mu.Unlock()
+		return fmt.Errorf("%w: saga %s step %d", ErrStepNotPaused, sagaID, stepID)
+	}
+	step.breakpointReleased = true
+	stageStart := saga.CurrentStep
+	saga.mu.Unlock()
+
+	sm.logSaga("info", sagaID, "", "Saga %s: Resumed at breakpoint, dispatching step %d", sagaID, stepID)
+
+	// A parallel group is dispatched as a whole, so resuming one member dispatches the
+	// group (or pauses again at another member's breakpoint)
+	if err := sm.dispatchStage(saga, stageStart); err != nil {
+		log.Printf("Saga %s: Failed to dispatch step %d: %v", sagaID, stageStart, err)
+		saga.mu.Lock()
+		saga.addFailureReason("step %d dispatch failed: %v", stageStart, err)
+		saga.mu.Unlock()
+		sm.triggerCompensation(saga, stageStart-1)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+Saga Cancellation
+
+An operator can stop a Saga that should never have started (e.g. it was triggered by
+bad data) with CancelSaga. Only an InProgress Saga can be cancelled; one that is
+already compensating or finished is left alone.
+
+Cancelling moves the Saga to Cancelling and compensates its completed steps as if a
+step had failed, in the usual order and with the usual acknowledgments. No further
+steps are dispatched. Steps in flight at that moment are marked Cancelled: their
+eventual step.completed or step.failed report is ignored, and they are not
+compensated, since there is no telling whether the simulation carried them out,
+unless they are marked compensate_on_partial (see compensation.go).
+Once every compensation is resolved the Saga ends Cancelled (or CompensationFailed if
+a compensation was not confirmed) and its simulation locks are released.
+*/
+
+// ErrSagaNotCancellable is returned when cancelling a Saga that is not in progress
+var ErrSagaNotCancellable = errors.New("saga is not in progress")
+
+// CancelSaga stops an InProgress Saga and compensates its completed steps
+// Returns ErrSagaNotFound for an unknown Saga and ErrSagaNotCancellable for one that is
+// compensating or has already finished.
+func (sm *SagaManager) CancelSaga(sagaID string) error {
+	saga, exists := sm.GetSaga(sagaID)
+	if !exists {
+		return ErrSagaNotFound
+	}
+
+	saga.mu.Lock()
+	if saga.Status != SagaStatusInProgress {
+		status := saga.Status
+		saga.mu.Unlock()
+		return fmt.Errorf("%w: %s is %s", ErrSagaNotCancellable, sagaID, status)
+	}
+
+	saga.Status = SagaStatusCancelling
+	saga.addFailureReason("cancelled by operator at step %d", saga.CurrentStep)
+	for _, step := range saga.Steps {
+		if step.Status == StepStatusInFlight {
+			step.Status = StepStatusCancelled
+			step.stopTimer()
+		}
+	}
+	// Completed members of the current parallel group are compensated too
+	lastStepToCompensate := saga.stageEnd(saga.CurrentStep) - 1
+	saga.mu.Unlock()
+
+	sm.logSaga("warning", sagaID, "", "Saga %s: Cancelled by operator", sagaID)
+
+	// Releases the locks and logs the summary once every compensation is resolved
+	sm.triggerCompensation(saga, lastStepToCompensate)
+	return nil
+}
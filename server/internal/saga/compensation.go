@@ -0,0 +1,408 @@
+package saga
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Acknowledged Compensation
+
+When a Saga fails, its completed steps are compensated one at a time, in the order
+given by compensationOrder. Each compensation waits for the simulation to confirm it:
+
+1. The compensate command is sent and the step moves to Compensating.
+2. The simulation replies with "step.compensated" (saga_id, step_id) once the rollback
+   has actually happened; the step moves to Compensated and the next compensation is
+   sent.
+3. If the simulation replies with "step.compensation_failed", doesn't reply within the
+   compensation timeout, or can't be reached at all, the compensation is retried (see
+   compensation_retry.go). Once its retries are used up, the step moves to
+   CompensationFailed and the remaining compensations still run.
+
+A step that was sent but never completed (it failed, timed out, lost its simulation, or
+was in flight when the Saga was cancelled) may still have done part of its work before
+the simulation crashed or gave up. Such a step is normally not compensated, but one
+marked compensate_on_partial is, best-effort: its compensation is sent first, since it
+ran last, and is acknowledged like any other. If it can't be delivered, it is skipped
+without failing the compensation, since nothing may have been applied. The
+simulation must treat a compensation for work it never did as a no-op and still
+acknowledge it; the compensation may also arrive while the forward command is still
+running (e.g. after a cancel or timeout).
+
+When no compensations are left, the Saga ends Failed if every compensation was
+confirmed, or CompensationFailed if any was not, meaning the simulations may be left
+inconsistent and need manual intervention. Only then are the Saga's simulation locks
+released and its summary logged, so no other Saga can use a simulation that is still
+rolling back.
+
+Like the forward steps, this is event-driven: nothing blocks while waiting for an
+acknowledgment, so the acknowledgment can arrive on any connection (including the one
+that reported the failure).
+*/
+
+// DefaultCompensationTimeout is how long a compensation waits for its acknowledgment
+// unless configured otherwise
+const DefaultCompensationTimeout = 30 * time.Second
+
+// SetCompensationTimeout sets how long a compensation may wait for "step.compensated"
+// before it is considered failed (0 = wait indefinitely)
+// May be called at any time; it applies to compensations sent afterwards.
+func (sm *SagaManager) SetCompensationTimeout(timeout time.Duration) {
+	sm.compensationTimeout.Store(int64(timeout))
+}
+
+// triggerCompensation starts compensating the completed steps up to lastStepToCompensate
+// This ensures eventual consistency: if any step fails, all previous steps are rolled back
+func (sm *SagaManager) triggerCompensation(saga *Saga, lastStepToCompensate int) {
+	saga.mu.Lock()
+	// A cancelled Saga stays Cancelling while it compensates
+	if saga.Status != SagaStatusCancelling {
+		saga.Status = SagaStatusCompensating
+	}
+	// Compensate in reverse completion order (most recent first), adjusted for
+	// any declared compensate_after dependencies
+	saga.compensationQueue = compensationOrder(saga, lastStepToCompensate)
+	saga.mu.Unlock()
+
+	sm.logSaga("warning", saga.SagaID, "", "Saga %s: Starting compensation from step %d", saga.SagaID, lastStepToCompensate)
+	sm.compensateNext(saga)
+}
+
+// compensateNext sends the next compensation that can run and waits for its
+// acknowledgment, or finishes the Saga if none are left
+func (sm *SagaManager) compensateNext(saga *Saga) {
+	for {
+		saga.mu.Lock()
+		if len(saga.compensationQueue) == 0 {
+			saga.mu.Unlock()
+			sm.finishCompensation(saga)
+			return
+		}
+		i := saga.compensationQueue[0]
+		saga.compensationQueue = saga.compensationQueue[1:]
+		step := saga.Steps[i]
+
+		// Only compensate steps that were completed, or that were sent and may have
+		// partly applied if the step asks for it
+		partial := step.isPartial()
+		if step.Status != StepStatusCompleted && !partial {
+			saga.mu.Unlock()
+			log.Printf("Saga %s: Skipping compensation for step %d (status: %s)", saga.SagaID, i, step.Status)
+			continue
+		}
+
+		// Check if compensation command is defined
+		if step.CompensateCommand == "" && partial {
+			saga.mu.Unlock()
+			log.Printf("Saga %s: Step %d may have partly applied but has no compensation command, skipping", saga.SagaID, i)
+			continue
+		}
+		if step.CompensateCommand == "" {
+			log.Printf("Saga %s: Step %d has no compensation command, skipping", saga.SagaID, i)
+			if sm.strict {
+				saga.addFailureReason("step %d completed but has no compensation command", i)
+			}
+			saga.mu.Unlock()
+			continue
+		}
+
+		// A rollback that can't be delivered didn't happen
+		targetSim, exists := sm.registry.Get(step.TargetSimulation)
+		if !exists && partial {
+			sm.logSaga("warning", saga.SagaID, step.TargetSimulation, "Saga %s: Skipping best-effort compensation for partial step %d: simulation %s not connected", saga.SagaID, i, step.TargetSimulation)
+			saga.mu.Unlock()
+			continue
+		}
+		if !exists {
+			sm.logSaga("error", saga.SagaID, step.TargetSimulation, "Saga %s: Target simulation not found for compensation: %s", saga.SagaID, step.TargetSimulation)
+			reason := fmt.Sprintf("step %d could not be compensated: simulation %s not connected", i, step.TargetSimulation)
+			step.Status = StepStatusCompensating
+			if sm.retryCompensationLocked(saga, i, reason) {
+				saga.mu.Unlock()
+				sm.persist(saga)
+				return
+			}
+			step.Status = StepStatusCompensationFailed
+			saga.addFailureReason("%s", reason)
+			sm.deadLetterLocked(saga, i, reason)
+			saga.mu.Unlock()
+			continue
+		}
+
+		// Compensation params may reference the forward params ("$forward.<path>"),
+		// which the step keeps unchanged for its whole lifetime, and the forward step's
+		// result ("{{ result.<path> }}"), which is nil if it never completed
+		compensateParams, missing := resolveCompensateParams(step.CompensateParams, step.Params, step.Result)
+		missingForward, missingResults := splitMissingRefs(missing)
+
+		// An unresolved "$forward.<path>" would reach the simulation as a literal token,
+		// so the compensation isn't sent; retrying can't resolve it either
+		if len(missingForward) > 0 {
+			reason := fmt.Sprintf("step %d compensation references missing forward params: %s", i, strings.Join(missingForward, ", "))
+			if partial {
+				sm.logSaga("warning", saga.SagaID, step.TargetSimulation, "Saga %s: Skipping best-effort compensation for partial step %d: %s", saga.SagaID, i, reason)
+				saga.mu.Unlock()
+				continue
+			}
+			sm.abandonCompensationLocked(saga, i, reason)
+			saga.mu.Unlock()
+			sm.persist(saga)
+			continue
+		}
+		// Likewise a result template whose result was too large to keep: rendering it
+		// as "" could roll back the wrong thing
+		if len(missingResults) > 0 && step.ResultDiscarded {
+			sm.abandonCompensationLocked(saga, i, fmt.Sprintf("step %d compensation references %s", i, sm.discardedResultReason(i)))
+			saga.mu.Unlock()
+			sm.persist(saga)
+			continue
+		}
+		if len(missingResults) > 0 {
+			log.Printf("Saga %s: Step %d compensation references missing result fields: %s", saga.SagaID, i, strings.Join(missingResults, ", "))
+			if sm.strict {
+				saga.addFailureReason("step %d compensation references missing result fields: %s", i, strings.Join(missingResults, ", "))
+			}
+		}
+
+		// Mark the step before sending so a fast acknowledgment finds it Compensating
+		if partial {
+			step.forwardStatus = step.Status
+		}
+		step.Status = StepStatusCompensating
+		sm.startCompensationTimer(saga, i)
+		saga.mu.Unlock()
+		sm.persist(saga)
+
+		// Create compensation command
+		stepIDPtr := &i
+		compensateMsg := models.Message{
+			Type:    "command",
+			Command: step.CompensateCommand,
+			Params:  compensateParams,
+			SagaID:  saga.SagaID,
+			StepID:  stepIDPtr,
+			Tenant:  saga.Tenant,
+		}
+
+		// Send compensation command
+		if err := targetSim.Send(compensateMsg, 0); err != nil {
+			sm.commandWriteErrors.Add(1)
+			sm.logSaga("error", saga.SagaID, step.TargetSimulation, "Saga %s: Failed to send compensation command for step %d: %v", saga.SagaID, i, err)
+			if partial {
+				sm.skipPartialCompensation(saga, i)
+				continue
+			}
+			reason := fmt.Sprintf("step %d compensation could not be sent: %v", i, err)
+			if sm.retryCompensation(saga, i, reason) {
+				return
+			}
+			// Continue with other compensations even if one fails
+			sm.failCompensation(saga, i, reason)
+			continue
+		}
+
+		sm.logSaga("info", saga.SagaID, step.TargetSimulation, "Saga %s: Compensation command sent for step %d to %s, awaiting acknowledgment", saga.SagaID, i, step.TargetSimulation)
+		sm.recordCommand(step.TargetSimulation, compensateMsg)
+		return
+	}
+}
+
+// abandonCompensationLocked marks a step's compensation failed for good without sending
+// it, and dead-letters it
+// Must be called with the saga's lock held
+func (sm *SagaManager) abandonCompensationLocked(saga *Saga, stepIndex int, reason string) {
+	step := saga.Steps[stepIndex]
+	sm.logSaga("error", saga.SagaID, step.TargetSimulation, "Saga %s: Not sending compensation: %s", saga.SagaID, reason)
+	step.Status = StepStatusCompensationFailed
+	saga.addFailureReason("%s", reason)
+	sm.deadLetterLocked(saga, stepIndex, reason)
+}
+
+// isPartial reports whether the step was sent but didn't complete, and asks to be
+// compensated anyway (compensate_on_partial)
+// Steps that couldn't be sent go back to Pending, so Failed and Cancelled steps were sent.
+// Must be called with the saga's lock held
+func (step *SagaStep) isPartial() bool {
+	return step.CompensateOnPartial && (step.Status == StepStatusFailed || step.Status == StepStatusCancelled)
+}
+
+// skipPartialCompensation gives up on a partial step's best-effort compensation that
+// couldn't be sent, returning the step to its forward status
+func (sm *SagaManager) skipPartialCompensation(saga *Saga, stepIndex int) {
+	saga.mu.Lock()
+	defer saga.mu.Unlock()
+
+	step := saga.Steps[stepIndex]
+	if step.Status != StepStatusCompensating {
+		return
+	}
+	step.Status = step.forwardStatus
+	step.forwardStatus = ""
+	step.stopTimer()
+}
+
+// startCompensationTimer fails the compensation if it isn't acknowledged in time
+// Must be called with the saga's lock held
+func (sm *SagaManager) startCompensationTimer(saga *Saga, stepIndex int) {
+	step := saga.Steps[stepIndex]
+	step.stopTimer()
+
+	timeout := time.Duration(sm.compensationTimeout.Load())
+	if timeout <= 0 {
+		return
+	}
+
+	step.timer = time.AfterFunc(timeout, func() {
+		reason := fmt.Sprintf("step %d compensation timed out after %s on %s", stepIndex, timeout, step.TargetSimulation)
+		if sm.retryCompensation(saga, stepIndex, reason) {
+			return
+		}
+		if sm.failCompensation(saga, stepIndex, reason) {
+			sm.logSaga("error", saga.SagaID, step.TargetSimulation, "Saga %s: Step %d compensation not acknowledged within %s", saga.SagaID, stepIndex, timeout)
+			sm.compensateNext(saga)
+		}
+	})
+}
+
+// failCompensation marks a step's compensation failed for good, and dead-letters it, if
+// it is still awaiting acknowledgment
+// Returns false if the compensation was already resolved (e.g. an acknowledgment won a
+// race with the timeout). The caller moves on to the next compensation.
+func (sm *SagaManager) failCompensation(saga *Saga, stepIndex int, reason string) bool {
+	saga.mu.Lock()
+	defer saga.mu.Unlock()
+
+	step := saga.Steps[stepIndex]
+	if step.Status != StepStatusCompensating {
+		return false
+	}
+	step.Status = StepStatusCompensationFailed
+	step.stopTimer()
+	saga.addFailureReason("%s", reason)
+	sm.deadLetterLocked(saga, stepIndex, reason)
+	return true
+}
+
+// finishCompensation puts a Saga whose compensations are all resolved in its final status
+// and releases its simulation locks
+func (sm *SagaManager) finishCompensation(saga *Saga) {
+	saga.mu.Lock()
+	switch saga.Status {
+	case SagaStatusCompensating:
+		saga.Status = SagaStatusFailed
+	case SagaStatusCancelling:
+		saga.Status = SagaStatusCancelled
+	default:
+		// Already finished (compensateNext ran out of work on two goroutines at once)
+		saga.mu.Unlock()
+		return
+	}
+	for _, step := range saga.Steps {
+		if step.Status == StepStatusCompensationFailed {
+			saga.Status = SagaStatusCompensationFailed
+			break
+		}
+	}
+	status := saga.Status
+	saga.mu.Unlock()
+
+	if status == SagaStatusCompensationFailed {
+		sm.logSaga("error", saga.SagaID, "", "Saga %s: Compensation incomplete, manual intervention needed", saga.SagaID)
+	} else {
+		sm.logSaga("info", saga.SagaID, "", "Saga %s: Compensation completed", saga.SagaID)
+	}
+
+	sm.releaseSagaLocks(saga)
+	sm.persist(saga)
+	sm.logSummary(saga)
+}
+
+// HandleStepCompensated is called when a simulation confirms a compensation with
+// step.compensated; the next compensation is then sent
+// simID is the simulation reporting; it must be the step's target
+func (sm *SagaManager) HandleStepCompensated(sagaID string, stepID int, simID string) error {
+	saga, step, err := sm.lockCompensatingStep(sagaID, stepID, simID)
+	if err != nil || step == nil {
+		return err
+	}
+
+	step.Status = StepStatusCompensated
+	step.stopTimer()
+	saga.compensationsRun++
+	saga.mu.Unlock()
+
+	sm.logSaga("info", sagaID, simID, "Saga %s: Step %d compensation acknowledged by %s", sagaID, stepID, simID)
+	sm.compensateNext(saga)
+	return nil
+}
+
+// HandleCompensationFailure is called when a simulation reports with
+// step.compensation_failed that it could not roll a step back
+// simID is the simulation reporting; it must be the step's target
+func (sm *SagaManager) HandleCompensationFailure(sagaID string, stepID int, simID string) error {
+	saga, step, err := sm.lockCompensatingStep(sagaID, stepID, simID)
+	if err != nil || step == nil {
+		return err
+	}
+
+	reason := fmt.Sprintf("step %d compensation failed on %s", stepID, simID)
+	if sm.retryCompensationLocked(saga, stepID, reason) {
+		saga.mu.Unlock()
+		return nil
+	}
+	step.Status = StepStatusCompensationFailed
+	step.stopTimer()
+	saga.addFailureReason("%s", reason)
+	sm.deadLetterLocked(saga, stepID, reason)
+	saga.mu.Unlock()
+
+	sm.logSaga("error", sagaID, simID, "Saga %s: Step %d compensation failed on %s", sagaID, stepID, simID)
+	sm.compensateNext(saga)
+	return nil
+}
+
+// lockCompensatingStep looks up a step whose compensation a simulation is reporting on
+// On success the Saga's lock is held and the step is Compensating. A nil step with a nil
+// error means the report is orphaned and was ignored (non-strict mode).
+func (sm *SagaManager) lockCompensatingStep(sagaID string, stepID int, simID string) (*Saga, *SagaStep, error) {
+	sm.mu.RLock()
+	saga, exists := sm.sagas[sagaID]
+	sm.mu.RUnlock()
+
+	if !exists {
+		return nil, nil, fmt.Errorf("saga not found: %s", sagaID)
+	}
+
+	saga.mu.Lock()
+
+	if stepID < 0 || stepID >= len(saga.Steps) {
+		saga.mu.Unlock()
+		return nil, nil, fmt.Errorf("invalid step ID: %d", stepID)
+	}
+
+	step := saga.Steps[stepID]
+
+	// Only the simulation that was asked to compensate may report on it
+	if step.TargetSimulation != simID {
+		saga.mu.Unlock()
+		log.Printf("Warning: Saga %s: Step %d compensation report from %s rejected (step targets %s)", sagaID, stepID, simID, step.TargetSimulation)
+		return nil, nil, fmt.Errorf("simulation %s is not the target of saga %s step %d", simID, sagaID, stepID)
+	}
+
+	if step.Status != StepStatusCompensating {
+		status := step.Status
+		saga.mu.Unlock()
+		log.Printf("Saga %s: Step %d is not awaiting compensation (status: %s), ignoring report", sagaID, stepID, status)
+		if sm.strict {
+			return nil, nil, fmt.Errorf("orphaned compensation report: saga %s step %d is not awaiting compensation (status: %s)", sagaID, stepID, status)
+		}
+		return nil, nil, nil
+	}
+
+	return saga, step, nil
+}
@@ -0,0 +1,97 @@
+package saga
+
+import (
+	"log"
+	"sort"
+)
+
+/*
+Compensation Ordering
+
+By default, compensations run in reverse completion order (most recently completed step
+first), after any partial steps being compensated (see compensation.go). A step may
+declare `compensate_after` — a list of step IDs whose compensations must run BEFORE its
+own. For example, if undoing step 0 requires step 2 to be undone first, step 0 declares
+`compensate_after: [2]`.
+
+compensationOrder topologically sorts the steps to compensate by these constraints.
+Whenever several steps are free to run, the one that completed most recently goes first,
+so steps without declared dependencies keep the default reverse-completion order.
+Dependencies on steps that aren't being compensated are ignored. If the constraints
+contain a cycle, the steps involved fall back to reverse-completion order.
+*/
+
+// compensationOrder returns the step indices in the order their compensations should run
+// Must be called with the saga's lock held (reads step status and completion times)
+func compensationOrder(saga *Saga, lastStepToCompensate int) []int {
+	// Candidate steps, most recently completed first (the fallback order)
+	candidates := make([]int, 0, lastStepToCompensate+1)
+	for i := lastStepToCompensate; i >= 0; i-- {
+		candidates = append(candidates, i)
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return completedLater(saga.Steps[candidates[a]], saga.Steps[candidates[b]])
+	})
+
+	inSet := make(map[int]bool, len(candidates))
+	for _, i := range candidates {
+		inSet[i] = true
+	}
+
+	// remaining[i] = number of steps that must be compensated before step i
+	// dependents[j] = steps waiting on step j's compensation
+	remaining := make(map[int]int, len(candidates))
+	dependents := make(map[int][]int)
+	for _, i := range candidates {
+		for _, dep := range saga.Steps[i].CompensateAfter {
+			if dep == i || !inSet[dep] {
+				continue
+			}
+			remaining[i]++
+			dependents[dep] = append(dependents[dep], i)
+		}
+	}
+
+	order := make([]int, 0, len(candidates))
+	done := make(map[int]bool, len(candidates))
+	for len(order) < len(candidates) {
+		// Pick the first ready step in fallback order
+		next := -1
+		for _, i := range candidates {
+			if !done[i] && remaining[i] == 0 {
+				next = i
+				break
+			}
+		}
+
+		if next == -1 {
+			// Cycle: take the remaining steps in fallback order
+			log.Printf("Saga %s: Cycle in compensate_after dependencies, using reverse completion order for remaining steps", saga.SagaID)
+			for _, i := range candidates {
+				if !done[i] {
+					order = append(order, i)
+					done[i] = true
+				}
+			}
+			break
+		}
+
+		order = append(order, next)
+		done[next] = true
+		for _, dependent := range dependents[next] {
+			remaining[dependent]--
+		}
+	}
+
+	return order
+}
+
+// completedLater reports whether step a completed after step b
+// Steps that never completed sort before completed ones, since any that are compensated
+// (compensate_on_partial) ran last, and keep their relative order
+func completedLater(a, b *SagaStep) bool {
+	if a.CompletedAt == nil || b.CompletedAt == nil {
+		return a.CompletedAt == nil && b.CompletedAt != nil
+	}
+	return a.CompletedAt.After(*b.CompletedAt)
+}
@@ -0,0 +1,156 @@
+package saga
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+func TestCompensationOrder(t *testing.T) {
+	base := time.Now()
+	at := func(seconds int) *time.Time {
+		completed := base.Add(time.Duration(seconds) * time.Second)
+		return &completed
+	}
+
+	type step struct {
+		completedAt *time.Time
+		after       []int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		last  int // Last step to compensate
+		want  []int
+	}{
+		{
+			name:  "reverse completion order by default",
+			steps: []step{{completedAt: at(1)}, {completedAt: at(2)}, {completedAt: at(3)}},
+			last:  2,
+			want:  []int{2, 1, 0},
+		},
+		{
+			name:  "completion time, not step index",
+			steps: []step{{completedAt: at(3)}, {completedAt: at(1)}, {completedAt: at(2)}},
+			last:  2,
+			want:  []int{0, 2, 1},
+		},
+		{
+			name:  "partial step first",
+			steps: []step{{completedAt: at(1)}, {completedAt: nil}, {completedAt: at(2)}},
+			last:  2,
+			want:  []int{1, 2, 0},
+		},
+		{
+			name:  "dependency delays a step",
+			steps: []step{{completedAt: at(1)}, {completedAt: at(2)}, {completedAt: at(3), after: []int{0}}},
+			last:  2,
+			want:  []int{1, 0, 2},
+		},
+		{
+			name:  "dependency chain",
+			steps: []step{{completedAt: at(1)}, {completedAt: at(2), after: []int{0}}, {completedAt: at(3), after: []int{1}}},
+			last:  2,
+			want:  []int{0, 1, 2},
+		},
+		{
+			name:  "several dependencies",
+			steps: []step{{completedAt: at(1), after: []int{1, 2}}, {completedAt: at(2)}, {completedAt: at(3), after: []int{1}}},
+			last:  2,
+			want:  []int{1, 2, 0},
+		},
+		{
+			name:  "dependency on a step not compensated is ignored",
+			steps: []step{{completedAt: at(1)}, {completedAt: at(2), after: []int{2}}, {}},
+			last:  1,
+			want:  []int{1, 0},
+		},
+		{
+			name:  "self-dependency is ignored",
+			steps: []step{{completedAt: at(1)}, {completedAt: at(2), after: []int{1}}, {completedAt: at(3)}},
+			last:  2,
+			want:  []int{2, 1, 0},
+		},
+		{
+			name:  "cycle falls back to reverse completion order",
+			steps: []step{{completedAt: at(1), after: []int{2}}, {completedAt: at(2)}, {completedAt: at(3), after: []int{0}}},
+			last:  2,
+			want:  []int{1, 2, 0},
+		},
+		{
+			name: "steps outside a cycle keep their dependencies",
+			steps: []step{
+				{completedAt: at(1), after: []int{1}},
+				{completedAt: at(2), after: []int{0}},
+				{completedAt: at(3), after: []int{3}},
+				{completedAt: at(4)},
+			},
+			last: 3,
+			want: []int{3, 2, 1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saga := &Saga{SagaID: "saga_test"}
+			for i, s := range tt.steps {
+				saga.Steps = append(saga.Steps, &SagaStep{StepID: i, CompletedAt: s.completedAt, CompensateAfter: s.after})
+			}
+			if got := compensationOrder(saga, tt.last); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("compensationOrder = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompensationFollowsDependencies(t *testing.T) {
+	sm, reg := newTestManager(t)
+	sims := []*testSim{connectSim(t, reg, "a"), connectSim(t, reg, "b"), connectSim(t, reg, "c")}
+	connectSim(t, reg, "d")
+
+	steps := actions("a", "b", "c", "d")
+	for i := range steps[:3] {
+		steps[i].CompensateCommand = "undo" + steps[i].Command
+	}
+	// Step 2 may only be undone once step 0 has been
+	steps[2].CompensateAfter = []int{0}
+
+	saga, err := sm.CreateSaga(context.Background(), steps, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	for i, sim := range sims {
+		sim.next(t)
+		if err := sm.HandleStepCompletion(saga.SagaID, i, sim.ID, nil); err != nil {
+			t.Fatal(err)
+		}
+		// Distinct completion times
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := sm.HandleStepFailure(saga.SagaID, 3, "d"); err != nil {
+		t.Fatal(err)
+	}
+
+	order := []int{1, 0, 2}
+	for n, i := range order {
+		msg := sims[i].next(t)
+		if msg.Command != "undocmd"+strconv.Itoa(i) {
+			t.Fatalf("step %d's simulation got %q, want its compensation", i, msg.Command)
+		}
+		// Compensations run one at a time
+		time.Sleep(20 * time.Millisecond)
+		for _, j := range order[n+1:] {
+			if len(sims[j].messages) > 0 {
+				t.Fatalf("step %d compensated before step %d finished compensating", j, i)
+			}
+		}
+		if err := sm.HandleStepCompensated(saga.SagaID, i, sims[i].ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForStatus(t, saga, SagaStatusFailed)
+}
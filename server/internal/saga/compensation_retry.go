@@ -0,0 +1,171 @@
+package saga
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Compensation Retries and Dead Letters
+
+A compensation that fails (its simulation isn't connected, the command can't be sent,
+it isn't acknowledged within the compensation timeout, or the simulation reports
+step.compensation_failed) is retried before the step is given up on: after the retry
+delay the step goes back to the front of the compensation queue and its compensate
+command is sent again. Meanwhile the Saga waits, as it does for an acknowledgment,
+and the step stays Compensating, so an acknowledgment of an earlier attempt that
+arrives late still counts. Best-effort compensations of partial steps that can't be
+sent are skipped as before, without retries.
+
+A step whose compensation still fails after the last retry is CompensationFailed: the
+rollback never happened and someone has to do it by hand. Such steps are added to the
+dead-letter list (see GetCompensationDeadLetters), which keeps everything needed for
+that: the target, the compensate command and params, and why it failed. The list is
+kept in memory and holds the most recent entries, up to its size (see
+SetCompensationDeadLetterSize); once full, the oldest is evicted for each new one. The
+Saga store keeps the step itself, with its CompensationFailed status.
+*/
+
+// Default compensation retry settings (see SetCompensationRetries)
+const (
+	DefaultCompensationRetries    = 2
+	DefaultCompensationRetryDelay = time.Second
+)
+
+// DefaultCompensationDeadLetterSize is how many dead letters are kept unless configured otherwise
+const DefaultCompensationDeadLetterSize = 1000
+
+// CompensationDeadLetter is a step whose compensation failed for good and needs a
+// manual rollback
+type CompensationDeadLetter struct {
+	SagaID            string
+	StepID            int
+	Tenant            string
+	TargetSimulation  string
+	CompensateCommand string
+	CompensateParams  map[string]interface{}
+	Reason            string // Why the last attempt failed
+	Attempts          int    // Compensation attempts made, retries included
+	Timestamp         time.Time
+}
+
+// deadLetters is the bounded list of the most recent compensations that failed for good
+type deadLetters struct {
+	mu      sync.Mutex
+	size    int
+	entries []CompensationDeadLetter // Oldest first
+}
+
+// trimLocked evicts the oldest entries beyond the list size
+// Caller must hold mu
+func (d *deadLetters) trimLocked() {
+	if len(d.entries) > d.size {
+		d.entries = d.entries[len(d.entries)-d.size:]
+	}
+}
+
+// SetCompensationRetries sets how many times a failed compensation is retried before
+// the step is given up on, and how long to wait before each retry
+// May be called at any time; it applies to compensations failing afterwards.
+func (sm *SagaManager) SetCompensationRetries(retries int, delay time.Duration) {
+	sm.compensationRetries.Store(int64(max(retries, 0)))
+	sm.compensationRetryDelay.Store(int64(max(delay, 0)))
+}
+
+// SetCompensationDeadLetterSize sets how many dead letters are kept (0 = none)
+// May be called at any time; shrinking the list evicts the oldest entries at once.
+func (sm *SagaManager) SetCompensationDeadLetterSize(size int) {
+	sm.deadLetters.mu.Lock()
+	defer sm.deadLetters.mu.Unlock()
+
+	sm.deadLetters.size = max(size, 0)
+	sm.deadLetters.trimLocked()
+}
+
+// GetCompensationDeadLetters returns the steps whose compensation failed for good,
+// oldest first
+func (sm *SagaManager) GetCompensationDeadLetters() []CompensationDeadLetter {
+	sm.deadLetters.mu.Lock()
+	defer sm.deadLetters.mu.Unlock()
+
+	result := make([]CompensationDeadLetter, len(sm.deadLetters.entries))
+	copy(result, sm.deadLetters.entries)
+	return result
+}
+
+// retryCompensation schedules another attempt at a step's compensation if it is still
+// awaiting acknowledgment and has retries left
+// Returns false if it doesn't; the caller then fails the compensation.
+func (sm *SagaManager) retryCompensation(saga *Saga, stepIndex int, reason string) bool {
+	saga.mu.Lock()
+	defer saga.mu.Unlock()
+
+	if saga.Steps[stepIndex].Status != StepStatusCompensating {
+		return false
+	}
+	return sm.retryCompensationLocked(saga, stepIndex, reason)
+}
+
+// retryCompensationLocked schedules another attempt at a Compensating step's
+// compensation if it has retries left, and reports whether it did
+// Must be called with the saga's lock held
+func (sm *SagaManager) retryCompensationLocked(saga *Saga, stepIndex int, reason string) bool {
+	step := saga.Steps[stepIndex]
+	retries := int(sm.compensationRetries.Load())
+	if step.compensationRetries >= retries {
+		return false
+	}
+	step.compensationRetries++
+
+	delay := time.Duration(sm.compensationRetryDelay.Load())
+	sm.logSaga("warning", saga.SagaID, step.TargetSimulation, "Saga %s: %s, retrying in %s (retry %d of %d)", saga.SagaID, reason, delay, step.compensationRetries, retries)
+
+	saga.compensationQueue = append([]int{stepIndex}, saga.compensationQueue...)
+	step.stopTimer()
+	step.timer = time.AfterFunc(delay, func() {
+		saga.mu.Lock()
+		if step.Status != StepStatusCompensating {
+			// An earlier attempt was acknowledged meanwhile
+			saga.mu.Unlock()
+			return
+		}
+		// Back to the status compensateNext expects of a step to compensate
+		if step.forwardStatus != "" {
+			step.Status = step.forwardStatus
+			step.forwardStatus = ""
+		} else {
+			step.Status = StepStatusCompleted
+		}
+		step.timer = nil
+		saga.mu.Unlock()
+
+		sm.compensateNext(saga)
+	})
+	return true
+}
+
+// deadLetterLocked adds a step whose compensation failed for good to the dead-letter list
+// Must be called with the saga's lock held
+func (sm *SagaManager) deadLetterLocked(saga *Saga, stepIndex int, reason string) {
+	step := saga.Steps[stepIndex]
+	compensateParams, _ := resolveCompensateParams(step.CompensateParams, step.Params, step.Result)
+
+	sm.deadLetters.mu.Lock()
+	if sm.deadLetters.size > 0 {
+		sm.deadLetters.entries = append(sm.deadLetters.entries, CompensationDeadLetter{
+			SagaID:            saga.SagaID,
+			StepID:            stepIndex,
+			Tenant:            saga.Tenant,
+			TargetSimulation:  step.TargetSimulation,
+			CompensateCommand: step.CompensateCommand,
+			CompensateParams:  compensateParams,
+			Reason:            reason,
+			Attempts:          step.compensationRetries + 1,
+			Timestamp:         time.Now(),
+		})
+		sm.deadLetters.trimLocked()
+	}
+	sm.deadLetters.mu.Unlock()
+
+	sm.logSaga("error", saga.SagaID, step.TargetSimulation, "Saga %s: Step %d compensation given up after %d attempts, needs manual rollback: %s", saga.SagaID, stepIndex, step.compensationRetries+1, reason)
+}
@@ -0,0 +1,86 @@
+package saga
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+// deadLetterSaga runs a Saga whose step 0 compensation fails for good and returns its ID
+// Compensation retries must be off.
+func deadLetterSaga(t *testing.T, sm *SagaManager, x, y *testSim) string {
+	t.Helper()
+
+	steps := actions("x", "y")
+	steps[0].CompensateCommand = "undo"
+	saga, err := sm.CreateSaga(context.Background(), steps, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	y.next(t)
+	if err := sm.HandleStepFailure(saga.SagaID, 1, "y"); err != nil {
+		t.Fatal(err)
+	}
+	x.next(t)
+	if err := sm.HandleCompensationFailure(saga.SagaID, 0, "x"); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, saga, SagaStatusCompensationFailed)
+	return saga.SagaID
+}
+
+// deadLetterIDs returns the Saga IDs of the dead letters, oldest first
+func deadLetterIDs(sm *SagaManager) []string {
+	ids := []string{}
+	for _, entry := range sm.GetCompensationDeadLetters() {
+		ids = append(ids, entry.SagaID)
+	}
+	return ids
+}
+
+func TestDeadLettersKeepMostRecent(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x, y := connectSim(t, reg, "x"), connectSim(t, reg, "y")
+	sm.SetCompensationRetries(0, 0)
+	sm.SetCompensationDeadLetterSize(2)
+
+	var sagaIDs []string
+	for range 3 {
+		sagaIDs = append(sagaIDs, deadLetterSaga(t, sm, x, y))
+	}
+
+	entries := sm.GetCompensationDeadLetters()
+	if got := deadLetterIDs(sm); len(got) != 2 || got[0] != sagaIDs[1] || got[1] != sagaIDs[2] {
+		t.Fatalf("dead letters = %v, want the last two of %v", got, sagaIDs)
+	}
+	if entry := entries[1]; entry.StepID != 0 || entry.TargetSimulation != "x" || entry.CompensateCommand != "undo" || entry.Attempts != 1 {
+		t.Fatalf("dead letter = %+v, want step 0 on x with undo after 1 attempt", entry)
+	}
+
+	// Shrinking the list evicts the oldest entries at once
+	sm.SetCompensationDeadLetterSize(1)
+	if got := deadLetterIDs(sm); len(got) != 1 || got[0] != sagaIDs[2] {
+		t.Fatalf("dead letters = %v after shrinking, want only %s", got, sagaIDs[2])
+	}
+
+	// 0 keeps none
+	sm.SetCompensationDeadLetterSize(0)
+	deadLetterSaga(t, sm, x, y)
+	if got := deadLetterIDs(sm); len(got) != 0 {
+		t.Fatalf("dead letters = %v with size 0, want none", got)
+	}
+}
+
+func TestDeadLetterSizeDefault(t *testing.T) {
+	sm, _ := newTestManager(t)
+	sm.deadLetters.mu.Lock()
+	defer sm.deadLetters.mu.Unlock()
+	if sm.deadLetters.size != DefaultCompensationDeadLetterSize {
+		t.Fatalf("dead-letter size = %d, want %d", sm.deadLetters.size, DefaultCompensationDeadLetterSize)
+	}
+}
@@ -0,0 +1,50 @@
+package saga
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+)
+
+// stepResults returns the Saga's step results in the form step conditions are matched
+// against (see scenario/step_conditions.go): {"steps": {"<step index>": result}}
+// Steps without a result are left out. Caller must hold saga.mu.
+func (saga *Saga) stepResults() map[string]interface{} {
+	results := make(map[string]interface{}, len(saga.Steps))
+	for i, step := range saga.Steps {
+		if step.Result != nil {
+			results[strconv.Itoa(i)] = step.Result
+		}
+	}
+	return map[string]interface{}{"steps": results}
+}
+
+// skipUnmetSteps marks Skipped each step from next on whose condition doesn't hold,
+// stopping at the first step that should run, and returns its index (len(saga.Steps)
+// if every remaining step was skipped)
+// Only sequential steps have conditions, so a skipped step is always a whole stage.
+// A skipped step is never dispatched, so it is never compensated either.
+// Returns an error, with the index of the step it stopped at, if a condition references
+// a result that was discarded for its size: the condition can't be decided.
+// Caller must hold saga.mu.
+func (sm *SagaManager) skipUnmetSteps(saga *Saga, next int) (int, error) {
+	for ; next < len(saga.Steps); next++ {
+		step := saga.Steps[next]
+		if len(step.Condition) == 0 {
+			return next, nil
+		}
+		for _, ref := range scenario.ConditionSteps(step.Condition) {
+			if ref < len(saga.Steps) && saga.Steps[ref].ResultDiscarded {
+				return next, fmt.Errorf("step %d condition references %s", next, sm.discardedResultReason(ref))
+			}
+		}
+		if scenario.MatchConditions(step.Condition, saga.stepResults()) {
+			return next, nil
+		}
+		step.Status = StepStatusSkipped
+		sm.logSaga("info", saga.SagaID, step.TargetSimulation, "Saga %s: Skipping step %d (%s to %s), its condition does not hold", saga.SagaID, next, step.Command, step.TargetSimulation)
+		sm.publishStepAdvanced(saga, step)
+	}
+	return next, nil
+}
@@ -0,0 +1,58 @@
+package saga
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+// A condition on a result that was discarded for its size fails the Saga instead of
+// skipping the step as if the condition didn't hold
+func TestConditionOnDiscardedResultFailsSaga(t *testing.T) {
+	sm, reg := newTestManager(t)
+	sm.SetMaxStepResultSize(16)
+	x := connectSim(t, reg, "x")
+	y := connectSim(t, reg, "y")
+
+	steps := actions("x", "y")
+	steps[0].CompensateCommand = "undo"
+	steps[1].Condition = []models.PayloadCondition{{Key: "steps.0.ok", Op: "eq", Value: true}}
+	saga, err := sm.CreateSaga(context.Background(), steps, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", map[string]interface{}{"ok": true, "padding": strings.Repeat("p", 100)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Step 0 is rolled back; step 1 is neither run nor skipped
+	if msg := x.next(t); msg.Command != "undo" {
+		t.Fatalf("x got %q, want the compensation", msg.Command)
+	}
+	if err := sm.HandleStepCompensated(saga.SagaID, 0, "x"); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, saga, SagaStatusFailed)
+
+	select {
+	case msg := <-y.messages:
+		t.Fatalf("y got %+v, want nothing", msg)
+	default:
+	}
+	snapshot := saga.Snapshot()
+	if status := snapshot.Steps[1].Status; status != StepStatusPending {
+		t.Fatalf("step 1 is %s, want Pending", status)
+	}
+	recorded := false
+	for _, reason := range snapshot.FailureReasons {
+		if strings.Contains(reason, "step 1 condition references the result of step 0") && strings.Contains(reason, "limit 16 bytes") {
+			recorded = true
+		}
+	}
+	if !recorded {
+		t.Fatalf("failure reasons %v don't name the discarded result and the limit", snapshot.FailureReasons)
+	}
+}
@@ -0,0 +1,101 @@
+package saga
+
+import (
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Saga Timeouts
+
+Step timeouts bound each step on its own, but not the Saga as a whole: a Saga with
+many steps, a step that is retried, or one paused at a breakpoint can run on
+indefinitely. A Saga timeout bounds the whole transaction.
+
+A Saga's Timeout is the shortest saga_timeout of the rules it was built from, or the
+server default (SetSagaTimeout) if none of them sets one; 0 means no timeout. A
+replayed Saga reuses the original's Timeout. The clock starts when the Saga is created.
+
+If the Saga is still Pending or InProgress when its deadline passes, it fails: steps in
+flight are marked Failed (their late reports are ignored, and they are compensated
+only if compensate_on_partial), and the completed steps are compensated as for any
+failure. A Saga that is already compensating is left to finish; its compensations have
+their own timeout. The timer is stopped as soon as the Saga reaches a terminal status.
+
+Restored Sagas (see persistence.go) keep their Timeout for inspection but, like their
+steps, run no timer.
+*/
+
+// SetSagaTimeout sets the default time a Saga may take to reach a terminal status
+// (0 = no timeout)
+// May be called at any time; it applies to Sagas created afterwards.
+func (sm *SagaManager) SetSagaTimeout(timeout time.Duration) {
+	sm.sagaTimeout.Store(int64(timeout))
+}
+
+// sagaTimeoutFor returns the timeout for a Saga built from actions: the shortest rule
+// saga_timeout among them, or the server default
+func (sm *SagaManager) sagaTimeoutFor(actions []models.Action) time.Duration {
+	var timeout time.Duration
+	for _, action := range actions {
+		if action.SagaTimeout > 0 && (timeout == 0 || action.SagaTimeout < timeout) {
+			timeout = action.SagaTimeout
+		}
+	}
+	if timeout == 0 {
+		timeout = time.Duration(sm.sagaTimeout.Load())
+	}
+	return timeout
+}
+
+// startDeadlineTimer fails the Saga if it hasn't finished by its deadline
+// Does nothing if the Saga has no timeout or already finished.
+func (sm *SagaManager) startDeadlineTimer(saga *Saga) {
+	saga.mu.Lock()
+	defer saga.mu.Unlock()
+
+	if saga.Timeout <= 0 || saga.Status.IsTerminal() {
+		return
+	}
+	saga.deadlineTimer = time.AfterFunc(time.Until(saga.CreatedAt.Add(saga.Timeout)), func() {
+		sm.failSagaDueToTimeout(saga)
+	})
+}
+
+// stopDeadlineTimer cancels the Saga's pending timeout, if any
+// Must be called with the saga's lock held
+func (saga *Saga) stopDeadlineTimer() {
+	if saga.deadlineTimer != nil {
+		saga.deadlineTimer.Stop()
+		saga.deadlineTimer = nil
+	}
+}
+
+// failSagaDueToTimeout fails a Saga whose deadline passed and compensates it
+// A Saga that is already compensating or finished is left alone.
+func (sm *SagaManager) failSagaDueToTimeout(saga *Saga) {
+	saga.mu.Lock()
+	saga.deadlineTimer = nil
+	if saga.Status != SagaStatusPending && saga.Status != SagaStatusInProgress {
+		saga.mu.Unlock()
+		return
+	}
+
+	saga.addFailureReason("saga timed out after %s at step %d", saga.Timeout, saga.CurrentStep)
+	for _, step := range saga.Steps {
+		if step.Status == StepStatusInFlight {
+			step.Status = StepStatusFailed
+			step.stopTimer()
+		}
+	}
+	// Completed members of the current parallel group are compensated too
+	lastStepToCompensate := saga.stageEnd(saga.CurrentStep) - 1
+	saga.Status = SagaStatusFailed
+	saga.mu.Unlock()
+
+	sm.logSaga("error", saga.SagaID, "", "Saga %s: Timed out after %s, triggering compensation", saga.SagaID, saga.Timeout)
+
+	// Releases the locks and logs the summary once every compensation is resolved
+	sm.triggerCompensation(saga, lastStepToCompensate)
+}
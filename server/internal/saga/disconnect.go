@@ -0,0 +1,83 @@
+package saga
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+/*
+Simulation Disconnects
+
+A simulation that disconnects won't report on the steps it was working on, so without
+intervention its Saga would wait for the step timeouts and keep holding its locks
+until then. HandleSimulationDisconnect fails those steps instead, as if each had
+reported step.failed, so the Saga compensates its completed steps and releases its
+locks right away.
+
+A simulation takes part in at most one running Saga at a time, so the simulation
+locks (see locks.go) double as the index from a simulation to the Saga that may have
+steps in flight on it; nothing else has to be scanned or kept up to date. Sagas
+restored from the Saga store hold no locks and are left alone.
+
+While reconnect tokens are enabled, the simulation may register again and have its
+in-flight commands re-sent (see ResendInFlight), so its steps are only failed if it
+hasn't come back when the resume window closes.
+*/
+
+// HandleSimulationDisconnect fails the in-flight steps targeting simKey once it has
+// been gone for grace (0 = right away), unless it has registered again by then
+func (sm *SagaManager) HandleSimulationDisconnect(simKey string, grace time.Duration) {
+	failInFlight := func() {
+		if _, back := sm.registry.Get(simKey); back {
+			return
+		}
+		if failed := sm.FailInFlight(simKey, "simulation disconnected"); failed > 0 {
+			sm.logSaga("warning", "", simKey, "Failed %d in-flight Saga steps on disconnected simulation %s", failed, simKey)
+		}
+	}
+
+	if grace <= 0 {
+		failInFlight()
+		return
+	}
+	time.AfterFunc(grace, failInFlight)
+}
+
+// FailInFlight fails every in-flight step targeting simKey, as if each had reported
+// step.failed, and compensates their Sagas
+// Used when a simulation is gone (it disconnected, or stopped answering heartbeats),
+// so its Saga doesn't have to wait for its step timeouts. Returns the number of steps failed.
+func (sm *SagaManager) FailInFlight(simKey string, cause string) int {
+	holders, locked := sm.CheckConflict(simKey)
+	if !locked {
+		return 0
+	}
+
+	sm.mu.RLock()
+	saga, exists := sm.sagas[holders[0]]
+	sm.mu.RUnlock()
+	if !exists {
+		return 0
+	}
+
+	saga.mu.RLock()
+	var steps []int
+	for i, step := range saga.Steps {
+		if step.TargetSimulation == simKey && step.Status == StepStatusInFlight {
+			steps = append(steps, i)
+		}
+	}
+	saga.mu.RUnlock()
+
+	failed := 0
+	for _, stepID := range steps {
+		reason := fmt.Sprintf("step %d failed on %s: %s", stepID, simKey, cause)
+		if err := sm.failStep(saga.SagaID, stepID, simKey, reason); err != nil {
+			log.Printf("Saga %s: Failed to fail step %d after losing %s: %v", saga.SagaID, stepID, simKey, err)
+			continue
+		}
+		failed++
+	}
+	return failed
+}
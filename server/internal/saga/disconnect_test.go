@@ -0,0 +1,149 @@
+package saga
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+func TestDisconnectWithoutGraceFailsInFlightSteps(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x, y := connectSim(t, reg, "x"), connectSim(t, reg, "y")
+
+	steps := actions("x", "y")
+	steps[0].CompensateCommand = "undo"
+	saga, err := sm.CreateSaga(context.Background(), steps, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	y.next(t)
+
+	reg.UnregisterIf("y", y.Simulation)
+	sm.HandleSimulationDisconnect("y", 0)
+
+	// Step 1 failed at once, so step 0 is rolled back without waiting for a timeout
+	if msg := x.next(t); msg.Command != "undo" {
+		t.Fatalf("x got %q, want the compensation", msg.Command)
+	}
+	if err := sm.HandleStepCompensated(saga.SagaID, 0, "x"); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, saga, SagaStatusFailed)
+	if status := saga.Snapshot().Steps[1].Status; status != StepStatusFailed {
+		t.Fatalf("step 1 is %s, want Failed", status)
+	}
+}
+
+func TestReconnectWithinGraceKeepsSteps(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x := connectSim(t, reg, "x")
+
+	saga, err := sm.CreateSaga(context.Background(), actions("x"), models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+
+	const grace = 100 * time.Millisecond
+	reg.UnregisterIf("x", x.Simulation)
+	sm.HandleSimulationDisconnect("x", grace)
+
+	// Back within the window; the in-flight command is re-sent on the new connection
+	resumed := connectSim(t, reg, "x")
+	if n := sm.ResendInFlight("x"); n != 1 {
+		t.Fatalf("ResendInFlight re-sent %d commands, want 1", n)
+	}
+	if msg := resumed.next(t); msg.Command != "cmd0" || msg.SagaID != saga.SagaID {
+		t.Fatalf("resumed connection got %+v, want the re-sent command", msg)
+	}
+
+	// The window closing doesn't fail the step of a simulation that came back
+	time.Sleep(2 * grace)
+	if status := saga.Snapshot().Steps[0].Status; status != StepStatusInFlight {
+		t.Fatalf("step 0 is %s after the window closed, want InFlight", status)
+	}
+	if holder := lockHolder(sm, "x"); holder != saga.SagaID {
+		t.Fatalf("x locked by %q, want %s", holder, saga.SagaID)
+	}
+
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, saga, SagaStatusCompleted)
+}
+
+func TestGraceExpiryFailsInFlightSteps(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x := connectSim(t, reg, "x")
+
+	saga, err := sm.CreateSaga(context.Background(), actions("x"), models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+
+	const grace = 100 * time.Millisecond
+	reg.UnregisterIf("x", x.Simulation)
+	sm.HandleSimulationDisconnect("x", grace)
+
+	// Still waiting for the simulation during the window
+	time.Sleep(grace / 2)
+	if status := saga.GetStatus(); status != SagaStatusInProgress {
+		t.Fatalf("saga is %s during the grace window, want InProgress", status)
+	}
+
+	waitForStatus(t, saga, SagaStatusFailed)
+	if status := saga.Snapshot().Steps[0].Status; status != StepStatusFailed {
+		t.Fatalf("step 0 is %s, want Failed", status)
+	}
+	if holder := lockHolder(sm, "x"); holder != "" {
+		t.Fatalf("x still locked by %s after its steps failed", holder)
+	}
+}
+
+// Commands aren't queued per connection; they're written when the step is dispatched.
+// A command that can't be sent because its simulation's connection has just closed
+// fails the step right away, so the Saga doesn't wait on a command that never left.
+func TestUnsentCommandFailsStep(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x, y := connectSim(t, reg, "x"), connectSim(t, reg, "y")
+
+	steps := actions("x", "y")
+	steps[0].CompensateCommand = "undo"
+	saga, err := sm.CreateSaga(context.Background(), steps, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+
+	// y's connection closes before the server has noticed and unregistered it
+	y.Connection.Close()
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil); err == nil {
+		t.Fatal("HandleStepCompletion reported no error for the command that couldn't be sent")
+	}
+
+	if msg := x.next(t); msg.Command != "undo" {
+		t.Fatalf("x got %q, want the compensation", msg.Command)
+	}
+	if err := sm.HandleStepCompensated(saga.SagaID, 0, "x"); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, saga, SagaStatusFailed)
+	snap := saga.Snapshot()
+	if status := snap.Steps[1].Status; status == StepStatusInFlight {
+		t.Fatal("step 1 is InFlight though its command was never sent")
+	}
+	if len(snap.FailureReasons) == 0 || !strings.HasPrefix(snap.FailureReasons[0], "step 1 dispatch failed") {
+		t.Fatalf("failure reasons = %q, want the failed dispatch of step 1", snap.FailureReasons)
+	}
+	if in := sm.GetInFlightStepsForSim("y"); len(in) != 0 {
+		t.Fatalf("in-flight steps for y = %+v, want none", in)
+	}
+}
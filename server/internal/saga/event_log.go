@@ -0,0 +1,40 @@
+package saga
+
+import (
+	"log"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
+)
+
+// SetEventLog enables recording every command sent to a simulation (forward steps,
+// compensations and re-sent steps) in the given event log (nil disables it)
+func (sm *SagaManager) SetEventLog(eventLog *store.EventLog) {
+	sm.eventLog = eventLog
+}
+
+// recordCommand appends a command that was sent to the simulation with registry key
+// target to the event log, if one is set
+// Best effort: a failed write is logged and never holds up the Saga.
+func (sm *SagaManager) recordCommand(target string, command models.Message) {
+	if sm.eventLog == nil {
+		return
+	}
+
+	tenant, simID := registry.SplitKey(target)
+	entry := store.EventLogEntry{
+		Kind:      store.EventLogKindCommand,
+		Tenant:    tenant,
+		SagaID:    command.SagaID,
+		StepID:    command.StepID,
+		Target:    simID,
+		Command:   command.Command,
+		Payload:   command.Params,
+		Timestamp: time.Now(),
+	}
+	if err := sm.eventLog.Append(entry); err != nil {
+		log.Printf("Saga %s: Failed to record command %s to %s: %v", command.SagaID, command.Command, target, err)
+	}
+}
@@ -0,0 +1,33 @@
+package saga
+
+import (
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/events"
+)
+
+// SetEventHub sets the hub that is told about Sagas being created, advancing a step
+// and finishing
+func (sm *SagaManager) SetEventHub(hub *events.Hub) {
+	sm.hub = hub
+}
+
+// sagaEvent describes the Saga's current state for the event hub
+// Must be called with saga.mu held.
+func sagaEvent(saga *Saga) events.SagaEvent {
+	return events.SagaEvent{
+		SagaID:      saga.SagaID,
+		Tenant:      saga.Tenant,
+		Status:      string(saga.Status),
+		CurrentStep: saga.CurrentStep,
+		Steps:       len(saga.Steps),
+	}
+}
+
+// publishStepAdvanced tells the event hub that a step of the Saga completed
+// Must be called with saga.mu held.
+func (sm *SagaManager) publishStepAdvanced(saga *Saga, step *SagaStep) {
+	data := sagaEvent(saga)
+	stepID := step.StepID
+	data.StepID = &stepID
+	data.Simulation = step.TargetSimulation
+	sm.hub.Publish(events.SagaStepAdvanced, data)
+}
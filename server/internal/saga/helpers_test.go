@@ -0,0 +1,116 @@
+package saga
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/gorilla/websocket"
+)
+
+// testSim is a simulation registered over a real WebSocket connection
+// The messages the server sends it (commands and compensations) arrive on messages.
+type testSim struct {
+	*models.Simulation
+	messages chan models.Message
+}
+
+// newTestManager creates a SagaManager with an empty registry
+func newTestManager(t *testing.T) (*SagaManager, *registry.Registry) {
+	t.Helper()
+	reg := registry.NewRegistry()
+	return NewSagaManager(reg), reg
+}
+
+// connectSim registers a simulation with the given registry key, connected to a
+// client that collects what the server sends it
+func connectSim(t *testing.T, reg *registry.Registry, key string) *testSim {
+	t.Helper()
+
+	serverConns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn := <-serverConns
+	t.Cleanup(func() { conn.Close() })
+
+	tenant, id := registry.SplitKey(key)
+	ts := &testSim{
+		Simulation: reg.Register(&models.Simulation{ID: id, Tenant: tenant, Connection: conn}),
+		messages:   make(chan models.Message, 4096),
+	}
+	go func() {
+		defer close(ts.messages)
+		for {
+			var msg models.Message
+			if err := client.ReadJSON(&msg); err != nil {
+				return
+			}
+			ts.messages <- msg
+		}
+	}()
+	return ts
+}
+
+// next returns the next message sent to the simulation, failing the test if none
+// arrives in time
+func (ts *testSim) next(t *testing.T) models.Message {
+	t.Helper()
+	select {
+	case msg, ok := <-ts.messages:
+		if !ok {
+			t.Fatalf("connection to %s closed", ts.ID)
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no message sent to %s", ts.ID)
+	}
+	return models.Message{}
+}
+
+// actions builds one action per target, with commands cmd0, cmd1, ...
+func actions(targets ...string) []models.Action {
+	result := make([]models.Action, len(targets))
+	for i, target := range targets {
+		result[i] = models.Action{SendTo: target, Command: "cmd" + strconv.Itoa(i)}
+	}
+	return result
+}
+
+// waitForStatus waits until the Saga reaches status, failing the test if it doesn't in time
+func waitForStatus(t *testing.T, saga *Saga, status SagaStatus) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for saga.GetStatus() != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("saga %s is %s, want %s", saga.SagaID, saga.GetStatus(), status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// lockHolder returns the ID of the Saga holding simKey's lock ("" = not locked)
+func lockHolder(sm *SagaManager, simKey string) string {
+	holders, _ := sm.CheckConflict(simKey)
+	if len(holders) == 0 {
+		return ""
+	}
+	return holders[0]
+}
@@ -0,0 +1,80 @@
+package saga
+
+import (
+	"fmt"
+	"log"
+)
+
+// LateCompletionPolicy controls how step.completed reports for Sagas that have already
+// completed or failed are handled
+type LateCompletionPolicy string
+
+const (
+	// LateCompletionIgnore logs the report and otherwise ignores it
+	LateCompletionIgnore LateCompletionPolicy = "ignore"
+	// LateCompletionWarn logs a warning; useful for spotting double-dispatch bugs
+	LateCompletionWarn LateCompletionPolicy = "warn"
+	// LateCompletionAck also tells the simulation the Saga is over so it can stop work
+	LateCompletionAck LateCompletionPolicy = "ack"
+)
+
+// ParseLateCompletionPolicy parses a policy name ("" = ignore)
+func ParseLateCompletionPolicy(name string) (LateCompletionPolicy, error) {
+	switch policy := LateCompletionPolicy(name); policy {
+	case "":
+		return LateCompletionIgnore, nil
+	case LateCompletionIgnore, LateCompletionWarn, LateCompletionAck:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown late completion policy %q (want ignore, warn or ack)", name)
+	}
+}
+
+// TerminalSagaError is returned for a late step completion under LateCompletionAck
+// The caller should tell the reporting simulation the Saga has already finished.
+type TerminalSagaError struct {
+	SagaID string
+	StepID int
+	Status SagaStatus
+}
+
+func (e *TerminalSagaError) Error() string {
+	return fmt.Sprintf("saga %s is already %s (step %d completion arrived late)", e.SagaID, e.Status, e.StepID)
+}
+
+// SetLateCompletionPolicy sets how late step completions are handled
+// May be called at any time; it applies to reports handled afterwards.
+func (sm *SagaManager) SetLateCompletionPolicy(policy LateCompletionPolicy) {
+	sm.lateCompletionPolicy.Store(&policy)
+}
+
+// GetLateCompletionCount returns the number of step completions received for finished Sagas
+func (sm *SagaManager) GetLateCompletionCount() int64 {
+	return sm.lateCompletions.Load()
+}
+
+// handleLateCompletion applies the late completion policy to a completion for a
+// Saga in terminal status and returns the error to report (nil = ignore)
+func (sm *SagaManager) handleLateCompletion(sagaID string, stepID int, simID string, status SagaStatus) error {
+	sm.lateCompletions.Add(1)
+
+	policy := LateCompletionIgnore
+	if p := sm.lateCompletionPolicy.Load(); p != nil {
+		policy = *p
+	}
+
+	switch policy {
+	case LateCompletionWarn:
+		sm.logSaga("warning", sagaID, simID, "Saga %s: Step %d completion from %s arrived after the Saga %s; the command may have been dispatched twice", sagaID, stepID, simID, status)
+	case LateCompletionAck:
+		log.Printf("Saga %s: Step %d completion from %s arrived after the Saga %s, notifying simulation", sagaID, stepID, simID, status)
+		return &TerminalSagaError{SagaID: sagaID, StepID: stepID, Status: status}
+	default:
+		log.Printf("Saga %s: Step %d completion from %s arrived after the Saga %s, ignoring", sagaID, stepID, simID, status)
+	}
+
+	if sm.strict {
+		return fmt.Errorf("orphaned completion: saga %s is already %s", sagaID, status)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+func TestParseLateCompletionPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    LateCompletionPolicy
+		wantErr bool
+	}{
+		{name: "", want: LateCompletionIgnore},
+		{name: "ignore", want: LateCompletionIgnore},
+		{name: "warn", want: LateCompletionWarn},
+		{name: "ack", want: LateCompletionAck},
+		{name: "Ack", wantErr: true},
+		{name: "drop", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLateCompletionPolicy(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLateCompletionPolicy(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// completedSaga runs a one-step Saga on x to completion
+func completedSaga(t *testing.T, sm *SagaManager, x *testSim) *Saga {
+	t.Helper()
+	saga, err := sm.CreateSaga(context.Background(), actions("x"), models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, saga, SagaStatusCompleted)
+	return saga
+}
+
+// loggedWarning reports whether logStore holds a warning containing text
+func loggedWarning(logStore *logging.LogStore, text string) bool {
+	for _, entry := range logStore.GetAll() {
+		if entry.Level == "warning" && strings.Contains(entry.Message, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLateCompletionPolicies(t *testing.T) {
+	tests := []struct {
+		policy      LateCompletionPolicy
+		strict      bool
+		wantWarning bool
+		wantAck     bool
+		wantErr     bool
+	}{
+		{policy: LateCompletionIgnore},
+		{policy: LateCompletionWarn, wantWarning: true},
+		{policy: LateCompletionAck, wantAck: true},
+		// Strict mode still reports the orphaned completion; ack takes precedence
+		{policy: LateCompletionIgnore, strict: true, wantErr: true},
+		{policy: LateCompletionWarn, strict: true, wantWarning: true, wantErr: true},
+		{policy: LateCompletionAck, strict: true, wantAck: true},
+	}
+
+	for _, tt := range tests {
+		name := string(tt.policy)
+		if tt.strict {
+			name += " strict"
+		}
+		t.Run(name, func(t *testing.T) {
+			sm, reg := newTestManager(t)
+			logStore := logging.NewLogStore(100)
+			sm.SetLogStore(logStore)
+			sm.SetStrictMode(tt.strict)
+			sm.SetLateCompletionPolicy(tt.policy)
+			x := connectSim(t, reg, "x")
+			saga := completedSaga(t, sm, x)
+
+			err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil)
+
+			var terminal *TerminalSagaError
+			if errors.As(err, &terminal) != tt.wantAck {
+				t.Fatalf("err = %v, want a TerminalSagaError: %v", err, tt.wantAck)
+			}
+			if tt.wantAck && (terminal.SagaID != saga.SagaID || terminal.StepID != 0 || terminal.Status != SagaStatusCompleted) {
+				t.Fatalf("TerminalSagaError = %+v, want saga %s step 0 Completed", terminal, saga.SagaID)
+			}
+			if !tt.wantAck && (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want an error: %v", err, tt.wantErr)
+			}
+			if got := loggedWarning(logStore, "arrived after the Saga"); got != tt.wantWarning {
+				t.Fatalf("warning logged = %v, want %v", got, tt.wantWarning)
+			}
+			if n := sm.GetLateCompletionCount(); n != 1 {
+				t.Fatalf("late completion count = %d, want 1", n)
+			}
+
+			// The finished Saga is unchanged
+			if status := saga.GetStatus(); status != SagaStatusCompleted {
+				t.Fatalf("saga is %s after a late completion, want Completed", status)
+			}
+		})
+	}
+}
+
+func TestLateCompletionPolicyDefaultsToIgnore(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x := connectSim(t, reg, "x")
+	saga := completedSaga(t, sm, x)
+
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil); err != nil {
+		t.Fatalf("late completion with the default policy: %v", err)
+	}
+	if n := sm.GetLateCompletionCount(); n != 1 {
+		t.Fatalf("late completion count = %d, want 1", n)
+	}
+}
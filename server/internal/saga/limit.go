@@ -0,0 +1,127 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+Concurrent Saga Limit
+
+Every running Saga holds simulation locks and timers, so a burst of matching events
+could otherwise start any number of them. SetConcurrencyLimit caps the number of Sagas
+that have not reached a terminal state. A Saga takes a slot when it starts and gives it
+back when it finishes (in logSummary, where every terminal transition ends). Sagas
+restored on startup hold no slot, just as they hold no simulation locks.
+
+When every slot is taken, starting a Saga fails with ErrSagaLimitReached, or, with a
+wait configured, blocks until a slot frees up and fails only if the wait runs out. An
+event waiting for a slot also holds up the rest of its simulation's queue, including
+that simulation's step reports (see the ordering model in websocket/event_handler.go),
+so waits should stay short.
+
+The limit is 0 (unlimited) by default; it and the wait may be changed at any time.
+*/
+
+// ErrSagaLimitReached is returned when a Saga can't start because the concurrent
+// Saga limit is reached
+var ErrSagaLimitReached = errors.New("concurrent saga limit reached")
+
+// sagaSlots counts the Sagas holding a slot against the concurrency limit
+type sagaSlots struct {
+	mu     sync.Mutex
+	active int
+	limit  int           // 0 = unlimited
+	wait   time.Duration // How long a Saga waits for a slot (0 = fail at once)
+
+	// freed is closed (and replaced) whenever a slot may have become available, to wake
+	// the Sagas waiting for one
+	freed chan struct{}
+}
+
+// SetConcurrencyLimit sets the most Sagas that may run at once (0 = unlimited) and how
+// long a new Saga waits for a slot when they all are taken (0 = fail at once)
+// Lowering the limit doesn't affect running Sagas; new ones wait until enough finish.
+func (sm *SagaManager) SetConcurrencyLimit(limit int, wait time.Duration) {
+	sm.slots.mu.Lock()
+	defer sm.slots.mu.Unlock()
+
+	sm.slots.limit = limit
+	sm.slots.wait = wait
+	sm.wakeSlotWaiters()
+}
+
+// ConcurrencyLimit returns the concurrent Saga limit (0 = unlimited) and the number of
+// Sagas currently holding a slot
+func (sm *SagaManager) ConcurrencyLimit() (limit, active int) {
+	sm.slots.mu.Lock()
+	defer sm.slots.mu.Unlock()
+
+	return sm.slots.limit, sm.slots.active
+}
+
+// acquireSlot takes a slot for a new Saga, waiting for one if configured
+// The caller gives the slot to the new Saga (holdsSlot), which returns it with releaseSlot.
+// Gives up with ctx's error if ctx is done while waiting.
+func (sm *SagaManager) acquireSlot(ctx context.Context) error {
+	var deadline <-chan time.Time
+	for {
+		if sm.stopped.Load() {
+			return ErrShuttingDown
+		}
+
+		sm.slots.mu.Lock()
+		if sm.slots.limit <= 0 || sm.slots.active < sm.slots.limit {
+			sm.slots.active++
+			sm.slots.mu.Unlock()
+			return nil
+		}
+		wait := sm.slots.wait
+		if sm.slots.freed == nil {
+			sm.slots.freed = make(chan struct{})
+		}
+		freed := sm.slots.freed
+		sm.slots.mu.Unlock()
+
+		if wait <= 0 {
+			return ErrSagaLimitReached
+		}
+		if deadline == nil {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+
+		select {
+		case <-freed:
+		case <-deadline:
+			return ErrSagaLimitReached
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// releaseSlot returns a finished Saga's slot; it does nothing if the Saga holds none
+func (sm *SagaManager) releaseSlot(saga *Saga) {
+	sm.slots.mu.Lock()
+	defer sm.slots.mu.Unlock()
+
+	if !saga.holdsSlot {
+		return
+	}
+	saga.holdsSlot = false
+	sm.slots.active--
+	sm.wakeSlotWaiters()
+}
+
+// wakeSlotWaiters wakes the Sagas waiting for a slot so they check again
+// Must be called with slots.mu held.
+func (sm *SagaManager) wakeSlotWaiters() {
+	if sm.slots.freed != nil {
+		close(sm.slots.freed)
+		sm.slots.freed = nil
+	}
+}
@@ -0,0 +1,140 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+/*
+Simulation Locks
+
+A simulation takes part in at most one running Saga at a time. A Saga acquires the
+locks of all its target simulations when it is created (all or nothing) and releases
+them once when it finishes, whichever way it finishes.
+
+Acquisition, tracking and release are symmetric:
+- simulationLocks maps each locked simulation to the Saga holding it; an entry exists
+  only while the lock is held, so there is nothing to garbage-collect afterwards.
+- The Saga records exactly the simulations it locked (each once, even if several
+  steps target the same simulation).
+- releaseSagaLocks removes only entries the Saga still holds and then forgets its
+  list, so releasing twice (e.g. a late step.failed for a Saga that already failed
+  during dispatch) is harmless.
+
+The conflict check and the acquisition are one critical section under lockMu, so two
+Sagas racing for overlapping simulations can't both pass the check: exactly one of
+them gets all of its locks. Simulations are always locked in sorted order, so
+acquisition stays deadlock-free should it ever wait for a lock, and a Saga that finds
+a simulation busy rolls back the locks it has taken before returning.
+*/
+
+// ErrSimulationsBusy is returned when a Saga's target simulations are locked by other Sagas
+var ErrSimulationsBusy = errors.New("conflict detected: target simulations are busy in other sagas")
+
+// acquireSagaLocks locks every simulation in sims for the Saga, or none of them
+// Returns an error wrapping ErrSimulationsBusy that names every simulation held by
+// another Saga.
+func (sm *SagaManager) acquireSagaLocks(saga *Saga, sims []string) error {
+	// Canonical order: each simulation once, sorted
+	unique := make([]string, 0, len(sims))
+	seen := make(map[string]bool, len(sims))
+	for _, simID := range sims {
+		if !seen[simID] {
+			seen[simID] = true
+			unique = append(unique, simID)
+		}
+	}
+	sort.Strings(unique)
+
+	sm.lockMu.Lock()
+	defer sm.lockMu.Unlock()
+
+	acquired := make([]string, 0, len(unique))
+	var busy []string
+	for _, simID := range unique {
+		if holder, locked := sm.simulationLocks[simID]; locked {
+			busy = append(busy, fmt.Sprintf("%s (saga %s)", simID, holder))
+			continue
+		}
+		if len(busy) == 0 {
+			sm.simulationLocks[simID] = saga.SagaID
+			acquired = append(acquired, simID)
+		}
+	}
+
+	if len(busy) > 0 {
+		// Roll back the partial acquisition
+		for _, simID := range acquired {
+			delete(sm.simulationLocks, simID)
+		}
+		return fmt.Errorf("%w: %s", ErrSimulationsBusy, strings.Join(busy, ", "))
+	}
+
+	for _, simID := range acquired {
+		log.Printf("Saga %s now active on simulation %s", saga.SagaID, simID)
+	}
+	saga.lockedSims = acquired
+	return nil
+}
+
+// releaseSagaLocks releases every simulation lock the Saga holds
+// Safe to call more than once; later calls do nothing.
+func (sm *SagaManager) releaseSagaLocks(saga *Saga) {
+	sm.lockMu.Lock()
+	defer sm.lockMu.Unlock()
+
+	for _, simID := range saga.lockedSims {
+		if sm.simulationLocks[simID] != saga.SagaID {
+			log.Printf("Warning: Saga %s does not hold the lock for simulation %s, skipping release", saga.SagaID, simID)
+			continue
+		}
+		delete(sm.simulationLocks, simID)
+		log.Printf("Released lock for simulation %s (saga %s)", simID, saga.SagaID)
+	}
+	saga.lockedSims = nil
+}
+
+// CheckConflict checks if a simulation is currently involved in an active Saga
+// Returns the conflicting saga IDs and whether a conflict exists
+func (sm *SagaManager) CheckConflict(simID string) ([]string, bool) {
+	sm.lockMu.Lock()
+	defer sm.lockMu.Unlock()
+
+	holder, locked := sm.simulationLocks[simID]
+	if !locked {
+		return nil, false
+	}
+	return []string{holder}, true
+}
+
+// GetActiveSagasForSim returns the IDs of the Sagas that have not reached a terminal
+// state and have a step targeting simID, sorted
+// Normally this is at most the Saga holding the simulation's lock, but Sagas restored
+// from the Saga store hold no locks.
+func (sm *SagaManager) GetActiveSagasForSim(simID string) []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ids := make([]string, 0)
+	for id, saga := range sm.sagas {
+		saga.mu.RLock()
+		involved := false
+		if !saga.Status.IsTerminal() {
+			for _, step := range saga.Steps {
+				if step.TargetSimulation == simID {
+					involved = true
+					break
+				}
+			}
+		}
+		saga.mu.RUnlock()
+		if involved {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
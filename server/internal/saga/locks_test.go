@@ -0,0 +1,240 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+// assertUnlocked checks that no Saga holds the simulations' locks and that a new Saga
+// can lock them again
+func assertUnlocked(t *testing.T, sm *SagaManager, sims ...string) {
+	t.Helper()
+	for _, sim := range sims {
+		if holder := lockHolder(sm, sim); holder != "" {
+			t.Fatalf("simulation %s still locked by saga %s", sim, holder)
+		}
+	}
+	next, err := sm.CreateSaga(context.Background(), actions(sims...), models.Event{})
+	if err != nil {
+		t.Fatalf("new saga on %v: %v", sims, err)
+	}
+	for _, sim := range sims {
+		if holder := lockHolder(sm, sim); holder != next.SagaID {
+			t.Fatalf("simulation %s locked by %q, want new saga %s", sim, holder, next.SagaID)
+		}
+	}
+}
+
+func TestLocksReleasedOnCompletion(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x, y := connectSim(t, reg, "x"), connectSim(t, reg, "y")
+
+	saga, err := sm.CreateSaga(context.Background(), actions("x", "y", "x"), models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	if got := len(saga.lockedSims); got != 2 {
+		t.Fatalf("saga holds %d locks, want 2 (x once, y once)", got)
+	}
+
+	x.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	y.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 1, "y", nil); err != nil {
+		t.Fatal(err)
+	}
+	x.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 2, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForStatus(t, saga, SagaStatusCompleted)
+	assertUnlocked(t, sm, "x", "y")
+}
+
+func TestLocksReleasedWhenFirstDispatchFails(t *testing.T) {
+	sm, reg := newTestManager(t)
+
+	// "x" isn't connected yet, so the first step can't be dispatched
+	saga, err := sm.CreateSaga(context.Background(), actions("x"), models.Event{})
+	if err == nil {
+		t.Fatal("CreateSaga succeeded without a connected target")
+	}
+	if saga == nil || saga.GetStatus() != SagaStatusFailed {
+		t.Fatalf("saga = %v, want a Failed saga", saga)
+	}
+
+	// Releasing again, e.g. for a late report, must be harmless
+	sm.releaseSagaLocks(saga)
+
+	connectSim(t, reg, "x")
+	assertUnlocked(t, sm, "x")
+}
+
+func TestLocksReleasedOnFailure(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x, y := connectSim(t, reg, "x"), connectSim(t, reg, "y")
+
+	steps := actions("x", "y")
+	steps[0].CompensateCommand = "undo"
+	saga, err := sm.CreateSaga(context.Background(), steps, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	y.next(t)
+	if err := sm.HandleStepFailure(saga.SagaID, 1, "y"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Locks are kept until the rollback is confirmed
+	if msg := x.next(t); msg.Command != "undo" {
+		t.Fatalf("x got %q, want the compensation", msg.Command)
+	}
+	if holder := lockHolder(sm, "x"); holder != saga.SagaID {
+		t.Fatalf("x locked by %q while compensating, want %s", holder, saga.SagaID)
+	}
+	if err := sm.HandleStepCompensated(saga.SagaID, 0, "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForStatus(t, saga, SagaStatusFailed)
+	assertUnlocked(t, sm, "x", "y")
+}
+
+func TestLocksReleasedOnCancel(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x, y := connectSim(t, reg, "x"), connectSim(t, reg, "y")
+
+	steps := actions("x", "y")
+	steps[0].CompensateCommand = "undo"
+	saga, err := sm.CreateSaga(context.Background(), steps, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	y.next(t)
+
+	if err := sm.CancelSaga(saga.SagaID); err != nil {
+		t.Fatal(err)
+	}
+	x.next(t)
+	if err := sm.HandleStepCompensated(saga.SagaID, 0, "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForStatus(t, saga, SagaStatusCancelled)
+	assertUnlocked(t, sm, "x", "y")
+
+	// The cancelled step's late report changes nothing
+	if err := sm.HandleStepCompletion(saga.SagaID, 1, "y", nil); err != nil {
+		t.Fatal(err)
+	}
+	if saga.GetStatus() != SagaStatusCancelled {
+		t.Fatalf("saga is %s after a late report, want Cancelled", saga.GetStatus())
+	}
+}
+
+func TestLocksReleasedWhenAbortedAtBreakpoint(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x := connectSim(t, reg, "x")
+	connectSim(t, reg, "y")
+
+	steps := actions("x", "y")
+	steps[1].Breakpoint = true
+	saga, err := sm.CreateSaga(context.Background(), steps, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paused before step 1 with both locks held
+	if holder := lockHolder(sm, "y"); holder != saga.SagaID {
+		t.Fatalf("y locked by %q at the breakpoint, want %s", holder, saga.SagaID)
+	}
+
+	if err := sm.CancelSaga(saga.SagaID); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, saga, SagaStatusCancelled)
+	assertUnlocked(t, sm, "x", "y")
+
+	if err := sm.ResumeStep(saga.SagaID, 1); err == nil {
+		t.Fatal("ResumeStep succeeded on a cancelled saga")
+	}
+}
+
+// Two Sagas targeting the same simulations in opposite orders race for their locks;
+// every round exactly one of them must get all of them. Run with -race.
+func TestConflictingSagasExactlyOneWins(t *testing.T) {
+	sm, reg := newTestManager(t)
+	connectSim(t, reg, "x")
+	connectSim(t, reg, "y")
+	connectSim(t, reg, "z")
+
+	orders := [][]models.Action{actions("x", "y", "z"), actions("z", "y", "x")}
+
+	for round := 0; round < 1000; round++ {
+		var (
+			wg    sync.WaitGroup
+			start = make(chan struct{})
+			sagas [2]*Saga
+			errs  [2]error
+		)
+		for i := range orders {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				sagas[i], errs[i] = sm.CreateSaga(context.Background(), orders[i], models.Event{})
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		winner := -1
+		for i, err := range errs {
+			switch {
+			case err == nil:
+				if winner >= 0 {
+					t.Fatalf("round %d: both sagas acquired their locks", round)
+				}
+				winner = i
+			case !errors.Is(err, ErrSimulationsBusy):
+				t.Fatalf("round %d: saga %d failed with %v, want ErrSimulationsBusy", round, i, err)
+			}
+		}
+		if winner < 0 {
+			t.Fatalf("round %d: neither saga acquired its locks: %v", round, errs)
+		}
+
+		// No partial acquisition is left behind by the loser
+		saga := sagas[winner]
+		for _, sim := range []string{"x", "y", "z"} {
+			if holder := lockHolder(sm, sim); holder != saga.SagaID {
+				t.Fatalf("round %d: %s locked by %q, want winner %s", round, sim, holder, saga.SagaID)
+			}
+		}
+
+		// Fail the winner's first step so the next round starts unlocked
+		if err := sm.HandleStepFailure(saga.SagaID, 0, saga.Steps[0].TargetSimulation); err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+		waitForStatus(t, saga, SagaStatusFailed)
+	}
+}
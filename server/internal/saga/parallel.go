@@ -0,0 +1,87 @@
+package saga
+
+/*
+Parallel Steps
+
+Steps run in stages. A stage is either a single step or a parallel group: consecutive
+steps sharing a non-zero ParallelGroup (set from `parallel: true` scenario actions).
+All steps of a stage are dispatched at once, and the Saga only moves on to the next
+stage when every one of them has reported step.completed. CurrentStep is the first
+step of the stage being executed.
+
+When a step of a parallel group fails (report, timeout or dispatch failure), the
+Saga is failing but does not compensate yet: the other members may still be working.
+Once none of them is in flight any more, compensation runs for every completed step
+up to the end of the group, i.e. the completed members of the group plus all earlier
+stages. Members that complete after the failure are compensated too, so no work done
+by a simulation is left behind.
+
+Without parallel actions every stage is one step, which is the plain sequential Saga.
+*/
+
+// stageEnd returns the index just past the stage that starts at start
+// ParallelGroup never changes after the Saga is created, so no lock is needed.
+func (saga *Saga) stageEnd(start int) int {
+	end := start + 1
+	if group := saga.Steps[start].ParallelGroup; group != 0 {
+		for end < len(saga.Steps) && saga.Steps[end].ParallelGroup == group {
+			end++
+		}
+	}
+	return end
+}
+
+// countInFlight returns the number of in-flight steps in [start, end)
+// Must be called with the saga's lock held
+func (saga *Saga) countInFlight(start, end int) int {
+	inFlight := 0
+	for i := start; i < end; i++ {
+		if saga.Steps[i].Status == StepStatusInFlight {
+			inFlight++
+		}
+	}
+	return inFlight
+}
+
+// settleFailedStage compensates a failing Saga once no step of its current stage is in
+// flight; until then it only records the state
+// Must be called with the saga's lock held; the lock is released.
+func (sm *SagaManager) settleFailedStage(saga *Saga) {
+	end := saga.stageEnd(saga.CurrentStep)
+	if inFlight := saga.countInFlight(saga.CurrentStep, end); inFlight > 0 {
+		saga.mu.Unlock()
+		sm.logSaga("warning", saga.SagaID, "", "Saga %s: Waiting for %d parallel steps to finish before compensating", saga.SagaID, inFlight)
+		sm.persist(saga)
+		return
+	}
+
+	saga.Status = SagaStatusFailed
+	saga.mu.Unlock()
+
+	// Compensate every completed step up to the end of the stage; the locks are
+	// released and the summary logged once every compensation is resolved
+	sm.triggerCompensation(saga, end-1)
+}
+
+// abortStage handles a stage whose step at index failed could not be sent
+// The steps from failed on were not sent and go back to Pending. If nothing was sent,
+// err is returned for the caller to fail the Saga as for any dispatch failure;
+// otherwise the stage is failed here and compensation waits for the members already
+// in flight.
+func (sm *SagaManager) abortStage(saga *Saga, start, failed int, err error) error {
+	saga.mu.Lock()
+	for i := failed; i < saga.stageEnd(start); i++ {
+		saga.Steps[i].Status = StepStatusPending
+	}
+
+	if failed == start {
+		saga.mu.Unlock()
+		return err
+	}
+
+	sm.logSaga("error", saga.SagaID, "", "Saga %s: Failed to dispatch parallel step %d: %v", saga.SagaID, failed, err)
+	saga.addFailureReason("step %d dispatch failed: %v", failed, err)
+	saga.failing = true
+	sm.settleFailedStage(saga)
+	return nil
+}
@@ -0,0 +1,145 @@
+package saga
+
+import (
+	"strings"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Step Parameter Merging
+
+A step's command params are built from two sources:
+1. Static params declared on the action in the scenario YAML (`params`)
+2. Selected fields from the triggering event's payload (`event_params`)
+
+Precedence:
+- Without `event_params_key`, selected event fields are merged at the top level and
+  OVERRIDE static params with the same key.
+- With `event_params_key`, selected event fields are placed in a nested map under that
+  key and static params are left untouched (except the namespace key itself, which
+  the event map replaces).
+
+Fields listed in `event_params` that are missing from the payload are skipped, so a
+static default can be provided for an optional event field in the non-namespaced form.
+*/
+
+// mergeParams builds the final command params for an action from its static params
+// and the selected fields of the triggering event's payload
+// The action's params map is never modified; a new map is always returned
+func mergeParams(action models.Action, payload map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(action.Params)+len(action.EventParams))
+	for k, v := range action.Params {
+		merged[k] = v
+	}
+
+	if len(action.EventParams) == 0 || payload == nil {
+		return merged
+	}
+
+	selected := make(map[string]interface{}, len(action.EventParams))
+	for _, field := range action.EventParams {
+		if value, ok := payload[field]; ok {
+			selected[field] = value
+		}
+	}
+
+	if action.EventParamsKey != "" {
+		merged[action.EventParamsKey] = selected
+		return merged
+	}
+
+	// Event values take precedence over static params
+	for k, v := range selected {
+		merged[k] = v
+	}
+	return merged
+}
+
+// forwardRefPrefix marks a compensation param value that refers to the step's forward params
+const forwardRefPrefix = "$forward."
+
+// resolveCompensateParams builds the params for a step's compensation command
+// A string value of the form "$forward.<path>" is replaced with the value at that
+// dotted path in the step's forward params (e.g. "$forward.order_id" or
+// "$forward.event.zone"), keeping its original type. References that can't be
+// resolved are left as-is and returned in missing; the caller must not send them
+// (see compensateNext).
+// Other strings have their "{{ result.<path> }}" templates rendered from the step's
+// result (see template.go); missing result fields render as "" and are returned in
+// missing as "result.<path>". Values taken from either source are not resolved again.
+// Nested maps and lists are resolved recursively; the inputs are never modified.
+func resolveCompensateParams(compensate, forward, result map[string]interface{}) (resolved map[string]interface{}, missing []string) {
+	if compensate == nil {
+		return nil, nil
+	}
+
+	var resolve func(value interface{}) interface{}
+	resolve = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			if !strings.HasPrefix(v, forwardRefPrefix) {
+				rendered, missingResults := renderTemplates(v, resultTemplatePattern, result)
+				for _, path := range missingResults {
+					missing = append(missing, "result."+path)
+				}
+				return rendered
+			}
+			if found, ok := lookupPath(forward, strings.TrimPrefix(v, forwardRefPrefix)); ok {
+				return found
+			}
+			missing = append(missing, v)
+			return v
+		case map[string]interface{}:
+			out := make(map[string]interface{}, len(v))
+			for k, inner := range v {
+				out[k] = resolve(inner)
+			}
+			return out
+		case []interface{}:
+			out := make([]interface{}, len(v))
+			for i, inner := range v {
+				out[i] = resolve(inner)
+			}
+			return out
+		default:
+			return v
+		}
+	}
+
+	resolved = resolve(compensate).(map[string]interface{})
+	return resolved, missing
+}
+
+// splitMissingRefs separates the missing references reported by resolveCompensateParams
+// into "$forward.<path>" references and "result.<path>" template fields
+func splitMissingRefs(missing []string) (forward, results []string) {
+	for _, ref := range missing {
+		if strings.HasPrefix(ref, forwardRefPrefix) {
+			forward = append(forward, ref)
+		} else {
+			results = append(results, ref)
+		}
+	}
+	return forward, results
+}
+
+// lookupPath returns the value at a dotted path in params
+func lookupPath(params map[string]interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return nil, false
+	}
+
+	var current interface{} = params
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,230 @@
+package saga
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+func TestMergeParams(t *testing.T) {
+	payload := map[string]interface{}{"zone": "north", "level": 3, "extra": true}
+
+	tests := []struct {
+		name    string
+		action  models.Action
+		payload map[string]interface{}
+		want    map[string]interface{}
+	}{
+		{
+			name:   "static params only",
+			action: models.Action{Params: map[string]interface{}{"mode": "auto"}},
+			want:   map[string]interface{}{"mode": "auto"},
+		},
+		{
+			name:   "no params at all",
+			action: models.Action{},
+			want:   map[string]interface{}{},
+		},
+		{
+			name:   "event fields added",
+			action: models.Action{Params: map[string]interface{}{"mode": "auto"}, EventParams: []string{"zone"}},
+			want:   map[string]interface{}{"mode": "auto", "zone": "north"},
+		},
+		{
+			name:   "event fields override static params",
+			action: models.Action{Params: map[string]interface{}{"zone": "default", "mode": "auto"}, EventParams: []string{"zone", "level"}},
+			want:   map[string]interface{}{"zone": "north", "level": 3, "mode": "auto"},
+		},
+		{
+			name:   "missing event field keeps the static default",
+			action: models.Action{Params: map[string]interface{}{"priority": "low"}, EventParams: []string{"priority", "zone"}},
+			want:   map[string]interface{}{"priority": "low", "zone": "north"},
+		},
+		{
+			name:   "namespaced event fields leave static params alone",
+			action: models.Action{Params: map[string]interface{}{"zone": "default"}, EventParams: []string{"zone", "missing"}, EventParamsKey: "event"},
+			want:   map[string]interface{}{"zone": "default", "event": map[string]interface{}{"zone": "north"}},
+		},
+		{
+			name:   "namespace replaces a static param of the same name",
+			action: models.Action{Params: map[string]interface{}{"event": "static"}, EventParams: []string{"level"}, EventParamsKey: "event"},
+			want:   map[string]interface{}{"event": map[string]interface{}{"level": 3}},
+		},
+		{
+			name:    "no payload",
+			action:  models.Action{Params: map[string]interface{}{"mode": "auto"}, EventParams: []string{"zone"}},
+			payload: map[string]interface{}{},
+			want:    map[string]interface{}{"mode": "auto"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := payload
+			if tt.payload != nil {
+				p = tt.payload
+			}
+			if got := mergeParams(tt.action, p); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("mergeParams = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A nil payload selects nothing
+	action := models.Action{Params: map[string]interface{}{"mode": "auto"}, EventParams: []string{"zone"}}
+	if got := mergeParams(action, nil); !reflect.DeepEqual(got, map[string]interface{}{"mode": "auto"}) {
+		t.Fatalf("mergeParams with nil payload = %v", got)
+	}
+}
+
+func TestMergeParamsDoesNotModifyAction(t *testing.T) {
+	action := models.Action{Params: map[string]interface{}{"zone": "default"}, EventParams: []string{"zone"}}
+
+	merged := mergeParams(action, map[string]interface{}{"zone": "north"})
+	merged["added"] = true
+
+	if !reflect.DeepEqual(action.Params, map[string]interface{}{"zone": "default"}) {
+		t.Fatalf("action params modified to %v", action.Params)
+	}
+}
+
+func TestResolveCompensateParams(t *testing.T) {
+	forward := map[string]interface{}{
+		"order_id": 7,
+		"event":    map[string]interface{}{"zone": "north"},
+	}
+
+	tests := []struct {
+		name        string
+		compensate  map[string]interface{}
+		forward     map[string]interface{}
+		result      map[string]interface{}
+		want        map[string]interface{}
+		wantMissing []string
+	}{
+		{
+			name:       "forward value keeps its type",
+			compensate: map[string]interface{}{"order_id": "$forward.order_id", "reason": "rollback"},
+			forward:    forward,
+			want:       map[string]interface{}{"order_id": 7, "reason": "rollback"},
+		},
+		{
+			name:       "nested path, in nested params",
+			compensate: map[string]interface{}{"where": map[string]interface{}{"zones": []interface{}{"$forward.event.zone", "south"}}},
+			forward:    forward,
+			want:       map[string]interface{}{"where": map[string]interface{}{"zones": []interface{}{"north", "south"}}},
+		},
+		{
+			name:        "missing forward field is left as-is",
+			compensate:  map[string]interface{}{"order_id": "$forward.order_id", "user": "$forward.user_id"},
+			forward:     forward,
+			want:        map[string]interface{}{"order_id": 7, "user": "$forward.user_id"},
+			wantMissing: []string{"$forward.user_id"},
+		},
+		{
+			name:        "path through a non-map value",
+			compensate:  map[string]interface{}{"id": "$forward.order_id.value"},
+			forward:     forward,
+			want:        map[string]interface{}{"id": "$forward.order_id.value"},
+			wantMissing: []string{"$forward.order_id.value"},
+		},
+		{
+			name:        "forward step had no params",
+			compensate:  map[string]interface{}{"order_id": "$forward.order_id", "empty": "$forward."},
+			forward:     nil,
+			want:        map[string]interface{}{"order_id": "$forward.order_id", "empty": "$forward."},
+			wantMissing: []string{"$forward.order_id", "$forward."},
+		},
+		{
+			name:        "result of a step that never completed",
+			compensate:  map[string]interface{}{"id": "{{ result.reservation }}"},
+			forward:     forward,
+			result:      nil,
+			want:        map[string]interface{}{"id": ""},
+			wantMissing: []string{"result.reservation"},
+		},
+		{
+			name:       "no compensation params",
+			compensate: nil,
+			forward:    forward,
+			want:       nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, missing := resolveCompensateParams(tt.compensate, tt.forward, tt.result)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("resolved = %v, want %v", got, tt.want)
+			}
+			sort.Strings(missing)
+			sort.Strings(tt.wantMissing)
+			if len(missing) != len(tt.wantMissing) || (len(missing) > 0 && !reflect.DeepEqual(missing, tt.wantMissing)) {
+				t.Fatalf("missing = %v, want %v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestCompensationWithMissingForwardParams(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x := connectSim(t, reg, "x")
+	connectSim(t, reg, "y")
+	connectSim(t, reg, "z")
+
+	steps := actions("x", "y", "z")
+	for i := range steps[:2] {
+		steps[i].EventParams = []string{"order_id"}
+		steps[i].CompensateCommand = "undo"
+	}
+	steps[0].CompensateParams = map[string]interface{}{"order_id": "$forward.order_id"}
+	steps[1].CompensateParams = map[string]interface{}{
+		"order_id": "$forward.order_id",
+		"user_id":  "$forward.user_id",
+	}
+	saga, err := sm.CreateSaga(context.Background(), steps, models.Event{Payload: map[string]interface{}{"order_id": 7}})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	for i, target := range []string{"x", "y"} {
+		if err := sm.HandleStepCompletion(saga.SagaID, i, target, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.HandleStepFailure(saga.SagaID, 2, "z"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Step 1's compensation isn't sent with the unresolved reference; the rollback
+	// moves on to step 0, whose params resolve
+	x.next(t)
+	msg := x.next(t)
+	if msg.Command != "undo" || msg.StepID == nil || *msg.StepID != 0 || msg.Params["order_id"] != float64(7) {
+		t.Fatalf("x got %+v, want the compensation of step 0 with order_id 7", msg)
+	}
+	if err := sm.HandleStepCompensated(saga.SagaID, 0, "x"); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, saga, SagaStatusCompensationFailed)
+
+	snapshot := saga.Snapshot()
+	if status := snapshot.Steps[1].Status; status != StepStatusCompensationFailed {
+		t.Fatalf("step 1 is %s, want CompensationFailed", status)
+	}
+	recorded := false
+	for _, reason := range snapshot.FailureReasons {
+		if strings.Contains(reason, "$forward.user_id") {
+			recorded = true
+		}
+	}
+	if !recorded {
+		t.Fatalf("failure reasons %v don't mention the missing reference", snapshot.FailureReasons)
+	}
+	if letters := sm.GetCompensationDeadLetters(); len(letters) != 1 || letters[0].StepID != 1 {
+		t.Fatalf("dead letters = %+v, want step 1", letters)
+	}
+}
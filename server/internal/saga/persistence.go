@@ -0,0 +1,178 @@
+package saga
+
+import (
+	"log"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
+)
+
+/*
+Saga Persistence
+
+With a SagaStore set, every Saga is written to the database when it is created and on
+each state transition (dispatch, completion, failure, each compensation step and the
+final status), so the database always holds the latest state of every Saga.
+
+On startup, LoadActiveSagas reads back the Sagas that were still InProgress or
+Compensating when the server stopped. They are restored for inspection through
+GetSaga/GetAllSagas (and the Saga API) exactly as they were saved. They do not hold
+simulation locks or run step timers: the simulations they were talking to may be gone,
+and deciding whether to resume or compensate them is left to a recovery step. Step
+reports that reference a restored Saga are still handled as usual.
+
+Persistence errors are logged and never fail a Saga: the in-memory state stays
+authoritative while the server runs.
+*/
+
+// SetSagaStore enables persisting Sagas to the given store (nil disables persistence)
+func (sm *SagaManager) SetSagaStore(sagaStore *store.SagaStore) {
+	sm.sagaStore = sagaStore
+}
+
+// persist writes the Saga's current state to the Saga store, if one is set
+// Writes for one Saga are serialized and each writes a fresh snapshot, so a slower
+// write can never overwrite a newer state with an older one.
+func (sm *SagaManager) persist(saga *Saga) {
+	if sm.sagaStore == nil {
+		return
+	}
+
+	saga.persistMu.Lock()
+	defer saga.persistMu.Unlock()
+
+	if err := sm.sagaStore.SaveSaga(saga.toStored()); err != nil {
+		log.Printf("Saga %s: Failed to persist state: %v", saga.SagaID, err)
+	}
+}
+
+// toStored converts the Saga's current state to its stored form
+func (saga *Saga) toStored() store.StoredSaga {
+	saga.mu.RLock()
+	defer saga.mu.RUnlock()
+
+	stored := store.StoredSaga{
+		SagaID:         saga.SagaID,
+		Tenant:         saga.Tenant,
+		Status:         string(saga.Status),
+		CurrentStep:    saga.CurrentStep,
+		ReplayOf:       saga.ReplayOf,
+		Timeout:        saga.Timeout,
+		FailureReasons: append([]string(nil), saga.FailureReasons...),
+		CreatedAt:      saga.CreatedAt,
+		UpdatedAt:      time.Now(),
+		Steps:          make([]store.StoredSagaStep, len(saga.Steps)),
+	}
+	for i, step := range saga.Steps {
+		stored.Steps[i] = store.StoredSagaStep{
+			StepID:              step.StepID,
+			TargetSimulation:    step.TargetSimulation,
+			Command:             step.Command,
+			CompensateCommand:   step.CompensateCommand,
+			Params:              step.Params,
+			CompensateParams:    step.CompensateParams,
+			CompensateAfter:     step.CompensateAfter,
+			CompensateOnPartial: step.CompensateOnPartial,
+			Status:              string(step.Status),
+			Breakpoint:          step.Breakpoint,
+			Timeout:             step.Timeout,
+			ParallelGroup:       step.ParallelGroup,
+			Condition:           storedConditions(step.Condition),
+			Result:              step.Result,
+			ResultDiscarded:     step.ResultDiscarded,
+			CreatedAt:           step.CreatedAt,
+			CompletedAt:         step.CompletedAt,
+		}
+	}
+	return stored
+}
+
+// LoadActiveSagas restores the Sagas that were InProgress, Compensating or Cancelling when the
+// server last stopped and returns how many were restored
+// Call once at startup, after SetSagaStore and before simulations connect.
+func (sm *SagaManager) LoadActiveSagas() (int, error) {
+	if sm.sagaStore == nil {
+		return 0, nil
+	}
+
+	stored, err := sm.sagaStore.GetSagasByStatus(string(SagaStatusInProgress), string(SagaStatusCompensating), string(SagaStatusCancelling))
+	if err != nil {
+		return 0, err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	restored := 0
+	for _, s := range stored {
+		if _, exists := sm.sagas[s.SagaID]; exists {
+			continue
+		}
+		sm.sagas[s.SagaID] = sagaFromStored(s)
+		restored++
+		log.Printf("Restored Saga %s (%s, step %d of %d)", s.SagaID, s.Status, s.CurrentStep, len(s.Steps))
+	}
+	return restored, nil
+}
+
+// sagaFromStored rebuilds a Saga from its stored form
+func sagaFromStored(s store.StoredSaga) *Saga {
+	saga := &Saga{
+		SagaID:         s.SagaID,
+		Tenant:         s.Tenant,
+		CurrentStep:    s.CurrentStep,
+		Status:         SagaStatus(s.Status),
+		CreatedAt:      s.CreatedAt,
+		ReplayOf:       s.ReplayOf,
+		Timeout:        s.Timeout,
+		FailureReasons: s.FailureReasons,
+		Steps:          make([]*SagaStep, len(s.Steps)),
+	}
+	for i, step := range s.Steps {
+		saga.Steps[i] = &SagaStep{
+			StepID:              step.StepID,
+			TargetSimulation:    step.TargetSimulation,
+			Command:             step.Command,
+			CompensateCommand:   step.CompensateCommand,
+			Params:              step.Params,
+			CompensateParams:    step.CompensateParams,
+			CompensateAfter:     step.CompensateAfter,
+			CompensateOnPartial: step.CompensateOnPartial,
+			Status:              StepStatus(step.Status),
+			CreatedAt:           step.CreatedAt,
+			CompletedAt:         step.CompletedAt,
+			Result:              step.Result,
+			ResultDiscarded:     step.ResultDiscarded,
+			Breakpoint:          step.Breakpoint,
+			Timeout:             step.Timeout,
+			ParallelGroup:       step.ParallelGroup,
+			Condition:           conditionsFromStored(step.Condition),
+		}
+	}
+	return saga
+}
+
+// storedConditions converts a step's condition to its stored form
+func storedConditions(conditions []models.PayloadCondition) []store.StoredCondition {
+	if len(conditions) == 0 {
+		return nil
+	}
+	stored := make([]store.StoredCondition, len(conditions))
+	for i, c := range conditions {
+		stored[i] = store.StoredCondition{Key: c.Key, Op: c.Op, Value: c.Value}
+	}
+	return stored
+}
+
+// conditionsFromStored converts a stored step condition back
+func conditionsFromStored(stored []store.StoredCondition) []models.PayloadCondition {
+	if len(stored) == 0 {
+		return nil
+	}
+	conditions := make([]models.PayloadCondition, len(stored))
+	for i, c := range stored {
+		conditions[i] = models.PayloadCondition{Key: c.Key, Op: c.Op, Value: c.Value}
+	}
+	return conditions
+}
@@ -0,0 +1,131 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
+)
+
+var (
+	// ErrSagaNotFound is returned when a Saga ID is unknown
+	ErrSagaNotFound = errors.New("saga not found")
+	// ErrSagaNotTerminal is returned when replaying a Saga that hasn't finished
+	ErrSagaNotTerminal = errors.New("saga has not finished")
+	// ErrTargetsNotConnected is returned when replaying a Saga whose target simulations
+	// are not all connected (see MissingTargetsError)
+	ErrTargetsNotConnected = errors.New("target simulations not connected")
+)
+
+// MissingTargetsError lists the target simulations a replay needs that aren't connected
+type MissingTargetsError struct {
+	Targets []string // Simulation IDs (without tenant), in step order
+}
+
+func (e *MissingTargetsError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrTargetsNotConnected, strings.Join(e.Targets, ", "))
+}
+
+// Is makes errors.Is(err, ErrTargetsNotConnected) match
+func (e *MissingTargetsError) Is(target error) bool {
+	return target == ErrTargetsNotConnected
+}
+
+// ReplaySaga starts a new Saga with the same steps and params as a finished one
+// The steps are sent to whichever simulations are currently connected under the
+// original targets, with the params the original Saga actually sent (event-derived
+// params included). The new Saga records the original's ID in ReplayOf.
+// A Saga that is no longer in memory (e.g. finished before a restart) is read from the
+// Saga store, if one is set. Nothing is started unless every target is connected; a
+// *MissingTargetsError lists the ones that aren't.
+// Like CreateSaga, a Saga may be returned together with an error if its first step
+// could not be dispatched.
+func (sm *SagaManager) ReplaySaga(sagaID string) (*Saga, error) {
+	original, exists := sm.GetSaga(sagaID)
+	if !exists {
+		var err error
+		if original, err = sm.loadStoredSaga(sagaID); err != nil {
+			return nil, err
+		}
+	}
+
+	original.mu.RLock()
+	status := original.Status
+	tenant := original.Tenant
+	actions := make([]models.Action, len(original.Steps))
+	for i, step := range original.Steps {
+		actions[i] = models.Action{
+			SendTo:              step.TargetSimulation,
+			Command:             step.Command,
+			Params:              step.Params,
+			CompensateCommand:   step.CompensateCommand,
+			CompensateParams:    step.CompensateParams,
+			CompensateAfter:     step.CompensateAfter,
+			CompensateOnPartial: step.CompensateOnPartial,
+			Breakpoint:          step.Breakpoint,
+			StepTimeout:         step.Timeout,
+			ParallelGroup:       step.ParallelGroup,
+			Condition:           step.Condition,
+			SagaTimeout:         original.Timeout,
+		}
+	}
+	original.mu.RUnlock()
+
+	if !status.IsTerminal() {
+		return nil, fmt.Errorf("%w: %s is %s", ErrSagaNotTerminal, sagaID, status)
+	}
+
+	if err := sm.checkTargetsConnected(actions); err != nil {
+		return nil, err
+	}
+
+	// Targets are already registry keys; no event payload is needed since the
+	// original params are reused as-is
+	replay, err := sm.startSaga(context.Background(), actions, models.Event{Tenant: tenant}, sagaID)
+	if replay != nil {
+		sm.logSaga("info", replay.SagaID, "", "Saga %s: Replay of Saga %s", replay.SagaID, sagaID)
+	}
+	return replay, err
+}
+
+// loadStoredSaga reads a Saga that is not in memory from the Saga store
+// The Saga is only used to build the replay; it is not added to the manager.
+func (sm *SagaManager) loadStoredSaga(sagaID string) (*Saga, error) {
+	if sm.sagaStore == nil {
+		return nil, ErrSagaNotFound
+	}
+
+	stored, err := sm.sagaStore.GetSaga(sagaID)
+	if errors.Is(err, store.ErrSagaNotFound) {
+		return nil, ErrSagaNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saga %s: %w", sagaID, err)
+	}
+	return sagaFromStored(*stored), nil
+}
+
+// checkTargetsConnected returns a *MissingTargetsError if any action's target is not in
+// the registry
+func (sm *SagaManager) checkTargetsConnected(actions []models.Action) error {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, action := range actions {
+		if seen[action.SendTo] {
+			continue
+		}
+		seen[action.SendTo] = true
+		if _, connected := sm.registry.Get(action.SendTo); !connected {
+			_, id := registry.SplitKey(action.SendTo)
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingTargetsError{Targets: missing}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package saga
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// DefaultMaxStepResultSize is the default limit for a stored step result, in bytes
+const DefaultMaxStepResultSize = 64 * 1024
+
+// SetMaxStepResultSize sets the largest step.completed payload (JSON-encoded size in
+// bytes) kept as a step's Result; larger payloads are discarded. 0 = no limit.
+// May be called at any time; it applies to completions received afterwards.
+func (sm *SagaManager) SetMaxStepResultSize(maxBytes int) {
+	sm.maxStepResultSize.Store(int64(maxBytes))
+}
+
+// storeStepResult records the payload of a step's completion report on the step
+// An oversized payload is discarded with a warning so one simulation can't bloat
+// Saga memory; the step is still completed and ResultDiscarded is set. A later use of
+// the discarded result fails instead of seeing an empty one (see discardedResultReason).
+// Must be called with the saga's lock held
+func (sm *SagaManager) storeStepResult(saga *Saga, step *SagaStep, result map[string]interface{}) {
+	if len(result) == 0 {
+		return
+	}
+
+	maxBytes := sm.maxStepResultSize.Load()
+	if maxBytes > 0 {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			log.Printf("Warning: Saga %s: Step %d result could not be encoded, discarding it: %v", saga.SagaID, step.StepID, err)
+			step.ResultDiscarded = true
+			return
+		}
+		if int64(len(encoded)) > maxBytes {
+			log.Printf("Warning: Saga %s: Step %d result is %d bytes (limit %d), discarding it", saga.SagaID, step.StepID, len(encoded), maxBytes)
+			step.ResultDiscarded = true
+			return
+		}
+	}
+
+	step.Result = result
+}
+
+// discardedResultReason describes a step's discarded result for a Saga failure reason
+func (sm *SagaManager) discardedResultReason(stepIndex int) string {
+	return fmt.Sprintf("the result of step %d, which was discarded (step result limit %d bytes)", stepIndex, sm.maxStepResultSize.Load())
+}
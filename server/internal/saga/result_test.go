@@ -0,0 +1,120 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+func TestStepResultSizeLimit(t *testing.T) {
+	result := map[string]interface{}{"reservation": strings.Repeat("r", 100), "count": 3}
+	encoded, _ := json.Marshal(result)
+	size := len(encoded)
+
+	tests := []struct {
+		name          string
+		limit         int
+		wantDiscarded bool
+	}{
+		{name: "no limit", limit: 0},
+		{name: "below the limit", limit: size + 1},
+		{name: "at the limit", limit: size},
+		{name: "above the limit", limit: size - 1, wantDiscarded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, reg := newTestManager(t)
+			sm.SetMaxStepResultSize(tt.limit)
+			x := connectSim(t, reg, "x")
+			y := connectSim(t, reg, "y")
+
+			saga, err := sm.CreateSaga(context.Background(), actions("x", "y"), models.Event{})
+			if err != nil {
+				t.Fatalf("CreateSaga: %v", err)
+			}
+			x.next(t)
+			if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", result); err != nil {
+				t.Fatal(err)
+			}
+
+			step := saga.Snapshot().Steps[0]
+			saga.mu.RLock()
+			stored := saga.Steps[0].Result
+			saga.mu.RUnlock()
+			if step.ResultDiscarded != tt.wantDiscarded {
+				t.Fatalf("ResultDiscarded = %v, want %v", step.ResultDiscarded, tt.wantDiscarded)
+			}
+			if tt.wantDiscarded {
+				if stored != nil {
+					t.Fatalf("discarded result kept: %v", stored)
+				}
+			} else if !reflect.DeepEqual(stored, result) {
+				t.Fatalf("result = %v, want %v", stored, result)
+			}
+
+			// The step completes either way and the Saga moves on
+			if step.Status != StepStatusCompleted {
+				t.Fatalf("step 0 is %s, want Completed", step.Status)
+			}
+			if msg := y.next(t); msg.Command != "cmd1" {
+				t.Fatalf("y got %q, want the next step", msg.Command)
+			}
+		})
+	}
+}
+
+func TestEmptyStepResultNotStored(t *testing.T) {
+	sm := NewSagaManager(nil)
+	sm.SetMaxStepResultSize(1)
+	saga := &Saga{SagaID: "saga_test"}
+	step := &SagaStep{}
+
+	sm.storeStepResult(saga, step, map[string]interface{}{})
+	if step.Result != nil || step.ResultDiscarded {
+		t.Fatalf("empty result stored as %v (discarded %v)", step.Result, step.ResultDiscarded)
+	}
+}
+
+// A compensation templated from a result that was discarded fails instead of rendering ""
+func TestDiscardedResultFailsCompensation(t *testing.T) {
+	sm, reg := newTestManager(t)
+	sm.SetMaxStepResultSize(16)
+	x := connectSim(t, reg, "x")
+	connectSim(t, reg, "y")
+
+	steps := actions("x", "y")
+	steps[0].CompensateCommand = "undo"
+	steps[0].CompensateParams = map[string]interface{}{"reservation": "{{ result.reservation }}"}
+	saga, err := sm.CreateSaga(context.Background(), steps, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+	if err := sm.HandleStepCompletion(saga.SagaID, 0, "x", map[string]interface{}{"reservation": strings.Repeat("r", 100)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.HandleStepFailure(saga.SagaID, 1, "y"); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, saga, SagaStatusCompensationFailed)
+
+	select {
+	case msg := <-x.messages:
+		t.Fatalf("x got %+v, want no compensation", msg)
+	default:
+	}
+	recorded := false
+	for _, reason := range saga.Snapshot().FailureReasons {
+		if strings.Contains(reason, "result of step 0") && strings.Contains(reason, "limit 16 bytes") {
+			recorded = true
+		}
+	}
+	if !recorded {
+		t.Fatalf("failure reasons %v don't name the discarded result and the limit", saga.Snapshot().FailureReasons)
+	}
+}
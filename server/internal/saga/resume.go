@@ -0,0 +1,97 @@
+package saga
+
+import (
+	"log"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+// InFlightStep is a step waiting on a simulation: dispatched and not yet reported, or
+// being compensated and not yet acknowledged
+type InFlightStep struct {
+	SagaID       string
+	StepID       int
+	Tenant       string
+	Command      string // The forward command, or the compensate command when Compensating
+	Params       map[string]interface{}
+	Compensating bool
+}
+
+// GetInFlightStepsForSim returns the steps waiting on simKey, across all Sagas
+func (sm *SagaManager) GetInFlightStepsForSim(simKey string) []InFlightStep {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var steps []InFlightStep
+	for _, saga := range sm.sagas {
+		saga.mu.Lock()
+		for i, step := range saga.Steps {
+			if step.TargetSimulation != simKey {
+				continue
+			}
+			switch step.Status {
+			case StepStatusInFlight:
+				steps = append(steps, InFlightStep{
+					SagaID:  saga.SagaID,
+					StepID:  i,
+					Tenant:  saga.Tenant,
+					Command: step.Command,
+					Params:  step.Params,
+				})
+			case StepStatusCompensating:
+				compensateParams, _ := resolveCompensateParams(step.CompensateParams, step.Params, step.Result)
+				steps = append(steps, InFlightStep{
+					SagaID:       saga.SagaID,
+					StepID:       i,
+					Tenant:       saga.Tenant,
+					Command:      step.CompensateCommand,
+					Params:       compensateParams,
+					Compensating: true,
+				})
+			}
+		}
+		saga.mu.Unlock()
+	}
+	return steps
+}
+
+// ResendInFlight re-sends the commands of all in-flight steps targeting simKey, and the
+// compensate commands of steps awaiting compensation acknowledgment
+// Used when a simulation registers again on a new connection, so commands that may
+// have been lost with the old connection are delivered again. Each carries its original
+// saga_id and step_id, so the simulation's report still matches the step, and is marked
+// resumed so the simulation can tell it apart from a new command. Step timers keep
+// running from the original dispatch; a command not yet acknowledged gets a new
+// acknowledgment window (see ack.go). Returns the number of commands re-sent.
+func (sm *SagaManager) ResendInFlight(simKey string) int {
+	targetSim, exists := sm.registry.Get(simKey)
+	if !exists {
+		return 0
+	}
+
+	sent := 0
+	for _, step := range sm.GetInFlightStepsForSim(simKey) {
+		stepID := step.StepID
+		command := models.Message{
+			Type:    "command",
+			Command: step.Command,
+			Params:  step.Params,
+			SagaID:  step.SagaID,
+			StepID:  &stepID,
+			Tenant:  step.Tenant,
+			Resumed: true,
+		}
+		if err := targetSim.Send(command, 0); err != nil {
+			sm.commandWriteErrors.Add(1)
+			log.Printf("Saga %s: Failed to re-send step %d to %s: %v", step.SagaID, stepID, simKey, err)
+			continue
+		}
+		log.Printf("Saga %s: Re-sent step %d to reconnected simulation %s", step.SagaID, stepID, simKey)
+		sm.recordCommand(simKey, command)
+		if !step.Compensating {
+			sm.restartAckTimer(step.SagaID, stepID, targetSim)
+		}
+		sent++
+	}
+	return sent
+}
@@ -1,13 +1,19 @@
 package saga
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/events"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
 )
 
 /*
@@ -19,7 +25,8 @@ and synchronization across multiple simulations when a scenario spans multiple a
 How Saga Ensures Synchronization:
 1. Sequential Execution: Steps are executed one at a time, with each step waiting for
    confirmation before the next step is dispatched. This prevents race conditions and
-   ensures ordered execution.
+   ensures ordered execution. Steps marked parallel are dispatched together as a group,
+   and the Saga waits for all of them before moving on (see parallel.go).
 
 2. Event-Driven Choreography: Sagas are driven by events (step.completed, step.failed)
    emitted by simulations. This is non-blocking and allows simulations to work
@@ -49,6 +56,13 @@ const (
 	SagaStatusCompleted    SagaStatus = "Completed"
 	SagaStatusFailed       SagaStatus = "Failed"
 	SagaStatusCompensating SagaStatus = "Compensating"
+	// SagaStatusCompensationFailed means at least one compensation was not confirmed;
+	// the simulations may be inconsistent and need manual intervention
+	SagaStatusCompensationFailed SagaStatus = "CompensationFailed"
+	// SagaStatusCancelling and SagaStatusCancelled are the compensating and final
+	// statuses of a Saga cancelled by an operator (see cancel.go)
+	SagaStatusCancelling SagaStatus = "Cancelling"
+	SagaStatusCancelled  SagaStatus = "Cancelled"
 )
 
 // StepStatus represents the current state of a Saga step
@@ -59,201 +73,222 @@ const (
 	StepStatusInFlight  StepStatus = "InFlight"
 	StepStatusCompleted StepStatus = "Completed"
 	StepStatusFailed    StepStatus = "Failed"
+	// Compensation states of a completed step (see compensation.go)
+	StepStatusCompensating       StepStatus = "Compensating"
+	StepStatusCompensated        StepStatus = "Compensated"
+	StepStatusCompensationFailed StepStatus = "CompensationFailed"
+	// StepStatusCancelled is a step that was in flight when its Saga was cancelled
+	StepStatusCancelled StepStatus = "Cancelled"
+	// StepStatusSkipped is a step whose condition didn't hold when the Saga reached it
+	// (see condition.go); it is never dispatched or compensated
+	StepStatusSkipped StepStatus = "Skipped"
 )
 
 // SagaStep represents a single step in a Saga transaction
 type SagaStep struct {
-	StepID            int                    // Sequential step identifier
-	TargetSimulation  string                 // Which simulation to send command to
-	Command           string                 // Forward action command
-	CompensateCommand string                 // Rollback command
-	Params            map[string]interface{} // Command parameters
-	CompensateParams  map[string]interface{} // Compensation parameters
-	Status            StepStatus             // Current step status
-	CreatedAt         time.Time              // When step was created
-	CompletedAt       *time.Time             // When step completed (nil if not completed)
+	StepID              int                       // Sequential step identifier
+	TargetSimulation    string                    // Which simulation to send command to
+	Command             string                    // Forward action command
+	CompensateCommand   string                    // Rollback command
+	Params              map[string]interface{}    // Command parameters (kept unchanged so compensation can reference them)
+	CompensateParams    map[string]interface{}    // Compensation parameters
+	CompensateAfter     []int                     // Steps whose compensations must run before this one
+	CompensateOnPartial bool                      // Compensate the step even if it was sent but didn't complete (see compensation.go)
+	Status              StepStatus                // Current step status
+	CreatedAt           time.Time                 // When step was created
+	CompletedAt         *time.Time                // When step completed (nil if not completed)
+	Result              map[string]interface{}    // Payload of the step.completed report (nil if none or discarded)
+	ResultDiscarded     bool                      // The completion payload exceeded the size limit and was not kept
+	Breakpoint          bool                      // Pause before dispatching this step until resumed (see ResumeStep)
+	Timeout             time.Duration             // Timeout set in the scenario (0 = server default)
+	EffectiveTimeout    time.Duration             // Timeout applied when the step was dispatched (0 = none)
+	ParallelGroup       int                       // Consecutive steps with the same non-zero group run together (0 = sequential)
+	Condition           []models.PayloadCondition // Earlier steps' results that must match for the step to run (see condition.go)
+
+	breakpointReleased  bool        // An operator resumed the Saga at this step's breakpoint
+	timer               *time.Timer // Pending step timeout (nil if none)
+	ackTimer            *time.Timer // Pending command acknowledgment timeout (nil if none; see ack.go)
+	commandAcked        bool        // The target acknowledged receiving the command
+	dispatchedAt        time.Time   // When the command was last dispatched (zero if never, or restored)
+	forwardStatus       StepStatus  // Failed or Cancelled for a partial step being compensated ("" otherwise)
+	compensationRetries int         // Compensation retries made so far (see compensation_retry.go)
 }
 
 // Saga represents a distributed transaction across multiple simulations
 // Each Saga ensures eventual consistency: either all steps complete or all are rolled back
 type Saga struct {
-	SagaID      string       // Unique identifier for this Saga
-	CurrentStep int          // Index of the current step being executed (0-based)
-	Status      SagaStatus   // Overall Saga status
-	Steps       []*SagaStep  // Ordered list of steps to execute
-	CreatedAt   time.Time    // When Saga was created
-	mu          sync.RWMutex // Protects Saga state
-	lockedSims  []string     // List of simulation IDs that are locked by this saga
+	SagaID      string        // Unique identifier for this Saga
+	Tenant      string        // Tenant the Saga runs in; all its targets belong to this tenant
+	CurrentStep int           // Index of the current step being executed (0-based; first step of a parallel group)
+	Status      SagaStatus    // Overall Saga status
+	Steps       []*SagaStep   // Ordered list of steps to execute
+	CreatedAt   time.Time     // When Saga was created
+	ReplayOf    string        // ID of the Saga this one replays ("" if not a replay)
+	Timeout     time.Duration // Time the Saga may take to reach a terminal status (0 = none; see deadline.go)
+	mu          sync.RWMutex  // Protects Saga state
+	persistMu   sync.Mutex    // Serializes writes of this Saga to the Saga store
+	lockedSims  []string      // Simulations whose locks this Saga holds (protected by SagaManager.lockMu)
+	holdsSlot   bool          // Counts against the concurrency limit (protected by SagaManager.slots.mu; see limit.go)
+
+	deadlineTimer *time.Timer // Pending Saga timeout (nil if none)
+
+	compensationsRun  int   // Number of compensations acknowledged (for the summary log)
+	compensationQueue []int // Steps still to compensate, in order (see compensateNext)
+
+	failing bool // A step of the current stage failed; compensation waits for the rest (see parallel.go)
+
+	FailureReasons []string // Why the Saga failed, plus any inconsistencies found in strict mode
 }
 
 // SagaManager manages the lifecycle of all Sagas
 // It handles Saga creation, step progression, and compensation in a thread-safe manner
 // It also prevents concurrent Sagas from targeting the same simulation
 type SagaManager struct {
-	sagas    map[string]*Saga // Map of SagaID -> Saga
-	mu       sync.RWMutex     // Protects sagas map
+	sagas    map[string]*Saga   // Map of SagaID -> Saga
+	mu       sync.RWMutex       // Protects sagas map
 	registry *registry.Registry // Reference to simulation registry for sending commands
 
-	// Simulation-level locking to prevent concurrent Sagas
-	simulationLocks map[string]*sync.Mutex // Map of simID -> mutex
-	activeSagas     map[string][]string    // Map of simID -> []sagaIDs (for conflict tracking)
-	lockMu          sync.Mutex             // Protects simulationLocks and activeSagas
-}
+	// Simulation-level locking to prevent concurrent Sagas (see locks.go)
+	simulationLocks map[string]string // Map of simID -> ID of the Saga holding its lock
+	lockMu          sync.Mutex        // Protects simulationLocks and every Saga's lockedSims
 
-// NewSagaManager creates a new SagaManager
-func NewSagaManager(reg *registry.Registry) *SagaManager {
-	return &SagaManager{
-		sagas:           make(map[string]*Saga),
-		registry:        reg,
-		simulationLocks: make(map[string]*sync.Mutex),
-		activeSagas:     make(map[string][]string),
-	}
-}
+	commandWriteErrors atomic.Int64 // Number of commands that failed to send to a simulation
 
-// acquireSimulationLock acquires a lock for a simulation, preventing concurrent Sagas
-// Returns the lock and true if acquired, false if simulation is already locked by another Saga
-func (sm *SagaManager) acquireSimulationLock(simID string) (*sync.Mutex, bool) {
-	sm.lockMu.Lock()
-	defer sm.lockMu.Unlock()
+	stats sagaStats // Sagas created/finished and step latency (see stats.go)
 
-	// Initialize lock if it doesn't exist
-	if sm.simulationLocks[simID] == nil {
-		sm.simulationLocks[simID] = &sync.Mutex{}
-	}
+	stopped atomic.Bool // New Sagas are refused during shutdown (see shutdown.go)
 
-	lock := sm.simulationLocks[simID]
+	slots sagaSlots // Concurrent Saga limit (see limit.go)
 
-	// Try to acquire lock (non-blocking check)
-	acquired := lock.TryLock()
-	return lock, acquired
-}
+	maxStepResultSize atomic.Int64 // Largest step result kept, in bytes (0 = no limit)
 
-// releaseSimulationLock releases a lock for a simulation
-func (sm *SagaManager) releaseSimulationLock(simID string, lock *sync.Mutex) {
-	lock.Unlock()
+	lateCompletionPolicy atomic.Pointer[LateCompletionPolicy] // How completions for finished Sagas are handled
+	lateCompletions      atomic.Int64                         // Number of completions received for finished Sagas
 
-	sm.lockMu.Lock()
-	defer sm.lockMu.Unlock()
+	stepTimeouts        atomic.Pointer[StepTimeoutConfig] // How long dispatched steps may stay in flight
+	sagaTimeout         atomic.Int64                      // Default time a Saga may take to finish (time.Duration; see deadline.go)
+	compensationTimeout atomic.Int64                      // How long a compensation may wait for its acknowledgment (time.Duration)
+	commandAckTimeout   atomic.Int64                      // How long a command may wait for command.received (time.Duration; see ack.go)
 
-	// Remove from active sagas tracking
-	if sagas, exists := sm.activeSagas[simID]; exists {
-		// Remove this saga from the list (cleanup happens in cleanupSimulationLocks)
-		_ = sagas // Keep for now, cleanup happens when saga completes
-	}
-}
+	compensationRetries    atomic.Int64 // Times a failed compensation is retried (see compensation_retry.go)
+	compensationRetryDelay atomic.Int64 // Wait before each compensation retry (time.Duration)
+	deadLetters            deadLetters  // Compensations that failed for good
 
-// trackActiveSimulation records that a saga is using a simulation
-func (sm *SagaManager) trackActiveSimulation(simID string, sagaID string) {
-	sm.lockMu.Lock()
-	defer sm.lockMu.Unlock()
+	strictTemplates atomic.Bool // Missing payload fields in param templates fail Saga creation (see template.go)
 
-	if sm.activeSagas[simID] == nil {
-		sm.activeSagas[simID] = make([]string, 0)
-	}
-	sm.activeSagas[simID] = append(sm.activeSagas[simID], sagaID)
-	log.Printf("Saga %s now active on simulation %s", sagaID, simID)
+	maxSagaSteps          atomic.Int64 // Most steps a Saga may have (0 = no limit; see step_limit.go)
+	allowDuplicateTargets atomic.Bool  // Several steps of a Saga may target the same simulation
+
+	logStore *logging.LogStore // Optional: receives one summary entry per finished Saga
+	hub      *events.Hub       // Optional: receives Saga lifecycle events (see events.go)
+
+	sagaStore *store.SagaStore // Optional: persists Saga state (see persistence.go)
+	eventLog  *store.EventLog  // Optional: records every dispatched command (see event_log.go)
+
+	// strict turns normally-tolerated inconsistencies (orphaned step reports,
+	// compensations that can't run) into errors and Saga failure reasons
+	strict bool
 }
 
-// untrackActiveSimulation removes a saga from simulation tracking
-func (sm *SagaManager) untrackActiveSimulation(simID string, sagaID string) {
-	sm.lockMu.Lock()
-	defer sm.lockMu.Unlock()
-
-	if sagas, exists := sm.activeSagas[simID]; exists {
-		for i, id := range sagas {
-			if id == sagaID {
-				// Remove from slice
-				sm.activeSagas[simID] = append(sagas[:i], sagas[i+1:]...)
-				log.Printf("Saga %s no longer active on simulation %s", sagaID, simID)
-				break
-			}
-		}
-		// Clean up empty entries
-		if len(sm.activeSagas[simID]) == 0 {
-			delete(sm.activeSagas, simID)
-		}
-	}
+// NewSagaManager creates a new SagaManager
+func NewSagaManager(reg *registry.Registry) *SagaManager {
+	sm := &SagaManager{
+		sagas:           make(map[string]*Saga),
+		registry:        reg,
+		simulationLocks: make(map[string]string),
+	}
+	sm.SetMaxStepResultSize(DefaultMaxStepResultSize)
+	sm.SetCompensationTimeout(DefaultCompensationTimeout)
+	sm.SetCommandAckTimeout(DefaultCommandAckTimeout)
+	sm.SetStepLimits(DefaultMaxSagaSteps, true)
+	sm.SetCompensationRetries(DefaultCompensationRetries, DefaultCompensationRetryDelay)
+	sm.SetCompensationDeadLetterSize(DefaultCompensationDeadLetterSize)
+	return sm
 }
 
-// CheckConflict checks if a simulation is currently involved in any active Sagas
-// Returns the list of conflicting saga IDs and whether a conflict exists
-func (sm *SagaManager) CheckConflict(simID string) ([]string, bool) {
-	sm.lockMu.Lock()
-	defer sm.lockMu.Unlock()
+// SetStrictMode enables or disables strict mode
+// In strict mode, step reports for steps that aren't in flight are rejected with an error,
+// and compensations that can't be run (no command, simulation missing) are recorded as
+// Saga failure reasons instead of being silently skipped.
+func (sm *SagaManager) SetStrictMode(strict bool) {
+	sm.strict = strict
+}
 
-	activeSagas, exists := sm.activeSagas[simID]
-	if !exists || len(activeSagas) == 0 {
-		return nil, false
-	}
+// IsTerminal reports whether a Saga in this status has finished for good
+func (status SagaStatus) IsTerminal() bool {
+	return status == SagaStatusCompleted || status == SagaStatusFailed || status == SagaStatusCompensationFailed ||
+		status == SagaStatusCancelled
+}
 
-	// Filter to only in-progress sagas
-	conflictingSagas := make([]string, 0)
-	sm.mu.RLock()
-	for _, sagaID := range activeSagas {
-		if saga, exists := sm.sagas[sagaID]; exists {
-			if saga.Status == SagaStatusInProgress || saga.Status == SagaStatusPending {
-				conflictingSagas = append(conflictingSagas, sagaID)
-			}
-		}
-	}
-	sm.mu.RUnlock()
+// GetStatus returns the Saga's current status
+func (saga *Saga) GetStatus() SagaStatus {
+	saga.mu.RLock()
+	defer saga.mu.RUnlock()
 
-	return conflictingSagas, len(conflictingSagas) > 0
+	return saga.Status
 }
 
-// cleanupSimulationLocks removes tracking for all simulations used by a saga
-func (sm *SagaManager) cleanupSimulationLocks(saga *Saga) {
-	// Get unique simulations from saga steps
-	sims := make(map[string]bool)
-	for _, step := range saga.Steps {
-		sims[step.TargetSimulation] = true
-	}
+// addFailureReason records why a Saga failed
+// Must be called with the saga's lock held
+func (saga *Saga) addFailureReason(format string, args ...interface{}) {
+	saga.FailureReasons = append(saga.FailureReasons, fmt.Sprintf(format, args...))
+}
 
-	// Untrack this saga from all simulations
-	for simID := range sims {
-		sm.untrackActiveSimulation(simID, saga.SagaID)
+// scopeActionsToTenant returns a copy of actions whose targets are registry keys in the tenant
+func scopeActionsToTenant(actions []models.Action, tenant string) []models.Action {
+	scoped := make([]models.Action, len(actions))
+	for i, action := range actions {
+		scoped[i] = action
+		scoped[i].SendTo = registry.Key(tenant, action.SendTo)
 	}
+	return scoped
 }
 
 // CreateSaga creates a new Saga from a list of actions (from a scenario rule)
 // The Saga is created in Pending status and the first step is dispatched immediately
-// This method now includes conflict detection and simulation-level locking
-func (sm *SagaManager) CreateSaga(actions []models.Action) (*Saga, error) {
+// This method includes conflict detection and simulation-level locking (see locks.go)
+// The triggering event's payload is used to fill in param templates and event-derived
+// step params
+// ctx bounds the wait for a slot under the concurrent Saga limit (see limit.go).
+func (sm *SagaManager) CreateSaga(ctx context.Context, actions []models.Action, event models.Event) (*Saga, error) {
 	if len(actions) == 0 {
 		return nil, fmt.Errorf("cannot create saga with no actions")
 	}
 
-	// Check for conflicts before creating the saga
-	conflictingSims := make(map[string][]string)
-	for _, action := range actions {
-		if conflicts, hasConflict := sm.CheckConflict(action.SendTo); hasConflict {
-			conflictingSims[action.SendTo] = conflicts
-		}
+	rendered, err := sm.renderActionTemplates(actions, event.Payload)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(conflictingSims) > 0 {
-		log.Printf("Conflict detected: cannot create saga - simulations are busy")
-		for simID, sagaIDs := range conflictingSims {
-			log.Printf("  Simulation %s is busy in sagas: %v", simID, sagaIDs)
-		}
-		return nil, fmt.Errorf("conflict detected: target simulations are busy in other sagas")
-	}
+	// Scope targets to the event's tenant: from here on, SendTo and TargetSimulation
+	// hold registry keys, so conflicts and locks are per tenant
+	return sm.startSaga(ctx, scopeActionsToTenant(rendered, event.Tenant), event, "")
+}
 
-	// Acquire locks for all target simulations
-	locks := make(map[string]*sync.Mutex)
-	lockedSims := make([]string, 0)
+// startSaga creates and starts a Saga from actions whose SendTo are already registry keys
+// replayOf is the ID of the Saga being replayed, if any
+func (sm *SagaManager) startSaga(ctx context.Context, actions []models.Action, event models.Event, replayOf string) (*Saga, error) {
+	if sm.stopped.Load() {
+		return nil, ErrShuttingDown
+	}
 
-	for _, action := range actions {
-		lock, acquired := sm.acquireSimulationLock(action.SendTo)
-		if !acquired {
-			// Release all previously acquired locks
-			for simID, l := range locks {
-				sm.releaseSimulationLock(simID, l)
+	// In strict mode, refuse to start a Saga that can't reach all of its targets
+	if sm.strict {
+		for _, action := range actions {
+			if _, exists := sm.registry.Get(action.SendTo); !exists {
+				return nil, fmt.Errorf("target simulation not connected: %s", action.SendTo)
 			}
-			return nil, fmt.Errorf("failed to acquire lock for simulation %s (may be busy)", action.SendTo)
 		}
-		locks[action.SendTo] = lock
-		lockedSims = append(lockedSims, action.SendTo)
+	}
+
+	// Refuse oversized Sagas before they take a slot or any lock (see step_limit.go)
+	if err := sm.checkStepLimits(actions); err != nil {
+		return nil, err
+	}
+
+	// Wait for (or fail without) a slot under the concurrent Saga limit
+	if err := sm.acquireSlot(ctx); err != nil {
+		return nil, err
 	}
 
 	// Generate unique Saga ID
@@ -263,105 +298,182 @@ func (sm *SagaManager) CreateSaga(actions []models.Action) (*Saga, error) {
 	steps := make([]*SagaStep, len(actions))
 	for i, action := range actions {
 		steps[i] = &SagaStep{
-			StepID:            i,
-			TargetSimulation:  action.SendTo,
-			Command:           action.Command,
-			CompensateCommand: action.CompensateCommand,
-			Params:            action.Params,
-			CompensateParams:  action.CompensateParams,
-			Status:            StepStatusPending,
-			CreatedAt:         time.Now(),
+			StepID:              i,
+			TargetSimulation:    action.SendTo,
+			Command:             action.Command,
+			CompensateCommand:   action.CompensateCommand,
+			Params:              mergeParams(action, event.Payload),
+			CompensateParams:    action.CompensateParams,
+			CompensateAfter:     action.CompensateAfter,
+			CompensateOnPartial: action.CompensateOnPartial,
+			Breakpoint:          action.Breakpoint,
+			Timeout:             action.StepTimeout,
+			ParallelGroup:       action.ParallelGroup,
+			Condition:           action.Condition,
+			Status:              StepStatusPending,
+			CreatedAt:           time.Now(),
 		}
 	}
 
 	saga := &Saga{
 		SagaID:      sagaID,
+		Tenant:      event.Tenant,
 		CurrentStep: 0,
 		Status:      SagaStatusPending,
 		Steps:       steps,
 		CreatedAt:   time.Now(),
-		lockedSims:  lockedSims, // Store which simulations are locked
+		ReplayOf:    replayOf,
+		Timeout:     sm.sagaTimeoutFor(actions),
+		holdsSlot:   true,
 	}
 
+	// Check for conflicts and acquire locks for all target simulations in one step
+	targets := make([]string, len(actions))
+	for i, action := range actions {
+		targets[i] = action.SendTo
+	}
+	if err := sm.acquireSagaLocks(saga, targets); err != nil {
+		log.Printf("Cannot create saga: %v", err)
+		sm.releaseSlot(saga)
+		return nil, err
+	}
+	lockedCount := len(saga.lockedSims)
+
 	// Store Saga
 	sm.mu.Lock()
 	sm.sagas[sagaID] = saga
 	sm.mu.Unlock()
+	sm.countCreated()
 
-	// Track this saga for all target simulations
-	for _, simID := range lockedSims {
-		sm.trackActiveSimulation(simID, sagaID)
-	}
-
-	log.Printf("Created Saga %s with %d steps (locks acquired for %d simulations)", sagaID, len(steps), len(lockedSims))
+	sm.logSaga("info", sagaID, "", "Created Saga %s with %d steps (locks acquired for %d simulations)", sagaID, len(steps), lockedCount)
+	saga.mu.RLock()
+	sm.hub.Publish(events.SagaCreated, sagaEvent(saga))
+	saga.mu.RUnlock()
 
-	// Dispatch first step immediately
-	if err := sm.dispatchStep(saga, 0); err != nil {
-		log.Printf("Failed to dispatch first step of Saga %s: %v", sagaID, err)
-		// Release locks and cleanup
-		for simID, lock := range locks {
-			sm.releaseSimulationLock(simID, lock)
-		}
-		sm.cleanupSimulationLocks(saga)
-		// Mark Saga as failed
+	// Dispatch first step (or parallel group) immediately
+	if err := sm.dispatchStage(saga, 0); err != nil {
+		sm.logSaga("error", sagaID, "", "Failed to dispatch first step of Saga %s: %v", sagaID, err)
+		// Mark Saga as failed, together with its reason, and release its locks
 		saga.mu.Lock()
+		saga.addFailureReason("step 0 dispatch failed: %v", err)
 		saga.Status = SagaStatusFailed
 		saga.mu.Unlock()
+		sm.releaseSagaLocks(saga)
+		sm.persist(saga)
+		sm.logSummary(saga)
 		return saga, err
 	}
 
+	// Fail the Saga if it hasn't finished in time
+	sm.startDeadlineTimer(saga)
+
 	// Note: Locks will be released when the saga completes or fails
 	// This is handled in HandleStepCompletion and HandleStepFailure
 
 	return saga, nil
 }
 
-// dispatchStep sends a command to the target simulation for a specific step
+// ErrCommandNotSupported is returned when a step's target simulation advertised
+// capabilities that don't include the step's command
+var ErrCommandNotSupported = errors.New("command not supported by target simulation")
+
+// dispatchStage sends the commands of the stage starting at stageStart: a single step,
+// or every step of a parallel group (see parallel.go)
 // This is the forward action of the Saga step
-func (sm *SagaManager) dispatchStep(saga *Saga, stepIndex int) error {
-	if stepIndex < 0 || stepIndex >= len(saga.Steps) {
-		return fmt.Errorf("invalid step index: %d", stepIndex)
+func (sm *SagaManager) dispatchStage(saga *Saga, stageStart int) error {
+	if stageStart < 0 || stageStart >= len(saga.Steps) {
+		return fmt.Errorf("invalid step index: %d", stageStart)
+	}
+	stageEnd := saga.stageEnd(stageStart)
+
+	// Stop at a breakpoint until an operator resumes the Saga; the steps stay Pending
+	// and the Saga keeps its locks
+	for i := stageStart; i < stageEnd; i++ {
+		if sm.pauseAtBreakpoint(saga, i) {
+			sm.persist(saga)
+			return nil
+		}
 	}
 
-	step := saga.Steps[stepIndex]
-
-	// Get target simulation
-	targetSim, exists := sm.registry.Get(step.TargetSimulation)
-	if !exists {
-		return fmt.Errorf("target simulation not found: %s", step.TargetSimulation)
+	// Get target simulations, so a missing or incapable one fails the stage before
+	// anything is sent
+	targets := make([]*models.Simulation, 0, stageEnd-stageStart)
+	for i := stageStart; i < stageEnd; i++ {
+		targetSim, exists := sm.registry.Get(saga.Steps[i].TargetSimulation)
+		if !exists {
+			return fmt.Errorf("target simulation not found: %s", saga.Steps[i].TargetSimulation)
+		}
+		// Fail fast instead of waiting for a timeout on a command the target can't handle
+		if !targetSim.Supports(saga.Steps[i].Command) {
+			return fmt.Errorf("%w: %s does not handle %s", ErrCommandNotSupported, saga.Steps[i].TargetSimulation, saga.Steps[i].Command)
+		}
+		targets = append(targets, targetSim)
 	}
 
-	// Create command message with Saga context
-	stepIDPtr := &stepIndex
-	command := models.Message{
-		Type:    "command",
-		Command: step.Command,
-		Params:  step.Params,
-		// Include Saga context so simulation can acknowledge with saga_id and step_id
-		SagaID: saga.SagaID,
-		StepID: stepIDPtr,
+	// Mark the steps before sending so a fast acknowledgment finds them in flight, and
+	// a member completing early doesn't look like the end of its group
+	saga.mu.Lock()
+	// The Saga was cancelled while this stage was being prepared
+	if saga.Status != SagaStatusPending && saga.Status != SagaStatusInProgress {
+		status := saga.Status
+		saga.mu.Unlock()
+		log.Printf("Saga %s: Not dispatching step %d, the Saga is %s", saga.SagaID, stageStart, status)
+		return nil
 	}
-
-	// Send command
-	if err := targetSim.Connection.WriteJSON(command); err != nil {
-		return fmt.Errorf("failed to send command to %s: %w", step.TargetSimulation, err)
+	now := time.Now()
+	for i := stageStart; i < stageEnd; i++ {
+		saga.Steps[i].Status = StepStatusInFlight
+		saga.Steps[i].dispatchedAt = now
+		saga.Steps[i].commandAcked = false
+		// A step without a compensate command of its own is rolled back with the
+		// target's default, if it advertised one
+		if saga.Steps[i].CompensateCommand == "" {
+			saga.Steps[i].CompensateCommand = targets[i-stageStart].DefaultCompensateCommand
+		}
 	}
-
-	// Update step status
-	saga.mu.Lock()
-	step.Status = StepStatusInFlight
 	if saga.Status == SagaStatusPending {
 		saga.Status = SagaStatusInProgress
 	}
 	saga.mu.Unlock()
 
-	log.Printf("Saga %s: Dispatched step %d to %s (command: %s)", saga.SagaID, stepIndex, step.TargetSimulation, step.Command)
+	for i := stageStart; i < stageEnd; i++ {
+		step := saga.Steps[i]
+
+		// Create command message with Saga context
+		stepIDPtr := &i
+		command := models.Message{
+			Type:    "command",
+			Command: step.Command,
+			Params:  step.Params,
+			// Include Saga context so simulation can acknowledge with saga_id and step_id
+			SagaID: saga.SagaID,
+			StepID: stepIDPtr,
+			Tenant: saga.Tenant,
+		}
+
+		// Send command
+		if err := targets[i-stageStart].Send(command, 0); err != nil {
+			sm.commandWriteErrors.Add(1)
+			return sm.abortStage(saga, stageStart, i, fmt.Errorf("failed to send command to %s: %w", step.TargetSimulation, err))
+		}
+
+		sm.logSaga("info", saga.SagaID, step.TargetSimulation, "Saga %s: Dispatched step %d to %s (command: %s)", saga.SagaID, i, step.TargetSimulation, step.Command)
+		sm.recordCommand(step.TargetSimulation, command)
+
+		// Fail the step if it isn't acknowledged in time
+		sm.startStepTimer(saga, i)
+		sm.startAckTimer(saga, i, targets[i-stageStart])
+	}
+
+	sm.persist(saga)
 	return nil
 }
 
 // HandleStepCompletion is called when a simulation emits a step.completed event
 // This advances the Saga to the next step or marks it as completed
-func (sm *SagaManager) HandleStepCompletion(sagaID string, stepID int) error {
+// simID is the simulation reporting the completion; it must be the step's target
+// result is the report's payload, kept on the step (subject to the result size limit)
+func (sm *SagaManager) HandleStepCompletion(sagaID string, stepID int, simID string, result map[string]interface{}) error {
 	sm.mu.RLock()
 	saga, exists := sm.sagas[sagaID]
 	sm.mu.RUnlock()
@@ -371,18 +483,43 @@ func (sm *SagaManager) HandleStepCompletion(sagaID string, stepID int) error {
 	}
 
 	saga.mu.Lock()
-	defer saga.mu.Unlock()
 
 	// Validate step ID
 	if stepID < 0 || stepID >= len(saga.Steps) {
+		saga.mu.Unlock()
 		return fmt.Errorf("invalid step ID: %d", stepID)
 	}
 
 	step := saga.Steps[stepID]
 
+	// Only the simulation the step was dispatched to may complete it
+	if step.TargetSimulation != simID {
+		saga.mu.Unlock()
+		sm.logSaga("warning", sagaID, simID, "Saga %s: Step %d completion from %s rejected (step targets %s)", sagaID, stepID, simID, step.TargetSimulation)
+		return fmt.Errorf("simulation %s is not the target of saga %s step %d", simID, sagaID, stepID)
+	}
+
+	// A completion for a Saga that already finished is handled by the late completion policy
+	if saga.Status.IsTerminal() {
+		status := saga.Status
+		saga.mu.Unlock()
+		return sm.handleLateCompletion(sagaID, stepID, simID, status)
+	}
+
+	// The step was in flight when the Saga was cancelled; its outcome no longer matters
+	if step.Status == StepStatusCancelled {
+		saga.mu.Unlock()
+		log.Printf("Saga %s: Step %d was cancelled, ignoring completion from %s", sagaID, stepID, simID)
+		return nil
+	}
+
 	// Check if this step is actually in flight
 	if step.Status != StepStatusInFlight {
+		saga.mu.Unlock()
 		log.Printf("Saga %s: Step %d is not in flight (status: %s), ignoring completion", sagaID, stepID, step.Status)
+		if sm.strict {
+			return fmt.Errorf("orphaned completion: saga %s step %d is not in flight (status: %s)", sagaID, stepID, step.Status)
+		}
 		return nil
 	}
 
@@ -390,44 +527,90 @@ func (sm *SagaManager) HandleStepCompletion(sagaID string, stepID int) error {
 	now := time.Now()
 	step.Status = StepStatusCompleted
 	step.CompletedAt = &now
+	step.stopTimer()
+	sm.storeStepResult(saga, step, result)
+	if !step.dispatchedAt.IsZero() {
+		sm.observeStepLatency(now.Sub(step.dispatchedAt))
+	}
 
-	log.Printf("Saga %s: Step %d completed", sagaID, stepID)
+	sm.logSaga("info", sagaID, simID, "Saga %s: Step %d completed", sagaID, stepID)
+	sm.publishStepAdvanced(saga, step)
+
+	// A step of this parallel group already failed: compensate once the group settles
+	if saga.failing {
+		sm.settleFailedStage(saga)
+		return nil
+	}
+
+	// Wait for the rest of a parallel group
+	stageEnd := saga.stageEnd(saga.CurrentStep)
+	if inFlight := saga.countInFlight(saga.CurrentStep, stageEnd); inFlight > 0 {
+		saga.mu.Unlock()
+		log.Printf("Saga %s: Waiting for %d more parallel steps", sagaID, inFlight)
+		sm.persist(saga)
+		return nil
+	}
+
+	// Skip the following steps whose conditions don't hold
+	nextStepIndex, err := sm.skipUnmetSteps(saga, stageEnd)
+	if err != nil {
+		sm.logSaga("error", sagaID, "", "Saga %s: Cannot decide whether to run step %d: %v", sagaID, nextStepIndex, err)
+		saga.addFailureReason("%v", err)
+		saga.mu.Unlock()
+		// Compensation releases the locks and logs the summary once it finishes
+		sm.triggerCompensation(saga, nextStepIndex-1)
+		return nil
+	}
 
 	// Check if this was the last step
-	if stepID == len(saga.Steps)-1 {
+	if nextStepIndex == len(saga.Steps) {
 		// All steps completed successfully
 		saga.Status = SagaStatusCompleted
-		log.Printf("Saga %s: All steps completed successfully", sagaID)
+		sm.logSaga("info", sagaID, "", "Saga %s: All steps completed successfully", sagaID)
 
-		// Release all simulation locks and cleanup tracking
+		// Release all simulation locks
 		saga.mu.Unlock()
-		sm.cleanupSimulationLocks(saga)
-		sm.releaseAllLocksForSaga(saga)
+		sm.releaseSagaLocks(saga)
+		sm.persist(saga)
+		sm.logSummary(saga)
 		return nil
 	}
 
-	// Advance to next step
-	nextStepIndex := stepID + 1
+	// Advance to next step (or parallel group)
 	saga.CurrentStep = nextStepIndex
 
 	// Unlock before dispatching to avoid deadlock
 	saga.mu.Unlock()
+	sm.persist(saga)
 
 	// Dispatch next step
-	if err := sm.dispatchStep(saga, nextStepIndex); err != nil {
-		log.Printf("Saga %s: Failed to dispatch step %d: %v", sagaID, nextStepIndex, err)
+	if err := sm.dispatchStage(saga, nextStepIndex); err != nil {
+		sm.logSaga("error", sagaID, "", "Saga %s: Failed to dispatch step %d: %v", sagaID, nextStepIndex, err)
+		saga.mu.Lock()
+		saga.addFailureReason("step %d dispatch failed: %v", nextStepIndex, err)
+		saga.mu.Unlock()
 		// Trigger compensation
-		sm.triggerCompensation(saga, stepID) // Compensate from the failed step backwards
+		// Compensation releases the locks and logs the summary once it finishes
+		sm.triggerCompensation(saga, nextStepIndex-1) // Compensate from the failed step backwards
 		return err
 	}
 
-	saga.mu.Lock()
 	return nil
 }
 
-// HandleStepFailure is called when a simulation emits a step.failed event or times out
+// HandleStepFailure is called when a simulation emits a step.failed event
 // This triggers compensation for all completed steps
-func (sm *SagaManager) HandleStepFailure(sagaID string, stepID int) error {
+// simID is the simulation reporting the failure; it must be the step's target
+func (sm *SagaManager) HandleStepFailure(sagaID string, stepID int, simID string) error {
+	return sm.failStep(sagaID, stepID, simID, "")
+}
+
+// failStep marks a step failed and compensates the Saga
+// reason is set when the server itself detected the failure (a step timeout or a dead
+// connection) and is "" for a step.failed report. A server-detected failure only fails a
+// step that is still in flight, checked under the Saga's lock so a completion arriving
+// at the same moment wins.
+func (sm *SagaManager) failStep(sagaID string, stepID int, simID string, reason string) error {
 	sm.mu.RLock()
 	saga, exists := sm.sagas[sagaID]
 	sm.mu.RUnlock()
@@ -437,113 +620,71 @@ func (sm *SagaManager) HandleStepFailure(sagaID string, stepID int) error {
 	}
 
 	saga.mu.Lock()
-	defer saga.mu.Unlock()
 
 	// Validate step ID
 	if stepID < 0 || stepID >= len(saga.Steps) {
+		saga.mu.Unlock()
 		return fmt.Errorf("invalid step ID: %d", stepID)
 	}
 
 	step := saga.Steps[stepID]
 
-	// Mark step as failed
-	step.Status = StepStatusFailed
-	saga.Status = SagaStatusFailed
-
-	log.Printf("Saga %s: Step %d failed, triggering compensation", sagaID, stepID)
-
-	// Unlock before compensation to avoid deadlock
-	saga.mu.Unlock()
-
-	// Trigger compensation (rollback all completed steps in reverse order)
-	sm.triggerCompensation(saga, stepID-1) // Compensate up to the step before the failed one
-
-	// Release all simulation locks and cleanup tracking after compensation
-	sm.cleanupSimulationLocks(saga)
-	sm.releaseAllLocksForSaga(saga)
-
-	return nil
-}
-
-// triggerCompensation executes compensating actions for all completed steps in reverse order
-// This ensures eventual consistency: if any step fails, all previous steps are rolled back
-func (sm *SagaManager) triggerCompensation(saga *Saga, lastStepToCompensate int) {
-	saga.mu.Lock()
-	saga.Status = SagaStatusCompensating
-	saga.mu.Unlock()
-
-	log.Printf("Saga %s: Starting compensation from step %d", saga.SagaID, lastStepToCompensate)
-
-	// Compensate in reverse order (most recent first)
-	for i := lastStepToCompensate; i >= 0; i-- {
-		step := saga.Steps[i]
-
-		saga.mu.RLock()
-		status := step.Status
-		saga.mu.RUnlock()
-
-		// Only compensate steps that were completed
-		if status != StepStatusCompleted {
-			log.Printf("Saga %s: Skipping compensation for step %d (status: %s)", saga.SagaID, i, status)
-			continue
-		}
-
-		// Check if compensation command is defined
-		if step.CompensateCommand == "" {
-			log.Printf("Saga %s: Step %d has no compensation command, skipping", saga.SagaID, i)
-			continue
-		}
+	// Only the simulation the step was dispatched to may fail it
+	if step.TargetSimulation != simID {
+		saga.mu.Unlock()
+		sm.logSaga("warning", sagaID, simID, "Saga %s: Step %d failure from %s rejected (step targets %s)", sagaID, stepID, simID, step.TargetSimulation)
+		return fmt.Errorf("simulation %s is not the target of saga %s step %d", simID, sagaID, stepID)
+	}
 
-		// Get target simulation
-		targetSim, exists := sm.registry.Get(step.TargetSimulation)
-		if !exists {
-			log.Printf("Saga %s: Target simulation not found for compensation: %s", saga.SagaID, step.TargetSimulation)
-			continue
-		}
+	// A timeout that lost the race with a completion or failure report is a no-op
+	if reason != "" && step.Status != StepStatusInFlight {
+		saga.mu.Unlock()
+		return nil
+	}
 
-		// Create compensation command
-		stepIDPtr := &i
-		compensateMsg := models.Message{
-			Type:    "command",
-			Command: step.CompensateCommand,
-			Params:  step.CompensateParams,
-			SagaID:  saga.SagaID,
-			StepID:  stepIDPtr,
-		}
+	// The step was in flight when the Saga was cancelled; its outcome no longer matters
+	if step.Status == StepStatusCancelled {
+		saga.mu.Unlock()
+		log.Printf("Saga %s: Step %d was cancelled, ignoring failure from %s", sagaID, stepID, simID)
+		return nil
+	}
 
-		// Send compensation command
-		if err := targetSim.Connection.WriteJSON(compensateMsg); err != nil {
-			log.Printf("Saga %s: Failed to send compensation command for step %d: %v", saga.SagaID, i, err)
-			// Continue with other compensations even if one fails
-			continue
+	// Once the Saga is compensating or finished, a further failure changes nothing
+	if saga.Status != SagaStatusInProgress && saga.Status != SagaStatusPending {
+		status := saga.Status
+		saga.mu.Unlock()
+		log.Printf("Saga %s: Step %d failure from %s arrived while the Saga is %s, ignoring", sagaID, stepID, simID, status)
+		if sm.strict {
+			return fmt.Errorf("orphaned failure: saga %s is already %s", sagaID, status)
 		}
+		return nil
+	}
 
-		log.Printf("Saga %s: Compensation command sent for step %d to %s", saga.SagaID, i, step.TargetSimulation)
-
-		// Mark step as compensated (we don't wait for acknowledgment in MVP)
-		saga.mu.Lock()
-		step.Status = StepStatusFailed // Mark as failed since we're compensating
+	// In strict mode, only an in-flight step can fail
+	if sm.strict && step.Status != StepStatusInFlight {
 		saga.mu.Unlock()
+		log.Printf("Saga %s: Step %d is not in flight (status: %s), rejecting failure", sagaID, stepID, step.Status)
+		return fmt.Errorf("orphaned failure: saga %s step %d is not in flight (status: %s)", sagaID, stepID, step.Status)
 	}
 
-	saga.mu.Lock()
-	saga.Status = SagaStatusFailed
-	saga.mu.Unlock()
+	// Mark step as failed
+	step.Status = StepStatusFailed
+	step.stopTimer()
+	saga.failing = true
+	if reason != "" {
+		saga.addFailureReason("%s", reason)
+	} else {
+		saga.addFailureReason("step %d failed on %s", stepID, step.TargetSimulation)
+	}
 
-	log.Printf("Saga %s: Compensation completed", saga.SagaID)
-}
+	sm.logSaga("error", sagaID, simID, "Saga %s: Step %d failed, triggering compensation", sagaID, stepID)
 
-// releaseAllLocksForSaga releases all simulation locks held by a saga
-func (sm *SagaManager) releaseAllLocksForSaga(saga *Saga) {
-	// Use the stored list of locked simulations from the saga
-	sm.lockMu.Lock()
-	for _, simID := range saga.lockedSims {
-		if lock, exists := sm.simulationLocks[simID]; exists {
-			lock.Unlock()
-			log.Printf("Released lock for simulation %s (saga %s)", simID, saga.SagaID)
-		}
-	}
-	sm.lockMu.Unlock()
+	// Trigger compensation (rollback all completed steps in reverse order) once no other
+	// step of a parallel group is in flight; this releases the saga's lock. The locks
+	// are released and the summary logged once every compensation is resolved
+	sm.settleFailedStage(saga)
+
+	return nil
 }
 
 // GetSaga retrieves a Saga by ID (for debugging/monitoring)
@@ -566,3 +707,22 @@ func (sm *SagaManager) GetAllSagas() map[string]*Saga {
 	}
 	return result
 }
+
+// CountByStatus returns the number of Sagas in each status (for metrics)
+func (sm *SagaManager) CountByStatus() map[SagaStatus]int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	counts := make(map[SagaStatus]int)
+	for _, saga := range sm.sagas {
+		saga.mu.RLock()
+		counts[saga.Status]++
+		saga.mu.RUnlock()
+	}
+	return counts
+}
+
+// GetCommandWriteErrorCount returns the number of commands that failed to send (for metrics)
+func (sm *SagaManager) GetCommandWriteErrorCount() int64 {
+	return sm.commandWriteErrors.Load()
+}
@@ -0,0 +1,62 @@
+package saga
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+// A simulation replying with another Saga's ID and one of its own step IDs must not
+// complete or fail a step it wasn't sent
+func TestStepReportFromOtherSagaRejected(t *testing.T) {
+	sm, reg := newTestManager(t)
+	x := connectSim(t, reg, "x")
+	connectSim(t, reg, "y")
+	z := connectSim(t, reg, "z")
+	connectSim(t, reg, "w")
+
+	first, err := sm.CreateSaga(context.Background(), actions("x", "y"), models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	second, err := sm.CreateSaga(context.Background(), actions("z", "w"), models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	x.next(t)
+	z.next(t)
+
+	// z's step 0 belongs to the second Saga, but it reports it against the first
+	if err := sm.HandleStepCompletion(first.SagaID, 0, "z", nil); err == nil {
+		t.Fatal("completion from a simulation that isn't the step's target accepted")
+	}
+	if err := sm.HandleStepFailure(first.SagaID, 0, "z"); err == nil {
+		t.Fatal("failure from a simulation that isn't the step's target accepted")
+	}
+	if err := sm.HandleStepCompensated(first.SagaID, 0, "z"); err == nil {
+		t.Fatal("compensation report from a simulation that isn't the step's target accepted")
+	}
+	// A step ID the first Saga doesn't have
+	if err := sm.HandleStepCompletion(first.SagaID, 5, "z", nil); err == nil {
+		t.Fatal("completion of a step the saga doesn't have accepted")
+	}
+
+	if status := first.Steps[0].Status; status != StepStatusInFlight {
+		t.Fatalf("first saga's step 0 is %s after rejected reports, want InFlight", status)
+	}
+	if status := first.GetStatus(); status != SagaStatusInProgress {
+		t.Fatalf("first saga is %s after rejected reports, want InProgress", status)
+	}
+
+	// Each Saga's real target can still complete its step
+	if err := sm.HandleStepCompletion(first.SagaID, 0, "x", nil); err != nil {
+		t.Fatalf("completion from the target: %v", err)
+	}
+	if err := sm.HandleStepCompletion(second.SagaID, 0, "z", nil); err != nil {
+		t.Fatalf("completion from the target: %v", err)
+	}
+	if first.Steps[0].Status != StepStatusCompleted || second.Steps[0].Status != StepStatusCompleted {
+		t.Fatal("step not completed by its target")
+	}
+}
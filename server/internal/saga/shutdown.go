@@ -0,0 +1,72 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+/*
+Shutdown
+
+On shutdown the server first stops the SagaManager from starting new Sagas, then gives
+the Sagas already running a grace period to reach a terminal state. Step reports keep
+flowing during the grace period, so a Saga whose simulations answer in time finishes
+normally (including its compensation). Sagas still running when the grace period ends
+are left as they are; with a Saga store they are restored on the next start.
+*/
+
+// ErrShuttingDown is returned when a Saga is requested after StopAccepting
+var ErrShuttingDown = errors.New("server is shutting down, not starting new sagas")
+
+// inFlightPollInterval is how often WaitForInFlight checks for running Sagas
+const inFlightPollInterval = 50 * time.Millisecond
+
+// StopAccepting makes every later CreateSaga and ReplaySaga fail with ErrShuttingDown
+// Sagas already running are not affected.
+func (sm *SagaManager) StopAccepting() {
+	sm.stopped.Store(true)
+
+	// Sagas waiting for a slot under the concurrency limit give up now
+	sm.slots.mu.Lock()
+	sm.wakeSlotWaiters()
+	sm.slots.mu.Unlock()
+}
+
+// InFlight returns the IDs of the Sagas that have not reached a terminal state, sorted
+func (sm *SagaManager) InFlight() []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ids := make([]string, 0)
+	for id, saga := range sm.sagas {
+		saga.mu.RLock()
+		terminal := saga.Status.IsTerminal()
+		saga.mu.RUnlock()
+		if !terminal {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// WaitForInFlight waits until no Saga is running, or until ctx is done
+// Returns the IDs of the Sagas still running (empty if all finished).
+func (sm *SagaManager) WaitForInFlight(ctx context.Context) []string {
+	ticker := time.NewTicker(inFlightPollInterval)
+	defer ticker.Stop()
+
+	for {
+		remaining := sm.InFlight()
+		if len(remaining) == 0 {
+			return remaining
+		}
+		select {
+		case <-ctx.Done():
+			return remaining
+		case <-ticker.C:
+		}
+	}
+}
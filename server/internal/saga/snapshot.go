@@ -0,0 +1,72 @@
+package saga
+
+import "time"
+
+// SagaSnapshot is a point-in-time copy of a Saga's state, safe to read without locks
+type SagaSnapshot struct {
+	SagaID         string
+	Tenant         string
+	Status         SagaStatus
+	CurrentStep    int
+	CreatedAt      time.Time
+	ReplayOf       string
+	Timeout        time.Duration
+	FailureReasons []string
+	Steps          []StepSnapshot
+}
+
+// StepSnapshot is a point-in-time copy of a Saga step's state
+type StepSnapshot struct {
+	StepID              int
+	TargetSimulation    string
+	Command             string
+	Status              StepStatus
+	CreatedAt           time.Time
+	CompletedAt         *time.Time
+	Breakpoint          bool
+	CompensateOnPartial bool
+	Timeout             time.Duration
+	EffectiveTimeout    time.Duration
+	ParallelGroup       int
+	ResultDiscarded     bool
+}
+
+// Snapshot returns a copy of the Saga's current state
+// The Saga's lock is held while copying, so the snapshot is consistent even while
+// steps are being dispatched, completed or compensated.
+func (saga *Saga) Snapshot() SagaSnapshot {
+	saga.mu.RLock()
+	defer saga.mu.RUnlock()
+
+	snapshot := SagaSnapshot{
+		SagaID:         saga.SagaID,
+		Tenant:         saga.Tenant,
+		Status:         saga.Status,
+		CurrentStep:    saga.CurrentStep,
+		CreatedAt:      saga.CreatedAt,
+		ReplayOf:       saga.ReplayOf,
+		Timeout:        saga.Timeout,
+		FailureReasons: append([]string(nil), saga.FailureReasons...),
+		Steps:          make([]StepSnapshot, len(saga.Steps)),
+	}
+	for i, step := range saga.Steps {
+		snapshot.Steps[i] = StepSnapshot{
+			StepID:              step.StepID,
+			TargetSimulation:    step.TargetSimulation,
+			Command:             step.Command,
+			Status:              step.Status,
+			CreatedAt:           step.CreatedAt,
+			Breakpoint:          step.Breakpoint,
+			CompensateOnPartial: step.CompensateOnPartial,
+			Timeout:             step.Timeout,
+			EffectiveTimeout:    step.EffectiveTimeout,
+			ParallelGroup:       step.ParallelGroup,
+			ResultDiscarded:     step.ResultDiscarded,
+		}
+		if step.CompletedAt != nil {
+			completedAt := *step.CompletedAt
+			snapshot.Steps[i].CompletedAt = &completedAt
+		}
+	}
+	return snapshot
+}
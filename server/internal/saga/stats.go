@@ -0,0 +1,116 @@
+package saga
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Saga Statistics
+
+The SagaManager keeps running totals of Sagas created, completed, failed and cancelled,
+and a histogram of step latency: the time from dispatching a step's command to
+receiving its step.completed report. They only grow; the metrics collector reads them
+at scrape time.
+
+A Saga counts as failed when it finishes Failed or CompensationFailed (including a
+cancelled Saga whose compensation failed). Steps of Sagas restored from the Saga store
+at startup have no dispatch time and aren't observed.
+*/
+
+// StepLatencyBuckets are the upper bounds, in seconds, of the step latency histogram
+var StepLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// SagaTotals holds the number of Sagas created and finished since startup
+type SagaTotals struct {
+	Created   int64
+	Completed int64
+	Failed    int64 // Finished Failed or CompensationFailed
+	Cancelled int64 // Cancelled by an operator, with every compensation confirmed
+}
+
+// LatencyHistogram is a snapshot of the step latency histogram
+type LatencyHistogram struct {
+	Count   uint64
+	Sum     float64            // Seconds
+	Buckets map[float64]uint64 // Upper bound -> cumulative count, for each of StepLatencyBuckets
+}
+
+// sagaStats holds the SagaManager's running totals (see GetSagaTotals and GetStepLatency)
+type sagaStats struct {
+	mu        sync.Mutex
+	totals    SagaTotals
+	latencies []uint64 // Non-cumulative count per bucket; the last entry is +Inf
+	count     uint64
+	sum       float64
+}
+
+// GetSagaTotals returns the number of Sagas created, completed, failed and cancelled since startup
+func (sm *SagaManager) GetSagaTotals() SagaTotals {
+	sm.stats.mu.Lock()
+	defer sm.stats.mu.Unlock()
+	return sm.stats.totals
+}
+
+// GetStepLatency returns a snapshot of the step latency histogram
+func (sm *SagaManager) GetStepLatency() LatencyHistogram {
+	sm.stats.mu.Lock()
+	defer sm.stats.mu.Unlock()
+
+	histogram := LatencyHistogram{
+		Count:   sm.stats.count,
+		Sum:     sm.stats.sum,
+		Buckets: make(map[float64]uint64, len(StepLatencyBuckets)),
+	}
+	var cumulative uint64
+	for i, bound := range StepLatencyBuckets {
+		if i < len(sm.stats.latencies) {
+			cumulative += sm.stats.latencies[i]
+		}
+		histogram.Buckets[bound] = cumulative
+	}
+	return histogram
+}
+
+// countCreated records a new Saga
+func (sm *SagaManager) countCreated() {
+	sm.stats.mu.Lock()
+	sm.stats.totals.Created++
+	sm.stats.mu.Unlock()
+}
+
+// countFinished records a Saga reaching a terminal status
+func (sm *SagaManager) countFinished(status SagaStatus) {
+	sm.stats.mu.Lock()
+	defer sm.stats.mu.Unlock()
+	switch status {
+	case SagaStatusCompleted:
+		sm.stats.totals.Completed++
+	case SagaStatusCancelled:
+		sm.stats.totals.Cancelled++
+	default:
+		sm.stats.totals.Failed++
+	}
+}
+
+// observeStepLatency records the time a step took from dispatch to completion
+func (sm *SagaManager) observeStepLatency(latency time.Duration) {
+	seconds := latency.Seconds()
+
+	sm.stats.mu.Lock()
+	defer sm.stats.mu.Unlock()
+
+	if sm.stats.latencies == nil {
+		sm.stats.latencies = make([]uint64, len(StepLatencyBuckets)+1)
+	}
+	bucket := len(StepLatencyBuckets)
+	for i, bound := range StepLatencyBuckets {
+		if seconds <= bound {
+			bucket = i
+			break
+		}
+	}
+	sm.stats.latencies[bucket]++
+	sm.stats.count++
+	sm.stats.sum += seconds
+}
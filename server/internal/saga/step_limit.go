@@ -0,0 +1,79 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+)
+
+/*
+Saga Size Guards
+
+A scenario mistake (a rule with hundreds of actions, a group expanding to every
+simulation, or an event matching many rules) could create a Saga that locks most of the
+connected simulations at once and holds them until it finishes. The fan-out warnings
+(see scenario/fanout.go) only log such events; these guards refuse the Saga.
+
+- Step limit: a Saga with more than the maximum number of steps is not created. There
+  is no limit by default, so existing scenarios are unaffected until one is set.
+- Repeated targets: unless allowed, a Saga with more than one step for the same
+  simulation is not created. Several steps for one simulation are safe (its lock is
+  taken once for the whole Saga), so they are allowed by default; disallowing them
+  suits deployments where every simulation should receive one command per Saga.
+
+Both checks run before the Saga takes a concurrency slot or any lock, for new Sagas and
+replays alike. A refused Saga is logged as an error, naming the limit it broke.
+*/
+
+// DefaultMaxSagaSteps is the most steps a Saga may have unless configured otherwise
+// (0 = no limit)
+const DefaultMaxSagaSteps = 0
+
+// ErrTooManySteps is returned when a Saga would have more steps than allowed
+var ErrTooManySteps = errors.New("saga exceeds the maximum step count")
+
+// ErrDuplicateTarget is returned when a Saga would send more than one step to the same
+// simulation and repeated targets are not allowed
+var ErrDuplicateTarget = errors.New("saga targets the same simulation more than once")
+
+// SetStepLimits sets the most steps a Saga may have (0 = no limit) and whether several
+// of its steps may target the same simulation
+// May be called at any time; it applies to Sagas created afterwards.
+func (sm *SagaManager) SetStepLimits(maxSteps int, allowDuplicateTargets bool) {
+	sm.maxSagaSteps.Store(int64(max(maxSteps, 0)))
+	sm.allowDuplicateTargets.Store(allowDuplicateTargets)
+}
+
+// checkStepLimits refuses actions that would make a Saga larger than the step limits allow
+// actions' SendTo are registry keys.
+func (sm *SagaManager) checkStepLimits(actions []models.Action) error {
+	if maxSteps := int(sm.maxSagaSteps.Load()); maxSteps > 0 && len(actions) > maxSteps {
+		sm.logSaga("error", "", "", "Refusing to create Saga with %d steps: the limit is %d (check the scenario for runaway actions or rule fan-out)", len(actions), maxSteps)
+		return fmt.Errorf("%w: %d steps, limit is %d", ErrTooManySteps, len(actions), maxSteps)
+	}
+
+	if sm.allowDuplicateTargets.Load() {
+		return nil
+	}
+	steps := make(map[string][]string, len(actions))
+	var repeated []string
+	for i, action := range actions {
+		if len(steps[action.SendTo]) == 1 {
+			repeated = append(repeated, action.SendTo)
+		}
+		steps[action.SendTo] = append(steps[action.SendTo], fmt.Sprint(i))
+	}
+	if len(repeated) == 0 {
+		return nil
+	}
+	details := make([]string, len(repeated))
+	for i, key := range repeated {
+		_, simID := registry.SplitKey(key)
+		details[i] = fmt.Sprintf("%s (steps %s)", simID, strings.Join(steps[key], ", "))
+	}
+	sm.logSaga("error", "", "", "Refusing to create Saga: simulations targeted by several steps: %s", strings.Join(details, "; "))
+	return fmt.Errorf("%w: %s", ErrDuplicateTarget, strings.Join(details, "; "))
+}
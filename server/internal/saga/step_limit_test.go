@@ -0,0 +1,101 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+func TestStepLimitOffByDefault(t *testing.T) {
+	sm, reg := newTestManager(t)
+	connectSim(t, reg, "x")
+
+	targets := make([]string, 250)
+	for i := range targets {
+		targets[i] = "x"
+	}
+	if _, err := sm.CreateSaga(context.Background(), actions(targets...), models.Event{}); err != nil {
+		t.Fatalf("CreateSaga with %d steps and no limit: %v", len(targets), err)
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	sm, reg := newTestManager(t)
+	connectSim(t, reg, "x")
+	connectSim(t, reg, "y")
+	connectSim(t, reg, "z")
+	sm.SetStepLimits(2, true)
+
+	_, err := sm.CreateSaga(context.Background(), actions("x", "y", "z"), models.Event{})
+	if !errors.Is(err, ErrTooManySteps) {
+		t.Fatalf("CreateSaga with 3 steps, limit 2: err = %v, want ErrTooManySteps", err)
+	}
+	// Refused before taking any lock or slot
+	for _, sim := range []string{"x", "y", "z"} {
+		if holder := lockHolder(sm, sim); holder != "" {
+			t.Fatalf("%s locked by %s after a refused saga", sim, holder)
+		}
+	}
+	if _, active := sm.ConcurrencyLimit(); active != 0 {
+		t.Fatalf("%d slots held after a refused saga, want 0", active)
+	}
+
+	if _, err := sm.CreateSaga(context.Background(), actions("x", "y"), models.Event{}); err != nil {
+		t.Fatalf("CreateSaga at the limit: %v", err)
+	}
+}
+
+func TestDuplicateTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   bool
+		targets []string
+		wantErr string // "" = created
+	}{
+		{name: "allowed", allow: true, targets: []string{"x", "y", "x"}},
+		{name: "distinct targets", allow: false, targets: []string{"x", "y"}},
+		{name: "repeated target", allow: false, targets: []string{"x", "y", "x"}, wantErr: "x (steps 0, 2)"},
+		{name: "several repeated targets", allow: false, targets: []string{"y", "x", "y", "x", "y"}, wantErr: "y (steps 0, 2, 4); x (steps 1, 3)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, reg := newTestManager(t)
+			connectSim(t, reg, "x")
+			connectSim(t, reg, "y")
+			sm.SetStepLimits(0, tt.allow)
+
+			_, err := sm.CreateSaga(context.Background(), actions(tt.targets...), models.Event{})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CreateSaga: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrDuplicateTarget) {
+				t.Fatalf("err = %v, want ErrDuplicateTarget", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %q, want it to name %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDuplicateTargetsAreScopedToTenant(t *testing.T) {
+	sm, reg := newTestManager(t)
+	connectSim(t, reg, "a/x")
+	sm.SetStepLimits(0, false)
+
+	_, err := sm.CreateSaga(context.Background(), actions("x", "x"), models.Event{Tenant: "a"})
+	if !errors.Is(err, ErrDuplicateTarget) {
+		t.Fatalf("err = %v, want ErrDuplicateTarget", err)
+	}
+	// The error names the simulation, not its registry key
+	if strings.Contains(err.Error(), "a/x") {
+		t.Fatalf("err = %q names the registry key", err)
+	}
+}
@@ -0,0 +1,78 @@
+package saga
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/events"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+)
+
+// SetLogStore sets the log store that receives the Saga lifecycle entries (creation,
+// dispatch, completion, failure, compensation) and a summary entry for each finished
+// Saga, each correlated with its Saga ID. Without one, they are only written to the
+// standard log.
+func (sm *SagaManager) SetLogStore(logStore *logging.LogStore) {
+	sm.logStore = logStore
+}
+
+// logSummary emits a single one-line postmortem for a Saga that reached a terminal state,
+// counts it in the Saga totals, stops its Saga timeout, releases its concurrency slot
+// and publishes it to the event hub; every terminal transition ends here.
+// Counts: succeeded = steps that completed their forward action, failed = steps that
+// failed without completing, compensated = compensations acknowledged by the simulation.
+func (sm *SagaManager) logSummary(saga *Saga) {
+	saga.mu.Lock()
+	saga.stopDeadlineTimer()
+	succeeded, failed := 0, 0
+	for _, step := range saga.Steps {
+		if step.CompletedAt != nil {
+			succeeded++
+		} else if step.Status == StepStatusFailed || step.forwardStatus == StepStatusFailed {
+			failed++
+		}
+	}
+	status := saga.Status
+	steps := len(saga.Steps)
+	compensated := saga.compensationsRun
+	duration := time.Since(saga.CreatedAt)
+	reasons := strings.Join(saga.FailureReasons, "; ")
+	finished := sagaEvent(saga)
+	finished.FailureReasons = append([]string(nil), saga.FailureReasons...)
+	saga.mu.Unlock()
+
+	sm.countFinished(status)
+	sm.releaseSlot(saga)
+	if status == SagaStatusCompleted {
+		sm.hub.Publish(events.SagaCompleted, finished)
+	} else {
+		sm.hub.Publish(events.SagaFailed, finished)
+	}
+
+	level := "error"
+	switch status {
+	case SagaStatusCompleted:
+		level = "info"
+	case SagaStatusCancelled:
+		level = "warning"
+	}
+
+	format := "Saga summary: saga_id=%s status=%s steps=%d succeeded=%d failed=%d compensated=%d duration=%s"
+	args := []interface{}{saga.SagaID, status, steps, succeeded, failed, compensated, duration.Round(time.Millisecond)}
+	if reasons != "" {
+		format += " reasons=%q"
+		args = append(args, reasons)
+	}
+	sm.logSaga(level, saga.SagaID, "", format, args...)
+}
+
+// logSaga logs a Saga lifecycle event, stored with the Saga ID and the simulation
+// involved ("" = none) when a log store is set
+func (sm *SagaManager) logSaga(level, sagaID, source, format string, args ...interface{}) {
+	if sm.logStore != nil {
+		sm.logStore.LogAndStoreCtx(level, sagaID, source, format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,124 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Param Templates
+
+A string value in an action's `params` may reference the triggering event's payload
+with "{{ payload.<path> }}" (dotted path, e.g. "{{ payload.order.id }}"). Templates are
+resolved once, when the Saga is created:
+- A value that is exactly one template is replaced with the referenced value, keeping
+  its type (a number stays a number, an object stays an object).
+- Templates embedded in a longer string are replaced with the value's text.
+
+A reference to a field the payload doesn't have is replaced with "" by default. With
+strict templates enabled, it fails the Saga's creation instead.
+
+Only the scenario's own params are rendered. Values copied from the event by
+`event_params` are merged afterwards and never treated as templates, so event data
+can't inject template references. A replayed Saga reuses the rendered params.
+
+Compensation params may likewise reference the forward step's result, the payload of
+its step.completed report, with "{{ result.<path> }}" (see resolveCompensateParams).
+These are resolved when the compensation command is sent, with the same rules, except
+that a missing field is always rendered as "" and logged, since the step may have
+completed without a result. If the step's result was too large to keep, the
+compensation is not sent and fails instead (see compensateNext).
+*/
+
+// ErrMissingTemplateValue is returned when strict templates are enabled and a param
+// template references a payload field the event doesn't have
+var ErrMissingTemplateValue = errors.New("param template references missing payload field")
+
+// templatePattern matches one "{{ payload.<path> }}" reference
+var templatePattern = regexp.MustCompile(`\{\{\s*payload\.([^\s{}]+)\s*\}\}`)
+
+// resultTemplatePattern matches one "{{ result.<path> }}" reference
+var resultTemplatePattern = regexp.MustCompile(`\{\{\s*result\.([^\s{}]+)\s*\}\}`)
+
+// SetStrictTemplates sets whether a param template referencing a missing payload field
+// fails Saga creation (true) or renders as "" (false)
+// May be called at any time; it applies to Sagas created afterwards.
+func (sm *SagaManager) SetStrictTemplates(strict bool) {
+	sm.strictTemplates.Store(strict)
+}
+
+// renderActionTemplates returns a copy of actions with the param templates resolved
+// against the event payload; the scenario's actions are never modified
+func (sm *SagaManager) renderActionTemplates(actions []models.Action, payload map[string]interface{}) ([]models.Action, error) {
+	strict := sm.strictTemplates.Load()
+
+	rendered := make([]models.Action, len(actions))
+	for i, action := range actions {
+		rendered[i] = action
+
+		params, missing := renderTemplates(action.Params, templatePattern, payload)
+		if len(missing) > 0 {
+			if strict {
+				return nil, fmt.Errorf("%w: step %d (%s): %s", ErrMissingTemplateValue, i, action.Command, strings.Join(missing, ", "))
+			}
+			log.Printf("Warning: Step %d (%s) param templates reference missing payload fields, using \"\": %s", i, action.Command, strings.Join(missing, ", "))
+		}
+		rendered[i].Params = params.(map[string]interface{})
+	}
+	return rendered, nil
+}
+
+// renderTemplates resolves the templates matching pattern in value (recursively through
+// maps and lists) against payload and returns the result with the paths of any missing
+// fields
+// The input is never modified.
+func renderTemplates(value interface{}, pattern *regexp.Regexp, payload map[string]interface{}) (rendered interface{}, missing []string) {
+	var render func(value interface{}) interface{}
+	render = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			// A value that is exactly one template keeps the referenced value's type
+			if match := pattern.FindStringSubmatchIndex(v); match != nil && match[0] == 0 && match[1] == len(v) {
+				path := v[match[2]:match[3]]
+				if found, ok := lookupPath(payload, path); ok {
+					return found
+				}
+				missing = append(missing, path)
+				return ""
+			}
+			return pattern.ReplaceAllStringFunc(v, func(reference string) string {
+				path := pattern.FindStringSubmatch(reference)[1]
+				found, ok := lookupPath(payload, path)
+				if !ok {
+					missing = append(missing, path)
+					return ""
+				}
+				return fmt.Sprint(found)
+			})
+		case map[string]interface{}:
+			if v == nil {
+				return v
+			}
+			out := make(map[string]interface{}, len(v))
+			for k, inner := range v {
+				out[k] = render(inner)
+			}
+			return out
+		case []interface{}:
+			out := make([]interface{}, len(v))
+			for i, inner := range v {
+				out[i] = render(inner)
+			}
+			return out
+		default:
+			return v
+		}
+	}
+
+	return render(value), missing
+}
@@ -0,0 +1,109 @@
+package saga
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+/*
+Step Timeouts
+
+A step that is dispatched but never acknowledged would otherwise hold its Saga (and the
+simulation locks) forever. When a step's timeout expires while it is still in flight,
+it is treated exactly like a step.failed event and compensation runs.
+
+The timeout for a step is chosen as follows:
+1. If the scenario action sets `timeout`, that value is used as-is.
+2. If the target simulation declared an expected command latency at registration, the
+   timeout is latency * LatencyMultiplier, clamped to [Min, Max].
+3. Otherwise the global Default is used (0 = no timeout).
+
+The chosen value is recorded on the step as EffectiveTimeout. The timer is stopped as
+soon as the step completes or fails, and a timer that fires anyway (racing a report)
+does nothing unless the step is still in flight.
+*/
+
+// DefaultStepTimeout is the Default step timeout when none is configured
+const DefaultStepTimeout = 30 * time.Second
+
+// StepTimeoutConfig configures how long a dispatched step may stay in flight
+type StepTimeoutConfig struct {
+	Default           time.Duration // Timeout for simulations without a declared latency (0 = none)
+	Min               time.Duration // Lower bound for latency-derived timeouts
+	Max               time.Duration // Upper bound for latency-derived timeouts (0 = unbounded)
+	LatencyMultiplier float64       // Declared latency is multiplied by this to get the timeout
+}
+
+// SetStepTimeouts configures step timeouts
+// May be called at any time; it applies to steps dispatched afterwards.
+func (sm *SagaManager) SetStepTimeouts(config StepTimeoutConfig) {
+	sm.stepTimeouts.Store(&config)
+}
+
+// stepTimeout returns the timeout to use for a step (0 = no timeout)
+func (sm *SagaManager) stepTimeout(step *SagaStep) time.Duration {
+	if step.Timeout > 0 {
+		return step.Timeout
+	}
+
+	config := sm.stepTimeouts.Load()
+	if config == nil {
+		return 0
+	}
+
+	targetSim, exists := sm.registry.Get(step.TargetSimulation)
+	if !exists || targetSim.ExpectedLatency <= 0 {
+		return config.Default
+	}
+
+	multiplier := config.LatencyMultiplier
+	if multiplier <= 0 {
+		multiplier = 1
+	}
+	timeout := time.Duration(float64(targetSim.ExpectedLatency) * multiplier)
+
+	if timeout < config.Min {
+		timeout = config.Min
+	}
+	if config.Max > 0 && timeout > config.Max {
+		timeout = config.Max
+	}
+	return timeout
+}
+
+// startStepTimer fails the step if it is still in flight when its timeout expires
+func (sm *SagaManager) startStepTimer(saga *Saga, stepIndex int) {
+	step := saga.Steps[stepIndex]
+	timeout := sm.stepTimeout(step)
+
+	saga.mu.Lock()
+	defer saga.mu.Unlock()
+
+	step.stopTimer()
+	step.EffectiveTimeout = timeout
+	if timeout <= 0 || step.Status != StepStatusInFlight {
+		return
+	}
+
+	step.timer = time.AfterFunc(timeout, func() {
+		sm.logSaga("error", saga.SagaID, step.TargetSimulation, "Saga %s: Step %d timed out after %s waiting for %s", saga.SagaID, stepIndex, timeout, step.TargetSimulation)
+		reason := fmt.Sprintf("step %d timed out after %s on %s", stepIndex, timeout, step.TargetSimulation)
+		if err := sm.failStep(saga.SagaID, stepIndex, step.TargetSimulation, reason); err != nil {
+			log.Printf("Saga %s: Failed to handle step %d timeout: %v", saga.SagaID, stepIndex, err)
+		}
+	})
+}
+
+// stopTimer cancels the step's pending timeout and acknowledgment timeout, if any
+// Must be called with the saga's lock held
+func (step *SagaStep) stopTimer() {
+	if step.timer != nil {
+		step.timer.Stop()
+		step.timer = nil
+	}
+	if step.ackTimer != nil {
+		step.ackTimer.Stop()
+		step.ackTimer = nil
+	}
+}
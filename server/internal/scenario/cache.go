@@ -0,0 +1,131 @@
+package scenario
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Parsed Scenario Cache
+
+Activating a stored scenario parses its YAML again each time: unmarshalling, validating
+joins, conditions, cooldowns and schemas, and compiling event_type patterns. With several
+scenarios being activated and swapped repeatedly, that is mostly the same work over and
+over. The manager keeps the most recently parsed stored scenarios, keyed by stored ID,
+so activating one again skips both the database read and the parse.
+
+An entry is dropped whenever its stored scenario changes: on update, on delete, and when
+an upload with ?replace=true overwrites it. All of these run under RunExclusive, as does
+activation, so an activation never sees a stale entry.
+
+The cache is bounded; once full, the least recently used entry is evicted. A size of 0
+disables it. Callers get their own shallow copy of the cached scenario, so each
+activation is a distinct *models.Scenario, as if it had just been parsed (join and
+cooldown state is keyed by it); the rules themselves are shared, as they are never
+modified after parsing.
+*/
+
+// DefaultScenarioCacheSize is how many parsed stored scenarios are cached unless
+// configured otherwise
+const DefaultScenarioCacheSize = 100
+
+// scenarioCache is a bounded LRU cache of parsed stored scenarios
+type scenarioCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[int]*list.Element // Stored ID -> element holding a *cachedScenario
+	order   *list.List            // Most recently used first
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// cachedScenario is a cache entry
+type cachedScenario struct {
+	id       int
+	scenario *models.Scenario
+}
+
+// SetScenarioCacheSize sets how many parsed stored scenarios are cached (0 = no cache)
+// May be called at any time; shrinking the cache evicts the least recently used entries at once.
+func (sm *ScenarioManager) SetScenarioCacheSize(size int) {
+	c := &sm.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[int]*list.Element)
+		c.order = list.New()
+	}
+	c.size = max(size, 0)
+	c.trimLocked()
+}
+
+// CachedScenario returns a copy of the parsed stored scenario with the given ID, if it is cached
+// Every lookup counts as a hit or a miss (see GetScenarioCacheStats).
+func (sm *ScenarioManager) CachedScenario(id int) (*models.Scenario, bool) {
+	c := &sm.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	c.order.MoveToFront(elem)
+	copied := *elem.Value.(*cachedScenario).scenario
+	return &copied, true
+}
+
+// CacheScenario caches a copy of a scenario parsed from the stored scenario with the given ID
+func (sm *ScenarioManager) CacheScenario(id int, scenario *models.Scenario) {
+	c := &sm.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size == 0 {
+		return
+	}
+	copied := *scenario
+	if elem, ok := c.entries[id]; ok {
+		elem.Value.(*cachedScenario).scenario = &copied
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[id] = c.order.PushFront(&cachedScenario{id: id, scenario: &copied})
+	c.trimLocked()
+}
+
+// InvalidateCachedScenario drops the stored scenario with the given ID from the cache
+// Must be called whenever the stored scenario is changed or deleted.
+func (sm *ScenarioManager) InvalidateCachedScenario(id int) {
+	c := &sm.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[id]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, id)
+	}
+}
+
+// GetScenarioCacheStats returns the number of cache lookups that found the scenario and
+// the number that didn't
+func (sm *ScenarioManager) GetScenarioCacheStats() (hits, misses int64) {
+	return sm.cache.hits.Load(), sm.cache.misses.Load()
+}
+
+// trimLocked evicts the least recently used entries beyond the cache size
+// Caller must hold mu
+func (c *scenarioCache) trimLocked() {
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedScenario).id)
+	}
+}
@@ -0,0 +1,155 @@
+package scenario
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+// Payload condition operators (see models.PayloadCondition)
+const (
+	ConditionEq       = "eq"
+	ConditionGt       = "gt"
+	ConditionLt       = "lt"
+	ConditionContains = "contains"
+)
+
+// validateConditions checks the payload conditions of a scenario's rules, including
+// those on the events of a join
+func validateConditions(scenario *models.Scenario) error {
+	for i, rule := range scenario.Rules {
+		if err := ValidateConditions(rule.When.Conditions); err != nil {
+			return fmt.Errorf("rule %d: when.conditions%w", i, err)
+		}
+		if rule.When.Join == nil {
+			continue
+		}
+		for j, part := range rule.When.Join.Events {
+			if err := ValidateConditions(part.Conditions); err != nil {
+				return fmt.Errorf("rule %d: when.join.events[%d].conditions%w", i, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateConditions checks a list of payload conditions
+// Errors start with the index of the offending condition (e.g. "[0].key is required"),
+// to follow the field path.
+func ValidateConditions(conditions []models.PayloadCondition) error {
+	for k, condition := range conditions {
+		if condition.Key == "" {
+			return fmt.Errorf("[%d].key is required", k)
+		}
+		switch condition.Op {
+		case ConditionEq:
+		case ConditionGt, ConditionLt:
+			if _, ok := toNumber(condition.Value); !ok {
+				return fmt.Errorf("[%d]: %s needs a numeric value, got %v", k, condition.Op, condition.Value)
+			}
+		case ConditionContains:
+			if condition.Value == nil {
+				return fmt.Errorf("[%d]: contains needs a value", k)
+			}
+		default:
+			return fmt.Errorf("[%d]: unknown op %q (want eq, gt, lt or contains)", k, condition.Op)
+		}
+	}
+	return nil
+}
+
+// MatchConditions reports whether a payload satisfies every condition
+// Also used for step conditions, which match against the Saga's step results.
+func MatchConditions(conditions []models.PayloadCondition, payload map[string]interface{}) bool {
+	for _, condition := range conditions {
+		if !matchCondition(condition, payload) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchCondition reports whether a payload satisfies one condition
+func matchCondition(condition models.PayloadCondition, payload map[string]interface{}) bool {
+	actual, ok := lookupPayloadPath(payload, condition.Key)
+	if !ok {
+		return false
+	}
+
+	switch condition.Op {
+	case ConditionEq:
+		return valuesEqual(actual, condition.Value)
+	case ConditionGt, ConditionLt:
+		a, ok := toNumber(actual)
+		if !ok {
+			return false
+		}
+		b, _ := toNumber(condition.Value) // validated at load time
+		if condition.Op == ConditionGt {
+			return a > b
+		}
+		return a < b
+	case ConditionContains:
+		switch actual := actual.(type) {
+		case string:
+			expected, ok := condition.Value.(string)
+			return ok && strings.Contains(actual, expected)
+		case []interface{}:
+			for _, element := range actual {
+				if valuesEqual(element, condition.Value) {
+					return true
+				}
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// lookupPayloadPath returns the value at a dotted path in an event payload
+func lookupPayloadPath(payload map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = payload
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// valuesEqual compares a payload value with a scenario value
+// JSON payload numbers are float64 while YAML numbers may be ints, so numbers are
+// compared by value.
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// toNumber converts a numeric payload or scenario value to float64
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,134 @@
+package scenario
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Rule Cooldowns
+
+A rule may set a `cooldown` so that a simulation repeating the same event can't start
+a Saga storm:
+
+	rules:
+	  - when:
+	      event_type: "sensor.triggered"
+	    cooldown: 5s
+	    then: [...]
+
+Once the rule fires for an event from a simulation, further events from that same
+simulation (and tenant) that match the rule are suppressed until the cooldown has
+passed; the window starts when the rule fires and is not extended by suppressed
+events. Events from other simulations, and other rules, are not affected.
+
+Suppressed events are counted (see GetCooldownSuppressedCount). Only the first one
+of each window is logged, so a flooding simulation doesn't flood the log as well.
+Like join state, cooldown windows belong to the scenario they were started under and
+are dropped when that scenario is deactivated or replaced.
+*/
+
+// cooldownKey identifies the cooldown window of a rule for one source simulation
+type cooldownKey struct {
+	scenario *models.Scenario // Scenario the rule belongs to (stale entries never match)
+	rule     int              // Rule index within the scenario
+	tenant   string
+	source   string
+}
+
+// cooldownWindow is an open cooldown window
+type cooldownWindow struct {
+	until      time.Time
+	suppressed int // Events suppressed in this window
+}
+
+// validateCooldowns checks the cooldowns of a scenario's rules
+func validateCooldowns(scenario *models.Scenario) error {
+	for i, rule := range scenario.Rules {
+		if _, err := ruleCooldown(rule); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ruleCooldown returns the configured cooldown of a rule (0 = none)
+func ruleCooldown(rule models.Rule) (time.Duration, error) {
+	if rule.Cooldown == "" {
+		return 0, nil
+	}
+	cooldown, err := time.ParseDuration(rule.Cooldown)
+	if err != nil || cooldown <= 0 {
+		return 0, fmt.Errorf("invalid cooldown %q (want a positive duration such as 5s)", rule.Cooldown)
+	}
+	return cooldown, nil
+}
+
+// GetCooldownSuppressedCount returns the number of rule matches suppressed by a cooldown
+func (sm *ScenarioManager) GetCooldownSuppressedCount() int64 {
+	return sm.cooldownSuppressed.Load()
+}
+
+// inCooldown reports whether a matched rule is still cooling down for the event's
+// source, and otherwise starts a new cooldown window
+// Rules without a cooldown are never suppressed.
+func (sm *ScenarioManager) inCooldown(scenario *models.Scenario, ruleIndex int, event models.Event) bool {
+	// Validated at load time
+	cooldown, _ := ruleCooldown(scenario.Rules[ruleIndex])
+	if cooldown == 0 {
+		return false
+	}
+
+	key := cooldownKey{scenario: scenario, rule: ruleIndex, tenant: event.Tenant, source: event.Source}
+	now := time.Now()
+
+	sm.cooldownMu.Lock()
+	defer sm.cooldownMu.Unlock()
+
+	sm.pruneCooldowns(now)
+
+	window, exists := sm.cooldowns[key]
+	if !exists {
+		sm.cooldowns[key] = &cooldownWindow{until: now.Add(cooldown)}
+		return false
+	}
+
+	window.suppressed++
+	sm.cooldownSuppressed.Add(1)
+	if window.suppressed == 1 {
+		log.Printf("Debug: Rule %d of scenario %s is cooling down for %s; suppressing matching events until %s",
+			ruleIndex, scenario.Name, event.Source, window.until.Format("15:04:05.000"))
+	}
+	return true
+}
+
+// pruneCooldowns closes cooldown windows that have passed
+// Caller must hold cooldownMu
+func (sm *ScenarioManager) pruneCooldowns(now time.Time) {
+	for key, window := range sm.cooldowns {
+		if now.Before(window.until) {
+			continue
+		}
+		delete(sm.cooldowns, key)
+		if window.suppressed > 0 {
+			log.Printf("Debug: Cooldown of rule %d of scenario %s for %s ended, %d events suppressed",
+				key.rule, key.scenario.Name, key.source, window.suppressed)
+		}
+	}
+}
+
+// dropCooldowns drops the cooldown windows of a scenario (called when it is
+// deactivated or replaced)
+func (sm *ScenarioManager) dropCooldowns(scenario *models.Scenario) {
+	sm.cooldownMu.Lock()
+	defer sm.cooldownMu.Unlock()
+
+	for key := range sm.cooldowns {
+		if key.scenario == scenario {
+			delete(sm.cooldowns, key)
+		}
+	}
+}
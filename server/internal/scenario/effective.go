@@ -0,0 +1,34 @@
+package scenario
+
+import "github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+
+// EffectiveScenario returns an active scenario as it is applied to events
+// Every transformation the server makes before running a rule's actions is applied:
+// group targets are expanded into one action per member and compensate_after indices
+// are rewritten to match. Each rule's actions are what a Saga created by that rule
+// alone would run now; capability selectors are resolved against the simulations
+// currently connected in the scenario's tenant. An empty name selects the most recently activated scenario.
+// Returns nil if the scenario is not active.
+func (sm *ScenarioManager) EffectiveScenario(name string) *models.Scenario {
+	current := sm.GetCurrentScenario()
+	if name != "" {
+		current = sm.GetActiveScenario(name)
+	}
+	if current == nil {
+		return nil
+	}
+
+	effective := &models.Scenario{
+		Name:   current.Name,
+		Tenant: current.Tenant,
+		Groups: current.Groups,
+		Rules:  make([]models.Rule, len(current.Rules)),
+	}
+	for i, rule := range current.Rules {
+		effective.Rules[i] = models.Rule{
+			When: rule.When,
+			Then: appendRuleActions(nil, rule.Then, current.Groups, sm.registry, current.Tenant),
+		}
+	}
+	return effective
+}
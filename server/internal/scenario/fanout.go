@@ -0,0 +1,44 @@
+package scenario
+
+import (
+	"log"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+// Default fan-out warning thresholds (see SetFanOutWarningThresholds)
+const (
+	DefaultFanOutWarningRules   = 5
+	DefaultFanOutWarningActions = 20
+)
+
+// SetFanOutWarningThresholds sets when a single event's matches are reported as
+// unexpectedly large: more than maxRules matched rules or more than maxActions
+// aggregated actions (after group expansion). 0 disables a threshold.
+// May be called at any time; it applies to events processed afterwards.
+func (sm *ScenarioManager) SetFanOutWarningThresholds(maxRules, maxActions int) {
+	sm.fanOutWarnRules.Store(int64(maxRules))
+	sm.fanOutWarnActions.Store(int64(maxActions))
+}
+
+// GetFanOutWarningCount returns the number of events whose matches exceeded a fan-out threshold
+func (sm *ScenarioManager) GetFanOutWarningCount() int64 {
+	return sm.fanOutWarnings.Load()
+}
+
+// checkFanOut warns if an event matched more rules or produced more actions than expected
+// This runs before the Saga is created so accidental fan-out is visible during authoring.
+func (sm *ScenarioManager) checkFanOut(event models.Event, matchedRules, actions int) {
+	maxRules := sm.fanOutWarnRules.Load()
+	maxActions := sm.fanOutWarnActions.Load()
+
+	rulesExceeded := maxRules > 0 && int64(matchedRules) > maxRules
+	actionsExceeded := maxActions > 0 && int64(actions) > maxActions
+	if !rulesExceeded && !actionsExceeded {
+		return
+	}
+
+	sm.fanOutWarnings.Add(1)
+	log.Printf("Warning: Event %s from %s matched %d rules producing %d actions (warning thresholds: %d rules, %d actions); check the scenario for accidental fan-out",
+		event.EventType, event.Source, matchedRules, actions, maxRules, maxActions)
+}
@@ -0,0 +1,150 @@
+package scenario
+
+import (
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+)
+
+/*
+Simulation Groups
+
+A scenario may define named groups of simulations:
+
+	scenario:
+	  groups:
+	    responders: ["vr_sim", "emergency_sim", "facility_sim"]
+
+A member of the form `capability:<name>` is a selector: it stands for every connected
+simulation, in the event's tenant, that advertised that capability when it registered
+(simulations that declared no capabilities are not selected, as for bulk commands):
+
+	    responders: ["vr_sim", "capability:evacuate"]
+
+An action whose `send_to` names a group is expanded into one action per member, in
+member order, when the rule's actions are collected for a new Saga. Selectors are
+resolved against the registry at that point and expand to their matches sorted by ID;
+a simulation already listed earlier in the group is not added twice. Group names take
+precedence over simulation IDs, so a group should not share a name with a simulation.
+
+Because expansion (and combining several matching rules into one Saga) changes step
+positions, `compensate_after` references are rewritten here so they keep pointing at
+the steps the scenario author meant: a reference to a grouped action becomes a
+reference to every step it expanded into. Step condition references are rewritten
+too (they can't reference grouped actions; see step_conditions.go).
+
+Consecutive actions marked `parallel: true` (including every member of a parallel
+group action) are given a common ParallelGroup so the Saga dispatches them together.
+Group numbers are unique across the whole Saga, so parallel actions of two different
+rules never merge into one group.
+*/
+
+// capabilitySelectorPrefix marks a group member that selects simulations by capability
+const capabilitySelectorPrefix = "capability:"
+
+// capabilitySelector returns the capability a group member selects, if it is a selector
+func capabilitySelector(member string) (string, bool) {
+	return strings.CutPrefix(member, capabilitySelectorPrefix)
+}
+
+// groupMembers returns the simulation IDs a group expands into for an event in tenant
+// Capability selectors are resolved against reg; with no registry they select nothing.
+func groupMembers(members []string, reg *registry.Registry, tenant string) []string {
+	resolved := make([]string, 0, len(members))
+	for _, member := range members {
+		capability, isSelector := capabilitySelector(member)
+		if !isSelector {
+			if !slices.Contains(resolved, member) {
+				resolved = append(resolved, member)
+			}
+			continue
+		}
+		if reg == nil {
+			continue
+		}
+
+		var matches []string
+		for _, sim := range reg.GetAll() {
+			if sim.Tenant == tenant && slices.Contains(sim.Capabilities, capability) && !slices.Contains(resolved, sim.ID) {
+				matches = append(matches, sim.ID)
+			}
+		}
+		sort.Strings(matches)
+		resolved = append(resolved, matches...)
+	}
+	return resolved
+}
+
+// appendRuleActions appends a matched rule's actions to the Saga action list,
+// expanding group targets and rebasing compensate_after and step condition references
+// Capability selectors in groups are resolved against reg for simulations in tenant.
+func appendRuleActions(actions []models.Action, ruleActions []models.Action, groups map[string][]string, reg *registry.Registry, tenant string) []models.Action {
+	offset := len(actions)
+
+	// stepIndexes[i] = Saga step indices that rule action i expanded into
+	stepIndexes := make([][]int, len(ruleActions))
+	expanded := make([]models.Action, 0, len(ruleActions))
+	for i, action := range ruleActions {
+		members, isGroup := groups[action.SendTo]
+		if !isGroup {
+			stepIndexes[i] = []int{offset + len(expanded)}
+			expanded = append(expanded, action)
+			continue
+		}
+
+		members = groupMembers(members, reg, tenant)
+		if len(members) == 0 {
+			log.Printf("Warning: Group %s has no members (or no connected simulation matches its selectors), skipping action %s", action.SendTo, action.Command)
+			continue
+		}
+
+		for _, member := range members {
+			memberAction := action
+			memberAction.SendTo = member
+			stepIndexes[i] = append(stepIndexes[i], offset+len(expanded))
+			expanded = append(expanded, memberAction)
+		}
+	}
+
+	// Rewrite compensate_after from rule-relative positions to Saga step indices
+	for i := range expanded {
+		if len(expanded[i].CompensateAfter) == 0 {
+			continue
+		}
+		rebased := make([]int, 0, len(expanded[i].CompensateAfter))
+		for _, dep := range expanded[i].CompensateAfter {
+			if dep < 0 || dep >= len(stepIndexes) {
+				log.Printf("Warning: compensate_after references unknown step %d, ignoring", dep)
+				continue
+			}
+			rebased = append(rebased, stepIndexes[dep]...)
+		}
+		expanded[i].CompensateAfter = rebased
+	}
+
+	// Rewrite step condition references the same way
+	for i := range expanded {
+		if len(expanded[i].Condition) > 0 {
+			expanded[i].Condition = rebaseStepCondition(expanded[i].Condition, stepIndexes)
+		}
+	}
+
+	// Number each run of consecutive parallel actions after its first Saga step (+1,
+	// since 0 means sequential)
+	for i := range expanded {
+		if !expanded[i].Parallel {
+			continue
+		}
+		if i > 0 && expanded[i-1].Parallel {
+			expanded[i].ParallelGroup = expanded[i-1].ParallelGroup
+		} else {
+			expanded[i].ParallelGroup = offset + i + 1
+		}
+	}
+
+	return append(actions, expanded...)
+}
@@ -0,0 +1,145 @@
+package scenario
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+)
+
+// targets returns the send_to of actions in order
+func targets(actions []models.Action) []string {
+	result := []string{}
+	for _, action := range actions {
+		result = append(result, action.SendTo)
+	}
+	return result
+}
+
+// newTestRegistry registers simulations without connections, keyed "tenant/id" or "id",
+// with the given capabilities
+func newTestRegistry(sims map[string][]string) *registry.Registry {
+	reg := registry.NewRegistry()
+	for key, capabilities := range sims {
+		tenant, id := registry.SplitKey(key)
+		reg.Register(&models.Simulation{ID: id, Tenant: tenant, Capabilities: capabilities})
+	}
+	return reg
+}
+
+func TestGroupMembers(t *testing.T) {
+	reg := newTestRegistry(map[string][]string{
+		"fire_b":    {"evacuate", "extinguish"},
+		"fire_a":    {"evacuate"},
+		"police":    {"patrol"},
+		"any":       nil, // declared no capabilities: not selected
+		"t1/fire_t": {"evacuate"},
+	})
+
+	tests := []struct {
+		name    string
+		members []string
+		reg     *registry.Registry
+		tenant  string
+		want    []string
+	}{
+		{name: "static", members: []string{"x", "y"}, reg: reg, want: []string{"x", "y"}},
+		{name: "selector sorted by ID", members: []string{"capability:evacuate"}, reg: reg, want: []string{"fire_a", "fire_b"}},
+		{name: "static and selector in order", members: []string{"police", "capability:evacuate"}, reg: reg, want: []string{"police", "fire_a", "fire_b"}},
+		{name: "listed simulations are not repeated", members: []string{"fire_b", "capability:evacuate", "capability:extinguish", "fire_a"}, reg: reg, want: []string{"fire_b", "fire_a"}},
+		{name: "selector matching nothing", members: []string{"capability:fly"}, reg: reg, want: []string{}},
+		{name: "selector scoped to tenant", members: []string{"capability:evacuate"}, reg: reg, tenant: "t1", want: []string{"fire_t"}},
+		{name: "no registry", members: []string{"x", "capability:evacuate"}, want: []string{"x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupMembers(tt.members, tt.reg, tt.tenant); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("groupMembers(%q) = %q, want %q", tt.members, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendRuleActionsExpandsSelectors(t *testing.T) {
+	reg := newTestRegistry(map[string][]string{
+		"fire_a": {"evacuate"},
+		"fire_b": {"evacuate"},
+	})
+	groups := map[string][]string{"responders": {"police", "capability:evacuate"}}
+	rule := []models.Action{
+		{SendTo: "dispatch", Command: "alert"},
+		{SendTo: "responders", Command: "evacuate", CompensateAfter: []int{0}},
+		{SendTo: "dispatch", Command: "log", CompensateAfter: []int{1}},
+	}
+
+	got := appendRuleActions(nil, rule, groups, reg, "")
+	if want := []string{"dispatch", "police", "fire_a", "fire_b", "dispatch"}; !reflect.DeepEqual(targets(got), want) {
+		t.Fatalf("targets = %q, want %q", targets(got), want)
+	}
+	for i := 1; i <= 3; i++ {
+		if !reflect.DeepEqual(got[i].CompensateAfter, []int{0}) {
+			t.Fatalf("step %d compensate_after = %v, want [0]", i, got[i].CompensateAfter)
+		}
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(got[4].CompensateAfter, want) {
+		t.Fatalf("step 4 compensate_after = %v, want %v (every step of the group)", got[4].CompensateAfter, want)
+	}
+}
+
+func TestSelectorsResolvedWhenEventIsProcessed(t *testing.T) {
+	reg := registry.NewRegistry()
+	sm := NewScenarioManager()
+	sm.SetRegistry(reg)
+	activate(t, sm, `
+scenario:
+  name: "drill"
+  groups:
+    responders: ["capability:evacuate"]
+  rules:
+    - when: {event_type: "fire.alarm"}
+      then: [{send_to: "responders", command: "evacuate"}]
+`)
+	event := models.Event{EventType: "fire.alarm", Source: "sensor"}
+
+	// Nobody matches yet: the action is skipped
+	if actions, _ := sm.ProcessEvent(event); len(actions) != 0 {
+		t.Fatalf("actions = %q with no matching simulation, want none", targets(actions))
+	}
+
+	// Membership follows the simulations connected when the event arrives
+	reg.Register(&models.Simulation{ID: "fire_a", Capabilities: []string{"evacuate"}})
+	reg.Register(&models.Simulation{ID: "other_tenant", Tenant: "t1", Capabilities: []string{"evacuate"}})
+	actions, _ := sm.ProcessEvent(event)
+	if want := []string{"fire_a"}; !reflect.DeepEqual(targets(actions), want) {
+		t.Fatalf("targets = %q, want %q", targets(actions), want)
+	}
+
+	reg.Register(&models.Simulation{ID: "fire_b", Capabilities: []string{"evacuate"}})
+	reg.Unregister("fire_a")
+	actions, _ = sm.ProcessEvent(event)
+	if want := []string{"fire_b"}; !reflect.DeepEqual(targets(actions), want) {
+		t.Fatalf("targets = %q after membership changed, want %q", targets(actions), want)
+	}
+}
+
+func TestValidateCapabilitySelectors(t *testing.T) {
+	report := ValidateScenario(&models.Scenario{
+		Groups: map[string][]string{
+			"responders": {"police", "capability:evacuate"},
+			"broken":     {"capability:"},
+		},
+		Rules: []models.Rule{{
+			When: models.WhenCondition{EventType: "fire.alarm"},
+			Then: []models.Action{{SendTo: "responders", Command: "evacuate"}},
+		}},
+	})
+
+	if len(report.Errors) != 1 || report.Errors[0].Message != "group broken has a capability selector without a capability" {
+		t.Fatalf("errors = %+v, want the empty selector", report.Errors)
+	}
+	// Selectors can't be resolved statically, so only listed members are targets
+	if len(report.Targets) != 1 || report.Targets[0].ID != "police" {
+		t.Fatalf("targets = %+v, want only police", report.Targets)
+	}
+}
@@ -0,0 +1,236 @@
+package scenario
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Correlated (Join) Rules
+
+A rule with `when.join` fires only after one event of each listed kind has arrived
+with the same value in the payload field named by `key`:
+
+	when:
+	  join:
+	    key: order_id
+	    timeout: 2m
+	    events:
+	      - event_type: "payment.received"
+	        from: "payment_sim"
+	      - event_type: "shipment.created"
+
+Events that match a join part are buffered per (rule, tenant, correlation value) until
+every part is present, then the rule's actions are returned together with the event
+that completed the join. That event's payload is extended with the fields of the other
+buffered events, so `event_params` can select fields from any of them (on conflicting
+field names, the completing event wins, then later parts over earlier ones).
+
+A completed join is only consumed (its buffered events dropped) when the rule fires.
+If the rule is cooling down or skipped for an exclusive rule (see priority.go), the
+buffered events are kept, so a later matching event can still complete the join.
+
+A partial match that does not complete within the timeout is discarded. Expiry is
+checked whenever an event is processed, so an abandoned partial match holds memory
+only until the next event arrives. Buffered state belongs to the scenario it was
+collected under and is dropped when that scenario is deactivated or replaced.
+*/
+
+// DefaultJoinTimeout is how long a partial join is kept when the rule sets no timeout
+const DefaultJoinTimeout = time.Minute
+
+// joinKey identifies one partial match of a join rule
+type joinKey struct {
+	scenario *models.Scenario // Scenario the rule belongs to (stale entries never match)
+	rule     int              // Rule index within the scenario
+	tenant   string           // Events from different tenants never correlate
+	value    string           // Correlation value (payload[key], compared as text)
+}
+
+// pendingJoin holds the events received so far for one partial match
+type pendingJoin struct {
+	events   []*models.Event // Indexed by join part; nil = not yet received
+	received int
+	expires  time.Time
+}
+
+// completedJoin is a join an event completed, not yet consumed (see consumeJoin)
+type completedJoin struct {
+	key     joinKey
+	pending *pendingJoin
+	event   models.Event // The completing event with the correlated payloads merged in
+}
+
+// validateJoins checks the join conditions of a scenario's rules
+func validateJoins(scenario *models.Scenario) error {
+	for i, rule := range scenario.Rules {
+		join := rule.When.Join
+		if join == nil {
+			continue
+		}
+		if rule.When.EventType != "" || rule.When.From != "" || len(rule.When.Conditions) > 0 {
+			return fmt.Errorf("rule %d: when.join cannot be combined with when.event_type, when.from or when.conditions (put conditions on the join events)", i)
+		}
+		if join.Key == "" {
+			return fmt.Errorf("rule %d: when.join.key is required", i)
+		}
+		if len(join.Events) < 2 {
+			return fmt.Errorf("rule %d: when.join.events must list at least two events", i)
+		}
+		for j, part := range join.Events {
+			if part.EventType == "" {
+				return fmt.Errorf("rule %d: when.join.events[%d].event_type is required", i, j)
+			}
+			if part.Join != nil {
+				return fmt.Errorf("rule %d: when.join.events[%d] cannot contain a nested join", i, j)
+			}
+		}
+		if _, err := joinTimeout(join); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// joinTimeout returns the configured partial-match timeout of a join
+func joinTimeout(join *models.JoinCondition) (time.Duration, error) {
+	if join.Timeout == "" {
+		return DefaultJoinTimeout, nil
+	}
+	timeout, err := time.ParseDuration(join.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid when.join.timeout %q (want a positive duration such as 30s)", join.Timeout)
+	}
+	return timeout, nil
+}
+
+// GetPendingJoinCount returns the number of partial join matches currently buffered
+func (sm *ScenarioManager) GetPendingJoinCount() int {
+	sm.joinMu.Lock()
+	defer sm.joinMu.Unlock()
+
+	return len(sm.joins)
+}
+
+// GetExpiredJoinCount returns the number of partial join matches discarded after timing out
+func (sm *ScenarioManager) GetExpiredJoinCount() int64 {
+	return sm.expiredJoins.Load()
+}
+
+// dropJoins drops the buffered partial matches of a scenario (called when it is
+// deactivated or replaced)
+func (sm *ScenarioManager) dropJoins(scenario *models.Scenario) {
+	sm.joinMu.Lock()
+	defer sm.joinMu.Unlock()
+
+	for key := range sm.joins {
+		if key.scenario == scenario {
+			delete(sm.joins, key)
+		}
+	}
+}
+
+// pruneExpiredJoins discards partial matches whose timeout has passed
+// Caller must hold joinMu
+func (sm *ScenarioManager) pruneExpiredJoins(now time.Time) {
+	for key, pending := range sm.joins {
+		if now.Before(pending.expires) {
+			continue
+		}
+		delete(sm.joins, key)
+		sm.expiredJoins.Add(1)
+		log.Printf("Join for rule %d (correlation %s) expired with %d of %d events received",
+			key.rule, key.value, pending.received, len(pending.events))
+	}
+}
+
+// matchJoin buffers an event for a join rule and returns the join if it completed
+// (nil = not complete). The completed join stays buffered until consumeJoin is called
+// for it; its event is the given event with the payloads of the other correlated events
+// merged in.
+func (sm *ScenarioManager) matchJoin(scenario *models.Scenario, ruleIndex int, event models.Event) *completedJoin {
+	join := scenario.Rules[ruleIndex].When.Join
+
+	part := -1
+	for i, condition := range join.Events {
+		if MatchRule(models.Rule{When: condition}, event) {
+			part = i
+			break
+		}
+	}
+	if part < 0 {
+		return nil
+	}
+
+	correlation, ok := event.Payload[join.Key]
+	if !ok || correlation == nil {
+		log.Printf("Warning: Event %s from %s matches a join rule but has no %s field, ignoring it for the join",
+			event.EventType, event.Source, join.Key)
+		return nil
+	}
+
+	// Validated at load time
+	timeout, _ := joinTimeout(join)
+
+	key := joinKey{scenario: scenario, rule: ruleIndex, tenant: event.Tenant, value: fmt.Sprint(correlation)}
+	now := time.Now()
+
+	sm.joinMu.Lock()
+	defer sm.joinMu.Unlock()
+
+	sm.pruneExpiredJoins(now)
+
+	pending, exists := sm.joins[key]
+	if !exists {
+		pending = &pendingJoin{
+			events:  make([]*models.Event, len(join.Events)),
+			expires: now.Add(timeout),
+		}
+		sm.joins[key] = pending
+	}
+
+	// Fill the first matching part still missing; if all are filled, the newest event
+	// replaces the one in the first matching part
+	for i := part; i < len(join.Events); i++ {
+		if pending.events[i] == nil && MatchRule(models.Rule{When: join.Events[i]}, event) {
+			part = i
+			break
+		}
+	}
+	if pending.events[part] == nil {
+		pending.received++
+	}
+	received := event
+	pending.events[part] = &received
+
+	if pending.received < len(pending.events) {
+		log.Printf("Join for rule %d (correlation %s): %d of %d events received",
+			ruleIndex, key.value, pending.received, len(pending.events))
+		return nil
+	}
+
+	var payload map[string]interface{}
+	for _, buffered := range pending.events {
+		payload = mergePayloads(payload, buffered.Payload)
+	}
+	event.Payload = mergePayloads(payload, event.Payload)
+	return &completedJoin{key: key, pending: pending, event: event}
+}
+
+// consumeJoin drops the buffered events of a completed join whose rule fires
+// Returns false if the join was consumed (or expired) in the meantime, e.g. by an event
+// processed concurrently; the rule must not fire for it again.
+func (sm *ScenarioManager) consumeJoin(completed *completedJoin) bool {
+	sm.joinMu.Lock()
+	defer sm.joinMu.Unlock()
+
+	if sm.joins[completed.key] != completed.pending {
+		return false
+	}
+	delete(sm.joins, completed.key)
+	log.Printf("Join for rule %d (correlation %s) complete", completed.key.rule, completed.key.value)
+	return true
+}
@@ -0,0 +1,87 @@
+package scenario
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Event Type Patterns
+
+Event types are dot-separated (e.g. `order.payment.failed`). A rule's `event_type` may
+use `*` in place of a segment to match any single segment there:
+
+	when:
+	  event_type: "order.*.failed"   # order.payment.failed, order.shipping.failed, ...
+
+A pattern only matches event types with the same number of segments, so `order.*`
+matches `order.created` but not `order.payment.failed`. `*` must be a whole segment;
+`order.pay*` is rejected when the scenario is loaded.
+
+Patterns are compiled into their segments once, when the scenario is parsed, so
+matching an event doesn't re-split the pattern. An event_type without `*` is compared
+exactly, as before.
+*/
+
+// eventTypeWildcard is the event_type segment that matches any single segment
+const eventTypeWildcard = "*"
+
+// compileEventPatterns compiles the event_type patterns of a scenario's rules, including
+// those on the events of a join
+func compileEventPatterns(scenario *models.Scenario) error {
+	for i := range scenario.Rules {
+		when := &scenario.Rules[i].When
+		if err := CompileEventPattern(when); err != nil {
+			return fmt.Errorf("rule %d: when.event_type: %w", i, err)
+		}
+		if when.Join == nil {
+			continue
+		}
+		for j := range when.Join.Events {
+			if err := CompileEventPattern(&when.Join.Events[j]); err != nil {
+				return fmt.Errorf("rule %d: when.join.events[%d].event_type: %w", i, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CompileEventPattern validates a when condition's event_type and, if it contains a
+// wildcard, stores its segments in EventPattern for matching
+// A condition that is not compiled is matched exactly, wildcards included.
+func CompileEventPattern(when *models.WhenCondition) error {
+	when.EventPattern = nil
+	if !strings.Contains(when.EventType, eventTypeWildcard) {
+		return nil
+	}
+
+	segments := strings.Split(when.EventType, ".")
+	for _, segment := range segments {
+		if segment != eventTypeWildcard && strings.Contains(segment, eventTypeWildcard) {
+			return fmt.Errorf("%q: * must be a whole segment (e.g. order.*.failed)", when.EventType)
+		}
+	}
+	when.EventPattern = segments
+	return nil
+}
+
+// matchEventType reports whether an event type matches a when condition's event_type
+func matchEventType(when models.WhenCondition, eventType string) bool {
+	if when.EventPattern == nil {
+		return when.EventType == eventType
+	}
+	if strings.Count(eventType, ".")+1 != len(when.EventPattern) {
+		return false
+	}
+
+	for _, segment := range when.EventPattern {
+		var current string
+		current, eventType, _ = strings.Cut(eventType, ".")
+		if segment != eventTypeWildcard && segment != current {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package scenario
+
+import (
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+func TestMatchEventType(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		eventType string
+		want      bool
+	}{
+		// Exact
+		{"order.created", "order.created", true},
+		{"order.created", "order.updated", false},
+		{"order.created", "order.created.late", false},
+		{"order.created", "order", false},
+		{"", "", true},
+		{"", "order", false},
+
+		// * alone matches any single segment
+		{"*", "started", true},
+		{"*", "order.created", false},
+		{"*", "", true},
+
+		// Prefix
+		{"order.*", "order.created", true},
+		{"order.*", "order.", true},
+		{"order.*", "order", false},
+		{"order.*", "order.payment.failed", false},
+		{"order.*", "orders.created", false},
+
+		// Suffix
+		{"*.failed", "payment.failed", true},
+		{"*.failed", "payment.succeeded", false},
+		{"*.failed", "order.payment.failed", false},
+		{"*.failed", "failed", false},
+
+		// Middle and several wildcards
+		{"order.*.failed", "order.payment.failed", true},
+		{"order.*.failed", "order.shipping.failed", true},
+		{"order.*.failed", "order.payment.succeeded", false},
+		{"order.*.failed", "invoice.payment.failed", false},
+		{"order.*.failed", "order.failed", false},
+		{"*.*", "order.created", true},
+		{"*.*", "order", false},
+		{"*.*.*", "a.b.c", true},
+	}
+
+	for _, tt := range tests {
+		when := models.WhenCondition{EventType: tt.pattern}
+		if err := CompileEventPattern(&when); err != nil {
+			t.Fatalf("CompileEventPattern(%q): %v", tt.pattern, err)
+		}
+		if got := matchEventType(when, tt.eventType); got != tt.want {
+			t.Errorf("pattern %q, event %q: matched = %v, want %v", tt.pattern, tt.eventType, got, tt.want)
+		}
+	}
+}
+
+func TestCompileEventPatternRejectsPartialWildcards(t *testing.T) {
+	for _, pattern := range []string{"order.pay*", "*order", "order.*x.failed", "**", "order.**"} {
+		when := models.WhenCondition{EventType: pattern}
+		if err := CompileEventPattern(&when); err == nil {
+			t.Errorf("CompileEventPattern(%q) succeeded, want an error", pattern)
+		}
+	}
+}
+
+func TestUncompiledPatternMatchesExactly(t *testing.T) {
+	// A condition that wasn't compiled compares its event_type literally
+	when := models.WhenCondition{EventType: "order.*"}
+	if matchEventType(when, "order.created") {
+		t.Fatal("uncompiled pattern matched as a wildcard")
+	}
+	if !matchEventType(when, "order.*") {
+		t.Fatal("uncompiled pattern didn't match itself")
+	}
+}
+
+func TestCompileEventPatternsCoversJoins(t *testing.T) {
+	s := &models.Scenario{Rules: []models.Rule{{
+		When: models.WhenCondition{Join: &models.JoinCondition{Events: []models.WhenCondition{
+			{EventType: "sensor.*"},
+			{EventType: "sensor.b*"},
+		}}},
+	}}}
+	if err := compileEventPatterns(s); err == nil {
+		t.Fatal("invalid pattern in a join accepted")
+	}
+
+	s.Rules[0].When.Join.Events[1].EventType = "*.ready"
+	if err := compileEventPatterns(s); err != nil {
+		t.Fatalf("compileEventPatterns: %v", err)
+	}
+	for _, event := range s.Rules[0].When.Join.Events {
+		if event.EventPattern == nil {
+			t.Fatalf("join event %q not compiled", event.EventType)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package scenario
+
+import (
+	"sort"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Rule Priority
+
+When one event matches several rules, their actions are combined into one Saga. A
+rule's `priority` (an integer, default 0) decides the order: the actions of higher
+priority rules come first. Rules of equal priority keep their usual order, scenario
+by scenario in name order and in file order within a scenario.
+
+A rule may also set `exclusive: true`. When it fires, the matching rules ranked after
+it (lower priority, or equal priority but later in that order) are skipped, so the
+event only yields the actions of the exclusive rule and of the rules ranked before it:
+
+	rules:
+	  - when:
+	      event_type: "alarm"
+	      conditions:
+	        - key: "severity"
+	          op: eq
+	          value: "critical"
+	    priority: 10
+	    exclusive: true
+	    then: [...]           # Critical alarms only run this rule
+	  - when:
+	      event_type: "alarm"
+	    then: [...]           # Every other alarm
+
+An exclusive rule that is cooling down (see cooldown.go) doesn't fire, so it doesn't
+skip anything either. Skipped rules don't start a cooldown window, and a join rule the
+event completed keeps its buffered events (see join.go).
+*/
+
+// ruleMatch is a rule that matched an event, before ranking
+type ruleMatch struct {
+	scenario *models.Scenario
+	rule     int            // Rule index within the scenario
+	join     *completedJoin // Join the event completed (nil = not a join rule)
+}
+
+// rankMatches orders matched rules by priority, highest first
+// The sort is stable, so rules of equal priority keep the order they matched in.
+func rankMatches(matches []ruleMatch) []ruleMatch {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].scenario.Rules[matches[i].rule].Priority > matches[j].scenario.Rules[matches[j].rule].Priority
+	})
+	return matches
+}
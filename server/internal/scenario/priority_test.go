@@ -0,0 +1,226 @@
+package scenario
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+// activate parses a scenario and activates it, failing the test if it is invalid
+func activate(t *testing.T, sm *ScenarioManager, yaml string) {
+	t.Helper()
+	if err := sm.LoadScenarioFromBytes([]byte(yaml)); err != nil {
+		t.Fatalf("LoadScenarioFromBytes: %v", err)
+	}
+}
+
+// commands returns the commands of actions in order
+func commands(actions []models.Action) []string {
+	result := []string{}
+	for _, action := range actions {
+		result = append(result, action.Command)
+	}
+	return result
+}
+
+// expectCommands processes an event and checks the commands of the actions it yields
+func expectCommands(t *testing.T, sm *ScenarioManager, event models.Event, want ...string) models.Event {
+	t.Helper()
+	actions, sagaEvent := sm.ProcessEvent(event)
+	if got := commands(actions); !reflect.DeepEqual(got, append([]string{}, want...)) {
+		t.Fatalf("event %s %v: commands = %v, want %v", event.EventType, event.Payload, got, want)
+	}
+	return sagaEvent
+}
+
+func TestPriorityOrdersActions(t *testing.T) {
+	sm := NewScenarioManager()
+	activate(t, sm, `
+scenario:
+  name: "b"
+  rules:
+    - when: {event_type: "alarm"}
+      then: [{send_to: "sim", command: "b-default"}]
+    - when: {event_type: "alarm"}
+      priority: 5
+      then: [{send_to: "sim", command: "b-five"}, {send_to: "sim", command: "b-five-again"}]
+    - when: {event_type: "alarm"}
+      priority: -1
+      then: [{send_to: "sim", command: "b-last"}]
+`)
+	activate(t, sm, `
+scenario:
+  name: "a"
+  rules:
+    - when: {event_type: "alarm"}
+      then: [{send_to: "sim", command: "a-default"}]
+    - when: {event_type: "alarm"}
+      priority: 10
+      then: [{send_to: "sim", command: "a-ten"}]
+    - when: {event_type: "alarm"}
+      priority: 5
+      then: [{send_to: "sim", command: "a-five"}]
+`)
+
+	// Highest priority first; ties by scenario name, then file order. Actions of one
+	// rule stay together.
+	expectCommands(t, sm, models.Event{EventType: "alarm"},
+		"a-ten", "a-five", "b-five", "b-five-again", "a-default", "b-default", "b-last")
+}
+
+func TestExclusiveRuleSkipsLowerRanked(t *testing.T) {
+	sm := NewScenarioManager()
+	activate(t, sm, `
+scenario:
+  name: "alarms"
+  rules:
+    - when: {event_type: "alarm"}
+      priority: 20
+      then: [{send_to: "sim", command: "audit"}]
+    - when: {event_type: "alarm"}
+      then: [{send_to: "sim", command: "notify"}]
+    - when:
+        event_type: "alarm"
+        conditions: [{key: "severity", op: eq, value: "critical"}]
+      priority: 10
+      exclusive: true
+      then: [{send_to: "sim", command: "evacuate"}]
+    - when: {event_type: "alarm"}
+      priority: 10
+      then: [{send_to: "sim", command: "log"}]
+`)
+
+	// Rules ranked before the exclusive one still run; equal priority later in the
+	// file is skipped
+	expectCommands(t, sm, models.Event{EventType: "alarm", Payload: map[string]interface{}{"severity": "critical"}},
+		"audit", "evacuate")
+	expectCommands(t, sm, models.Event{EventType: "alarm", Payload: map[string]interface{}{"severity": "low"}},
+		"audit", "log", "notify")
+}
+
+func TestExclusiveRuleInCooldownSkipsNothing(t *testing.T) {
+	sm := NewScenarioManager()
+	activate(t, sm, `
+scenario:
+  name: "alarms"
+  rules:
+    - when: {event_type: "alarm"}
+      priority: 10
+      exclusive: true
+      cooldown: 1h
+      then: [{send_to: "sim", command: "page"}]
+    - when: {event_type: "alarm"}
+      then: [{send_to: "sim", command: "log"}]
+`)
+
+	event := models.Event{EventType: "alarm", Source: "sensor"}
+	expectCommands(t, sm, event, "page")
+	expectCommands(t, sm, event, "log")
+}
+
+func TestJoinSkippedByExclusiveRuleKeepsEvents(t *testing.T) {
+	sm := NewScenarioManager()
+	activate(t, sm, `
+scenario:
+  name: "orders"
+  rules:
+    - when:
+        event_type: "shipment.created"
+        conditions: [{key: "express", op: eq, value: true}]
+      priority: 10
+      exclusive: true
+      then: [{send_to: "sim", command: "express"}]
+    - when:
+        join:
+          key: order_id
+          events:
+            - event_type: "payment.received"
+            - event_type: "shipment.created"
+      then: [{send_to: "sim", command: "ship"}]
+`)
+
+	expectCommands(t, sm, models.Event{EventType: "payment.received", Payload: map[string]interface{}{"order_id": 1, "amount": 5}})
+
+	// Completes the join, but the exclusive rule skips it
+	expectCommands(t, sm, models.Event{EventType: "shipment.created", Payload: map[string]interface{}{"order_id": 1, "express": true}},
+		"express")
+	if n := sm.GetPendingJoinCount(); n != 1 {
+		t.Fatalf("%d pending joins after the join was skipped, want 1 (its events kept)", n)
+	}
+
+	// The buffered payment still joins with the next shipment
+	sagaEvent := expectCommands(t, sm, models.Event{EventType: "shipment.created", Payload: map[string]interface{}{"order_id": 1, "express": false}},
+		"ship")
+	if sagaEvent.Payload["amount"] != 5 {
+		t.Fatalf("saga event payload = %v, want the payment's amount merged in", sagaEvent.Payload)
+	}
+	if n := sm.GetPendingJoinCount(); n != 0 {
+		t.Fatalf("%d pending joins after the join fired, want 0", n)
+	}
+}
+
+func TestJoinInCooldownKeepsEvents(t *testing.T) {
+	sm := NewScenarioManager()
+	activate(t, sm, `
+scenario:
+  name: "orders"
+  rules:
+    - when:
+        join:
+          key: order_id
+          events:
+            - event_type: "payment.received"
+            - event_type: "shipment.created"
+      cooldown: 1h
+      then: [{send_to: "sim", command: "ship"}]
+`)
+
+	payment := func(id int) models.Event {
+		return models.Event{EventType: "payment.received", Source: "shop", Payload: map[string]interface{}{"order_id": id}}
+	}
+	shipment := func(id int) models.Event {
+		return models.Event{EventType: "shipment.created", Source: "shop", Payload: map[string]interface{}{"order_id": id}}
+	}
+
+	expectCommands(t, sm, payment(1))
+	expectCommands(t, sm, shipment(1), "ship")
+
+	// Order 2 completes while the rule is cooling down for the source
+	expectCommands(t, sm, payment(2))
+	expectCommands(t, sm, shipment(2))
+	if n := sm.GetPendingJoinCount(); n != 1 {
+		t.Fatalf("%d pending joins after a suppressed completion, want 1 (its events kept)", n)
+	}
+}
+
+func TestConsumedJoinDoesNotFireTwice(t *testing.T) {
+	sm := NewScenarioManager()
+	activate(t, sm, `
+scenario:
+  name: "orders"
+  rules:
+    - when:
+        join:
+          key: order_id
+          events:
+            - event_type: "payment.received"
+            - event_type: "shipment.created"
+      then: [{send_to: "sim", command: "ship"}]
+`)
+	s := sm.GetActiveScenario("orders")
+
+	sm.matchJoin(s, 0, models.Event{EventType: "payment.received", Payload: map[string]interface{}{"order_id": 1}})
+	// Two events complete the same join before either consumes it
+	first := sm.matchJoin(s, 0, models.Event{EventType: "shipment.created", Payload: map[string]interface{}{"order_id": 1}})
+	second := sm.matchJoin(s, 0, models.Event{EventType: "shipment.created", Payload: map[string]interface{}{"order_id": 1}})
+	if first == nil || second == nil {
+		t.Fatal("join not completed")
+	}
+	if !sm.consumeJoin(first) {
+		t.Fatal("first completion not consumed")
+	}
+	if sm.consumeJoin(second) {
+		t.Fatal("join consumed twice")
+	}
+}
@@ -0,0 +1,58 @@
+package scenario
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+// validateSagaTimeouts checks the saga_timeout of a scenario's rules and the timeout
+// of their actions
+func validateSagaTimeouts(scenario *models.Scenario) error {
+	for i, rule := range scenario.Rules {
+		if _, err := ruleSagaTimeout(rule); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		for j, action := range rule.Then {
+			if _, err := actionTimeout(action); err != nil {
+				return fmt.Errorf("rule %d action %d: %w", i, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ruleSagaTimeout returns the configured saga_timeout of a rule (0 = server default)
+func ruleSagaTimeout(rule models.Rule) (time.Duration, error) {
+	if rule.SagaTimeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(rule.SagaTimeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid saga_timeout %q (want a positive duration such as 5m)", rule.SagaTimeout)
+	}
+	return timeout, nil
+}
+
+// actionTimeout returns the configured timeout of an action (0 = server default)
+func actionTimeout(action models.Action) (time.Duration, error) {
+	if action.Timeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(action.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q (want a positive duration such as 30s)", action.Timeout)
+	}
+	return timeout, nil
+}
+
+// setSagaTimeout records a matched rule's saga_timeout, and each action's own timeout,
+// on the actions the rule contributed
+func setSagaTimeout(actions []models.Action, rule models.Rule) {
+	timeout, _ := ruleSagaTimeout(rule) // validated when the scenario was loaded
+	for i := range actions {
+		actions[i].SagaTimeout = timeout
+		actions[i].StepTimeout, _ = actionTimeout(actions[i])
+	}
+}
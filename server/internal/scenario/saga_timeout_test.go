@@ -0,0 +1,51 @@
+package scenario
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+func TestStepTimeout(t *testing.T) {
+	tests := []struct {
+		timeout string
+		want    time.Duration
+		wantErr bool
+	}{
+		{timeout: `""`, want: 0},
+		{timeout: `"30s"`, want: 30 * time.Second},
+		{timeout: `2m`, want: 2 * time.Minute},
+		{timeout: `30`, wantErr: true},
+		{timeout: `"-5s"`, wantErr: true},
+		{timeout: `"soon"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timeout, func(t *testing.T) {
+			yaml := fmt.Sprintf(`
+scenario:
+  name: "timeouts"
+  rules:
+    - when: {event_type: "alarm"}
+      then: [{send_to: "sim", command: "work", timeout: %s}]
+`, tt.timeout)
+			sm := NewScenarioManager()
+			err := sm.LoadScenarioFromBytes([]byte(yaml))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "rule 0 action 0: invalid timeout") {
+					t.Fatalf("LoadScenarioFromBytes = %v, want an invalid timeout error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadScenarioFromBytes: %v", err)
+			}
+			actions, _ := sm.ProcessEvent(models.Event{EventType: "alarm", Source: "source"})
+			if len(actions) != 1 || actions[0].StepTimeout != tt.want {
+				t.Fatalf("actions = %+v, want one with a step timeout of %s", actions, tt.want)
+			}
+		})
+	}
+}
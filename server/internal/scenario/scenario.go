@@ -4,19 +4,70 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
 	"gopkg.in/yaml.v3"
 )
 
 // ScenarioManager handles loading and matching scenario rules
+// Any number of scenarios can be active at once, keyed by name; activating a scenario
+// with the name of an active one replaces it. It is safe for concurrent use: rule
+// matching can run while scenarios are activated or deactivated.
 type ScenarioManager struct {
-	scenario *models.Scenario
+	active map[string]*models.Scenario // Active scenarios by name
+	latest string                      // Name of the most recently activated scenario
+	mu     sync.RWMutex                // Protects active and latest
+
+	// opMu linearizes scenario-mutating operations (upload, activate, update, delete)
+	// so each one applies atomically and in arrival order
+	opMu sync.Mutex
+
+	// Fan-out warning thresholds and the number of events that exceeded them
+	fanOutWarnRules   atomic.Int64
+	fanOutWarnActions atomic.Int64
+	fanOutWarnings    atomic.Int64
+
+	// Partial matches of join rules (see join.go)
+	joins        map[joinKey]*pendingJoin
+	joinMu       sync.Mutex // Protects joins
+	expiredJoins atomic.Int64
+
+	// Open rule cooldown windows (see cooldown.go)
+	cooldowns          map[cooldownKey]*cooldownWindow
+	cooldownMu         sync.Mutex // Protects cooldowns
+	cooldownSuppressed atomic.Int64
+
+	// Events that failed an event schema (see schema.go)
+	schemaRejected atomic.Int64
+
+	// Parsed stored scenarios (see cache.go)
+	cache scenarioCache
+
+	// Resolves capability selectors in groups (see groups.go); set before events are
+	// processed (nil = selectors match nothing)
+	registry *registry.Registry
 }
 
 // NewScenarioManager creates a new scenario manager
 func NewScenarioManager() *ScenarioManager {
-	return &ScenarioManager{}
+	sm := &ScenarioManager{
+		active:    make(map[string]*models.Scenario),
+		joins:     make(map[joinKey]*pendingJoin),
+		cooldowns: make(map[cooldownKey]*cooldownWindow),
+	}
+	sm.SetFanOutWarningThresholds(DefaultFanOutWarningRules, DefaultFanOutWarningActions)
+	sm.SetScenarioCacheSize(DefaultScenarioCacheSize)
+	return sm
+}
+
+// SetRegistry sets the registry capability selectors in groups are resolved against
+// Must be called before events are processed.
+func (sm *ScenarioManager) SetRegistry(reg *registry.Registry) {
+	sm.registry = reg
 }
 
 // LoadScenario loads a scenario from a YAML file
@@ -29,46 +80,255 @@ func (sm *ScenarioManager) LoadScenario(filepath string) error {
 	return sm.LoadScenarioFromBytes(data)
 }
 
-// LoadScenarioFromBytes loads a scenario from YAML bytes
+// LoadScenarioFromBytes parses a scenario from YAML bytes and activates it
 func (sm *ScenarioManager) LoadScenarioFromBytes(data []byte) error {
+	scenario, err := ParseScenario(data)
+	if err != nil {
+		return err
+	}
+
+	sm.ActivateScenario(scenario)
+	return nil
+}
+
+// ParseScenario parses and validates a scenario from YAML bytes without activating it
+func ParseScenario(data []byte) (*models.Scenario, error) {
 	var scenarioFile models.ScenarioFile
 	if err := yaml.Unmarshal(data, &scenarioFile); err != nil {
-		return fmt.Errorf("failed to parse YAML: %w", err)
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if err := validateJoins(&scenarioFile.Scenario); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := validateConditions(&scenarioFile.Scenario); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
 	}
+	if err := validateStepConditions(&scenarioFile.Scenario); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := compileEventPatterns(&scenarioFile.Scenario); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := validateCooldowns(&scenarioFile.Scenario); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := validateSagaTimeouts(&scenarioFile.Scenario); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := validateEventSchemas(&scenarioFile.Scenario); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	return &scenarioFile.Scenario, nil
+}
 
-	sm.scenario = &scenarioFile.Scenario
-	log.Printf("Loaded scenario: %s with %d rules", scenarioFile.Scenario.Name, len(scenarioFile.Scenario.Rules))
-	return nil
+// ActivateScenario adds a scenario to the active set
+// An active scenario with the same name is replaced, and its buffered join matches
+// are dropped; the other active scenarios are left untouched.
+func (sm *ScenarioManager) ActivateScenario(scenario *models.Scenario) {
+	sm.mu.Lock()
+	previous := sm.active[scenario.Name]
+	sm.active[scenario.Name] = scenario
+	sm.latest = scenario.Name
+	active := len(sm.active)
+	sm.mu.Unlock()
+
+	if previous != nil {
+		sm.dropJoins(previous)
+		sm.dropCooldowns(previous)
+		log.Printf("Replaced active scenario: %s with %d rules (%d active)", scenario.Name, len(scenario.Rules), active)
+		return
+	}
+	log.Printf("Activated scenario: %s with %d rules (%d active)", scenario.Name, len(scenario.Rules), active)
 }
 
-// GetCurrentScenario returns information about the currently loaded scenario
-func (sm *ScenarioManager) GetCurrentScenario() *models.Scenario {
-	return sm.scenario
+// DeactivateScenario removes the scenario with the given name from the active set
+// and drops its buffered join matches. Returns the removed scenario, or nil if no
+// scenario with that name was active.
+func (sm *ScenarioManager) DeactivateScenario(name string) *models.Scenario {
+	sm.mu.Lock()
+	scenario := sm.active[name]
+	if scenario == nil {
+		sm.mu.Unlock()
+		return nil
+	}
+	delete(sm.active, name)
+	if sm.latest == name {
+		sm.latest = ""
+	}
+	active := len(sm.active)
+	sm.mu.Unlock()
+
+	sm.dropJoins(scenario)
+	sm.dropCooldowns(scenario)
+	log.Printf("Deactivated scenario: %s (%d active)", name, active)
+	return scenario
 }
 
-// ProcessEvent checks if an event matches any rules and returns actions to execute
-func (sm *ScenarioManager) ProcessEvent(event models.Event) []models.Action {
-	if sm.scenario == nil {
+// DeactivateStoredScenario removes the active scenario that was loaded from the stored
+// scenario with the given ID, if any (e.g. because that stored scenario was deleted)
+// Returns the removed scenario, or nil if none was loaded from that ID.
+func (sm *ScenarioManager) DeactivateStoredScenario(id int) *models.Scenario {
+	sm.mu.RLock()
+	name := ""
+	for _, scenario := range sm.active {
+		if scenario.StoredID == id {
+			name = scenario.Name
+			break
+		}
+	}
+	sm.mu.RUnlock()
+
+	if name == "" {
 		return nil
 	}
+	// Scenario-changing operations are linearized by RunExclusive, so the entry
+	// can't have been replaced in between
+	return sm.DeactivateScenario(name)
+}
+
+// ListActive returns the active scenarios sorted by name
+// This is the order in which ProcessEvent evaluates them.
+func (sm *ScenarioManager) ListActive() []*models.Scenario {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	active := make([]*models.Scenario, 0, len(sm.active))
+	for _, scenario := range sm.active {
+		active = append(active, scenario)
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Name < active[j].Name })
+	return active
+}
+
+// GetCurrentScenario returns the most recently activated scenario that is still active
+// (nil if none is active)
+func (sm *ScenarioManager) GetCurrentScenario() *models.Scenario {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.active[sm.latest]
+}
 
+// GetActiveScenario returns the active scenario with the given name (nil if not active)
+func (sm *ScenarioManager) GetActiveScenario(name string) *models.Scenario {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.active[name]
+}
+
+// RunExclusive runs a scenario-mutating operation while holding the operation lock
+// Operations that change the active scenario and/or the scenario store (upload, activate,
+// update, delete) must go through here so concurrent requests are applied one at a time
+// in order, instead of interleaving and leaving a surprising "last write wins" result.
+func (sm *ScenarioManager) RunExclusive(op func() error) error {
+	sm.opMu.Lock()
+	defer sm.opMu.Unlock()
+
+	return op()
+}
+
+// ProcessEvent checks if an event matches any rules and returns actions to execute
+// Rules of every active scenario are evaluated, scenario by scenario in name order and
+// in file order within a scenario. Matching rules are then ranked by priority, ties
+// keeping that order, and an exclusive rule stops the rules ranked after it (see
+// priority.go), so an event matching several rules always yields the same actions in
+// the same order.
+// It also returns the event the Saga should be created from: the given event, with
+// the payloads of the correlated events merged in if the event completed a join rule.
+// A matching rule that is cooling down for the event's source is skipped (see cooldown.go),
+// and a scenario ignores events that don't conform to its event schemas (see schema.go).
+func (sm *ScenarioManager) ProcessEvent(event models.Event) ([]models.Action, models.Event) {
 	var actions []models.Action
+	var matches []ruleMatch
+	matchedRules := 0
+	sagaEvent := event
 
-	for _, rule := range sm.scenario.Rules {
-		// Check if event type matches
-		if rule.When.EventType != event.EventType {
+	for _, scenario := range sm.ListActive() {
+		// A tenant-scoped scenario only sees its own tenant's events
+		if scenario.Tenant != "" && scenario.Tenant != event.Tenant {
+			continue
+		}
+		// A malformed event must not match rules and start Sagas with missing params
+		if !sm.conformsToSchema(scenario, event) {
 			continue
 		}
 
-		// Check if source matches (if specified in rule)
-		if rule.When.From != "" && rule.When.From != event.Source {
+		for i, rule := range scenario.Rules {
+			match := ruleMatch{scenario: scenario, rule: i}
+			if rule.When.Join != nil {
+				if match.join = sm.matchJoin(scenario, i, event); match.join == nil {
+					continue
+				}
+			} else if !MatchRule(rule, event) {
+				continue
+			}
+			matches = append(matches, match)
+		}
+	}
+
+	ranked := rankMatches(matches)
+	for i, match := range ranked {
+		rule := match.scenario.Rules[match.rule]
+		if sm.inCooldown(match.scenario, match.rule, event) {
 			continue
 		}
+		// Only a join rule that fires uses up its buffered events
+		if match.join != nil {
+			if !sm.consumeJoin(match.join) {
+				continue
+			}
+			sagaEvent.Payload = mergePayloads(sagaEvent.Payload, match.join.event.Payload)
+		}
 
 		// Rule matches! Add all actions
-		log.Printf("Rule matched! Event: %s from %s", event.EventType, event.Source)
-		actions = append(actions, rule.Then...)
+		log.Printf("Rule matched in scenario %s! Event: %s from %s", match.scenario.Name, event.EventType, event.Source)
+		matchedRules++
+		ruleStart := len(actions)
+		actions = appendRuleActions(actions, rule.Then, match.scenario.Groups, sm.registry, event.Tenant)
+		setSagaTimeout(actions[ruleStart:], rule)
+
+		if rule.Exclusive {
+			if skipped := len(ranked) - i - 1; skipped > 0 {
+				log.Printf("Exclusive rule %d in scenario %s fired, skipping %d lower-ranked matching rules", match.rule, match.scenario.Name, skipped)
+			}
+			break
+		}
+	}
+
+	sm.checkFanOut(event, matchedRules, len(actions))
+	return actions, sagaEvent
+}
+
+// mergePayloads returns a new payload holding the fields of base overlaid with extra
+func mergePayloads(base, extra map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(extra))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+// MatchRule reports whether a single rule's when condition matches an event
+// Join rules never match a single event (see matchJoin).
+func MatchRule(rule models.Rule, event models.Event) bool {
+	if rule.When.Join != nil {
+		return false
+	}
+
+	// Check if event type matches (exactly, or the compiled pattern)
+	if !matchEventType(rule.When, event.EventType) {
+		return false
+	}
+
+	// Check if source matches (if specified in rule)
+	if rule.When.From != "" && rule.When.From != event.Source {
+		return false
 	}
 
-	return actions
+	// Check payload conditions (all must hold)
+	return MatchConditions(rule.When.Conditions, event.Payload)
 }
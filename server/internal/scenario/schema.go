@@ -0,0 +1,143 @@
+package scenario
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Event Schemas
+
+A scenario may declare the payload each event type must carry:
+
+	event_schemas:
+	  sensor.triggered:
+	    required:
+	      zone: string
+	      reading.value: number
+
+Before an event is matched against a scenario's rules, it is checked against that
+scenario's schema for its event type (exact type, no patterns). An event that lacks a
+required field, or has one of the wrong JSON type, is rejected: it matches none of the
+scenario's rules, the rejection is logged with every offending field, and it is counted
+(see GetSchemaRejectedCount). Other active scenarios judge the event by their own
+schemas. Event types without a schema are not checked, and fields not listed are
+allowed.
+
+Types are JSON types: string, number, integer (a number without a fractional part),
+boolean, object and array. A field set to null is treated as missing.
+*/
+
+// Event schema field types
+const (
+	SchemaString  = "string"
+	SchemaNumber  = "number"
+	SchemaInteger = "integer"
+	SchemaBoolean = "boolean"
+	SchemaObject  = "object"
+	SchemaArray   = "array"
+)
+
+// validateEventSchemas checks a scenario's event schemas
+func validateEventSchemas(scenario *models.Scenario) error {
+	for eventType, schema := range scenario.EventSchemas {
+		if eventType == "" {
+			return fmt.Errorf("event_schemas: event type is empty")
+		}
+		if strings.Contains(eventType, "*") {
+			return fmt.Errorf("event_schemas.%s: patterns are not supported, use the exact event type", eventType)
+		}
+		for path, fieldType := range schema.Required {
+			if path == "" {
+				return fmt.Errorf("event_schemas.%s.required: field path is empty", eventType)
+			}
+			switch fieldType {
+			case SchemaString, SchemaNumber, SchemaInteger, SchemaBoolean, SchemaObject, SchemaArray:
+			default:
+				return fmt.Errorf("event_schemas.%s.required.%s: unknown type %q (want string, number, integer, boolean, object or array)", eventType, path, fieldType)
+			}
+		}
+	}
+	return nil
+}
+
+// conformsToSchema reports whether an event satisfies the scenario's schema for its
+// type, logging and counting it if not
+func (sm *ScenarioManager) conformsToSchema(scenario *models.Scenario, event models.Event) bool {
+	schema, exists := scenario.EventSchemas[event.EventType]
+	if !exists {
+		return true
+	}
+
+	violations := schemaViolations(schema, event.Payload)
+	if len(violations) == 0 {
+		return true
+	}
+
+	sm.schemaRejected.Add(1)
+	log.Printf("Scenario %s: Rejected event %s from %s, payload does not match its schema: %s",
+		scenario.Name, event.EventType, event.Source, strings.Join(violations, "; "))
+	return false
+}
+
+// schemaViolations returns what is wrong with a payload under a schema, one entry per
+// offending field, sorted by field path
+func schemaViolations(schema models.EventSchema, payload map[string]interface{}) []string {
+	paths := make([]string, 0, len(schema.Required))
+	for path := range schema.Required {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var violations []string
+	for _, path := range paths {
+		expected := schema.Required[path]
+		value, ok := lookupPayloadPath(payload, path)
+		if !ok || value == nil {
+			violations = append(violations, fmt.Sprintf("%s is missing (expected %s)", path, expected))
+			continue
+		}
+		if actual := jsonType(value); !typeMatches(expected, actual, value) {
+			violations = append(violations, fmt.Sprintf("%s is %s (expected %s)", path, actual, expected))
+		}
+	}
+	return violations
+}
+
+// typeMatches reports whether a value of JSON type actual satisfies the expected type
+func typeMatches(expected, actual string, value interface{}) bool {
+	if expected == SchemaInteger {
+		n, ok := toNumber(value)
+		return ok && n == math.Trunc(n)
+	}
+	return expected == actual
+}
+
+// jsonType returns the JSON type of a decoded payload value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return SchemaString
+	case bool:
+		return SchemaBoolean
+	case map[string]interface{}:
+		return SchemaObject
+	case []interface{}:
+		return SchemaArray
+	}
+	if _, ok := toNumber(value); ok {
+		return SchemaNumber
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// GetSchemaRejectedCount returns the number of times an event was rejected by a
+// scenario's event schema
+func (sm *ScenarioManager) GetSchemaRejectedCount() int64 {
+	return sm.schemaRejected.Load()
+}
@@ -0,0 +1,117 @@
+package scenario
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Step Conditions
+
+An action may set a `condition`: payload conditions (the same key/op/value list as
+`when.conditions`) matched against the results that earlier steps reported in their
+step.completed payloads. If it doesn't hold when the Saga reaches the step, the step
+is skipped instead of dispatched:
+
+	then:
+	  - send_to: "inventory_sim"     # step 0
+	    command: "check_inventory"
+	  - send_to: "billing_sim"       # step 1
+	    command: "charge_card"
+	    condition:
+	      - key: "steps.0.in_stock"
+	        op: eq
+	        value: true
+
+Keys have the form "steps.<n>.<path>", where n is the position of an earlier action
+in the rule's `then` list (as in `compensate_after`) and path is a dotted path in its
+result. A step that was skipped, or reported no result, has no fields to match. A
+step whose result was discarded for its size fails the Saga instead (see
+saga/condition.go), since matching nothing could silently pick the wrong branch.
+
+Conditions are only allowed on sequential actions, and may only reference earlier
+actions that send to a single simulation, so each reference names exactly one step.
+When the rule's actions are collected for a Saga, references are rewritten from rule
+positions to Saga step indices (see appendRuleActions).
+*/
+
+// stepConditionPrefix starts every step condition key
+const stepConditionPrefix = "steps."
+
+// validateStepConditions checks the step conditions of a scenario's actions
+func validateStepConditions(scenario *models.Scenario) error {
+	for i, rule := range scenario.Rules {
+		for a, action := range rule.Then {
+			if len(action.Condition) == 0 {
+				continue
+			}
+			if action.Parallel {
+				return fmt.Errorf("rule %d: then[%d]: condition is not supported on parallel actions", i, a)
+			}
+			if err := ValidateConditions(action.Condition); err != nil {
+				return fmt.Errorf("rule %d: then[%d].condition%w", i, a, err)
+			}
+			for k, condition := range action.Condition {
+				ref, _, ok := parseStepConditionKey(condition.Key)
+				if !ok {
+					return fmt.Errorf("rule %d: then[%d].condition[%d]: key %q must have the form steps.<n>.<path>", i, a, k, condition.Key)
+				}
+				if ref >= a {
+					return fmt.Errorf("rule %d: then[%d].condition[%d]: key %q must reference an earlier action", i, a, k, condition.Key)
+				}
+				if _, isGroup := scenario.Groups[rule.Then[ref].SendTo]; isGroup {
+					return fmt.Errorf("rule %d: then[%d].condition[%d]: key %q references action %d, which sends to group %s", i, a, k, condition.Key, ref, rule.Then[ref].SendTo)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseStepConditionKey splits a step condition key "steps.<n>.<path>" into the step
+// it references and the path in that step's result
+func parseStepConditionKey(key string) (step int, path string, ok bool) {
+	rest, found := strings.CutPrefix(key, stepConditionPrefix)
+	if !found {
+		return 0, "", false
+	}
+	index, path, found := strings.Cut(rest, ".")
+	if !found || path == "" {
+		return 0, "", false
+	}
+	step, err := strconv.Atoi(index)
+	if err != nil || step < 0 {
+		return 0, "", false
+	}
+	return step, path, true
+}
+
+// ConditionSteps returns the Saga steps a validated step condition references
+func ConditionSteps(condition []models.PayloadCondition) []int {
+	var steps []int
+	for _, c := range condition {
+		if step, _, ok := parseStepConditionKey(c.Key); ok {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// rebaseStepCondition returns a copy of a validated condition with each reference to
+// a rule action rewritten to the Saga step it became (stepIndexes, as in
+// appendRuleActions)
+func rebaseStepCondition(condition []models.PayloadCondition, stepIndexes [][]int) []models.PayloadCondition {
+	rebased := make([]models.PayloadCondition, len(condition))
+	for k, c := range condition {
+		rebased[k] = c
+		ref, path, ok := parseStepConditionKey(c.Key)
+		if !ok || ref >= len(stepIndexes) || len(stepIndexes[ref]) != 1 {
+			continue // Can't happen for a validated scenario
+		}
+		rebased[k].Key = stepConditionPrefix + strconv.Itoa(stepIndexes[ref][0]) + "." + path
+	}
+	return rebased
+}
@@ -0,0 +1,163 @@
+package scenario
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+)
+
+/*
+Scenario Validation
+
+ParseScenario rejects scenarios that can't be loaded at all. ValidateScenario goes further
+and looks for mistakes that load fine but make rules misbehave at runtime: actions
+without a target or command, rules without an event type, compensation settings that
+are ignored, references to steps that don't exist and duplicated rules.
+
+Problems that stop a rule from working are errors; suspicious but harmless ones are
+warnings. The checks are static; whether the targets are connected and handle the
+commands is up to the caller, using the report's Targets.
+*/
+
+// ValidationIssue is one problem found by ValidateScenario
+// Rule and Action are indexes into the scenario's rules and the rule's actions (-1 = not
+// tied to one).
+type ValidationIssue struct {
+	Rule    int
+	Action  int
+	Message string
+}
+
+// ValidationTarget is a simulation the scenario sends commands to, with the commands
+// (forward and compensating) it would be sent
+type ValidationTarget struct {
+	ID                 string
+	Commands           []string
+	CompensateCommands []string
+}
+
+// ValidationReport is the result of ValidateScenario
+type ValidationReport struct {
+	Targets  []ValidationTarget // Sorted by ID; groups are expanded into their listed members (capability selectors are only resolved when a Saga is created)
+	Errors   []ValidationIssue
+	Warnings []ValidationIssue
+}
+
+func (r *ValidationReport) addError(rule, action int, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, ValidationIssue{Rule: rule, Action: action, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ValidationReport) addWarning(rule, action int, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, ValidationIssue{Rule: rule, Action: action, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateScenario checks a parsed scenario for rules that would misbehave at runtime
+// The scenario is not modified or activated.
+func ValidateScenario(scenario *models.Scenario) *ValidationReport {
+	report := &ValidationReport{
+		Errors:   make([]ValidationIssue, 0),
+		Warnings: make([]ValidationIssue, 0),
+	}
+	targets := make(map[string]*ValidationTarget)
+
+	if len(scenario.Rules) == 0 {
+		report.addWarning(-1, -1, "scenario has no rules")
+	}
+	groupNames := make([]string, 0, len(scenario.Groups))
+	for name := range scenario.Groups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	for _, name := range groupNames {
+		if len(scenario.Groups[name]) == 0 {
+			report.addWarning(-1, -1, "group %s has no members; actions sent to it are skipped", name)
+		}
+		for _, member := range scenario.Groups[name] {
+			if capability, isSelector := capabilitySelector(member); isSelector && capability == "" {
+				report.addError(-1, -1, "group %s has a capability selector without a capability", name)
+			}
+		}
+	}
+
+	for i, rule := range scenario.Rules {
+		if rule.When.EventType == "" && rule.When.Join == nil {
+			report.addError(i, -1, "rule has no when.event_type")
+		}
+		if len(rule.Then) == 0 {
+			report.addWarning(i, -1, "rule has no actions")
+		}
+		for j := 0; j < i; j++ {
+			if reflect.DeepEqual(rule, scenario.Rules[j]) {
+				report.addWarning(i, -1, "rule duplicates rule %d; every matching event starts both", j)
+				break
+			}
+		}
+
+		for a, action := range rule.Then {
+			if action.SendTo == "" {
+				report.addError(i, a, "action has no send_to")
+			}
+			if action.Command == "" {
+				if action.CompensateCommand != "" {
+					report.addError(i, a, "action has compensate_command %s but no command to compensate", action.CompensateCommand)
+				} else {
+					report.addError(i, a, "action has no command")
+				}
+			}
+			if action.CompensateCommand == "" && len(action.CompensateParams) > 0 {
+				report.addWarning(i, a, "compensate_params are ignored without compensate_command, unless the target has a default_compensate_command")
+			}
+			if action.CompensateCommand == "" && action.CompensateOnPartial {
+				report.addWarning(i, a, "compensate_on_partial is ignored without compensate_command, unless the target has a default_compensate_command")
+			}
+			if action.CompensateCommand != "" && action.CompensateCommand == action.Command {
+				report.addWarning(i, a, "compensate_command is the same as command %s", action.Command)
+			}
+			for _, dep := range action.CompensateAfter {
+				if dep < 0 || dep >= len(rule.Then) {
+					report.addWarning(i, a, "compensate_after references unknown action %d, ignored", dep)
+				}
+			}
+
+			if action.SendTo == "" {
+				continue
+			}
+			members, isGroup := scenario.Groups[action.SendTo]
+			if !isGroup {
+				members = []string{action.SendTo}
+			}
+			for _, member := range members {
+				if _, isSelector := capabilitySelector(member); isSelector {
+					continue
+				}
+				target, exists := targets[member]
+				if !exists {
+					target = &ValidationTarget{ID: member, Commands: make([]string, 0)}
+					targets[member] = target
+				}
+				target.Commands = appendUnique(target.Commands, action.Command)
+				target.CompensateCommands = appendUnique(target.CompensateCommands, action.CompensateCommand)
+			}
+		}
+	}
+
+	report.Targets = make([]ValidationTarget, 0, len(targets))
+	for _, target := range targets {
+		report.Targets = append(report.Targets, *target)
+	}
+	sort.Slice(report.Targets, func(i, j int) bool {
+		return report.Targets[i].ID < report.Targets[j].ID
+	})
+	return report
+}
+
+// appendUnique appends value to list unless it is empty or already present
+func appendUnique(list []string, value string) []string {
+	if value == "" || slices.Contains(list, value) {
+		return list
+	}
+	return append(list, value)
+}
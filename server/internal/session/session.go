@@ -0,0 +1,147 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Reconnect Sessions
+
+Each registration is issued a reconnect token. A simulation that loses its connection
+can present the token in its next register message to resume its session instead of
+starting fresh. Resuming keeps the simulation's place in any in-flight Saga steps
+(their commands are re-sent on the new connection).
+
+A session stays resumable while connected and for the configured window after it
+disconnects. Tokens are bound to the registry key (tenant + simulation ID) they were
+issued for, and a token is single-use: resuming issues a new one.
+*/
+
+// Session is the resumable state of one simulation registration
+type Session struct {
+	Token          string
+	SimKey         string    // Registry key the session belongs to
+	Connected      bool      // Whether a connection currently holds the session
+	DisconnectedAt time.Time // When the session was last detached (zero while connected)
+}
+
+// Manager issues and validates reconnect tokens
+type Manager struct {
+	sessions map[string]*Session // token -> session
+	bySimKey map[string]string   // simKey -> current token
+	ttl      atomic.Int64        // time.Duration; atomic so it can be changed at runtime
+	mu       sync.Mutex
+}
+
+// NewManager creates a session manager whose sessions stay resumable for ttl after
+// disconnecting. A ttl of 0 disables reconnect tokens.
+func NewManager(ttl time.Duration) *Manager {
+	m := &Manager{
+		sessions: make(map[string]*Session),
+		bySimKey: make(map[string]string),
+	}
+	m.SetTTL(ttl)
+	return m
+}
+
+// SetTTL changes how long disconnected sessions stay resumable
+// Applies to existing sessions as well as new ones. A ttl of 0 stops issuing tokens.
+func (m *Manager) SetTTL(ttl time.Duration) {
+	m.ttl.Store(int64(ttl))
+}
+
+// TTL returns how long disconnected sessions stay resumable (0 = tokens disabled)
+func (m *Manager) TTL() time.Duration {
+	return time.Duration(m.ttl.Load())
+}
+
+// Enabled reports whether reconnect tokens are issued
+func (m *Manager) Enabled() bool {
+	return m.ttl.Load() > 0
+}
+
+// Issue starts a new session for simKey and returns its token
+// Any previous session for simKey is discarded. Returns "" if tokens are disabled.
+func (m *Manager) Issue(simKey string) (string, error) {
+	if !m.Enabled() {
+		return "", nil
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneExpired()
+	if old, exists := m.bySimKey[simKey]; exists {
+		delete(m.sessions, old)
+	}
+	m.sessions[token] = &Session{
+		Token:     token,
+		SimKey:    simKey,
+		Connected: true,
+	}
+	m.bySimKey[simKey] = token
+	return token, nil
+}
+
+// Resume validates token for simKey and, if it is still resumable, consumes it
+// Returns false if the token is unknown, expired, or was issued for another simulation.
+// The caller should Issue a new token for the resumed connection.
+func (m *Manager) Resume(token, simKey string) bool {
+	if !m.Enabled() || token == "" {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneExpired()
+	session, exists := m.sessions[token]
+	if !exists || session.SimKey != simKey {
+		return false
+	}
+
+	delete(m.sessions, token)
+	delete(m.bySimKey, simKey)
+	return true
+}
+
+// Detach marks the session for token as disconnected, starting its expiry window
+// Does nothing if the session has been replaced by a newer registration.
+func (m *Manager) Detach(token string) {
+	if token == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, exists := m.sessions[token]; exists {
+		session.Connected = false
+		session.DisconnectedAt = time.Now()
+	}
+}
+
+// pruneExpired removes disconnected sessions whose window has passed
+// Caller must hold m.mu
+func (m *Manager) pruneExpired() {
+	now := time.Now()
+	ttl := time.Duration(m.ttl.Load())
+	for token, session := range m.sessions {
+		if !session.Connected && now.Sub(session.DisconnectedAt) > ttl {
+			delete(m.sessions, token)
+			if m.bySimKey[session.SimKey] == token {
+				delete(m.bySimKey, session.SimKey)
+			}
+		}
+	}
+}
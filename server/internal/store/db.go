@@ -0,0 +1,58 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// openDatabase opens and pings the database named by connectionString
+// Returns the database, its type ("sqlite" or "postgres") and the driver name.
+func openDatabase(connectionString string) (*sql.DB, string, string, error) {
+	var dbType, driverName string
+
+	// Detect database type from connection string
+	if strings.HasPrefix(connectionString, "postgres://") || strings.HasPrefix(connectionString, "postgresql://") {
+		// PostgreSQL connection
+		dbType = "postgres"
+		driverName = "postgres"
+	} else {
+		// SQLite connection (file path)
+		dbType = "sqlite"
+		driverName = "sqlite"
+	}
+
+	db, err := sql.Open(driverName, connectionString)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Test the connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, "", "", fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, dbType, driverName, nil
+}
+
+// rebind rewrites ? placeholders to PostgreSQL's $1, $2, ... form
+// SQLite queries are returned unchanged.
+func rebind(dbType, query string) string {
+	if dbType != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
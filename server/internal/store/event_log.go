@@ -0,0 +1,177 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+/*
+Event Log
+
+The event log is an append-only audit trail in the event_log table: one row for every
+event received from a simulation and one for every command dispatched to one as part
+of a Saga (forward steps, compensations and steps re-sent to a resumed simulation).
+Rows are never updated, so the table records what was exchanged, in order, while the
+Saga tables only hold each Saga's latest state.
+
+Timestamps are stored as fixed-width RFC 3339 UTC text, so they compare correctly as
+strings in both databases.
+*/
+
+// Event log entry kinds
+const (
+	EventLogKindEvent   = "event"
+	EventLogKindCommand = "command"
+)
+
+// eventLogTimeFormat is RFC 3339 with a fixed number of fractional digits
+const eventLogTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// EventLog handles database operations for the event audit trail
+type EventLog struct {
+	db         *sql.DB
+	dbType     string // "sqlite" or "postgres"
+	driverName string
+}
+
+// EventLogEntry represents one logged event or command
+// Events set Source, EventType and Payload; commands set SagaID, StepID, Target,
+// Command and Payload (the command's params).
+type EventLogEntry struct {
+	ID        int64
+	Kind      string // EventLogKindEvent or EventLogKindCommand
+	Tenant    string
+	Source    string
+	EventType string
+	SagaID    string
+	StepID    *int
+	Target    string
+	Command   string
+	Payload   map[string]interface{}
+	Timestamp time.Time
+}
+
+// EventLogFilter selects event log entries; empty fields match everything
+type EventLogFilter struct {
+	SagaID string    // Commands dispatched for this Saga
+	Tenant string    // Entries of this tenant
+	Source string    // Events sent by, or commands sent to, this simulation ID
+	Since  time.Time // Entries logged at or after this time
+}
+
+// NewEventLog creates a new event log in the database named by connectionString
+// (see NewScenarioStore for the accepted forms)
+func NewEventLog(connectionString string) (*EventLog, error) {
+	db, dbType, driverName, err := openDatabase(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	if dbType == "sqlite" {
+		// Every event and command is written; as with the Saga store, queue writes
+		// on a single connection and wait for writers from other connections
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec(`PRAGMA busy_timeout = 5000`); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to configure database: %w", err)
+		}
+	}
+
+	eventLog := &EventLog{
+		db:         db,
+		dbType:     dbType,
+		driverName: driverName,
+	}
+
+	// Bring the schema up to date (see migrations.go)
+	if err := migrate(db, dbType); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	return eventLog, nil
+}
+
+// Append writes one entry to the event log (its ID is assigned by the database)
+func (l *EventLog) Append(entry EventLogEntry) error {
+	payload, err := json.Marshal(nonNilMap(entry.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to encode %s payload: %w", entry.Kind, err)
+	}
+
+	var stepID sql.NullInt64
+	if entry.StepID != nil {
+		stepID = sql.NullInt64{Int64: int64(*entry.StepID), Valid: true}
+	}
+
+	_, err = l.db.Exec(rebind(l.dbType, `
+		INSERT INTO event_log (kind, tenant, source, event_type, saga_id, step_id, target, command, payload, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		entry.Kind, entry.Tenant, entry.Source, entry.EventType, entry.SagaID, stepID, entry.Target, entry.Command,
+		string(payload), entry.Timestamp.UTC().Format(eventLogTimeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log %s: %w", entry.Kind, err)
+	}
+	return nil
+}
+
+// Query returns the entries matching filter, oldest first
+func (l *EventLog) Query(filter EventLogFilter) ([]EventLogEntry, error) {
+	query := `
+		SELECT id, kind, tenant, source, event_type, saga_id, step_id, target, command, payload, created_at
+		FROM event_log WHERE 1 = 1`
+	var args []interface{}
+	if filter.SagaID != "" {
+		query += ` AND saga_id = ?`
+		args = append(args, filter.SagaID)
+	}
+	if filter.Tenant != "" {
+		query += ` AND tenant = ?`
+		args = append(args, filter.Tenant)
+	}
+	if filter.Source != "" {
+		query += ` AND (source = ? OR target = ?)`
+		args = append(args, filter.Source, filter.Source)
+	}
+	if !filter.Since.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, filter.Since.UTC().Format(eventLogTimeFormat))
+	}
+	query += ` ORDER BY id ASC`
+
+	rows, err := l.db.Query(rebind(l.dbType, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]EventLogEntry, 0)
+	for rows.Next() {
+		var entry EventLogEntry
+		var stepID sql.NullInt64
+		var payload, createdAt string
+		if err := rows.Scan(&entry.ID, &entry.Kind, &entry.Tenant, &entry.Source, &entry.EventType, &entry.SagaID,
+			&stepID, &entry.Target, &entry.Command, &payload, &createdAt); err != nil {
+			return nil, err
+		}
+		if stepID.Valid {
+			step := int(stepID.Int64)
+			entry.StepID = &step
+		}
+		if err := json.Unmarshal([]byte(payload), &entry.Payload); err != nil {
+			return nil, fmt.Errorf("event log entry %d: invalid payload: %w", entry.ID, err)
+		}
+		entry.Timestamp = parseTime(createdAt)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Close closes the database connection
+func (l *EventLog) Close() error {
+	return l.db.Close()
+}
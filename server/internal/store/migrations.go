@@ -0,0 +1,258 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+/*
+Schema Migrations
+
+The schema is built by an ordered list of numbered migrations, each with a SQLite
+and a PostgreSQL variant. The schema_migrations table records which versions have
+been applied; on startup every migration not recorded there is applied, in order,
+together with its record in one transaction. A migration runs once per database, so
+a schema change is always a new migration appended to the list, never an edit to an
+existing one.
+
+Databases created before migrations were versioned already have some of the tables
+(and possibly columns) without any schema_migrations rows. The baseline migrations
+(1 and 2) therefore use IF NOT EXISTS, and a later migration may declare a check for
+whether its change is already present; such a migration is then only recorded.
+*/
+
+// migration is one versioned schema change
+type migration struct {
+	version     int
+	description string
+	sqlite      []string
+	postgres    []string
+
+	// present reports whether a database created before versioning already has this
+	// change (nil = never)
+	present func(tx *sql.Tx, dbType string) (bool, error)
+}
+
+// migrations lists every schema change in the order it is applied
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create scenarios table",
+		sqlite: []string{
+			`CREATE TABLE IF NOT EXISTS scenarios (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				yaml_content TEXT NOT NULL,
+				created_at TEXT DEFAULT (datetime('now'))
+			)`,
+		},
+		postgres: []string{
+			`CREATE TABLE IF NOT EXISTS scenarios (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL,
+				yaml_content TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+	},
+	{
+		// Timestamps are stored as RFC 3339 text in both databases
+		version:     2,
+		description: "create sagas and saga_steps tables",
+		sqlite:      sagaTables,
+		postgres:    sagaTables,
+	},
+	{
+		version:     3,
+		description: "add saga_steps.parallel_group",
+		sqlite:      []string{`ALTER TABLE saga_steps ADD COLUMN parallel_group INTEGER NOT NULL DEFAULT 0`},
+		postgres:    []string{`ALTER TABLE saga_steps ADD COLUMN parallel_group INTEGER NOT NULL DEFAULT 0`},
+		present: func(tx *sql.Tx, dbType string) (bool, error) {
+			return columnExists(tx, dbType, "saga_steps", "parallel_group")
+		},
+	},
+	{
+		version:     4,
+		description: "add saga_steps.compensate_on_partial",
+		sqlite:      []string{`ALTER TABLE saga_steps ADD COLUMN compensate_on_partial BOOLEAN NOT NULL DEFAULT FALSE`},
+		postgres:    []string{`ALTER TABLE saga_steps ADD COLUMN compensate_on_partial BOOLEAN NOT NULL DEFAULT FALSE`},
+	},
+	{
+		version:     5,
+		description: "add sagas.timeout_ms",
+		sqlite:      []string{`ALTER TABLE sagas ADD COLUMN timeout_ms BIGINT NOT NULL DEFAULT 0`},
+		postgres:    []string{`ALTER TABLE sagas ADD COLUMN timeout_ms BIGINT NOT NULL DEFAULT 0`},
+	},
+	{
+		version:     6,
+		description: "create event_log table",
+		sqlite:      eventLogTable("id INTEGER PRIMARY KEY AUTOINCREMENT"),
+		postgres:    eventLogTable("id BIGSERIAL PRIMARY KEY"),
+	},
+	{
+		version:     7,
+		description: "add saga_steps.conditions",
+		sqlite:      []string{`ALTER TABLE saga_steps ADD COLUMN conditions TEXT NOT NULL DEFAULT '[]'`},
+		postgres:    []string{`ALTER TABLE saga_steps ADD COLUMN conditions TEXT NOT NULL DEFAULT '[]'`},
+	},
+}
+
+// eventLogTable is the event log schema, given each database's auto-incrementing key
+func eventLogTable(idColumn string) []string {
+	return []string{
+		`CREATE TABLE event_log (
+			` + idColumn + `,
+			kind TEXT NOT NULL,
+			tenant TEXT NOT NULL DEFAULT '',
+			source TEXT NOT NULL DEFAULT '',
+			event_type TEXT NOT NULL DEFAULT '',
+			saga_id TEXT NOT NULL DEFAULT '',
+			step_id INTEGER,
+			target TEXT NOT NULL DEFAULT '',
+			command TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL DEFAULT '{}',
+			created_at TEXT NOT NULL
+		)`,
+		`CREATE INDEX event_log_saga_id ON event_log (saga_id)`,
+		`CREATE INDEX event_log_created_at ON event_log (created_at)`,
+	}
+}
+
+// sagaTables is the Saga schema as first created (the same in both databases)
+var sagaTables = []string{
+	`CREATE TABLE IF NOT EXISTS sagas (
+		saga_id TEXT PRIMARY KEY,
+		tenant TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		current_step INTEGER NOT NULL,
+		replay_of TEXT NOT NULL DEFAULT '',
+		failure_reasons TEXT NOT NULL DEFAULT '[]',
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS saga_steps (
+		saga_id TEXT NOT NULL,
+		step_id INTEGER NOT NULL,
+		target_simulation TEXT NOT NULL,
+		command TEXT NOT NULL,
+		compensate_command TEXT NOT NULL DEFAULT '',
+		params TEXT NOT NULL DEFAULT '{}',
+		compensate_params TEXT NOT NULL DEFAULT '{}',
+		compensate_after TEXT NOT NULL DEFAULT '[]',
+		status TEXT NOT NULL,
+		breakpoint BOOLEAN NOT NULL DEFAULT FALSE,
+		timeout_ms BIGINT NOT NULL DEFAULT 0,
+		result TEXT,
+		result_discarded BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TEXT NOT NULL,
+		completed_at TEXT,
+		PRIMARY KEY (saga_id, step_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS sagas_status ON sagas (status)`,
+}
+
+// migrate applies the migrations not yet recorded in schema_migrations
+// Safe to call on every start, and from every store sharing the database.
+func migrate(db *sql.DB, dbType string) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := applyMigration(db, dbType, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+// appliedVersions returns the versions recorded in schema_migrations
+func appliedVersions(db *sql.DB) (map[int]bool, error) {
+	rows, err := db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration runs one migration and records it, in a single transaction
+func applyMigration(db *sql.DB, dbType string, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	present := false
+	if m.present != nil {
+		if present, err = m.present(tx, dbType); err != nil {
+			return err
+		}
+	}
+
+	if !present {
+		statements := m.sqlite
+		if dbType == "postgres" {
+			statements = m.postgres
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(rebind(dbType, `INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)`),
+		m.version, m.description, formatTime(time.Now())); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if present {
+		log.Printf("Schema migration %d (%s) already present, recorded", m.version, m.description)
+	} else {
+		log.Printf("Applied schema migration %d (%s)", m.version, m.description)
+	}
+	return nil
+}
+
+// columnExists reports whether table has the named column
+func columnExists(tx *sql.Tx, dbType, table, column string) (bool, error) {
+	query := `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+	if dbType == "postgres" {
+		query = `SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2`
+	}
+
+	var count int
+	if err := tx.QueryRow(query, table, column).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
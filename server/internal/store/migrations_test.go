@@ -0,0 +1,150 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB opens a new, empty SQLite database
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, _, _, err := openDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("openDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// migrationRecords returns the applied_at of every recorded migration, by version
+func migrationRecords(t *testing.T, db *sql.DB) map[int]string {
+	t.Helper()
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		t.Fatalf("read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	records := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			t.Fatal(err)
+		}
+		records[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// assertMigrated checks that every migration is recorded and that the columns and
+// tables added by later migrations exist
+func assertMigrated(t *testing.T, db *sql.DB) map[int]string {
+	t.Helper()
+	records := migrationRecords(t, db)
+	if len(records) != len(migrations) {
+		t.Fatalf("%d migrations recorded, want %d", len(records), len(migrations))
+	}
+	for _, m := range migrations {
+		if _, ok := records[m.version]; !ok {
+			t.Fatalf("migration %d (%s) not recorded", m.version, m.description)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, c := range []struct{ table, column string }{
+		{"saga_steps", "parallel_group"},
+		{"saga_steps", "compensate_on_partial"},
+		{"saga_steps", "conditions"},
+		{"sagas", "timeout_ms"},
+		{"event_log", "kind"},
+	} {
+		exists, err := columnExists(tx, "sqlite", c.table, c.column)
+		if err != nil {
+			t.Fatalf("columnExists(%s.%s): %v", c.table, c.column, err)
+		}
+		if !exists {
+			t.Fatalf("column %s.%s missing after migrating", c.table, c.column)
+		}
+	}
+	return records
+}
+
+// assertNoOp checks that migrating again changes nothing
+func assertNoOp(t *testing.T, db *sql.DB, before map[int]string) {
+	t.Helper()
+	if err := migrate(db, "sqlite"); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	after := migrationRecords(t, db)
+	if len(after) != len(before) {
+		t.Fatalf("%d migrations recorded after migrating again, want %d", len(after), len(before))
+	}
+	for version, appliedAt := range before {
+		if after[version] != appliedAt {
+			t.Fatalf("migration %d re-applied by a second migrate", version)
+		}
+	}
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := migrate(db, "sqlite"); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	records := assertMigrated(t, db)
+	assertNoOp(t, db, records)
+}
+
+func TestMigratePreVersioningDatabase(t *testing.T) {
+	db := openTestDB(t)
+
+	// The schema as created before migrations were versioned: the baseline tables,
+	// already including parallel_group, and no schema_migrations table
+	for _, statement := range append(append([]string{}, migrations[0].sqlite...), sagaTables...) {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("create old schema: %v", err)
+		}
+	}
+	if _, err := db.Exec(`ALTER TABLE saga_steps ADD COLUMN parallel_group INTEGER NOT NULL DEFAULT 0`); err != nil {
+		t.Fatalf("add parallel_group: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO scenarios (name, yaml_content) VALUES ('existing', 'rules: []')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO saga_steps (saga_id, step_id, target_simulation, command, status, created_at, parallel_group)
+		VALUES ('saga_1', 0, 'sim', 'start', 'completed', '2024-01-01T00:00:00Z', 2)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// parallel_group is already there, so migration 3 must be recorded, not re-run
+	// (adding the column again would fail)
+	if err := migrate(db, "sqlite"); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	records := assertMigrated(t, db)
+
+	var name string
+	if err := db.QueryRow(`SELECT name FROM scenarios`).Scan(&name); err != nil || name != "existing" {
+		t.Fatalf("existing scenario = %q, %v after migrating", name, err)
+	}
+	var group int
+	var conditions string
+	if err := db.QueryRow(`SELECT parallel_group, conditions FROM saga_steps WHERE saga_id = 'saga_1'`).Scan(&group, &conditions); err != nil {
+		t.Fatal(err)
+	}
+	if group != 2 || conditions != "[]" {
+		t.Fatalf("existing step has parallel_group %d, conditions %q; want 2, []", group, conditions)
+	}
+
+	assertNoOp(t, db, records)
+}
@@ -0,0 +1,369 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrSagaNotFound is returned when no stored Saga has the requested ID
+var ErrSagaNotFound = errors.New("saga not found")
+
+// SagaStore handles database operations for Sagas
+// Each Saga is one row in sagas and one row per step in saga_steps. Rows are
+// upserted on every state transition, so the tables always hold each Saga's latest state.
+type SagaStore struct {
+	db         *sql.DB
+	dbType     string // "sqlite" or "postgres"
+	driverName string
+}
+
+// StoredSaga represents a Saga stored in the database
+type StoredSaga struct {
+	SagaID         string
+	Tenant         string
+	Status         string
+	CurrentStep    int
+	ReplayOf       string
+	Timeout        time.Duration
+	FailureReasons []string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Steps          []StoredSagaStep
+}
+
+// StoredSagaStep represents a Saga step stored in the database
+type StoredSagaStep struct {
+	StepID              int
+	TargetSimulation    string
+	Command             string
+	CompensateCommand   string
+	Params              map[string]interface{}
+	CompensateParams    map[string]interface{}
+	CompensateAfter     []int
+	CompensateOnPartial bool
+	Status              string
+	Breakpoint          bool
+	Timeout             time.Duration
+	ParallelGroup       int
+	Condition           []StoredCondition
+	Result              map[string]interface{}
+	ResultDiscarded     bool
+	CreatedAt           time.Time
+	CompletedAt         *time.Time
+}
+
+// StoredCondition represents one condition of a stored Saga step
+type StoredCondition struct {
+	Key   string      `json:"key"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// NewSagaStore creates a new Saga store in the database named by connectionString
+// (see NewScenarioStore for the accepted forms)
+func NewSagaStore(connectionString string) (*SagaStore, error) {
+	db, dbType, driverName, err := openDatabase(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	if dbType == "sqlite" {
+		// Sagas are written on every step transition; use a single connection so
+		// writes queue up instead of failing with SQLITE_BUSY, and wait briefly
+		// for writers from other connections (e.g. the scenario store)
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec(`PRAGMA busy_timeout = 5000`); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to configure database: %w", err)
+		}
+	}
+
+	store := &SagaStore{
+		db:         db,
+		dbType:     dbType,
+		driverName: driverName,
+	}
+
+	// Bring the schema up to date (see migrations.go)
+	if err := migrate(db, dbType); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	return store, nil
+}
+
+// SaveSaga writes a Saga and all of its steps, replacing any previously saved state
+func (s *SagaStore) SaveSaga(saga StoredSaga) error {
+	failureReasons, err := json.Marshal(nonNilStrings(saga.FailureReasons))
+	if err != nil {
+		return fmt.Errorf("failed to encode failure reasons: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(rebind(s.dbType, `
+		INSERT INTO sagas (saga_id, tenant, status, current_step, replay_of, timeout_ms, failure_reasons, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (saga_id) DO UPDATE SET
+			status = excluded.status,
+			current_step = excluded.current_step,
+			failure_reasons = excluded.failure_reasons,
+			updated_at = excluded.updated_at`),
+		saga.SagaID, saga.Tenant, saga.Status, saga.CurrentStep, saga.ReplayOf, saga.Timeout.Milliseconds(), string(failureReasons),
+		formatTime(saga.CreatedAt), formatTime(saga.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save saga %s: %w", saga.SagaID, err)
+	}
+
+	stepQuery := rebind(s.dbType, `
+		INSERT INTO saga_steps (saga_id, step_id, target_simulation, command, compensate_command, params,
+			compensate_params, compensate_after, compensate_on_partial, status, breakpoint, timeout_ms,
+			parallel_group, conditions, result, result_discarded, created_at, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (saga_id, step_id) DO UPDATE SET
+			status = excluded.status,
+			result = excluded.result,
+			result_discarded = excluded.result_discarded,
+			completed_at = excluded.completed_at`)
+
+	for _, step := range saga.Steps {
+		params, err := json.Marshal(nonNilMap(step.Params))
+		if err != nil {
+			return fmt.Errorf("failed to encode saga %s step %d params: %w", saga.SagaID, step.StepID, err)
+		}
+		compensateParams, err := json.Marshal(nonNilMap(step.CompensateParams))
+		if err != nil {
+			return fmt.Errorf("failed to encode saga %s step %d compensate params: %w", saga.SagaID, step.StepID, err)
+		}
+		compensateAfter, err := json.Marshal(nonNilInts(step.CompensateAfter))
+		if err != nil {
+			return fmt.Errorf("failed to encode saga %s step %d compensate_after: %w", saga.SagaID, step.StepID, err)
+		}
+		conditions, err := json.Marshal(nonNilConditions(step.Condition))
+		if err != nil {
+			return fmt.Errorf("failed to encode saga %s step %d conditions: %w", saga.SagaID, step.StepID, err)
+		}
+
+		var result, completedAt sql.NullString
+		if step.Result != nil {
+			encoded, err := json.Marshal(step.Result)
+			if err != nil {
+				return fmt.Errorf("failed to encode saga %s step %d result: %w", saga.SagaID, step.StepID, err)
+			}
+			result = sql.NullString{String: string(encoded), Valid: true}
+		}
+		if step.CompletedAt != nil {
+			completedAt = sql.NullString{String: formatTime(*step.CompletedAt), Valid: true}
+		}
+
+		_, err = tx.Exec(stepQuery,
+			saga.SagaID, step.StepID, step.TargetSimulation, step.Command, step.CompensateCommand,
+			string(params), string(compensateParams), string(compensateAfter), step.CompensateOnPartial, step.Status,
+			step.Breakpoint, step.Timeout.Milliseconds(), step.ParallelGroup, string(conditions), result, step.ResultDiscarded,
+			formatTime(step.CreatedAt), completedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save saga %s step %d: %w", saga.SagaID, step.StepID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetSagasByStatus returns all Sagas (with their steps) in any of the given statuses,
+// oldest first
+func (s *SagaStore) GetSagasByStatus(statuses ...string) ([]StoredSaga, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ")
+	args := make([]interface{}, len(statuses))
+	for i, status := range statuses {
+		args[i] = status
+	}
+
+	rows, err := s.db.Query(rebind(s.dbType, `
+		SELECT saga_id, tenant, status, current_step, replay_of, timeout_ms, failure_reasons, created_at, updated_at
+		FROM sagas WHERE status IN (`+placeholders+`) ORDER BY created_at ASC, saga_id ASC`), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var sagas []StoredSaga
+	for rows.Next() {
+		saga, err := scanSaga(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sagas = append(sagas, saga)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Load steps after closing the saga rows (SQLite uses a single connection)
+	for i := range sagas {
+		steps, err := s.getSteps(sagas[i].SagaID)
+		if err != nil {
+			return nil, err
+		}
+		sagas[i].Steps = steps
+	}
+
+	return sagas, nil
+}
+
+// GetSaga returns the stored Saga (with its steps) with the given ID, whatever its status
+// Returns ErrSagaNotFound if no Saga with that ID is stored.
+func (s *SagaStore) GetSaga(sagaID string) (*StoredSaga, error) {
+	row := s.db.QueryRow(rebind(s.dbType, `
+		SELECT saga_id, tenant, status, current_step, replay_of, timeout_ms, failure_reasons, created_at, updated_at
+		FROM sagas WHERE saga_id = ?`), sagaID)
+	saga, err := scanSaga(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSagaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if saga.Steps, err = s.getSteps(sagaID); err != nil {
+		return nil, err
+	}
+	return &saga, nil
+}
+
+// scanSaga reads a sagas row (without its steps)
+func scanSaga(row interface{ Scan(...interface{}) error }) (StoredSaga, error) {
+	var saga StoredSaga
+	var failureReasons, createdAt, updatedAt string
+	var timeoutMs int64
+	if err := row.Scan(&saga.SagaID, &saga.Tenant, &saga.Status, &saga.CurrentStep, &saga.ReplayOf, &timeoutMs,
+		&failureReasons, &createdAt, &updatedAt); err != nil {
+		return StoredSaga{}, err
+	}
+	saga.Timeout = time.Duration(timeoutMs) * time.Millisecond
+	if err := json.Unmarshal([]byte(failureReasons), &saga.FailureReasons); err != nil {
+		return StoredSaga{}, fmt.Errorf("saga %s: invalid failure reasons: %w", saga.SagaID, err)
+	}
+	saga.CreatedAt = parseTime(createdAt)
+	saga.UpdatedAt = parseTime(updatedAt)
+	return saga, nil
+}
+
+// getSteps returns a Saga's steps in step order
+func (s *SagaStore) getSteps(sagaID string) ([]StoredSagaStep, error) {
+	rows, err := s.db.Query(rebind(s.dbType, `
+		SELECT step_id, target_simulation, command, compensate_command, params, compensate_params,
+			compensate_after, compensate_on_partial, status, breakpoint, timeout_ms, parallel_group, conditions,
+			result, result_discarded, created_at, completed_at
+		FROM saga_steps WHERE saga_id = ? ORDER BY step_id ASC`), sagaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []StoredSagaStep
+	for rows.Next() {
+		var step StoredSagaStep
+		var params, compensateParams, compensateAfter, conditions, createdAt string
+		var result, completedAt sql.NullString
+		var timeoutMs int64
+		if err := rows.Scan(&step.StepID, &step.TargetSimulation, &step.Command, &step.CompensateCommand,
+			&params, &compensateParams, &compensateAfter, &step.CompensateOnPartial, &step.Status, &step.Breakpoint, &timeoutMs,
+			&step.ParallelGroup, &conditions, &result, &step.ResultDiscarded, &createdAt, &completedAt); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(params), &step.Params); err != nil {
+			return nil, fmt.Errorf("saga %s step %d: invalid params: %w", sagaID, step.StepID, err)
+		}
+		if err := json.Unmarshal([]byte(compensateParams), &step.CompensateParams); err != nil {
+			return nil, fmt.Errorf("saga %s step %d: invalid compensate params: %w", sagaID, step.StepID, err)
+		}
+		if err := json.Unmarshal([]byte(compensateAfter), &step.CompensateAfter); err != nil {
+			return nil, fmt.Errorf("saga %s step %d: invalid compensate_after: %w", sagaID, step.StepID, err)
+		}
+		if err := json.Unmarshal([]byte(conditions), &step.Condition); err != nil {
+			return nil, fmt.Errorf("saga %s step %d: invalid conditions: %w", sagaID, step.StepID, err)
+		}
+		if result.Valid {
+			if err := json.Unmarshal([]byte(result.String), &step.Result); err != nil {
+				return nil, fmt.Errorf("saga %s step %d: invalid result: %w", sagaID, step.StepID, err)
+			}
+		}
+		step.Timeout = time.Duration(timeoutMs) * time.Millisecond
+		step.CreatedAt = parseTime(createdAt)
+		if completedAt.Valid {
+			t := parseTime(completedAt.String)
+			step.CompletedAt = &t
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, rows.Err()
+}
+
+// Close closes the database connection
+func (s *SagaStore) Close() error {
+	return s.db.Close()
+}
+
+// formatTime encodes a timestamp for storage
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseTime decodes a stored timestamp (zero time if it can't be parsed)
+func parseTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// nonNilMap returns m, or an empty map if m is nil, so it encodes as {} rather than null
+func nonNilMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
+
+// nonNilInts returns v, or an empty slice if v is nil, so it encodes as [] rather than null
+func nonNilInts(v []int) []int {
+	if v == nil {
+		return []int{}
+	}
+	return v
+}
+
+// nonNilConditions returns v, or an empty slice if v is nil, so it encodes as [] rather than null
+func nonNilConditions(v []StoredCondition) []StoredCondition {
+	if v == nil {
+		return []StoredCondition{}
+	}
+	return v
+}
+
+// nonNilStrings returns v, or an empty slice if v is nil, so it encodes as [] rather than null
+func nonNilStrings(v []string) []string {
+	if v == nil {
+		return []string{}
+	}
+	return v
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// newTestScenarioStore opens a scenario store on a new SQLite database
+func newTestScenarioStore(t *testing.T) *ScenarioStore {
+	t.Helper()
+	ss, err := NewScenarioStore(filepath.Join(t.TempDir(), "scenarios.db"))
+	if err != nil {
+		t.Fatalf("NewScenarioStore: %v", err)
+	}
+	t.Cleanup(func() { ss.Close() })
+	return ss
+}
+
+func TestUpdateScenario(t *testing.T) {
+	ss := newTestScenarioStore(t)
+
+	id, err := ss.SaveScenario("first", "v1")
+	if err != nil {
+		t.Fatalf("SaveScenario: %v", err)
+	}
+	before, err := ss.GetScenarioByID(id)
+	if err != nil {
+		t.Fatalf("GetScenarioByID: %v", err)
+	}
+
+	if err := ss.UpdateScenario(id, "renamed", "v2"); err != nil {
+		t.Fatalf("UpdateScenario: %v", err)
+	}
+	after, err := ss.GetScenarioByID(id)
+	if err != nil {
+		t.Fatalf("GetScenarioByID after update: %v", err)
+	}
+	if after.ID != id || after.Name != "renamed" || after.YAMLContent != "v2" {
+		t.Fatalf("updated scenario = %+v, want ID %d, renamed, v2", after, id)
+	}
+	if !after.CreatedAt.Equal(before.CreatedAt) {
+		t.Fatalf("created_at changed from %v to %v", before.CreatedAt, after.CreatedAt)
+	}
+
+	// Updated in place, not saved as a new revision
+	all, err := ss.GetAllScenarios()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("%d scenarios stored after an update, want 1", len(all))
+	}
+}
+
+func TestUpdateScenarioNotFound(t *testing.T) {
+	ss := newTestScenarioStore(t)
+
+	if err := ss.UpdateScenario(42, "missing", "v1"); !errors.Is(err, ErrScenarioNotFound) {
+		t.Fatalf("err = %v, want ErrScenarioNotFound", err)
+	}
+}
+
+func TestUpdateScenarioNameTaken(t *testing.T) {
+	ss := newTestScenarioStore(t)
+	if err := ss.SetUniqueNames(true); err != nil {
+		t.Fatalf("SetUniqueNames: %v", err)
+	}
+
+	if _, err := ss.SaveScenario("taken", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := ss.SaveScenario("other", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ss.UpdateScenario(id, "taken", "v2"); !errors.Is(err, ErrScenarioNameTaken) {
+		t.Fatalf("err = %v, want ErrScenarioNameTaken", err)
+	}
+	s, err := ss.GetScenarioByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "other" || s.YAMLContent != "v1" {
+		t.Fatalf("refused update changed the scenario to %+v", s)
+	}
+
+	// Keeping its own name is not a conflict
+	if err := ss.UpdateScenario(id, "other", "v2"); err != nil {
+		t.Fatalf("update keeping the name: %v", err)
+	}
+
+	// Without unique names, any name may be reused
+	if err := ss.SetUniqueNames(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.UpdateScenario(id, "taken", "v3"); err != nil {
+		t.Fatalf("update to a used name without unique names: %v", err)
+	}
+}
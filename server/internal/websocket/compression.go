@@ -0,0 +1,30 @@
+package websocket
+
+import "github.com/gorilla/websocket"
+
+/*
+Compression
+
+With Config.Compression set, the server offers permessage-deflate (RFC 7692) to every
+connection, simulation or dashboard. Verbose JSON payloads compress well, which helps
+simulations on constrained links. Compression is only used if the client asks for it
+in its handshake; a client that doesn't gets an uncompressed connection, exactly as
+when compression is disabled. Once negotiated, the server compresses the messages it
+writes, and the client may compress the messages it sends.
+
+Compressing costs CPU on both ends, so it can be turned off if the server becomes
+CPU-bound.
+
+A compressed message can inflate to far more than its size on the wire, and the
+connection's read limit only counts wire bytes. To keep a small "deflate bomb" from
+getting around MaxMessageSize, messages are also cut off at MaxMessageSize bytes once
+decompressed (see readMessageData), and treated like any other oversized message.
+*/
+
+// enableCompression turns on write compression for a connection that negotiated
+// permessage-deflate
+// Does nothing if compression is disabled; for a connection that didn't negotiate it,
+// writes stay uncompressed.
+func enableCompression(conn *websocket.Conn, config Config) {
+	conn.EnableWriteCompression(config.Compression)
+}
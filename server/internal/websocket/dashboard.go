@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/auth"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/events"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+	"github.com/gorilla/websocket"
+)
+
+/*
+Dashboard Stream
+
+/ws/dashboard is a read-only WebSocket for dashboards. Each connection subscribes to the
+event hub and receives every event published from then on as one JSON text message
+({"type": ..., "time": ..., "data": ...}). Dashboard clients don't register and are not
+simulations: they are not in the registry, can't send events and don't receive commands.
+Anything they send is ignored.
+
+A dashboard that can't keep up is dropped by the hub; its socket is closed with a "try
+again later" close frame so it can reconnect and reload state from the REST API. The
+connection is kept alive with the same pings as simulations (see heartbeat.go).
+*/
+
+// dashboardWriteTimeout bounds each write to a dashboard client
+const dashboardWriteTimeout = 10 * time.Second
+
+// HandleDashboard serves the /ws/dashboard event stream
+// Bearer tokens are checked as for /ws; client certificates identify simulations and
+// are not required.
+func HandleDashboard(hub *events.Hub, logStore *logging.LogStore, config Config) http.HandlerFunc {
+	upgrader := newUpgrader(config)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed, bearerProtocol := config.Tokens.AllowWebSocket(r)
+		if !allowed {
+			logStore.LogAndStore("error", "Dashboard connection rejected: missing or invalid token from %s", r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var responseHeader http.Header
+		if bearerProtocol {
+			responseHeader = http.Header{"Sec-Websocket-Protocol": {auth.BearerSubprotocol}}
+		}
+
+		conn, err := upgrader.Upgrade(w, r, responseHeader)
+		if err != nil {
+			logStore.LogAndStore("error", "Dashboard WebSocket upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		setReadLimit(conn, config)
+		enableCompression(conn, config)
+
+		sub := hub.Subscribe()
+		defer sub.Close()
+		logStore.LogAndStore("info", "Dashboard connected from %s (%d dashboards)", r.RemoteAddr, hub.Count())
+
+		stopHeartbeat := startHeartbeat(conn, config)
+		defer stopHeartbeat()
+
+		// Read (and discard) client messages so pongs and the close handshake are processed
+		gone := make(chan struct{})
+		go func() {
+			defer close(gone)
+			for {
+				if _, err := readMessageData(conn, config.MaxMessageSize); err != nil {
+					return
+				}
+				extendReadDeadline(conn, config)
+			}
+		}()
+
+		for {
+			select {
+			case <-gone:
+				logStore.LogAndStore("info", "Dashboard disconnected from %s", r.RemoteAddr)
+				return
+			case event, ok := <-sub.C:
+				if !ok {
+					closeDashboard(conn, sub, logStore, r.RemoteAddr)
+					return
+				}
+				conn.SetWriteDeadline(time.Now().Add(dashboardWriteTimeout))
+				if err := conn.WriteJSON(event); err != nil {
+					logStore.LogAndStore("warning", "Dashboard %s dropped: %v", r.RemoteAddr, err)
+					return
+				}
+			}
+		}
+	}
+}
+
+// closeDashboard ends a dashboard connection whose subscription ended, telling the
+// client why
+func closeDashboard(conn *websocket.Conn, sub *events.Subscription, logStore *logging.LogStore, remoteAddr string) {
+	code, reason := websocket.CloseGoingAway, "server shutting down"
+	if sub.Dropped() {
+		code, reason = websocket.CloseTryAgainLater, "too slow, events were dropped"
+		logStore.LogAndStore("warning", "Dashboard %s dropped: it fell too far behind the event stream", remoteAddr)
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
@@ -1,47 +1,188 @@
 package websocket
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
 )
 
-// CreateEventHandler creates an event handler function that processes events and creates Sagas
+/*
+Ordering Model
+
+Every message that changes orchestration state goes through the event queue:
+- "event" messages, which may create Sagas
+- "step.completed" / "step.failed" messages, which advance or fail existing Sagas
+- "step.compensated" / "step.compensation_failed" messages, which resolve compensations
+
+The queue keeps one FIFO per simulation, processed by one worker at a time, so the
+messages of a simulation are applied in the order the server received them. Without
+this, a step report (handled directly on the connection goroutine) could overtake an
+earlier event from the same simulation that creates a conflicting Saga, and the
+outcome would depend on goroutine scheduling.
+
+Messages from different simulations are processed concurrently, so the handler may run
+on several goroutines at once; the scenario and Saga managers are safe for that, and
+Saga lock acquisition is atomic (see saga/locks.go).
+
+An event the queue abandons after the processing timeout has its context cancelled.
+The handler then gives up before matching it against the scenario, or while its Saga
+waits for a slot under the concurrent Saga limit, so an abandoned event doesn't go on
+to start a Saga after the simulation's later messages have been applied.
+*/
+
+// CreateEventHandler creates the queue processor function for simulation messages
+// It creates Sagas from events and advances Sagas from step reports, in each
+// simulation's queue order
 func CreateEventHandler(
 	scenarioManager *scenario.ScenarioManager,
 	sagaManager *saga.SagaManager,
 	logStore *logging.LogStore,
-) func(sourceID string, msg models.Message) {
-	return func(sourceID string, msg models.Message) {
-		// Create event
-		event := models.Event{
-			Type:      msg.Type,
-			EventType: msg.EventType,
-			Source:    sourceID,
-			Payload:   msg.Payload,
+	reg *registry.Registry,
+	config Config,
+) func(ctx context.Context, sourceID string, msg models.Message) {
+	return func(ctx context.Context, sourceID string, msg models.Message) {
+		switch msg.Type {
+		case "step.completed":
+			err := handleStepCompleted(sourceID, msg, sagaManager, logStore)
+			var terminal *saga.TerminalSagaError
+			if errors.As(err, &terminal) {
+				replySagaTerminal(reg, sourceID, terminal)
+			} else if err != nil && config.StrictMode {
+				replyStepRejected(reg, sourceID, msg, err)
+			}
+		case "step.failed":
+			if err := handleStepFailed(sourceID, msg, sagaManager, logStore); err != nil && config.StrictMode {
+				replyStepRejected(reg, sourceID, msg, err)
+			}
+		case "step.compensated", "step.compensation_failed":
+			if err := handleStepCompensationReport(sourceID, msg, sagaManager, logStore); err != nil && config.StrictMode {
+				replyStepRejected(reg, sourceID, msg, err)
+			}
+		default:
+			recordEvent(config.EventLog, logStore, sourceID, msg)
+			if config.Dedupe != nil && config.Dedupe.Seen(sourceID, msg.EventID) {
+				logStore.LogAndStoreCtx("info", "", sourceID, "Duplicate event from %s ignored: %s (event_id %s)", sourceID, msg.EventType, msg.EventID)
+				return
+			}
+			if err := handleEvent(ctx, sourceID, msg, scenarioManager, sagaManager, logStore, config.Unmatched); err != nil && config.Dedupe != nil {
+				// No Saga was started, so a retry of the event must not count as a duplicate
+				config.Dedupe.Forget(sourceID, msg.EventID)
+			}
 		}
+	}
+}
 
-		logStore.LogAndStore("info", "Event received from %s: %s", sourceID, msg.EventType)
+// recordEvent appends an event from the simulation with registry key sourceID to the
+// event log, if one is set
+// Best effort: a failed write is logged and the event is still processed.
+func recordEvent(eventLog *store.EventLog, logStore *logging.LogStore, sourceID string, msg models.Message) {
+	if eventLog == nil {
+		return
+	}
 
-		// Process event through scenario manager to get matching actions
-		actions := scenarioManager.ProcessEvent(event)
+	tenant, simID := registry.SplitKey(sourceID)
+	entry := store.EventLogEntry{
+		Kind:      store.EventLogKindEvent,
+		Tenant:    tenant,
+		Source:    simID,
+		EventType: msg.EventType,
+		Payload:   msg.Payload,
+		Timestamp: time.Now(),
+	}
+	if err := eventLog.Append(entry); err != nil {
+		logStore.LogAndStoreCtx("warning", "", sourceID, "Failed to record event %s from %s: %v", msg.EventType, sourceID, err)
+	}
+}
 
-		if len(actions) == 0 {
-			logStore.LogAndStore("info", "No matching rules for event: %s", msg.EventType)
-			return
-		}
+// replyStepRejected sends a step_rejected error to a simulation if it is still connected
+func replyStepRejected(reg *registry.Registry, simID string, msg models.Message, err error) {
+	if sim, exists := reg.Get(simID); exists {
+		sendStepRejected(sim, msg, err)
+	}
+}
 
-		// Create a Saga from the actions
-		// The Saga ensures eventual consistency: either all steps complete or all are rolled back
-		saga, err := sagaManager.CreateSaga(actions)
-		if err != nil {
-			logStore.LogAndStore("error", "Failed to create Saga: %v", err)
-			return
+// replySagaTerminal tells a simulation that the Saga it reported on has already finished
+func replySagaTerminal(reg *registry.Registry, simID string, terminal *saga.TerminalSagaError) {
+	if sim, exists := reg.Get(simID); exists {
+		stepID := terminal.StepID
+		sim.Send(models.Message{
+			Type:   "saga.terminal",
+			Status: string(terminal.Status),
+			SagaID: terminal.SagaID,
+			StepID: &stepID,
+		}, 0)
+	}
+}
+
+// handleEvent matches an event against the scenario and creates a Saga from the resulting actions
+// It stops early once ctx is done. Returns an error if the event was abandoned or its
+// Saga could not be created; an event matching no rule is not an error.
+func handleEvent(
+	ctx context.Context,
+	sourceID string,
+	msg models.Message,
+	scenarioManager *scenario.ScenarioManager,
+	sagaManager *saga.SagaManager,
+	logStore *logging.LogStore,
+	unmatched *queue.UnmatchedEvents,
+) error {
+	// Create event (sourceID is the registry key; rules see the bare simulation ID)
+	tenant, simID := registry.SplitKey(sourceID)
+	event := models.Event{
+		Type:      msg.Type,
+		EventType: msg.EventType,
+		Source:    simID,
+		Tenant:    tenant,
+		EventID:   msg.EventID,
+		Payload:   msg.Payload,
+	}
+
+	logStore.LogAndStoreCtx("info", "", sourceID, "Event received from %s: %s", sourceID, msg.EventType)
+
+	// Abandoned (e.g. after a slow event log write): matching would consume join and
+	// cooldown state for a Saga that is never created
+	if err := ctx.Err(); err != nil {
+		logStore.LogAndStoreCtx("warning", "", sourceID, "Event %s from %s abandoned before matching: %v", msg.EventType, sourceID, err)
+		return err
+	}
+
+	// Process event through scenario manager to get matching actions
+	// A completed join rule extends the event with its correlated events' payloads
+	actions, event := scenarioManager.ProcessEvent(event)
+
+	if len(actions) == 0 {
+		logStore.LogAndStoreCtx("info", "", sourceID, "No matching rules for event: %s", msg.EventType)
+		if unmatched != nil {
+			unmatched.Add(queue.UnmatchedEvent{
+				Source:    simID,
+				Tenant:    tenant,
+				EventType: msg.EventType,
+				EventID:   msg.EventID,
+				Payload:   msg.Payload,
+				Timestamp: time.Now(),
+			})
 		}
+		return nil
+	}
 
-		logStore.LogAndStore("info", "Saga %s created from event %s with %d steps", saga.SagaID, msg.EventType, len(actions))
-		// Note: The first step is dispatched automatically by CreateSaga
-		// Subsequent steps will be dispatched when step.completed events are received
+	// Create a Saga from the actions
+	// The Saga ensures eventual consistency: either all steps complete or all are rolled back
+	saga, err := sagaManager.CreateSaga(ctx, actions, event)
+	if err != nil {
+		logStore.LogAndStoreCtx("error", "", sourceID, "Failed to create Saga: %v", err)
+		return err
 	}
+
+	logStore.LogAndStoreCtx("info", saga.SagaID, sourceID, "Saga %s created from event %s with %d steps", saga.SagaID, msg.EventType, len(actions))
+	// Note: The first step is dispatched automatically by CreateSaga
+	// Subsequent steps will be dispatched when step.completed events are received
+	return nil
 }
@@ -0,0 +1,189 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
+	"github.com/gorilla/websocket"
+)
+
+func TestLateCompletionAckTellsSimulation(t *testing.T) {
+	ts := newTestServer(t, Config{}, nil)
+	ts.process(Config{})
+	ts.sagaManager.SetLateCompletionPolicy(saga.LateCompletionAck)
+	conn := ts.register(t, "sim")
+
+	sg, err := ts.sagaManager.CreateSaga(context.Background(), []models.Action{{SendTo: "sim", Command: "work"}}, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	readNext(t, conn)
+
+	step := 0
+	report := models.Message{Type: "step.completed", SagaID: sg.SagaID, StepID: &step}
+	conn.WriteJSON(report)
+	deadline := time.Now().Add(2 * time.Second)
+	for sg.GetStatus() != saga.SagaStatusCompleted {
+		if time.Now().After(deadline) {
+			t.Fatalf("saga is %s, want Completed", sg.GetStatus())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The same report again, e.g. from a command dispatched twice
+	conn.WriteJSON(report)
+	msg := readNext(t, conn)
+	if msg.Type != "saga.terminal" || msg.SagaID != sg.SagaID || msg.StepID == nil || *msg.StepID != 0 || msg.Status != string(saga.SagaStatusCompleted) {
+		t.Fatalf("got %+v, want saga.terminal for %s step 0 with status completed", msg, sg.SagaID)
+	}
+}
+
+// A simulation reports its step and immediately sends an event whose Saga targets it
+// again. The event only succeeds if the report was applied first (releasing the
+// simulation's lock), so every Saga being created, in order, shows that step reports
+// and events from one simulation are processed in the order they were sent.
+func TestStepReportsAndEventsKeepOrder(t *testing.T) {
+	ts := newTestServer(t, Config{}, nil)
+	ts.process(Config{})
+	if err := ts.scenarioManager.LoadScenarioFromBytes([]byte(`
+scenario:
+  name: "loop"
+  rules:
+    - when:
+        event_type: "next"
+      then:
+        - send_to: "sim"
+          command: "work"
+          event_params: ["n"]
+`)); err != nil {
+		t.Fatal(err)
+	}
+	conn := ts.register(t, "sim")
+
+	const n = 50
+	conn.WriteJSON(models.Message{Type: "event", EventType: "next", Payload: map[string]interface{}{"n": 0}})
+	var sagaIDs []string
+	for i := 0; i < n; i++ {
+		msg := readNext(t, conn)
+		if msg.Type != "command" || msg.Params["n"] != float64(i) {
+			t.Fatalf("got %+v, want the command for event %d", msg, i)
+		}
+		sagaIDs = append(sagaIDs, msg.SagaID)
+
+		// Back to back, without waiting for the server
+		step := 0
+		conn.WriteJSON(models.Message{Type: "step.completed", SagaID: msg.SagaID, StepID: &step})
+		if i+1 < n {
+			conn.WriteJSON(models.Message{Type: "event", EventType: "next", Payload: map[string]interface{}{"n": i + 1}})
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for _, id := range sagaIDs {
+		sg, exists := ts.sagaManager.GetSaga(id)
+		if !exists {
+			t.Fatalf("saga %s not found", id)
+		}
+		for sg.GetStatus() != saga.SagaStatusCompleted {
+			if time.Now().After(deadline) {
+				t.Fatalf("saga %s is %s, want Completed", id, sg.GetStatus())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+// Events from one simulation start their Sagas in the order they were sent
+func TestEventsDispatchInOrder(t *testing.T) {
+	ts := newTestServer(t, Config{}, nil)
+	ts.process(Config{})
+
+	// Event n starts a Saga on target n, so the Sagas don't conflict
+	const n = 30
+	var yaml strings.Builder
+	yaml.WriteString("scenario:\n  name: \"fan\"\n  rules:\n")
+	targets := make([]*websocket.Conn, n)
+	for i := range targets {
+		target := fmt.Sprintf("target%d", i)
+		fmt.Fprintf(&yaml, "    - when:\n        event_type: \"next\"\n        conditions: [{key: \"n\", op: eq, value: %d}]\n      then: [{send_to: %q, command: \"work\"}]\n", i, target)
+		targets[i] = ts.register(t, target)
+	}
+	if err := ts.scenarioManager.LoadScenarioFromBytes([]byte(yaml.String())); err != nil {
+		t.Fatal(err)
+	}
+
+	// Held in the queue until all have arrived, so they are taken off it back to back
+	ts.eventQueue.Pause()
+	source := ts.register(t, "source")
+	for i := 0; i < n; i++ {
+		source.WriteJSON(models.Message{Type: "event", EventType: "next", Payload: map[string]interface{}{"n": i}})
+	}
+	ts.waitForQueued(t, n)
+	ts.eventQueue.Resume()
+
+	var previous time.Time
+	for i, conn := range targets {
+		msg := readNext(t, conn)
+		sg, exists := ts.sagaManager.GetSaga(msg.SagaID)
+		if !exists {
+			t.Fatalf("target %d got a command for unknown saga %s", i, msg.SagaID)
+		}
+		created := sg.Snapshot().CreatedAt
+		if i > 0 && !created.After(previous) {
+			t.Fatalf("saga for event %d created at %s, before the saga for event %d (%s)", i, created, i-1, previous)
+		}
+		previous = created
+	}
+}
+
+// An event sent twice with the same event_id starts one Saga, unless the first one
+// failed to start a Saga, in which case the retry is not a duplicate
+func TestDuplicateEventStartsOneSaga(t *testing.T) {
+	config := Config{Dedupe: queue.NewDeduper(time.Minute, 10)}
+	ts := newTestServer(t, config, nil)
+	ts.process(config)
+	if err := ts.scenarioManager.LoadScenarioFromBytes([]byte(`
+scenario:
+  name: "dedupe"
+  rules:
+    - when:
+        event_type: "go"
+      then:
+        - send_to: "target"
+          command: "work"
+`)); err != nil {
+		t.Fatal(err)
+	}
+	target := ts.register(t, "target")
+	source := ts.register(t, "source")
+
+	// The target is locked by another Saga, so the first attempt fails
+	blocking, err := ts.sagaManager.CreateSaga(context.Background(), []models.Action{{SendTo: "target", Command: "block"}}, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	readNext(t, target)
+	event := models.Message{Type: "event", EventType: "go", EventID: "e1"}
+	source.WriteJSON(event)
+	ts.waitForLog(t, "Failed to create Saga")
+
+	if err := ts.sagaManager.HandleStepCompletion(blocking.SagaID, 0, "target", nil); err != nil {
+		t.Fatal(err)
+	}
+	source.WriteJSON(event)
+	if msg := readNext(t, target); msg.Command != "work" {
+		t.Fatalf("target got %+v, want the command of the retried event", msg)
+	}
+	source.WriteJSON(event)
+	ts.waitForLog(t, "Duplicate event from source ignored")
+
+	if sagas := ts.sagaManager.GetAllSagas(); len(sagas) != 2 {
+		t.Fatalf("%d sagas, want the blocking one and one from the event", len(sagas))
+	}
+}
@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+/*
+Heartbeats
+
+A simulation process that dies without closing its connection (killed, host lost,
+network cut) leaves a TCP connection that can stay open for a long time. Until it is
+noticed, the registry lists the simulation as connected and Sagas keep dispatching to it.
+
+After registration the server pings every simulation each HeartbeatInterval. Every pong
+or other message from the simulation pushes the connection's read deadline
+HeartbeatTimeout into the future. If the deadline passes, the read fails, the
+connection is closed and unregistered as for any disconnect, and the simulation's
+in-flight Saga steps are failed so their Sagas compensate right away instead of
+waiting for their step timeouts.
+
+WebSocket clients answer pings automatically, so simulations need no changes.
+*/
+
+// Default heartbeat settings
+const (
+	DefaultHeartbeatInterval = 15 * time.Second
+	DefaultHeartbeatTimeout  = 45 * time.Second
+)
+
+// startHeartbeat starts pinging the connection and arms its read deadline
+// Returns a function that stops the pings; it must be called when the connection ends.
+// Does nothing if config.HeartbeatInterval is 0.
+func startHeartbeat(conn *websocket.Conn, config Config) (stop func()) {
+	if config.HeartbeatInterval <= 0 {
+		return func() {}
+	}
+
+	extendReadDeadline(conn, config)
+	conn.SetPongHandler(func(string) error {
+		extendReadDeadline(conn, config)
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(config.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// WriteControl may be called concurrently with the connection's other writers
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(config.HeartbeatInterval)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// extendReadDeadline gives the simulation another HeartbeatTimeout to show it is alive
+func extendReadDeadline(conn *websocket.Conn, config Config) {
+	if config.HeartbeatInterval > 0 {
+		conn.SetReadDeadline(time.Now().Add(config.HeartbeatTimeout))
+	}
+}
+
+// isHeartbeatTimeout reports whether a read failed because the read deadline passed
+func isHeartbeatTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
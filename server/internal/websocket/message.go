@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+// wireMessage mirrors models.Message but keeps the payload raw so a payload that
+// isn't a JSON object can be detected instead of failing the whole decode
+type wireMessage struct {
+	models.Message
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// Accepted spellings of the Saga context fields besides the canonical
+	// saga_id / step_id (see resolveStepFieldAliases)
+	SagaIDCamel *string `json:"sagaId,omitempty"`
+	StepIDCamel *int    `json:"stepId,omitempty"`
+	StepShort   *int    `json:"step,omitempty"`
+}
+
+// readMessage reads the next message from the connection and decodes it
+// Connection errors are returned as-is (the connection is unusable). Decode errors are
+// wrapped in *decodeError so callers can report them and keep reading.
+// payloadWrapped is true if a non-object payload was wrapped as {"value": <payload>}.
+// Messages larger than limit bytes fail with websocket.ErrReadLimit (0 = no limit).
+func readMessage(conn *websocket.Conn, limit int64) (msg models.Message, payloadWrapped bool, err error) {
+	data, err := readMessageData(conn, limit)
+	if err != nil {
+		return models.Message{}, false, err
+	}
+	return decodeMessage(data)
+}
+
+// decodeError indicates a message was received but could not be decoded
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("invalid message: %v", e.err)
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// decodeMessage decodes a raw WebSocket message
+// models.Message.Payload is a map, but clients may send an array or scalar payload.
+// Rather than rejecting the message, such payloads are wrapped under a "value" key.
+func decodeMessage(data []byte) (models.Message, bool, error) {
+	var wire wireMessage
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return models.Message{}, false, &decodeError{err: err}
+	}
+
+	msg := wire.Message
+	if isStepReport(msg.Type) {
+		if err := resolveStepFieldAliases(&msg, &wire); err != nil {
+			return models.Message{}, false, &decodeError{err: err}
+		}
+	}
+
+	raw := bytes.TrimSpace(wire.Payload)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return msg, false, nil
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(raw, &payload); err == nil {
+		msg.Payload = payload
+		return msg, false, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return models.Message{}, false, &decodeError{err: err}
+	}
+	msg.Payload = map[string]interface{}{"value": value}
+	return msg, true, nil
+}
+
+// isStepReport reports whether a message type reports on a Saga step
+func isStepReport(messageType string) bool {
+	switch messageType {
+	case "step.completed", "step.failed", "step.compensated", "step.compensation_failed":
+		return true
+	}
+	return false
+}
+
+// resolveStepFieldAliases fills in a step report's saga_id and step_id from the
+// alternative spellings clients use: sagaId for saga_id, and stepId or step for step_id
+// Several spellings may be sent together as long as they agree; conflicting values
+// make the message ambiguous and it is rejected.
+func resolveStepFieldAliases(msg *models.Message, wire *wireMessage) error {
+	if wire.SagaIDCamel != nil {
+		if msg.SagaID != "" && msg.SagaID != *wire.SagaIDCamel {
+			return fmt.Errorf("ambiguous saga id: saga_id %q and sagaId %q differ", msg.SagaID, *wire.SagaIDCamel)
+		}
+		msg.SagaID = *wire.SagaIDCamel
+	}
+
+	aliases := []struct {
+		name  string
+		value *int
+	}{
+		{"stepId", wire.StepIDCamel},
+		{"step", wire.StepShort},
+	}
+	name := "step_id"
+	for _, alias := range aliases {
+		if alias.value == nil {
+			continue
+		}
+		if msg.StepID != nil && *msg.StepID != *alias.value {
+			return fmt.Errorf("ambiguous step id: %s %d and %s %d differ", name, *msg.StepID, alias.name, *alias.value)
+		}
+		if msg.StepID == nil {
+			msg.StepID = alias.value
+			name = alias.name
+		}
+	}
+	return nil
+}
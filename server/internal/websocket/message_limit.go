@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"io"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+/*
+Message Size Limit
+
+Every message is read into memory whole before it is decoded, so without a limit a
+buggy or hostile client could exhaust the server's memory with one huge message.
+
+Each connection, simulation or dashboard, accepts messages of at most MaxMessageSize
+bytes. When a larger one arrives, the connection sends a close frame with status 1009
+(message too big) and the read fails with websocket.ErrReadLimit. The server logs the
+protocol violation and ends the connection; a simulation is then unregistered as for
+any other disconnect. No "error" message is sent first: nothing may follow a close
+frame, so the 1009 close status is how the client learns why it was disconnected.
+
+The limit applies to a message's decompressed size as well (see compression.go).
+*/
+
+// DefaultMaxMessageSize is the default message size limit in bytes (1 MiB)
+const DefaultMaxMessageSize = 1 << 20
+
+// setReadLimit applies config.MaxMessageSize to the connection
+// Does nothing if config.MaxMessageSize is 0.
+func setReadLimit(conn *websocket.Conn, config Config) {
+	if config.MaxMessageSize > 0 {
+		conn.SetReadLimit(config.MaxMessageSize)
+	}
+}
+
+// readMessageData reads the next message from the connection, at most limit bytes once
+// decompressed (0 = no limit)
+// The connection's own read limit only counts bytes on the wire; a compressed message
+// that inflates beyond limit is refused the same way, with close status 1009 and
+// websocket.ErrReadLimit.
+func readMessageData(conn *websocket.Conn, limit int64) ([]byte, error) {
+	_, r, err := conn.NextReader()
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		closeMessage := websocket.FormatCloseMessage(websocket.CloseMessageTooBig, "")
+		conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+		return nil, websocket.ErrReadLimit
+	}
+	return data, nil
+}
@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+// expectClose reads from conn until the server closes it, and checks the close code
+func expectClose(t *testing.T, conn *websocket.Conn, code int) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("read failed with %v, want close code %d", err, code)
+		}
+		if closeErr.Code != code {
+			t.Fatalf("close code = %d, want %d", closeErr.Code, code)
+		}
+		return
+	}
+}
+
+// eventOfSize returns an event message exactly size bytes long
+func eventOfSize(t *testing.T, size int) []byte {
+	t.Helper()
+	msg := models.Message{Type: "event", EventType: "big", Payload: map[string]interface{}{"pad": ""}}
+	data, _ := json.Marshal(msg)
+	if len(data) > size {
+		t.Fatalf("smallest event is %d bytes, want %d", len(data), size)
+	}
+	msg.Payload["pad"] = strings.Repeat("x", size-len(data))
+	data, _ = json.Marshal(msg)
+	if len(data) != size {
+		t.Fatalf("event is %d bytes, want %d", len(data), size)
+	}
+	return data
+}
+
+func TestOversizedRegistrationClosesConnection(t *testing.T) {
+	ts := newTestServer(t, Config{MaxMessageSize: 256}, nil)
+	conn := ts.dial(t)
+
+	conn.WriteJSON(models.Message{Type: "register", ID: "sim", Name: strings.Repeat("x", 512)})
+	expectClose(t, conn, websocket.CloseMessageTooBig)
+
+	if _, exists := ts.reg.Get("sim"); exists {
+		t.Fatal("sim registered by an oversized registration")
+	}
+}
+
+func TestOversizedMessageClosesConnection(t *testing.T) {
+	const limit = 512
+	ts := newTestServer(t, Config{MaxMessageSize: limit}, nil)
+	conn := ts.register(t, "sim")
+
+	// A message of exactly the limit is accepted
+	if err := conn.WriteMessage(websocket.TextMessage, eventOfSize(t, limit)); err != nil {
+		t.Fatal(err)
+	}
+	ts.waitForQueued(t, 1)
+
+	// One byte more closes the connection with 1009 (message too big)
+	if err := conn.WriteMessage(websocket.TextMessage, eventOfSize(t, limit+1)); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, conn, websocket.CloseMessageTooBig)
+
+	ts.waitForLog(t, "Simulation disconnected: sim")
+	if _, exists := ts.reg.Get("sim"); exists {
+		t.Fatal("sim still registered after an oversized message")
+	}
+	if n := ts.eventQueue.GetQueueLength(); n != 1 {
+		t.Fatalf("%d events queued, want only the one within the limit", n)
+	}
+}
+
+func TestCompressedMessageLimitedWhenInflated(t *testing.T) {
+	const limit = 512
+	ts := newTestServer(t, Config{MaxMessageSize: limit, Compression: true}, nil)
+
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = true
+	conn, _, err := dialer.Dial(ts.url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(models.Message{Type: "register", ID: "sim", Name: "sim"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readNext(t, conn); msg.Type != "registered" {
+		t.Fatalf("got %q, want registered", msg.Type)
+	}
+
+	// Compresses to far less than the limit on the wire
+	conn.EnableWriteCompression(true)
+	if err := conn.WriteMessage(websocket.TextMessage, eventOfSize(t, 4*limit)); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, conn, websocket.CloseMessageTooBig)
+}
@@ -0,0 +1,125 @@
+package websocket
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+func TestDecodeMessagePayload(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantPayload map[string]interface{}
+		wantWrapped bool
+	}{
+		{name: "object", data: `{"type":"event","payload":{"zone":"north","level":3}}`, wantPayload: map[string]interface{}{"zone": "north", "level": float64(3)}},
+		{name: "empty object", data: `{"type":"event","payload":{}}`, wantPayload: map[string]interface{}{}},
+		{name: "no payload", data: `{"type":"event"}`},
+		{name: "null", data: `{"type":"event","payload":null}`},
+		{name: "array", data: `{"type":"event","payload":[1,"two"]}`, wantPayload: map[string]interface{}{"value": []interface{}{float64(1), "two"}}, wantWrapped: true},
+		{name: "number", data: `{"type":"event","payload":42}`, wantPayload: map[string]interface{}{"value": float64(42)}, wantWrapped: true},
+		{name: "string", data: `{"type":"event","payload":"hot"}`, wantPayload: map[string]interface{}{"value": "hot"}, wantWrapped: true},
+		{name: "boolean", data: `{"type":"event","payload":false}`, wantPayload: map[string]interface{}{"value": false}, wantWrapped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, wrapped, err := decodeMessage([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("decodeMessage: %v", err)
+			}
+			if wrapped != tt.wantWrapped {
+				t.Fatalf("payloadWrapped = %v, want %v", wrapped, tt.wantWrapped)
+			}
+			if !reflect.DeepEqual(msg.Payload, tt.wantPayload) {
+				t.Fatalf("payload = %#v, want %#v", msg.Payload, tt.wantPayload)
+			}
+			if msg.Type != "event" {
+				t.Fatalf("type = %q, want event", msg.Type)
+			}
+		})
+	}
+}
+
+func TestDecodeMessageRejectsMalformedJSON(t *testing.T) {
+	for _, data := range []string{`{"type":"event"`, `not json`, `{"type":"event","payload":{"zone":}}`, `[1,2]`} {
+		_, _, err := decodeMessage([]byte(data))
+		var decodeErr *decodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("decodeMessage(%s): err = %v, want a *decodeError", data, err)
+		}
+	}
+}
+
+func TestNonObjectPayloadKeepsConnection(t *testing.T) {
+	ts := newTestServer(t, Config{}, nil)
+	conn := ts.register(t, "sim")
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"event","event_type":"reading","payload":[1,2]}`)); err != nil {
+		t.Fatal(err)
+	}
+	queued := ts.waitForQueued(t, 1)
+	if want := map[string]interface{}{"value": []interface{}{float64(1), float64(2)}}; !reflect.DeepEqual(queued[0].Message.Payload, want) {
+		t.Fatalf("queued payload = %#v, want %#v", queued[0].Message.Payload, want)
+	}
+	ts.waitForLog(t, "is not a JSON object, wrapped as")
+
+	// The connection is still usable
+	if err := conn.WriteJSON(models.Message{Type: "event", EventType: "reading", Payload: map[string]interface{}{"n": 3}}); err != nil {
+		t.Fatal(err)
+	}
+	ts.waitForQueued(t, 2)
+}
+
+func TestDecodeStepFieldAliases(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantSagaID string
+		wantStepID *int // nil = no step ID
+		wantErr    bool
+	}{
+		{name: "canonical", data: `{"type":"step.completed","saga_id":"s1","step_id":2}`, wantSagaID: "s1", wantStepID: intPtr(2)},
+		{name: "camel case", data: `{"type":"step.completed","sagaId":"s1","stepId":2}`, wantSagaID: "s1", wantStepID: intPtr(2)},
+		{name: "step", data: `{"type":"step.failed","saga_id":"s1","step":0}`, wantSagaID: "s1", wantStepID: intPtr(0)},
+		{name: "mixed", data: `{"type":"step.compensated","sagaId":"s1","step_id":1}`, wantSagaID: "s1", wantStepID: intPtr(1)},
+		{name: "compensation failed", data: `{"type":"step.compensation_failed","saga_id":"s1","stepId":3}`, wantSagaID: "s1", wantStepID: intPtr(3)},
+		{name: "agreeing duplicates", data: `{"type":"step.completed","saga_id":"s1","sagaId":"s1","step_id":1,"stepId":1,"step":1}`, wantSagaID: "s1", wantStepID: intPtr(1)},
+		{name: "no step ID", data: `{"type":"step.completed","saga_id":"s1"}`, wantSagaID: "s1"},
+		{name: "conflicting saga IDs", data: `{"type":"step.completed","saga_id":"s1","sagaId":"s2","step_id":1}`, wantErr: true},
+		{name: "conflicting step IDs", data: `{"type":"step.completed","saga_id":"s1","step_id":1,"stepId":2}`, wantErr: true},
+		{name: "conflicting aliases", data: `{"type":"step.completed","saga_id":"s1","stepId":1,"step":2}`, wantErr: true},
+		// Only step reports take the aliases
+		{name: "not a step report", data: `{"type":"event","sagaId":"s1","stepId":2}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, _, err := decodeMessage([]byte(tt.data))
+			if tt.wantErr {
+				var decodeErr *decodeError
+				if !errors.As(err, &decodeErr) {
+					t.Fatalf("err = %v, want a *decodeError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeMessage: %v", err)
+			}
+			if msg.SagaID != tt.wantSagaID {
+				t.Fatalf("saga ID = %q, want %q", msg.SagaID, tt.wantSagaID)
+			}
+			if (msg.StepID == nil) != (tt.wantStepID == nil) || (msg.StepID != nil && *msg.StepID != *tt.wantStepID) {
+				t.Fatalf("step ID = %v, want %v", msg.StepID, tt.wantStepID)
+			}
+		})
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
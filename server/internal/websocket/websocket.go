@@ -1,26 +1,129 @@
 package websocket
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/auth"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
 	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/session"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/store"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins for MVP
-		return true
-	},
+// newUpgrader creates the WebSocket upgrader for the given configuration
+func newUpgrader(config Config) *websocket.Upgrader {
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:  config.ReadBufferSize,
+		WriteBufferSize: config.WriteBufferSize,
+		// Offer permessage-deflate; clients that don't ask for it aren't compressed
+		EnableCompression: config.Compression,
+		CheckOrigin: func(r *http.Request) bool {
+			// Allow all origins for MVP
+			return true
+		},
+	}
+	if config.WriteBufferPool {
+		// Connections share write buffers between writes instead of each holding one
+		upgrader.WriteBufferPool = &sync.Pool{}
+	}
+	return upgrader
 }
 
 // EventHandler is a function type for handling events
-type EventHandler func(sourceID string, msg models.Message)
+// ctx is cancelled if the event queue abandons the event (see queue.ProcessorFunc).
+type EventHandler func(ctx context.Context, sourceID string, msg models.Message)
+
+// Config holds optional connection-level settings for the WebSocket handler
+type Config struct {
+	// RequireClientCert rejects connections that did not present a verified TLS
+	// client certificate (mTLS). When a certificate is present, the simulation ID
+	// is taken from the certificate's Common Name and the tenant from its first
+	// Organizational Unit instead of the register message.
+	RequireClientCert bool
+
+	// StrictMode reports orchestration inconsistencies (e.g. orphaned or malformed step
+	// reports) back to the simulation as error messages instead of only logging them
+	StrictMode bool
+
+	// ReadBufferSize and WriteBufferSize set the connection I/O buffer sizes in bytes
+	// (0 = gorilla/websocket's default of 4096). Messages larger than a buffer still
+	// work but are read and written in more pieces (see BenchmarkMessageRoundTrip).
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// WriteBufferPool shares write buffers between connections instead of each
+	// connection keeping its own, which saves memory with many mostly-idle simulations
+	WriteBufferPool bool
+
+	// MaxMessageSize is the largest message, in bytes, accepted from a client (0 = no
+	// limit); a larger one closes the connection (see setReadLimit)
+	MaxMessageSize int64
+
+	// Compression negotiates permessage-deflate with clients that support it and
+	// compresses what the server writes to them (see compression.go)
+	Compression bool
+
+	// HeartbeatInterval is how often registered simulations are pinged (0 = no
+	// heartbeats); a simulation silent for HeartbeatTimeout is considered dead
+	// (see heartbeat.go)
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration
+
+	// Tokens are the bearer tokens a connection must present before it is upgraded
+	// (nil or empty = no token required; see the auth package)
+	Tokens *auth.Tokens
+
+	// Dedupe recognizes retried events by their event_id, so they don't start another
+	// Saga (nil = no deduplication; see queue/dedupe.go)
+	Dedupe *queue.Deduper
+
+	// RateLimit limits the rate of events from each simulation; step reports are exempt
+	// (nil = no rate limiting; see queue/rate_limit.go)
+	RateLimit *queue.RateLimiter
+
+	// EventLog records every event taken off the event queue, duplicates included, for
+	// audit (nil = not recorded; see store/event_log.go)
+	EventLog *store.EventLog
+
+	// Unmatched keeps the most recent events that matched no rule, so scenario authors
+	// can see what simulations send (nil = not kept; see queue/unmatched.go)
+	Unmatched *queue.UnmatchedEvents
+}
+
+// certIdentity is the simulation identity carried by a verified TLS client certificate
+type certIdentity struct {
+	ID     string // Common Name
+	Tenant string // First Organizational Unit ("" = default tenant)
+}
+
+// clientCertIdentity returns the identity carried by the verified TLS client certificate
+// Returns false if the connection is not TLS or no certificate was verified
+func clientCertIdentity(r *http.Request) (certIdentity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return certIdentity{}, false
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	if leaf.Subject.CommonName == "" {
+		return certIdentity{}, false
+	}
+	identity := certIdentity{ID: leaf.Subject.CommonName}
+	if len(leaf.Subject.OrganizationalUnit) > 0 {
+		identity.Tenant = leaf.Subject.OrganizationalUnit[0]
+	}
+	return identity, true
+}
 
 // HandleWebSocket handles WebSocket connections
 func HandleWebSocket(
@@ -29,21 +132,55 @@ func HandleWebSocket(
 	sagaManager *saga.SagaManager,
 	eventQueue *queue.EventQueue,
 	logStore *logging.LogStore,
+	sessions *session.Manager,
 	eventHandler EventHandler,
+	config Config,
 ) http.HandlerFunc {
+	upgrader := newUpgrader(config)
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
+		// Authenticate via client certificate before upgrading (mTLS)
+		cert, hasCert := clientCertIdentity(r)
+		if config.RequireClientCert && !hasCert {
+			logStore.LogAndStore("error", "WebSocket connection rejected: no verified client certificate from %s", r.RemoteAddr)
+			http.Error(w, "Client certificate required", http.StatusUnauthorized)
+			return
+		}
+
+		// Authenticate via bearer token before upgrading
+		allowed, bearerProtocol := config.Tokens.AllowWebSocket(r)
+		if !allowed {
+			logStore.LogAndStore("error", "WebSocket connection rejected: missing or invalid token from %s", r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var responseHeader http.Header
+		if bearerProtocol {
+			responseHeader = http.Header{"Sec-Websocket-Protocol": {auth.BearerSubprotocol}}
+		}
+
+		conn, err := upgrader.Upgrade(w, r, responseHeader)
 		if err != nil {
 			logStore.LogAndStore("error", "WebSocket upgrade failed: %v", err)
 			return
 		}
 		defer conn.Close()
+		setReadLimit(conn, config)
+		enableCompression(conn, config)
 
 		logStore.LogAndStore("info", "New WebSocket connection established")
 
+		// Until the simulation is registered this goroutine is the connection's only
+		// writer; afterwards Sagas and broadcasts write to it too, so every write goes
+		// through sim.Send, which serializes them
+
 		// Wait for registration message
-		var msg models.Message
-		if err := conn.ReadJSON(&msg); err != nil {
+		msg, _, err := readMessage(conn, config.MaxMessageSize)
+		if errors.Is(err, websocket.ErrReadLimit) {
+			logStore.LogAndStore("warning", "Protocol violation: registration from %s exceeds the %d byte message limit, connection closed", r.RemoteAddr, config.MaxMessageSize)
+			return
+		}
+		if err != nil {
 			logStore.LogAndStore("error", "Failed to read registration: %v", err)
 			return
 		}
@@ -55,100 +192,325 @@ func HandleWebSocket(
 
 		// Register simulation
 		simID := msg.ID
+		if hasCert {
+			// The certificate is authoritative; the register message may omit the ID
+			// but must not claim a different one
+			if simID != "" && simID != cert.ID {
+				logStore.LogAndStore("error", "Registration ID %s does not match client certificate identity %s", simID, cert.ID)
+				conn.WriteJSON(models.Message{
+					Type:   "error",
+					Status: "unauthorized",
+				})
+				return
+			}
+			simID = cert.ID
+		}
 		if simID == "" {
 			logStore.LogAndStore("error", "Registration missing ID")
 			return
 		}
 
-		reg.Register(simID, msg.Name, conn)
-		logStore.LogAndStore("info", "Simulation registered: %s (%s)", simID, msg.Name)
+		// The tenant scopes the simulation: its events only match scenarios for that
+		// tenant, and its Sagas, conflicts and locks never cross tenant boundaries
+		tenant := msg.Tenant
+		if hasCert {
+			// Likewise the certificate's tenant: a simulation may only register under
+			// the tenant it was issued for
+			if tenant != "" && tenant != cert.Tenant {
+				logStore.LogAndStore("error", "Registration tenant %q from %s does not match client certificate tenant %q", tenant, simID, cert.Tenant)
+				conn.WriteJSON(models.Message{
+					Type:   "error",
+					Status: "unauthorized",
+				})
+				return
+			}
+			tenant = cert.Tenant
+		}
+		if strings.Contains(tenant, "/") {
+			logStore.LogAndStore("error", "Registration from %s has invalid tenant %q", simID, tenant)
+			conn.WriteJSON(models.Message{
+				Type:   "error",
+				Status: "invalid_tenant",
+			})
+			return
+		}
+		simKey := registry.Key(tenant, simID)
+
+		expectedLatency := time.Duration(msg.ExpectedLatencyMs) * time.Millisecond
+		sim := reg.Register(&models.Simulation{
+			ID:              simID,
+			Name:            msg.Name,
+			Tenant:          tenant,
+			Connection:      conn,
+			ExpectedLatency: expectedLatency,
+			Capabilities:    msg.Capabilities,
+			AcksCommands:    msg.AcksCommands,
+
+			DefaultCompensateCommand: msg.DefaultCompensateCommand,
+		})
+		if expectedLatency > 0 {
+			logStore.LogAndStoreCtx("info", "", simKey, "Simulation registered: %s (%s, expected latency %s)", simKey, msg.Name, expectedLatency)
+		} else {
+			logStore.LogAndStoreCtx("info", "", simKey, "Simulation registered: %s (%s)", simKey, msg.Name)
+		}
+
+		// Resume the previous session if the simulation presented a valid reconnect
+		// token, then issue a fresh token for this connection
+		resumed := false
+		if msg.ReconnectToken != "" {
+			resumed = sessions.Resume(msg.ReconnectToken, simKey)
+			if !resumed {
+				logStore.LogAndStoreCtx("warning", "", simKey, "Reconnect token from %s is invalid or expired, starting a new session", simKey)
+			}
+		}
+		token, err := sessions.Issue(simKey)
+		if err != nil {
+			logStore.LogAndStoreCtx("error", "", simKey, "Failed to issue reconnect token for %s: %v", simKey, err)
+		}
 
 		// Send registration confirmation
 		response := models.Message{
-			Type:   "registered",
-			Status: "ok",
+			Type:           "registered",
+			Status:         "ok",
+			Tenant:         tenant,
+			ReconnectToken: token,
+			Resumed:        resumed,
 		}
-		if err := conn.WriteJSON(response); err != nil {
-			logStore.LogAndStore("error", "Failed to send registration confirmation: %v", err)
+		if err := sim.Send(response, 0); err != nil {
+			logStore.LogAndStoreCtx("error", "", simKey, "Failed to send registration confirmation: %v", err)
 			return
 		}
 
+		// Re-attach the simulation to the steps still waiting on it, which its previous
+		// connection may have lost (with or without a reconnect token: a simulation that
+		// registers again before its steps are failed gets them re-sent either way)
+		resent := sagaManager.ResendInFlight(simKey)
+		if resumed {
+			logStore.LogAndStoreCtx("info", "", simKey, "Simulation %s resumed its session (%d in-flight commands re-sent)", simKey, resent)
+		} else if resent > 0 {
+			logStore.LogAndStoreCtx("info", "", simKey, "Simulation %s registered again, %d in-flight commands re-sent", simKey, resent)
+		}
+
+		// Detect simulations that die without closing the connection
+		stopHeartbeat := startHeartbeat(conn, config)
+		defer stopHeartbeat()
+		heartbeatLost := false
+
 		// Handle messages
 		for {
-			var msg models.Message
-			if err := conn.ReadJSON(&msg); err != nil {
-				logStore.LogAndStore("error", "Error reading message from %s: %v", simID, err)
+			msg, payloadWrapped, err := readMessage(conn, config.MaxMessageSize)
+			if err == nil || errors.As(err, new(*decodeError)) {
+				// Any message shows the simulation is alive
+				extendReadDeadline(conn, config)
+				reg.Touch(simKey)
+			}
+			if err != nil {
+				var decodeErr *decodeError
+				if errors.As(err, &decodeErr) {
+					// A malformed message shouldn't cost the simulation its connection
+					logStore.LogAndStoreCtx("warning", "", simKey, "Ignoring malformed message from %s: %v", simKey, err)
+					sim.Send(models.Message{
+						Type:   "error",
+						Status: "invalid_message",
+					}, 0)
+					continue
+				}
+				if errors.Is(err, websocket.ErrReadLimit) {
+					// The connection has already sent close code 1009 (see message_limit.go)
+					logStore.LogAndStoreCtx("warning", "", simKey, "Protocol violation: message from %s exceeds the %d byte message limit, closing connection", simKey, config.MaxMessageSize)
+					break
+				}
+				if isHeartbeatTimeout(err) {
+					heartbeatLost = true
+					logStore.LogAndStoreCtx("warning", "", simKey, "Simulation %s missed heartbeats for %s, closing connection", simKey, config.HeartbeatTimeout)
+					break
+				}
+				logStore.LogAndStoreCtx("error", "", simKey, "Error reading message from %s: %v", simKey, err)
 				break
 			}
+			if payloadWrapped {
+				logStore.LogAndStoreCtx("warning", "", simKey, "Payload from %s (%s) is not a JSON object, wrapped as {\"value\": ...}", simKey, msg.EventType)
+			}
 
 			// Handle different message types
+			// A message may repeat its tenant but can't address another one
+			if msg.Tenant != "" && msg.Tenant != tenant {
+				logStore.LogAndStoreCtx("warning", "", simKey, "Rejecting %s from %s: tenant %q does not match connection tenant %q", msg.Type, simKey, msg.Tenant, tenant)
+				sim.Send(models.Message{
+					Type:   "error",
+					Status: "tenant_mismatch",
+				}, 0)
+				continue
+			}
+
 			switch msg.Type {
-			case "event":
-				// Enqueue event for sequential processing to prevent race conditions
-				if !eventQueue.Enqueue(simID, msg) {
-					logStore.LogAndStore("error", "Failed to enqueue event from %s: %s", simID, msg.EventType)
+			case "event", "step.completed", "step.failed", "step.compensated", "step.compensation_failed":
+				// Events and step reports share the queue so they are applied in arrival
+				// order (see the ordering model in event_handler.go). A full queue blocks
+				// this read loop for up to the enqueue timeout before an event is dropped.
+				// Step reports are never rate limited nor dropped for lack of room, so
+				// Sagas can always make progress.
+				if msg.Type != "event" {
+					if !eventQueue.EnqueueAlways(simKey, msg) {
+						logStore.LogAndStoreCtx("error", msg.SagaID, simKey, "Failed to enqueue %s from %s: event queue is closed", msg.Type, simKey)
+					}
+					continue
+				}
+				if config.RateLimit != nil && !config.RateLimit.Allow(simKey) {
+					logStore.LogAndStoreCtx("warning", "", simKey, "Rate limit exceeded by %s, dropping event %s", simKey, msg.EventType)
+					sim.Send(models.Message{
+						Type:      "error",
+						Status:    "rate_limited",
+						EventType: msg.EventType,
+					}, 0)
+					continue
+				}
+				if !eventQueue.EnqueueWait(r.Context(), simKey, msg) {
+					logStore.LogAndStoreCtx("error", "", simKey, "Failed to enqueue event from %s: %s", simKey, msg.EventType)
 					// Optionally send error response to simulation
 					errorResponse := models.Message{
-						Type:   "error",
-						Status: "queue_full",
+						Type:      "error",
+						Status:    "queue_full",
+						EventType: msg.EventType,
 					}
-					conn.WriteJSON(errorResponse)
+					sim.Send(errorResponse, 0)
 				}
-			case "step.completed":
-				// Step completion events don't need queuing - they're part of existing sagas
-				handleStepCompleted(simID, msg, sagaManager, logStore)
-			case "step.failed":
-				// Step failure events don't need queuing - they're part of existing sagas
-				handleStepFailed(simID, msg, sagaManager, logStore)
+			case "command.received":
+				// Acknowledgments only stop a timer, so they skip the queue: waiting
+				// behind queued events could make them late (see saga/ack.go)
+				handleCommandReceived(simKey, msg, sagaManager, logStore)
 			default:
-				logStore.LogAndStore("warning", "Unknown message type: %s", msg.Type)
+				logStore.LogAndStoreCtx("warning", "", simKey, "Unknown message type: %s", msg.Type)
 			}
 		}
 
-		// Cleanup on disconnect
-		reg.Unregister(simID)
-		logStore.LogAndStore("info", "Simulation disconnected: %s", simID)
+		// Cleanup on disconnect; messages already queued from the simulation are still processed
+		// If the simulation has already registered again, simKey belongs to the new
+		// connection: its registration, queue, rate limit and in-flight steps are left alone
+		if !reg.UnregisterIf(simKey, sim) {
+			logStore.LogAndStoreCtx("info", "", simKey, "Replaced connection of %s closed", simKey)
+			return
+		}
+		sessions.Detach(token)
+		eventQueue.RemoveSource(simKey)
+		if config.RateLimit != nil {
+			config.RateLimit.Remove(simKey)
+		}
+		logStore.LogAndStoreCtx("info", "", simKey, "Simulation disconnected: %s", simKey)
+
+		// A dead simulation won't report on its in-flight steps; fail them now (after
+		// unregistering, so compensation doesn't try to reach it). One that merely
+		// disconnected may still resume its session, so it gets the resume window first.
+		if heartbeatLost {
+			if failed := sagaManager.FailInFlight(simKey, "simulation stopped responding to heartbeats"); failed > 0 {
+				logStore.LogAndStoreCtx("warning", "", simKey, "Failed %d in-flight Saga steps on unresponsive simulation %s", failed, simKey)
+			}
+		} else {
+			var grace time.Duration
+			if token != "" {
+				grace = sessions.TTL()
+			}
+			sagaManager.HandleSimulationDisconnect(simKey, grace)
+		}
+	}
+}
+
+// sendStepRejected tells a simulation that its step report was not accepted (strict mode)
+func sendStepRejected(sim *models.Simulation, msg models.Message, err error) {
+	sim.Send(models.Message{
+		Type:   "error",
+		Status: "step_rejected",
+		SagaID: msg.SagaID,
+		StepID: msg.StepID,
+		Params: map[string]interface{}{
+			"reason": err.Error(),
+		},
+	}, 0)
+}
+
+// handleCommandReceived processes command.received acknowledgments from simulations
+func handleCommandReceived(simID string, msg models.Message, sagaManager *saga.SagaManager, logStore *logging.LogStore) {
+	if msg.SagaID == "" || msg.StepID == nil {
+		logStore.LogAndStoreCtx("error", msg.SagaID, simID, "command.received from %s missing saga_id or step_id", simID)
+		return
+	}
+
+	if err := sagaManager.HandleCommandReceived(msg.SagaID, *msg.StepID, simID); err != nil {
+		logStore.LogAndStoreCtx("warning", msg.SagaID, simID, "Ignoring command acknowledgment from %s: %v", simID, err)
 	}
 }
 
 // handleStepCompleted processes step.completed events from simulations
 // This advances the Saga to the next step or marks it as completed
-func handleStepCompleted(simID string, msg models.Message, sagaManager *saga.SagaManager, logStore *logging.LogStore) {
+func handleStepCompleted(simID string, msg models.Message, sagaManager *saga.SagaManager, logStore *logging.LogStore) error {
 	if msg.SagaID == "" {
-		logStore.LogAndStore("error", "step.completed event missing saga_id from %s", simID)
-		return
+		logStore.LogAndStoreCtx("error", "", simID, "step.completed event missing saga_id from %s", simID)
+		return fmt.Errorf("step.completed missing saga_id")
 	}
 
 	if msg.StepID == nil {
-		logStore.LogAndStore("error", "step.completed event missing step_id from %s", simID)
-		return
+		logStore.LogAndStoreCtx("error", msg.SagaID, simID, "step.completed event missing step_id from %s", simID)
+		return fmt.Errorf("step.completed missing step_id")
 	}
 
 	stepID := *msg.StepID
-	logStore.LogAndStore("info", "Step completion received from %s: Saga %s, Step %d", simID, msg.SagaID, stepID)
+	logStore.LogAndStoreCtx("info", msg.SagaID, simID, "Step completion received from %s: Saga %s, Step %d", simID, msg.SagaID, stepID)
 
-	if err := sagaManager.HandleStepCompletion(msg.SagaID, stepID); err != nil {
-		logStore.LogAndStore("error", "Failed to handle step completion: %v", err)
+	if err := sagaManager.HandleStepCompletion(msg.SagaID, stepID, simID, msg.Payload); err != nil {
+		logStore.LogAndStoreCtx("error", msg.SagaID, simID, "Failed to handle step completion: %v", err)
+		return err
 	}
+	return nil
+}
+
+// handleStepCompensationReport processes step.compensated and step.compensation_failed
+// events, which resolve a pending compensation so the next one can run
+func handleStepCompensationReport(simID string, msg models.Message, sagaManager *saga.SagaManager, logStore *logging.LogStore) error {
+	if msg.SagaID == "" {
+		logStore.LogAndStoreCtx("error", "", simID, "%s event missing saga_id from %s", msg.Type, simID)
+		return fmt.Errorf("%s missing saga_id", msg.Type)
+	}
+
+	if msg.StepID == nil {
+		logStore.LogAndStoreCtx("error", msg.SagaID, simID, "%s event missing step_id from %s", msg.Type, simID)
+		return fmt.Errorf("%s missing step_id", msg.Type)
+	}
+
+	stepID := *msg.StepID
+	var err error
+	if msg.Type == "step.compensated" {
+		logStore.LogAndStoreCtx("info", msg.SagaID, simID, "Compensation acknowledged by %s: Saga %s, Step %d", simID, msg.SagaID, stepID)
+		err = sagaManager.HandleStepCompensated(msg.SagaID, stepID, simID)
+	} else {
+		logStore.LogAndStoreCtx("warning", msg.SagaID, simID, "Compensation failure reported by %s: Saga %s, Step %d", simID, msg.SagaID, stepID)
+		err = sagaManager.HandleCompensationFailure(msg.SagaID, stepID, simID)
+	}
+	if err != nil {
+		logStore.LogAndStoreCtx("error", msg.SagaID, simID, "Failed to handle %s: %v", msg.Type, err)
+		return err
+	}
+	return nil
 }
 
 // handleStepFailed processes step.failed events from simulations
 // This triggers compensation for all previously completed steps
-func handleStepFailed(simID string, msg models.Message, sagaManager *saga.SagaManager, logStore *logging.LogStore) {
+func handleStepFailed(simID string, msg models.Message, sagaManager *saga.SagaManager, logStore *logging.LogStore) error {
 	if msg.SagaID == "" {
-		logStore.LogAndStore("error", "step.failed event missing saga_id from %s", simID)
-		return
+		logStore.LogAndStoreCtx("error", "", simID, "step.failed event missing saga_id from %s", simID)
+		return fmt.Errorf("step.failed missing saga_id")
 	}
 
 	if msg.StepID == nil {
-		logStore.LogAndStore("error", "step.failed event missing step_id from %s", simID)
-		return
+		logStore.LogAndStoreCtx("error", msg.SagaID, simID, "step.failed event missing step_id from %s", simID)
+		return fmt.Errorf("step.failed missing step_id")
 	}
 
 	stepID := *msg.StepID
-	logStore.LogAndStore("info", "Step failure received from %s: Saga %s, Step %d", simID, msg.SagaID, stepID)
+	logStore.LogAndStoreCtx("info", msg.SagaID, simID, "Step failure received from %s: Saga %s, Step %d", simID, msg.SagaID, stepID)
 
-	if err := sagaManager.HandleStepFailure(msg.SagaID, stepID); err != nil {
-		logStore.LogAndStore("error", "Failed to handle step failure: %v", err)
+	if err := sagaManager.HandleStepFailure(msg.SagaID, stepID, simID); err != nil {
+		logStore.LogAndStoreCtx("error", msg.SagaID, simID, "Failed to handle step failure: %v", err)
+		return err
 	}
+	return nil
 }
@@ -0,0 +1,499 @@
+package websocket
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/auth"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/logging"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/models"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/queue"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/registry"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/saga"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/scenario"
+	"github.com/aidenletourneau/simulation_orchestration_server/server/internal/session"
+	"github.com/gorilla/websocket"
+)
+
+// testServer serves HandleWebSocket with its components exposed to the test
+type testServer struct {
+	url             string
+	reg             *registry.Registry
+	scenarioManager *scenario.ScenarioManager
+	sagaManager     *saga.SagaManager
+	eventQueue      *queue.EventQueue
+	logStore        *logging.LogStore
+	sessions        *session.Manager
+}
+
+// newTestServer starts a WebSocket server; events taken off its queue are passed to
+// eventHandler (nil = the queue isn't processed)
+func newTestServer(t *testing.T, config Config, eventHandler EventHandler) *testServer {
+	t.Helper()
+
+	reg := registry.NewRegistry()
+	ts := &testServer{
+		reg:             reg,
+		scenarioManager: scenario.NewScenarioManager(),
+		sagaManager:     saga.NewSagaManager(reg),
+		eventQueue:      queue.NewEventQueue(100),
+		logStore:        logging.NewLogStore(1000),
+		sessions:        session.NewManager(time.Minute),
+	}
+	ts.scenarioManager.SetRegistry(reg)
+	if eventHandler != nil {
+		ts.eventQueue.StartProcessor(queue.ProcessorFunc(eventHandler), 1)
+	}
+	t.Cleanup(ts.eventQueue.Close)
+
+	srv := httptest.NewServer(HandleWebSocket(ts.reg, ts.scenarioManager, ts.sagaManager, ts.eventQueue, ts.logStore, ts.sessions, eventHandler, config))
+	t.Cleanup(srv.Close)
+	ts.url = "ws" + strings.TrimPrefix(srv.URL, "http")
+	return ts
+}
+
+// process starts processing the server's event queue with the real event handler
+func (ts *testServer) process(config Config) {
+	ts.eventQueue.StartProcessor(CreateEventHandler(ts.scenarioManager, ts.sagaManager, ts.logStore, ts.reg, config), 1)
+}
+
+// dial opens a connection to the server without registering
+func (ts *testServer) dial(t *testing.T) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(ts.url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// register opens a connection and registers it as the simulation with the given ID
+func (ts *testServer) register(t *testing.T, id string) *websocket.Conn {
+	t.Helper()
+	conn := ts.dial(t)
+	if err := conn.WriteJSON(models.Message{Type: "register", ID: id, Name: id}); err != nil {
+		t.Fatalf("register %s: %v", id, err)
+	}
+	if msg := readNext(t, conn); msg.Type != "registered" {
+		t.Fatalf("%s got %q, want registered", id, msg.Type)
+	}
+	return conn
+}
+
+// readNext reads the next message the server sends on conn
+func readNext(t *testing.T, conn *websocket.Conn) models.Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var msg models.Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+// waitForLog waits until the server has logged a message containing any of texts
+func (ts *testServer) waitForLog(t *testing.T, texts ...string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		for _, entry := range ts.logStore.GetAll() {
+			for _, text := range texts {
+				if strings.Contains(entry.Message, text) {
+					return
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server never logged any of %q", texts)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReconnectKeepsNewConnection(t *testing.T) {
+	ts := newTestServer(t, Config{}, nil)
+
+	old := ts.register(t, "sim")
+	sg, err := ts.sagaManager.CreateSaga(context.Background(), []models.Action{{SendTo: "sim", Command: "work"}}, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	if msg := readNext(t, old); msg.Command != "work" {
+		t.Fatalf("old connection got %q, want the command", msg.Command)
+	}
+
+	// The simulation registers again before its old connection has gone away; the
+	// in-flight command is re-sent on the new connection
+	current := ts.register(t, "sim")
+	if msg := readNext(t, current); msg.Command != "work" || msg.SagaID != sg.SagaID || msg.StepID == nil || *msg.StepID != 0 {
+		t.Fatalf("new connection got %+v, want the re-sent command", msg)
+	}
+	sim, _ := ts.reg.Get("sim")
+
+	// The old connection closing must not touch the new registration
+	old.Close()
+	ts.waitForLog(t, "Replaced connection of sim closed", "Simulation disconnected: sim")
+
+	if got, exists := ts.reg.Get("sim"); !exists || got != sim {
+		t.Fatal("new connection was unregistered when the old one closed")
+	}
+	step := sg.Steps[0]
+	if status := sg.GetStatus(); status != saga.SagaStatusInProgress {
+		t.Fatalf("saga is %s, want InProgress", status)
+	}
+	if in := ts.sagaManager.GetInFlightStepsForSim("sim"); len(in) != 1 || in[0].StepID != step.StepID {
+		t.Fatalf("in-flight steps for sim = %+v, want step 0", in)
+	}
+
+	// ...and the live connection can still complete the step
+	if err := ts.sagaManager.HandleStepCompletion(sg.SagaID, 0, "sim", nil); err != nil {
+		t.Fatalf("HandleStepCompletion: %v", err)
+	}
+	if status := sg.GetStatus(); status != saga.SagaStatusCompleted {
+		t.Fatalf("saga is %s, want Completed", status)
+	}
+
+	// Closing the live connection still cleans up
+	current.Close()
+	ts.waitForLog(t, "Simulation disconnected: sim")
+	if _, exists := ts.reg.Get("sim"); exists {
+		t.Fatal("sim still registered after its connection closed")
+	}
+}
+
+// waitForQueued waits until n messages are waiting in the event queue and returns them
+func (ts *testServer) waitForQueued(t *testing.T, n int) []queue.QueuedEvent {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if queued := ts.eventQueue.Snapshot(); len(queued) >= n {
+			return queued
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d messages queued, want %d", ts.eventQueue.GetQueueLength(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRateLimitExemptsStepReports(t *testing.T) {
+	ts := newTestServer(t, Config{RateLimit: queue.NewRateLimiter(0.001, 1)}, nil)
+	conn := ts.register(t, "sim")
+
+	step := 0
+	conn.WriteJSON(models.Message{Type: "event", EventType: "first"})
+	conn.WriteJSON(models.Message{Type: "event", EventType: "limited"})
+	if msg := readNext(t, conn); msg.Type != "error" || msg.Status != "rate_limited" || msg.EventType != "limited" {
+		t.Fatalf("got %+v, want a rate_limited error for the second event", msg)
+	}
+
+	for _, report := range []string{"step.completed", "step.failed", "step.compensated", "step.compensation_failed"} {
+		conn.WriteJSON(models.Message{Type: report, SagaID: "saga_1", StepID: &step})
+	}
+
+	queued := ts.waitForQueued(t, 5)
+	want := []string{"first", "step.completed", "step.failed", "step.compensated", "step.compensation_failed"}
+	for i, q := range queued {
+		got := q.Message.EventType
+		if q.Message.Type != "event" {
+			got = q.Message.Type
+		}
+		if got != want[i] {
+			t.Fatalf("queued[%d] = %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+// A full queue drops events but still takes step reports, so the Saga advances
+func TestStepReportsNotDroppedWhenQueueFull(t *testing.T) {
+	ts := newTestServer(t, Config{}, nil)
+	ts.process(Config{})
+	ts.eventQueue.SetEnqueueTimeout(10 * time.Millisecond)
+	conn := ts.register(t, "sim")
+
+	sg, err := ts.sagaManager.CreateSaga(context.Background(), []models.Action{{SendTo: "sim", Command: "work"}}, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	readNext(t, conn)
+
+	// Fill the queue while nothing is taken off it
+	ts.eventQueue.Pause()
+	capacity := ts.eventQueue.GetQueueStats().Capacity
+	for i := 0; i < capacity; i++ {
+		conn.WriteJSON(models.Message{Type: "event", EventType: "filler"})
+	}
+	ts.waitForQueued(t, capacity)
+	conn.WriteJSON(models.Message{Type: "event", EventType: "overflow"})
+	if msg := readNext(t, conn); msg.Type != "error" || msg.Status != "queue_full" || msg.EventType != "overflow" {
+		t.Fatalf("got %+v, want a queue_full error for the overflowing event", msg)
+	}
+
+	step := 0
+	conn.WriteJSON(models.Message{Type: "step.completed", SagaID: sg.SagaID, StepID: &step})
+	ts.waitForQueued(t, capacity+1)
+	ts.eventQueue.Resume()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sg.GetStatus() != saga.SagaStatusCompleted {
+		if time.Now().After(deadline) {
+			t.Fatalf("saga is %s, want Completed", sg.GetStatus())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebSocketRequiresToken(t *testing.T) {
+	ts := newTestServer(t, Config{Tokens: auth.ParseTokens("secret")}, nil)
+
+	tests := []struct {
+		name      string
+		url       string
+		header    http.Header
+		wantOK    bool
+		wantProto string
+	}{
+		{name: "missing", url: ts.url},
+		{name: "invalid", url: ts.url + "?token=wrong"},
+		{name: "header", url: ts.url, header: http.Header{"Authorization": {"Bearer secret"}}, wantOK: true},
+		{name: "query", url: ts.url + "?token=secret", wantOK: true},
+		{name: "subprotocol", url: ts.url, header: http.Header{"Sec-WebSocket-Protocol": {"bearer, secret"}}, wantOK: true, wantProto: auth.BearerSubprotocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, resp, err := websocket.DefaultDialer.Dial(tt.url, tt.header)
+			if !tt.wantOK {
+				if err == nil {
+					conn.Close()
+					t.Fatal("connection upgraded without a valid token")
+				}
+				if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+					t.Fatalf("handshake failed with %v, want 401", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+			if conn.Subprotocol() != tt.wantProto {
+				t.Fatalf("subprotocol = %q, want %q", conn.Subprotocol(), tt.wantProto)
+			}
+		})
+	}
+}
+
+func TestResumeWithinGraceWindow(t *testing.T) {
+	ts := newTestServer(t, Config{}, nil)
+
+	registerWithToken := func(token string) (*websocket.Conn, models.Message) {
+		conn := ts.dial(t)
+		conn.WriteJSON(models.Message{Type: "register", ID: "sim", Name: "sim", ReconnectToken: token})
+		msg := readNext(t, conn)
+		if msg.Type != "registered" || msg.ReconnectToken == "" {
+			t.Fatalf("got %+v, want registered with a reconnect token", msg)
+		}
+		return conn, msg
+	}
+
+	first, registered := registerWithToken("")
+	sg, err := ts.sagaManager.CreateSaga(context.Background(), []models.Action{{SendTo: "sim", Command: "work"}}, models.Event{})
+	if err != nil {
+		t.Fatalf("CreateSaga: %v", err)
+	}
+	readNext(t, first)
+
+	// Disconnected: its step waits for the resume window instead of failing
+	first.Close()
+	ts.waitForLog(t, "Simulation disconnected: sim")
+	if status := sg.GetStatus(); status != saga.SagaStatusInProgress {
+		t.Fatalf("saga is %s after the disconnect, want InProgress", status)
+	}
+
+	resumed, msg := registerWithToken(registered.ReconnectToken)
+	if !msg.Resumed {
+		t.Fatal("session not resumed with a valid reconnect token")
+	}
+	if msg := readNext(t, resumed); msg.Command != "work" || msg.SagaID != sg.SagaID {
+		t.Fatalf("resumed connection got %+v, want the re-sent command", msg)
+	}
+	if err := ts.sagaManager.HandleStepCompletion(sg.SagaID, 0, "sim", nil); err != nil {
+		t.Fatal(err)
+	}
+	if status := sg.GetStatus(); status != saga.SagaStatusCompleted {
+		t.Fatalf("saga is %s, want Completed", status)
+	}
+}
+
+// newClientCert issues a client certificate for the given simulation ID and tenant,
+// signed by a fresh CA, and returns it with a pool holding the CA
+func newClientCert(t *testing.T, id, tenant string) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: id, OrganizationalUnit: []string{tenant}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestClientCertTenantIsAuthoritative(t *testing.T) {
+	ts := newTestServer(t, Config{RequireClientCert: true}, nil)
+	cert, pool := newClientCert(t, "sim", "tenant-a")
+
+	srv := httptest.NewUnstartedServer(HandleWebSocket(ts.reg, ts.scenarioManager, ts.sagaManager, ts.eventQueue, ts.logStore, ts.sessions, nil, Config{RequireClientCert: true}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	dialer := websocket.Dialer{TLSClientConfig: &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		InsecureSkipVerify: true,
+	}}
+	dial := func() *websocket.Conn {
+		conn, _, err := dialer.Dial("wss"+strings.TrimPrefix(srv.URL, "https"), nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	// A certificate issued for tenant A can't register under tenant B
+	conn := dial()
+	conn.WriteJSON(models.Message{Type: "register", ID: "sim", Name: "sim", Tenant: "tenant-b"})
+	if msg := readNext(t, conn); msg.Type != "error" || msg.Status != "unauthorized" {
+		t.Fatalf("got %+v, want an unauthorized error", msg)
+	}
+	if _, exists := ts.reg.Get(registry.Key("tenant-b", "sim")); exists {
+		t.Fatal("sim registered under tenant-b")
+	}
+
+	// Without a tenant in the register message, the certificate's tenant is used
+	conn = dial()
+	conn.WriteJSON(models.Message{Type: "register", Name: "sim"})
+	if msg := readNext(t, conn); msg.Type != "registered" || msg.Tenant != "tenant-a" {
+		t.Fatalf("got %+v, want registered under tenant-a", msg)
+	}
+	if _, exists := ts.reg.Get(registry.Key("tenant-a", "sim")); !exists {
+		t.Fatal("sim not registered under tenant-a")
+	}
+}
+
+// BenchmarkMessageRoundTrip echoes messages of typical sizes through a server using the
+// library's default buffers and one using tuned buffers with a shared write buffer pool
+func BenchmarkMessageRoundTrip(b *testing.B) {
+	configs := []struct {
+		name   string
+		config Config
+	}{
+		{name: "default", config: Config{}},
+		{name: "tuned", config: Config{ReadBufferSize: 16384, WriteBufferSize: 16384, WriteBufferPool: true}},
+	}
+	sizes := []struct {
+		name string
+		size int
+	}{
+		{name: "1KB", size: 1 << 10},
+		{name: "16KB", size: 16 << 10},
+		{name: "64KB", size: 64 << 10},
+	}
+
+	for _, cfg := range configs {
+		upgrader := newUpgrader(cfg.config)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for {
+				data, err := readMessageData(conn, 0)
+				if err != nil {
+					return
+				}
+				if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+					return
+				}
+			}
+		}))
+
+		for _, sz := range sizes {
+			b.Run(cfg.name+"/"+sz.name, func(b *testing.B) {
+				conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+				if err != nil {
+					b.Fatalf("dial: %v", err)
+				}
+				defer conn.Close()
+				msg := []byte(strings.Repeat("x", sz.size))
+
+				b.SetBytes(int64(sz.size))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+						b.Fatalf("write: %v", err)
+					}
+					_, r, err := conn.NextReader()
+					if err != nil {
+						b.Fatalf("read: %v", err)
+					}
+					if _, err := io.Copy(io.Discard, r); err != nil {
+						b.Fatalf("read: %v", err)
+					}
+				}
+			})
+		}
+		srv.Close()
+	}
+}